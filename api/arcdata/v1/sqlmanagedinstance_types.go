@@ -0,0 +1,147 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// SQLManagedInstanceStateReady state of a sql managed instance that accepts connections
+const SQLManagedInstanceStateReady = "Ready"
+
+// LoginRef reference to the secret holding the admin login of the sql managed instance
+type LoginRef struct {
+	Kind      string `json:"kind,omitempty"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// ResourceList cpu and memory of a container
+type ResourceList struct {
+	CPU    string `json:"cpu,omitempty"`
+	Memory string `json:"memory,omitempty"`
+}
+
+// Resources limits and requests of the sql managed instance containers
+type Resources struct {
+	Limits   ResourceList `json:"limits,omitempty"`
+	Requests ResourceList `json:"requests,omitempty"`
+}
+
+// SchedulingOptions scheduling of the sql managed instance pods
+type SchedulingOptions struct {
+	Resources Resources `json:"resources,omitempty"`
+}
+
+// Scheduling scheduling of the sql managed instance
+type Scheduling struct {
+	Default SchedulingOptions `json:"default,omitempty"`
+}
+
+// Service kubernetes service exposing the sql managed instance
+type Service struct {
+	Type string `json:"type,omitempty"`
+	Port int    `json:"port,omitempty"`
+}
+
+// Services services exposing the sql managed instance
+type Services struct {
+	Primary Service `json:"primary,omitempty"`
+}
+
+// Volume persistent volume claim template
+type Volume struct {
+	ClassName string `json:"className,omitempty"`
+	Size      string `json:"size,omitempty"`
+}
+
+// VolumeClaim volumes of a storage class of the sql managed instance
+type VolumeClaim struct {
+	Volumes []Volume `json:"volumes,omitempty"`
+}
+
+// Storage storage of the sql managed instance
+type Storage struct {
+	Backups  VolumeClaim `json:"backups,omitempty"`
+	Data     VolumeClaim `json:"data,omitempty"`
+	Datalogs VolumeClaim `json:"datalogs,omitempty"`
+	Logs     VolumeClaim `json:"logs,omitempty"`
+}
+
+// SQLManagedInstanceSpec desired state of the sql managed instance
+type SQLManagedInstanceSpec struct {
+	Dev         bool       `json:"dev,omitempty"`
+	LicenseType string     `json:"licenseType,omitempty"`
+	LoginRef    LoginRef   `json:"loginRef,omitempty"`
+	Replicas    int        `json:"replicas,omitempty"`
+	Scheduling  Scheduling `json:"scheduling,omitempty"`
+	Services    Services   `json:"services,omitempty"`
+	Storage     Storage    `json:"storage,omitempty"`
+	Tier        string     `json:"tier,omitempty"`
+}
+
+// SQLManagedInstanceStatus observed state of the sql managed instance
+type SQLManagedInstanceStatus struct {
+	AGStatus           string `json:"AGStatus,omitempty"`
+	LogSearchDashboard string `json:"logSearchDashboard,omitempty"`
+	MetricsDashboard   string `json:"metricsDashboard,omitempty"`
+	ObservedGeneration int64  `json:"observedGeneration,omitempty"`
+	PrimaryEndpoint    string `json:"primaryEndpoint,omitempty"`
+	ReadyReplicas      string `json:"readyReplicas,omitempty"`
+	SecondaryEndpoint  string `json:"secondaryEndpoint,omitempty"`
+	State              string `json:"state,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// SQLManagedInstance is an Azure Arc enabled sql managed instance
+type SQLManagedInstance struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SQLManagedInstanceSpec   `json:"spec,omitempty"`
+	Status SQLManagedInstanceStatus `json:"status,omitempty"`
+}
+
+// IsReady the sql managed instance is accepting connections
+func (in *SQLManagedInstance) IsReady() bool {
+	return in.Status.State == SQLManagedInstanceStateReady
+}
+
+// LoginSecret the secret holding the admin login, in the namespace of the sql managed instance unless the
+// loginRef names another
+func (in *SQLManagedInstance) LoginSecret() types.NamespacedName {
+	namespace := in.Spec.LoginRef.Namespace
+	if namespace == "" {
+		namespace = in.Namespace
+	}
+	return types.NamespacedName{Name: in.Spec.LoginRef.Name, Namespace: namespace}
+}
+
+//+kubebuilder:object:root=true
+
+// SQLManagedInstanceList contains a list of SQLManagedInstance
+type SQLManagedInstanceList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SQLManagedInstance `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&SQLManagedInstance{}, &SQLManagedInstanceList{})
+}
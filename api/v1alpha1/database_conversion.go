@@ -0,0 +1,215 @@
+package v1alpha1
+
+import (
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	"github.com/pplavetzki/azure-sql-mi/api/v1beta1"
+)
+
+// ConversionDataAnnotation holds the v1beta1 spec of a Database that v1alpha1 cannot represent, e.g. a
+// username and a password read from different secrets, so converting back to v1beta1 is lossless
+const ConversionDataAnnotation = "actions.msft.isd.coe.io/conversion-data"
+
+// Keys of the credentials secret used when the v1alpha1 spec leaves them empty
+const (
+	defaultUsernameKey = "username"
+	defaultPasswordKey = "password"
+)
+
+var _ conversion.Convertible = &Database{}
+
+// ConvertTo converts this Database to the Hub version (v1beta1)
+func (src *Database) ConvertTo(dstRaw conversion.Hub) error {
+	dst, ok := dstRaw.(*v1beta1.Database)
+	if !ok {
+		return fmt.Errorf("unexpected hub type %T", dstRaw)
+	}
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	dst.Spec = convertSpecTo(&src.Spec)
+	convertStatusTo(&src.Status, &dst.Status)
+
+	data, ok := dst.Annotations[ConversionDataAnnotation]
+	if !ok {
+		return nil
+	}
+	delete(dst.Annotations, ConversionDataAnnotation)
+	if len(dst.Annotations) == 0 {
+		dst.Annotations = nil
+	}
+	restored := v1beta1.DatabaseSpec{}
+	if err := json.Unmarshal([]byte(data), &restored); err != nil {
+		return fmt.Errorf("invalid %s annotation: %w", ConversionDataAnnotation, err)
+	}
+	// the restored spec is only kept when the Database was not changed through v1alpha1 since
+	if equality.Semantic.DeepEqual(convertSpecFrom(&restored), src.Spec) {
+		dst.Spec = restored
+	}
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1beta1) to this version
+func (dst *Database) ConvertFrom(srcRaw conversion.Hub) error {
+	src, ok := srcRaw.(*v1beta1.Database)
+	if !ok {
+		return fmt.Errorf("unexpected hub type %T", srcRaw)
+	}
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	dst.Spec = convertSpecFrom(&src.Spec)
+	convertStatusFrom(&src.Status, &dst.Status)
+
+	if equality.Semantic.DeepEqual(convertSpecTo(&dst.Spec), src.Spec) {
+		return nil
+	}
+	data, err := json.Marshal(src.Spec)
+	if err != nil {
+		return err
+	}
+	if dst.Annotations == nil {
+		dst.Annotations = map[string]string{}
+	}
+	dst.Annotations[ConversionDataAnnotation] = string(data)
+	return nil
+}
+
+func convertSpecTo(src *DatabaseSpec) v1beta1.DatabaseSpec {
+	dst := v1beta1.DatabaseSpec{
+		Name: src.Name,
+		Connection: v1beta1.ConnectionSpec{
+			SQLManagedInstance: src.SQLManagedInstance,
+			Server:             src.Server,
+			Port:               src.Port,
+		},
+		Options: v1beta1.DatabaseOptions{
+			Collation:                  src.Collation,
+			AllowSnapshotIsolation:     src.AllowSnapshotIsolation,
+			AllowReadCommittedSnapshot: src.AllowReadCommittedSnapshot,
+			Parameterization:           src.Parameterization,
+			CompatibilityLevel:         src.CompatibilityLevel,
+		},
+		Sync: v1beta1.SyncSpec{
+			Schedule:    src.Schedule,
+			DriftPolicy: v1beta1.DriftPolicy(src.DriftPolicy),
+		},
+		AdoptExisting:      src.AdoptExisting,
+		DeletionPolicy:     v1beta1.DeletionPolicy(src.DeletionPolicy),
+		BackupDirectory:    src.BackupDirectory,
+		DeletionProtection: src.DeletionProtection,
+	}
+	if src.SoftDeleteGracePeriod != nil {
+		period := *src.SoftDeleteGracePeriod
+		dst.SoftDeleteGracePeriod = &period
+	}
+	if src.Credentials.Name != "" {
+		usernameKey, passwordKey := src.Credentials.UsernameKey, src.Credentials.PasswordKey
+		if usernameKey == "" {
+			usernameKey = defaultUsernameKey
+		}
+		if passwordKey == "" {
+			passwordKey = defaultPasswordKey
+		}
+		dst.Connection.Credentials = &v1beta1.Credentials{
+			Username: corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: src.Credentials.Name}, Key: usernameKey},
+			Password: corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: src.Credentials.Name}, Key: passwordKey},
+		}
+	}
+	return dst
+}
+
+func convertSpecFrom(src *v1beta1.DatabaseSpec) DatabaseSpec {
+	dst := DatabaseSpec{
+		Name:                       src.Name,
+		SQLManagedInstance:         src.Connection.SQLManagedInstance,
+		Server:                     src.Connection.Server,
+		Port:                       src.Connection.Port,
+		Collation:                  src.Options.Collation,
+		AllowSnapshotIsolation:     src.Options.AllowSnapshotIsolation,
+		AllowReadCommittedSnapshot: src.Options.AllowReadCommittedSnapshot,
+		Parameterization:           src.Options.Parameterization,
+		CompatibilityLevel:         src.Options.CompatibilityLevel,
+		Schedule:                   src.Sync.Schedule,
+		DriftPolicy:                DriftPolicy(src.Sync.DriftPolicy),
+		AdoptExisting:              src.AdoptExisting,
+		DeletionPolicy:             DeletionPolicy(src.DeletionPolicy),
+		BackupDirectory:            src.BackupDirectory,
+		DeletionProtection:         src.DeletionProtection,
+	}
+	if src.SoftDeleteGracePeriod != nil {
+		period := *src.SoftDeleteGracePeriod
+		dst.SoftDeleteGracePeriod = &period
+	}
+	if credentials := src.Connection.Credentials; credentials != nil {
+		// v1alpha1 reads both keys from a single secret, a username of another secret is kept in the
+		// conversion data only
+		dst.Credentials = CredentialsSecret{
+			Name:        credentials.Password.Name,
+			UsernameKey: credentials.Username.Key,
+			PasswordKey: credentials.Password.Key,
+		}
+	}
+	return dst
+}
+
+func convertStatusTo(src *DatabaseStatus, dst *v1beta1.DatabaseStatus) {
+	in := src.DeepCopy()
+	*dst = v1beta1.DatabaseStatus{
+		Status:             in.Status,
+		DatabaseID:         in.DatabaseID,
+		ObservedGeneration: in.ObservedGeneration,
+		LastSyncTime:       in.LastSyncTime,
+		Conditions:         in.Conditions,
+		LastChecked:        in.LastChecked,
+		LastDrift:          in.LastDrift,
+		SoftDeletedName:    in.SoftDeletedName,
+		SoftDeletedAt:      in.SoftDeletedAt,
+		BackupPath:         in.BackupPath,
+	}
+	if in.Observed != nil {
+		observed := v1beta1.ObservedDatabase(*in.Observed)
+		dst.Observed = &observed
+	}
+	for _, f := range in.Drift {
+		dst.Drift = append(dst.Drift, v1beta1.DriftField(f))
+	}
+	if in.LastSyncRun != nil {
+		dst.LastSyncRun = &v1beta1.SyncRun{Time: in.LastSyncRun.Time, Result: v1beta1.SyncResult(in.LastSyncRun.Result), Error: in.LastSyncRun.Error,
+			LastSucceeded: in.LastSyncRun.LastSucceeded}
+	}
+	for _, p := range in.ManualPermissions {
+		dst.ManualPermissions = append(dst.ManualPermissions, v1beta1.ObservedPermission(p))
+	}
+}
+
+func convertStatusFrom(src *v1beta1.DatabaseStatus, dst *DatabaseStatus) {
+	in := src.DeepCopy()
+	*dst = DatabaseStatus{
+		Status:             in.Status,
+		DatabaseID:         in.DatabaseID,
+		ObservedGeneration: in.ObservedGeneration,
+		LastSyncTime:       in.LastSyncTime,
+		Conditions:         in.Conditions,
+		LastChecked:        in.LastChecked,
+		LastDrift:          in.LastDrift,
+		SoftDeletedName:    in.SoftDeletedName,
+		SoftDeletedAt:      in.SoftDeletedAt,
+		BackupPath:         in.BackupPath,
+	}
+	if in.Observed != nil {
+		observed := ObservedDatabase(*in.Observed)
+		dst.Observed = &observed
+	}
+	for _, f := range in.Drift {
+		dst.Drift = append(dst.Drift, DriftField(f))
+	}
+	if in.LastSyncRun != nil {
+		dst.LastSyncRun = &SyncRun{Time: in.LastSyncRun.Time, Result: SyncResult(in.LastSyncRun.Result), Error: in.LastSyncRun.Error,
+			LastSucceeded: in.LastSyncRun.LastSucceeded}
+	}
+	for _, p := range in.ManualPermissions {
+		dst.ManualPermissions = append(dst.ManualPermissions, ObservedPermission(p))
+	}
+}
@@ -0,0 +1,137 @@
+package v1alpha1
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/pplavetzki/azure-sql-mi/api/v1beta1"
+)
+
+func TestConvertRoundTripsFromV1alpha1(t *testing.T) {
+	now := metav1.NewTime(time.Date(2021, 9, 1, 12, 0, 0, 0, time.UTC))
+	size := resource.MustParse("8Mi")
+	src := &Database{
+		ObjectMeta: metav1.ObjectMeta{Name: "database", Namespace: "default", Generation: 2},
+		Spec: DatabaseSpec{
+			Name:                       "Database",
+			Server:                     "sqlmi-p-svc",
+			Credentials:                CredentialsSecret{Name: "login", UsernameKey: "user", PasswordKey: "pass"},
+			Port:                       1433,
+			Collation:                  "SQL_Latin1_General_CP1_CI_AS",
+			AllowSnapshotIsolation:     true,
+			AllowReadCommittedSnapshot: true,
+			Parameterization:           "forced",
+			CompatibilityLevel:         150,
+			SQLManagedInstance:         "sqlmi",
+			Schedule:                   "*/30 * * * *",
+			DriftPolicy:                DriftPolicyRemediate,
+			AdoptExisting:              true,
+			DeletionPolicy:             DeletionPolicySoftDelete,
+			BackupDirectory:            "/backups",
+			SoftDeleteGracePeriod:      &metav1.Duration{Duration: time.Hour},
+			DeletionProtection:         true,
+		},
+		Status: DatabaseStatus{
+			Status:             "Synced",
+			DatabaseID:         "4f5a0b6e-0d2b-4d16-a8a4-3d1b1b7c1c11",
+			ObservedGeneration: 2,
+			Observed:           &ObservedDatabase{State: "ONLINE", CompatibilityLevel: 150, CreateDate: &now, DataSize: &size},
+			LastSyncTime:       &now,
+			Conditions:         []metav1.Condition{{Type: "Ready", Status: metav1.ConditionTrue, Reason: "DatabaseReady", LastTransitionTime: now}},
+			Drift:              []DriftField{{Field: "collation", Desired: "a", Observed: "b"}},
+			LastChecked:        &now,
+			LastSyncRun:        &SyncRun{Time: now, Result: SyncResultFailed, Error: "login failed", LastSucceeded: &now},
+			ManualPermissions:  []ObservedPermission{{Principal: "app", State: "GRANT", Permission: "SELECT", Class: "DATABASE"}},
+			BackupPath:         "/backups/App_20211016120000.bak",
+		},
+	}
+
+	hub := &v1beta1.Database{}
+	if err := src.ConvertTo(hub); err != nil {
+		t.Fatal(err)
+	}
+	if hub.Spec.Connection.Credentials == nil || hub.Spec.Connection.Credentials.Password.Name != "login" ||
+		hub.Spec.Connection.Credentials.Password.Key != "pass" || hub.Spec.Sync.DriftPolicy != v1beta1.DriftPolicyRemediate {
+		t.Errorf("unexpected v1beta1 spec: %+v", hub.Spec)
+	}
+
+	dst := &Database{}
+	if err := dst.ConvertFrom(hub); err != nil {
+		t.Fatal(err)
+	}
+	if !equality.Semantic.DeepEqual(src, dst) {
+		t.Errorf("round trip changed the Database:\n%+v\n%+v", src, dst)
+	}
+	if _, ok := dst.Annotations[ConversionDataAnnotation]; ok {
+		t.Error("expected no conversion data for a spec v1alpha1 can represent")
+	}
+}
+
+func TestConvertDefaultsTheCredentialsKeys(t *testing.T) {
+	src := &Database{Spec: DatabaseSpec{Name: "Database", Credentials: CredentialsSecret{Name: "login"}}}
+	hub := &v1beta1.Database{}
+	if err := src.ConvertTo(hub); err != nil {
+		t.Fatal(err)
+	}
+	credentials := hub.Spec.Connection.Credentials
+	if credentials.Username.Key != defaultUsernameKey || credentials.Password.Key != defaultPasswordKey {
+		t.Errorf("unexpected credentials: %+v", credentials)
+	}
+
+	src.Spec.Credentials = CredentialsSecret{}
+	if err := src.ConvertTo(hub); err != nil {
+		t.Fatal(err)
+	}
+	if hub.Spec.Connection.Credentials != nil {
+		t.Errorf("expected no credentials, got %+v", hub.Spec.Connection.Credentials)
+	}
+}
+
+func TestConvertRoundTripsFromV1beta1(t *testing.T) {
+	hub := &v1beta1.Database{
+		ObjectMeta: metav1.ObjectMeta{Name: "database", Namespace: "default"},
+		Spec: v1beta1.DatabaseSpec{
+			Name: "Database",
+			Connection: v1beta1.ConnectionSpec{
+				SQLManagedInstance: "sqlmi",
+				Port:               1433,
+				Credentials: &v1beta1.Credentials{
+					Username: corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "login-name"}, Key: "username"},
+					Password: corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "login-password"}, Key: "password"},
+				},
+			},
+			Options: v1beta1.DatabaseOptions{Parameterization: "simple"},
+			SyncJob: &v1beta1.SyncJobSpec{Image: "example.com/sync:test"},
+		},
+	}
+
+	spoke := &Database{}
+	if err := spoke.ConvertFrom(hub); err != nil {
+		t.Fatal(err)
+	}
+	if spoke.Annotations[ConversionDataAnnotation] == "" {
+		t.Fatal("expected the credentials of two secrets to be kept in the conversion data")
+	}
+
+	restored := &v1beta1.Database{}
+	if err := spoke.ConvertTo(restored); err != nil {
+		t.Fatal(err)
+	}
+	if !equality.Semantic.DeepEqual(hub, restored) {
+		t.Errorf("round trip changed the Database:\n%+v\n%+v", hub, restored)
+	}
+
+	// a change through v1alpha1 discards the conversion data
+	spoke.Spec.Credentials.Name = "other-login"
+	if err := spoke.ConvertTo(restored); err != nil {
+		t.Fatal(err)
+	}
+	if restored.Spec.Connection.Credentials.Username.Name != "other-login" || restored.Annotations != nil {
+		t.Errorf("expected the v1alpha1 credentials to win: %+v", restored)
+	}
+}
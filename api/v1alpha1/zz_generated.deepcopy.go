@@ -21,9 +21,8 @@ limitations under the License.
 package v1alpha1
 
 import (
-	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/runtime"
+	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
@@ -46,7 +45,7 @@ func (in *Database) DeepCopyInto(out *Database) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	in.Status.DeepCopyInto(&out.Status)
 }
 
@@ -104,6 +103,11 @@ func (in *DatabaseList) DeepCopyObject() runtime.Object {
 func (in *DatabaseSpec) DeepCopyInto(out *DatabaseSpec) {
 	*out = *in
 	out.Credentials = in.Credentials
+	if in.SoftDeleteGracePeriod != nil {
+		in, out := &in.SoftDeleteGracePeriod, &out.SoftDeleteGracePeriod
+		*out = new(v1.Duration)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DatabaseSpec.
@@ -119,6 +123,15 @@ func (in *DatabaseSpec) DeepCopy() *DatabaseSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DatabaseStatus) DeepCopyInto(out *DatabaseStatus) {
 	*out = *in
+	if in.Observed != nil {
+		in, out := &in.Observed, &out.Observed
+		*out = new(ObservedDatabase)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.LastSyncTime != nil {
+		in, out := &in.LastSyncTime, &out.LastSyncTime
+		*out = (*in).DeepCopy()
+	}
 	if in.Conditions != nil {
 		in, out := &in.Conditions, &out.Conditions
 		*out = make([]v1.Condition, len(*in))
@@ -126,6 +139,33 @@ func (in *DatabaseStatus) DeepCopyInto(out *DatabaseStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.Drift != nil {
+		in, out := &in.Drift, &out.Drift
+		*out = make([]DriftField, len(*in))
+		copy(*out, *in)
+	}
+	if in.LastChecked != nil {
+		in, out := &in.LastChecked, &out.LastChecked
+		*out = (*in).DeepCopy()
+	}
+	if in.LastDrift != nil {
+		in, out := &in.LastDrift, &out.LastDrift
+		*out = (*in).DeepCopy()
+	}
+	if in.LastSyncRun != nil {
+		in, out := &in.LastSyncRun, &out.LastSyncRun
+		*out = new(SyncRun)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ManualPermissions != nil {
+		in, out := &in.ManualPermissions, &out.ManualPermissions
+		*out = make([]ObservedPermission, len(*in))
+		copy(*out, *in)
+	}
+	if in.SoftDeletedAt != nil {
+		in, out := &in.SoftDeletedAt, &out.SoftDeletedAt
+		*out = (*in).DeepCopy()
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DatabaseStatus.
@@ -139,21 +179,80 @@ func (in *DatabaseStatus) DeepCopy() *DatabaseStatus {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *SecretsFromSource) DeepCopyInto(out *SecretsFromSource) {
+func (in *DriftField) DeepCopyInto(out *DriftField) {
 	*out = *in
-	if in.SecretKeyRef != nil {
-		in, out := &in.SecretKeyRef, &out.SecretKeyRef
-		*out = new(corev1.SecretKeySelector)
-		(*in).DeepCopyInto(*out)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DriftField.
+func (in *DriftField) DeepCopy() *DriftField {
+	if in == nil {
+		return nil
+	}
+	out := new(DriftField)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ObservedDatabase) DeepCopyInto(out *ObservedDatabase) {
+	*out = *in
+	if in.CreateDate != nil {
+		in, out := &in.CreateDate, &out.CreateDate
+		*out = (*in).DeepCopy()
+	}
+	if in.DataSize != nil {
+		in, out := &in.DataSize, &out.DataSize
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.LogSize != nil {
+		in, out := &in.LogSize, &out.LogSize
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ObservedDatabase.
+func (in *ObservedDatabase) DeepCopy() *ObservedDatabase {
+	if in == nil {
+		return nil
+	}
+	out := new(ObservedDatabase)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ObservedPermission) DeepCopyInto(out *ObservedPermission) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ObservedPermission.
+func (in *ObservedPermission) DeepCopy() *ObservedPermission {
+	if in == nil {
+		return nil
+	}
+	out := new(ObservedPermission)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SyncRun) DeepCopyInto(out *SyncRun) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+	if in.LastSucceeded != nil {
+		in, out := &in.LastSucceeded, &out.LastSucceeded
+		*out = (*in).DeepCopy()
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SecretsFromSource.
-func (in *SecretsFromSource) DeepCopy() *SecretsFromSource {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SyncRun.
+func (in *SyncRun) DeepCopy() *SyncRun {
 	if in == nil {
 		return nil
 	}
-	out := new(SecretsFromSource)
+	out := new(SyncRun)
 	in.DeepCopyInto(out)
 	return out
 }
@@ -0,0 +1,72 @@
+package v1beta1
+
+import (
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Condition types shared by the kinds, each kind sums its other conditions up in Ready
+const (
+	// ConditionReady the object exists on the server and matches the spec
+	ConditionReady string = "Ready"
+	// ConditionInstanceReady the sql managed instance of a Database or a Login is in a `Ready` state
+	ConditionInstanceReady string = "InstanceReady"
+	// ConditionDatabaseReady the Database of a DatabaseUser, DatabaseRole, DatabasePermission or DatabaseSchema is
+	// ready and its sql managed instance is reachable
+	ConditionDatabaseReady string = "DatabaseReady"
+	// ConditionSynced the last reconcile brought the server to the spec
+	ConditionSynced string = "Synced"
+)
+
+// readyPrerequisite a condition the Ready condition of a kind depends on
+type readyPrerequisite struct {
+	conditionType string
+	// blocking the condition holds Ready back while it is True rather than while it is not
+	blocking bool
+	// notReady the message of Ready while the condition holds it back
+	notReady string
+}
+
+// readiness how the Ready condition of a kind is computed from its other conditions, the first prerequisite
+// holding it back names the reason in the message of Ready
+type readiness struct {
+	readyReason    string
+	readyMessage   string
+	notReadyReason string
+	prerequisites  []readyPrerequisite
+}
+
+// dependentReadiness the readiness of a kind reconciled in the database of a Database, it is Ready when
+// DatabaseReady and Synced are True
+func dependentReadiness(readyReason, readyMessage, notReadyReason, notSynced string) *readiness {
+	return &readiness{
+		readyReason:    readyReason,
+		readyMessage:   readyMessage,
+		notReadyReason: notReadyReason,
+		prerequisites: []readyPrerequisite{
+			{conditionType: ConditionDatabaseReady, notReady: "Database is not ready"},
+			{conditionType: ConditionSynced, notReady: notSynced},
+		},
+	}
+}
+
+// setCondition sets the condition for the generation of the object and recomputes Ready
+func (r *readiness) setCondition(conditions *[]metav1.Condition, generation int64, conditionType string, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		ObservedGeneration: generation,
+		Reason:             reason,
+		Message:            message,
+	})
+	if conditionType == ConditionReady {
+		return
+	}
+	for _, p := range r.prerequisites {
+		if meta.IsStatusConditionTrue(*conditions, p.conditionType) == p.blocking {
+			r.setCondition(conditions, generation, ConditionReady, metav1.ConditionFalse, r.notReadyReason, p.notReady)
+			return
+		}
+	}
+	r.setCondition(conditions, generation, ConditionReady, metav1.ConditionTrue, r.readyReason, r.readyMessage)
+}
@@ -0,0 +1,69 @@
+package v1beta1
+
+import (
+	"errors"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// dependent the conditions of the kinds reconciled in the database of a Database
+type dependent interface {
+	MarkDatabaseReady()
+	MarkDatabaseNotReady(reason, message string)
+	MarkSynced(reason, message string)
+	MarkSyncFailed(reason string, err error)
+	IsReady() bool
+}
+
+func TestDependentReadyCondition(t *testing.T) {
+	objectMeta := metav1.ObjectMeta{Generation: 3}
+	user := &DatabaseUser{ObjectMeta: objectMeta}
+	role := &DatabaseRole{ObjectMeta: objectMeta}
+	permission := &DatabasePermission{ObjectMeta: objectMeta}
+	schema := &DatabaseSchema{ObjectMeta: objectMeta}
+	tests := []struct {
+		name           string
+		object         dependent
+		conditions     *[]metav1.Condition
+		readyReason    string
+		notReadyReason string
+		notSynced      string
+	}{
+		{"DatabaseUser", user, &user.Status.Conditions, DatabaseUserReasonReady, DatabaseUserReasonNotReady, "User is not synced"},
+		{"DatabaseRole", role, &role.Status.Conditions, DatabaseRoleReasonReady, DatabaseRoleReasonNotReady, "Role is not synced"},
+		{"DatabasePermission", permission, &permission.Status.Conditions, DatabasePermissionReasonReady, DatabasePermissionReasonNotReady,
+			"Permissions are not synced"},
+		{"DatabaseSchema", schema, &schema.Status.Conditions, DatabaseSchemaReasonReady, DatabaseSchemaReasonNotReady, "Schema is not synced"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.object.MarkSynced("Created", "created")
+			if tt.object.IsReady() {
+				t.Error("expected the object not to be ready before the database is ready")
+			}
+			tt.object.MarkDatabaseReady()
+			if !tt.object.IsReady() {
+				t.Fatal("expected the object to be ready")
+			}
+			ready := meta.FindStatusCondition(*tt.conditions, ConditionReady)
+			if ready.ObservedGeneration != 3 || ready.Reason != tt.readyReason {
+				t.Errorf("unexpected Ready condition: %+v", ready)
+			}
+
+			tt.object.MarkDatabaseNotReady("DatabaseNotFound", "Database app not found")
+			ready = meta.FindStatusCondition(*tt.conditions, ConditionReady)
+			if tt.object.IsReady() || ready.ObservedGeneration != 3 || ready.Reason != tt.notReadyReason || ready.Message != "Database is not ready" {
+				t.Errorf("expected a missing Database to flip Ready to False: %+v", ready)
+			}
+
+			tt.object.MarkDatabaseReady()
+			tt.object.MarkSyncFailed("SyncFailed", errors.New("cannot find the user 'app'"))
+			ready = meta.FindStatusCondition(*tt.conditions, ConditionReady)
+			if tt.object.IsReady() || ready.ObservedGeneration != 3 || ready.Reason != tt.notReadyReason || ready.Message != tt.notSynced {
+				t.Errorf("expected a failed sync to flip Ready to False: %+v", ready)
+			}
+		})
+	}
+}
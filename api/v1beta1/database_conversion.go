@@ -0,0 +1,4 @@
+package v1beta1
+
+// Hub marks v1beta1 as the version every other version of Database converts to and from
+func (*Database) Hub() {}
@@ -0,0 +1,62 @@
+package v1beta1
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const namespaceDeletionPath = "/validate-actions-msft-isd-coe-io-v1beta1-database-namespace-deletion"
+
+//+kubebuilder:webhook:path=/validate-actions-msft-isd-coe-io-v1beta1-database-namespace-deletion,mutating=false,failurePolicy=fail,sideEffects=None,groups=actions.msft.isd.coe.io,resources=databases,verbs=delete,versions=v1beta1,name=vdatabasenamespacedeletion.kb.io,admissionReviewVersions={v1,v1beta1}
+//+kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch
+
+// namespaceDeletionValidator refuses the deletion of the Databases of a terminating Namespace unless the
+// break-glass annotation is set on the Database or the Namespace, deleting a namespace must not take every
+// database in it down by accident
+type namespaceDeletionValidator struct {
+	reader  client.Reader
+	decoder *admission.Decoder
+}
+
+// newNamespaceDeletionValidator a validator reading the Namespaces from reader
+func newNamespaceDeletionValidator(reader client.Reader, scheme *runtime.Scheme) (*namespaceDeletionValidator, error) {
+	decoder, err := admission.NewDecoder(scheme)
+	if err != nil {
+		return nil, err
+	}
+	return &namespaceDeletionValidator{reader: reader, decoder: decoder}, nil
+}
+
+// Handle implements admission.Handler
+func (v *namespaceDeletionValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if req.Operation != admissionv1.Delete {
+		return admission.Allowed("")
+	}
+
+	db := &Database{}
+	if err := v.decoder.DecodeRaw(req.OldObject, db); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if annotationTrue(db.Annotations, AllowNamespaceDeletionAnnotation) {
+		return admission.Allowed("")
+	}
+
+	namespace := &corev1.Namespace{}
+	if err := v.reader.Get(ctx, types.NamespacedName{Name: req.Namespace}, namespace); err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if namespace.DeletionTimestamp.IsZero() || annotationTrue(namespace.Annotations, AllowNamespaceDeletionAnnotation) {
+		return admission.Allowed("")
+	}
+	databaselog.Info("refusing namespace deletion", "name", db.Name, "namespace", req.Namespace)
+	return admission.Denied(fmt.Sprintf("namespace %s is being deleted, set the %s annotation to \"true\" on the Namespace or the Database to delete its databases",
+		req.Namespace, AllowNamespaceDeletionAnnotation))
+}
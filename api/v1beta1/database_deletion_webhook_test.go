@@ -0,0 +1,70 @@
+package v1beta1
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// deleteRequest the admission request deleting the Database
+func deleteRequest(t *testing.T, db *Database) admission.Request {
+	raw, err := json.Marshal(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+		Operation: admissionv1.Delete,
+		Name:      db.Name,
+		Namespace: db.Namespace,
+		OldObject: runtime.RawExtension{Raw: raw},
+	}}
+}
+
+func TestNamespaceDeletionValidator(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	now := metav1.Now()
+	namespaces := []runtime.Object{
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "terminating", DeletionTimestamp: &now}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "break-glass", DeletionTimestamp: &now,
+			Annotations: map[string]string{AllowNamespaceDeletionAnnotation: "true"}}},
+	}
+	validator, err := newNamespaceDeletionValidator(fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(namespaces...).Build(), scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		namespace   string
+		annotations map[string]string
+		allowed     bool
+	}{
+		{namespace: "default", allowed: true},
+		{namespace: "terminating", allowed: false},
+		{namespace: "terminating", annotations: map[string]string{AllowNamespaceDeletionAnnotation: "true"}, allowed: true},
+		{namespace: "break-glass", allowed: true},
+	}
+	for _, tt := range tests {
+		db := newValidDatabase()
+		db.Namespace = tt.namespace
+		db.Annotations = tt.annotations
+		response := validator.Handle(context.Background(), deleteRequest(t, db))
+		if response.Allowed != tt.allowed {
+			t.Errorf("deleting a Database of %s with %v: expected allowed %v, got %+v", tt.namespace, tt.annotations, tt.allowed, response.Result)
+		}
+	}
+}
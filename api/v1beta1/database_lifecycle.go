@@ -0,0 +1,157 @@
+package v1beta1
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Condition types of a Database
+const (
+	// DatabaseConditionReady the database exists on the server and is managed by the controller, it is True
+	// when InstanceReady and Synced are True and the Database is not being deleted
+	DatabaseConditionReady string = ConditionReady
+	// DatabaseConditionInstanceReady the sql managed instance hosting the database is in a `Ready` state
+	DatabaseConditionInstanceReady string = ConditionInstanceReady
+	// DatabaseConditionSynced the last reconcile created, adopted or altered the database to the spec
+	DatabaseConditionSynced string = ConditionSynced
+	// DatabaseConditionDrifted the database differs from the spec, see status.drift for the options
+	DatabaseConditionDrifted string = "Drifted"
+	// DatabaseConditionDeleting the Database is being deleted and its deletion policy is applied
+	DatabaseConditionDeleting string = "Deleting"
+)
+
+// Condition reasons of a Database
+const (
+	// DatabaseReasonInstanceReady InstanceReady is True
+	DatabaseReasonInstanceReady string = "InstanceReady"
+	// DatabaseReasonInstanceNotReady InstanceReady is False, the instance is not in a `Ready` state
+	DatabaseReasonInstanceNotReady string = "InstanceNotReady"
+	// DatabaseReasonInstanceNotFound InstanceReady is False, the instance could not be read
+	DatabaseReasonInstanceNotFound string = "InstanceNotFound"
+	// DatabaseReasonCredentialsNotFound Synced is False, the sql login could not be read from its secret
+	DatabaseReasonCredentialsNotFound string = "CredentialsNotFound"
+	// DatabaseReasonCreated Synced is True, the database was created
+	DatabaseReasonCreated string = "DatabaseCreated"
+	// DatabaseReasonAdopted Synced is True, an existing database was adopted
+	DatabaseReasonAdopted string = "DatabaseAdopted"
+	// DatabaseReasonSynced Synced is True, the database was compared with the spec and altered where needed
+	DatabaseReasonSynced string = "DatabaseSynced"
+	// DatabaseReasonSyncFailed Synced is False, creating, adopting or altering the database failed
+	DatabaseReasonSyncFailed string = "SyncFailed"
+	// DatabaseReasonDriftDetected Drifted is True, an option differs from the spec and was not remediated
+	DatabaseReasonDriftDetected string = "DriftDetected"
+	// DatabaseReasonNoDrift Drifted is False, every option matches the spec
+	DatabaseReasonNoDrift string = "NoDrift"
+	// DatabaseReasonDriftNotChecked Drifted is Unknown, the drift policy is Ignore
+	DatabaseReasonDriftNotChecked string = "DriftNotChecked"
+	// DatabaseReasonDeleting Deleting is True, the deletion policy is being applied
+	DatabaseReasonDeleting string = "DeletionPolicyApplied"
+	// DatabaseReasonSoftDeleted Deleting is True, the database was renamed and waits for its grace period
+	DatabaseReasonSoftDeleted string = "SoftDeleted"
+	// DatabaseReasonReady Ready is True
+	DatabaseReasonReady string = "DatabaseReady"
+	// DatabaseReasonNotReady Ready is False, the message names the condition that is not True
+	DatabaseReasonNotReady string = "DatabaseNotReady"
+)
+
+// Values of the Status summary of a Database
+const (
+	DatabaseStatusCreated  string = "Created"
+	DatabaseStatusAdopted  string = "Adopted"
+	DatabaseStatusSynced   string = "Synced"
+	DatabaseStatusDeleting string = "Deleting"
+	DatabaseStatusError    string = "Error"
+)
+
+// databaseReadiness Ready is True when the instance is ready, the database is synced and not being deleted
+var databaseReadiness = &readiness{
+	readyReason:    DatabaseReasonReady,
+	readyMessage:   "Database is ready",
+	notReadyReason: DatabaseReasonNotReady,
+	prerequisites: []readyPrerequisite{
+		{conditionType: DatabaseConditionDeleting, blocking: true, notReady: "Database is being deleted"},
+		{conditionType: DatabaseConditionInstanceReady, notReady: "SQL managed instance is not ready"},
+		{conditionType: DatabaseConditionSynced, notReady: "Database is not synced"},
+	},
+}
+
+// SetCondition sets the condition for the current generation of the Database and recomputes Ready
+func (d *Database) SetCondition(conditionType string, status metav1.ConditionStatus, reason, message string) {
+	databaseReadiness.setCondition(&d.Status.Conditions, d.Generation, conditionType, status, reason, message)
+}
+
+// IsConditionTrue whether the condition is set and True
+func (d *Database) IsConditionTrue(conditionType string) bool {
+	return meta.IsStatusConditionTrue(d.Status.Conditions, conditionType)
+}
+
+// IsReady whether the Ready condition is True
+func (d *Database) IsReady() bool {
+	return d.IsConditionTrue(DatabaseConditionReady)
+}
+
+// MarkInstanceReady sets InstanceReady to True
+func (d *Database) MarkInstanceReady() {
+	d.SetCondition(DatabaseConditionInstanceReady, metav1.ConditionTrue, DatabaseReasonInstanceReady, "SQL managed instance is ready")
+}
+
+// MarkInstanceNotReady sets InstanceReady to False
+func (d *Database) MarkInstanceNotReady(reason, message string) {
+	d.SetCondition(DatabaseConditionInstanceReady, metav1.ConditionFalse, reason, message)
+}
+
+// MarkSynced sets Synced to True
+func (d *Database) MarkSynced(reason, message string) {
+	d.SetCondition(DatabaseConditionSynced, metav1.ConditionTrue, reason, message)
+}
+
+// MarkSyncFailed sets Synced to False
+func (d *Database) MarkSyncFailed(reason string, err error) {
+	d.SetCondition(DatabaseConditionSynced, metav1.ConditionFalse, reason, err.Error())
+}
+
+// RecordSyncRun records the outcome of a run of the scheduled sync, err is nil when it succeeded
+func (d *Database) RecordSyncRun(err error) {
+	now := metav1.Now()
+	run := &SyncRun{Time: now, Result: SyncResultSucceeded, LastSucceeded: &now}
+	if err != nil {
+		run.Result = SyncResultFailed
+		run.Error = err.Error()
+		run.LastSucceeded = d.LastSuccessfulSync()
+	}
+	d.Status.LastSyncRun = run
+}
+
+// LastSuccessfulSync when the scheduled sync last succeeded, nil when it never did
+func (d *Database) LastSuccessfulSync() *metav1.Time {
+	if d.Status.LastSyncRun == nil {
+		return nil
+	}
+	return d.Status.LastSyncRun.LastSucceeded
+}
+
+// MarkDrift sets Drifted from the drift recorded in the status
+func (d *Database) MarkDrift() {
+	if len(d.Status.Drift) == 0 {
+		d.SetCondition(DatabaseConditionDrifted, metav1.ConditionFalse, DatabaseReasonNoDrift, "Database matches the spec")
+		return
+	}
+	fields := make([]string, len(d.Status.Drift))
+	for i, f := range d.Status.Drift {
+		fields[i] = f.Field
+	}
+	d.SetCondition(DatabaseConditionDrifted, metav1.ConditionTrue, DatabaseReasonDriftDetected,
+		"Database differs from the spec: "+strings.Join(fields, ", "))
+}
+
+// MarkDriftNotChecked sets Drifted to Unknown
+func (d *Database) MarkDriftNotChecked() {
+	d.SetCondition(DatabaseConditionDrifted, metav1.ConditionUnknown, DatabaseReasonDriftNotChecked, "Drift policy is Ignore")
+}
+
+// MarkDeleting sets Deleting to True
+func (d *Database) MarkDeleting(reason, message string) {
+	d.SetCondition(DatabaseConditionDeleting, metav1.ConditionTrue, reason, message)
+}
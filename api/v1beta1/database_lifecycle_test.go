@@ -0,0 +1,91 @@
+package v1beta1
+
+import (
+	"fmt"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestReadyCondition(t *testing.T) {
+	db := &Database{ObjectMeta: metav1.ObjectMeta{Generation: 3}}
+
+	db.MarkInstanceReady()
+	if db.IsReady() {
+		t.Error("expected the database not to be ready before it is synced")
+	}
+	db.MarkSynced(DatabaseReasonCreated, "Database was created")
+	if !db.IsReady() {
+		t.Fatal("expected the database to be ready")
+	}
+	ready := meta.FindStatusCondition(db.Status.Conditions, DatabaseConditionReady)
+	if ready.ObservedGeneration != 3 || ready.Reason != DatabaseReasonReady {
+		t.Errorf("unexpected Ready condition: %+v", ready)
+	}
+
+	db.MarkSyncFailed(DatabaseReasonSyncFailed, fmt.Errorf("boom"))
+	if db.IsReady() {
+		t.Error("expected a failed sync to flip Ready to False")
+	}
+	synced := meta.FindStatusCondition(db.Status.Conditions, DatabaseConditionSynced)
+	if synced.Status != metav1.ConditionFalse || synced.Message != "boom" {
+		t.Errorf("unexpected Synced condition: %+v", synced)
+	}
+
+	db.MarkSynced(DatabaseReasonSynced, "Database was compared with the spec")
+	db.MarkInstanceNotReady(DatabaseReasonInstanceNotReady, "not ready")
+	if db.IsReady() {
+		t.Error("expected an instance that is not ready to flip Ready to False")
+	}
+	db.MarkInstanceReady()
+	db.MarkDeleting(DatabaseReasonDeleting, "Applying the Delete deletion policy")
+	if db.IsReady() {
+		t.Error("expected a deleting database not to be ready")
+	}
+}
+
+func TestDriftedCondition(t *testing.T) {
+	db := &Database{}
+
+	db.MarkDrift()
+	if drifted := meta.FindStatusCondition(db.Status.Conditions, DatabaseConditionDrifted); drifted.Status != metav1.ConditionFalse {
+		t.Errorf("expected Drifted to be False, got %+v", drifted)
+	}
+
+	db.Status.Drift = []DriftField{{Field: "collation"}, {Field: "compatibilityLevel"}}
+	db.MarkDrift()
+	drifted := meta.FindStatusCondition(db.Status.Conditions, DatabaseConditionDrifted)
+	if drifted.Status != metav1.ConditionTrue || drifted.Message != "Database differs from the spec: collation, compatibilityLevel" {
+		t.Errorf("unexpected Drifted condition: %+v", drifted)
+	}
+
+	db.MarkDriftNotChecked()
+	if drifted := meta.FindStatusCondition(db.Status.Conditions, DatabaseConditionDrifted); drifted.Status != metav1.ConditionUnknown {
+		t.Errorf("expected Drifted to be Unknown, got %+v", drifted)
+	}
+}
+
+func TestRecordSyncRun(t *testing.T) {
+	db := &Database{}
+
+	db.RecordSyncRun(fmt.Errorf("login failed"))
+	if run := db.Status.LastSyncRun; run.Result != SyncResultFailed || run.Error != "login failed" || run.Time.IsZero() {
+		t.Errorf("unexpected failed sync run: %+v", run)
+	}
+
+	if last := db.LastSuccessfulSync(); last != nil {
+		t.Errorf("expected no successful sync, got %v", last)
+	}
+
+	db.RecordSyncRun(nil)
+	if run := db.Status.LastSyncRun; run.Result != SyncResultSucceeded || run.Error != "" {
+		t.Errorf("unexpected succeeded sync run: %+v", run)
+	}
+	succeeded := db.Status.LastSyncRun.Time
+
+	db.RecordSyncRun(fmt.Errorf("login failed"))
+	if last := db.LastSuccessfulSync(); last == nil || !last.Equal(&succeeded) {
+		t.Errorf("expected the failed sync run to keep the last success %v, got %v", succeeded, last)
+	}
+}
@@ -0,0 +1,286 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DriftPolicy what the scheduled sync does when the database no longer matches the spec
+// +kubebuilder:validation:Enum=Report;Remediate;Ignore
+type DriftPolicy string
+
+const (
+	// DriftPolicyReport records the drift in the status of the Database
+	DriftPolicyReport DriftPolicy = "Report"
+	// DriftPolicyRemediate alters the database back to the spec and records the drift that could not be remediated
+	DriftPolicyRemediate DriftPolicy = "Remediate"
+	// DriftPolicyIgnore skips the comparison
+	DriftPolicyIgnore DriftPolicy = "Ignore"
+)
+
+// DeletionPolicy what happens to the database on the server when the Database is deleted
+// +kubebuilder:validation:Enum=Delete;Retain;BackupThenDelete;SoftDelete
+type DeletionPolicy string
+
+const (
+	// DeletionPolicyDelete drops the database
+	DeletionPolicyDelete DeletionPolicy = "Delete"
+	// DeletionPolicyRetain leaves the database in place
+	DeletionPolicyRetain DeletionPolicy = "Retain"
+	// DeletionPolicyBackupThenDelete takes a COPY_ONLY backup of the database before dropping it
+	DeletionPolicyBackupThenDelete DeletionPolicy = "BackupThenDelete"
+	// DeletionPolicySoftDelete renames the database with a timestamp suffix and drops it once the grace
+	// period elapsed, the Database is kept until then
+	DeletionPolicySoftDelete DeletionPolicy = "SoftDelete"
+)
+
+// Credentials the sql server login, each key is selected from a secret in the namespace of the Database
+type Credentials struct {
+	// Username selects the login name
+	Username corev1.SecretKeySelector `json:"username"`
+	// Password selects the password of the login
+	Password corev1.SecretKeySelector `json:"password"`
+}
+
+// ConnectionSpec how the controller and the sync job reach the sql server
+type ConnectionSpec struct {
+	// SQLManagedInstance name of the managed instance to create database in
+	// this is used to query for the status of the instance as well as
+	// primary endpoint and connection info
+	SQLManagedInstance string `json:"sqlManagedInstance"`
+	// Server is the sql server (fqdn/ip addresss)
+	Server string `json:"server,omitempty"`
+	// Port where Sql Server is listening, defaults to 1433
+	Port int `json:"port,omitempty"`
+	// Credentials the sql server login, when not set the login of the sql managed instance is used
+	Credentials *Credentials `json:"credentials,omitempty"`
+}
+
+// DatabaseOptions the options of the database set by CREATE DATABASE and ALTER DATABASE
+type DatabaseOptions struct {
+	// Collation of the database, it cannot be changed once the database exists
+	Collation string `json:"collation,omitempty"`
+	// AllowSnapshotIsolation whether snapshot isolation is on
+	AllowSnapshotIsolation bool `json:"allowSnapshotIsolation,omitempty"`
+	// AllowReadCommittedSnapshot whether read committed snapshot is on
+	AllowReadCommittedSnapshot bool `json:"allowReadCommittedSnapshot,omitempty"`
+	// Parameterization simple or forced, defaults to simple
+	Parameterization string `json:"parameterization,omitempty"`
+	// CompatibilityLevel of the database, the server default is kept when not set
+	CompatibilityLevel int `json:"compatibilityLevel,omitempty"`
+}
+
+// SyncSpec how the database is compared with the spec between changes of the Database
+type SyncSpec struct {
+	// Schedule how often the database to k8s state should occur in cron format
+	Schedule string `json:"schedule,omitempty"`
+	// DriftPolicy what the controller and the scheduled sync do when the database drifted from a spec that did not
+	// change, defaults to Report. Changes of the Database itself are always applied by the controller.
+	// +kubebuilder:default=Report
+	DriftPolicy DriftPolicy `json:"driftPolicy,omitempty"`
+}
+
+// SyncJobSpec the CronJob running the scheduled sync of the Database
+type SyncJobSpec struct {
+	// Image of the sync container, defaults to the image the controller was built with
+	Image string `json:"image,omitempty"`
+	// Resources of the sync container
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+	// NodeSelector of the sync pods
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// Tolerations of the sync pods
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+	// Suspend stops the scheduling of new sync jobs, running jobs are not affected
+	Suspend *bool `json:"suspend,omitempty"`
+	// ConcurrencyPolicy how a sync job is scheduled while the previous one is still running, defaults to Forbid
+	// +kubebuilder:validation:Enum=Allow;Forbid;Replace
+	ConcurrencyPolicy batchv1.ConcurrencyPolicy `json:"concurrencyPolicy,omitempty"`
+	// SuccessfulJobsHistoryLimit the number of successful sync jobs kept
+	// +kubebuilder:validation:Minimum=0
+	SuccessfulJobsHistoryLimit *int32 `json:"successfulJobsHistoryLimit,omitempty"`
+	// FailedJobsHistoryLimit the number of failed sync jobs kept
+	// +kubebuilder:validation:Minimum=0
+	FailedJobsHistoryLimit *int32 `json:"failedJobsHistoryLimit,omitempty"`
+	// ActiveDeadlineSeconds how long a sync job may run before it is terminated
+	// +kubebuilder:validation:Minimum=1
+	ActiveDeadlineSeconds *int64 `json:"activeDeadlineSeconds,omitempty"`
+}
+
+// DatabaseSpec defines the desired state of Database
+type DatabaseSpec struct {
+	// Name is the Database name.
+	Name string `json:"name"`
+	// Connection how the sql server is reached
+	Connection ConnectionSpec `json:"connection"`
+	// Options of the database
+	Options DatabaseOptions `json:"options,omitempty"`
+	// Sync settings of the scheduled comparison with the database
+	Sync SyncSpec `json:"sync,omitempty"`
+	// SyncJob settings of the CronJob running the scheduled sync
+	SyncJob *SyncJobSpec `json:"syncJob,omitempty"`
+	// AdoptExisting takes over the management of a database that already exists on the server instead of
+	// failing to create it, the settings of the adopted database are reported or remediated per the DriftPolicy
+	AdoptExisting bool `json:"adoptExisting,omitempty"`
+	// DeletionPolicy what happens to the database when the Database is deleted, defaults to Delete
+	// +kubebuilder:default=Delete
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+	// BackupDirectory directory on the sql server the backup of the BackupThenDelete policy is written to,
+	// defaults to /var/opt/mssql/backups
+	BackupDirectory string `json:"backupDirectory,omitempty"`
+	// SoftDeleteGracePeriod how long the SoftDelete policy keeps the renamed database before dropping it,
+	// defaults to 24h
+	SoftDeleteGracePeriod *metav1.Duration `json:"softDeleteGracePeriod,omitempty"`
+	// DeletionProtection refuses the deletion of the Database until it is cleared, the
+	// actions.msft.isd.coe.io/deletion-protection annotation has the same effect
+	DeletionProtection bool `json:"deletionProtection,omitempty"`
+}
+
+// DriftField an option of the database that differs from the spec
+type DriftField struct {
+	// Field json name of the spec field
+	Field string `json:"field"`
+	// Desired value of the spec
+	Desired string `json:"desired"`
+	// Observed value of the database
+	Observed string `json:"observed"`
+	// Remediable whether the sync can alter the database back to the desired value
+	Remediable bool `json:"remediable"`
+}
+
+// ObservedDatabase the database as last read from sys.databases
+type ObservedDatabase struct {
+	// State state_desc of the database e.g. ONLINE, RESTORING or SUSPECT
+	State string `json:"state,omitempty"`
+	// CompatibilityLevel compatibility_level of the database
+	CompatibilityLevel int `json:"compatibilityLevel,omitempty"`
+	// Collation collation_name of the database
+	Collation string `json:"collation,omitempty"`
+	// AllowSnapshotIsolation whether snapshot isolation is on
+	AllowSnapshotIsolation bool `json:"allowSnapshotIsolation"`
+	// AllowReadCommittedSnapshot whether read committed snapshot is on
+	AllowReadCommittedSnapshot bool `json:"allowReadCommittedSnapshot"`
+	// Parameterization simple or forced
+	Parameterization string `json:"parameterization,omitempty"`
+	// RecoveryModel recovery_model_desc of the database e.g. FULL or SIMPLE
+	RecoveryModel string `json:"recoveryModel,omitempty"`
+	// CreateDate when the database was created
+	CreateDate *metav1.Time `json:"createDate,omitempty"`
+	// DataSize total size of the data files
+	DataSize *resource.Quantity `json:"dataSize,omitempty"`
+	// LogSize total size of the log files
+	LogSize *resource.Quantity `json:"logSize,omitempty"`
+}
+
+// SyncResult the outcome of a scheduled sync
+// +kubebuilder:validation:Enum=Succeeded;Failed
+type SyncResult string
+
+const (
+	// SyncResultSucceeded the database was compared with the spec and the drift policy applied
+	SyncResultSucceeded SyncResult = "Succeeded"
+	// SyncResultFailed the sync could not compare the database with the spec
+	SyncResultFailed SyncResult = "Failed"
+)
+
+// SyncRun the last run of the scheduled sync, the drift it found is recorded in status.drift
+type SyncRun struct {
+	// Time when the sync ran
+	Time metav1.Time `json:"time"`
+	// Result of the sync
+	Result SyncResult `json:"result"`
+	// Error why the sync failed
+	Error string `json:"error,omitempty"`
+	// LastSucceeded when the sync last succeeded, kept across the runs that failed
+	LastSucceeded *metav1.Time `json:"lastSucceeded,omitempty"`
+}
+
+// DatabaseStatus defines the observed state of Database
+type DatabaseStatus struct {
+	Status string `json:"status"`
+	// DatabaseID guid of the database
+	DatabaseID string `json:"databaseID,omitempty"`
+	// ObservedGeneration the generation of the Database last reconciled by the controller
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Observed the database as last read from the server
+	Observed *ObservedDatabase `json:"observed,omitempty"`
+	// LastSyncTime when the database was last read from the server
+	LastSyncTime *metav1.Time `json:"lastSyncTime,omitempty"`
+	// Conditions the array of conditions of the object
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// Drift the options of the database that differed from the spec at the last check
+	Drift []DriftField `json:"drift,omitempty"`
+	// LastChecked when the database was last compared with the spec by the controller or the scheduled sync
+	LastChecked *metav1.Time `json:"lastChecked,omitempty"`
+	// LastDrift when the database was last found drifted from the spec
+	LastDrift *metav1.Time `json:"lastDrift,omitempty"`
+	// LastSyncRun the last run of the scheduled sync by the sync job or the controller
+	LastSyncRun *SyncRun `json:"lastSyncRun,omitempty"`
+	// ManualPermissions the permissions found by the last scheduled sync that were not applied by a
+	// DatabasePermission of the Database, only checked when the Database has DatabasePermissions
+	ManualPermissions []ObservedPermission `json:"manualPermissions,omitempty"`
+	// SoftDeletedName name the database was renamed to by the SoftDelete policy
+	SoftDeletedName string `json:"softDeletedName,omitempty"`
+	// SoftDeletedAt when the database was renamed by the SoftDelete policy
+	SoftDeletedAt *metav1.Time `json:"softDeletedAt,omitempty"`
+	// BackupPath the file of the backup taken by the BackupThenDelete policy, it is not taken again when the drop
+	// is retried
+	BackupPath string `json:"backupPath,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:storageversion
+//+kubebuilder:printcolumn:name="Database ID",type="string",JSONPath=`.status.databaseID`,description="MSSql Database ID"
+//+kubebuilder:printcolumn:name="Database Name",type=string,JSONPath=`.spec.name`,description="Name of Database"
+//+kubebuilder:printcolumn:name="Database Status",type=string,JSONPath=`.status.status`,description="Status of Database"
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`,description="Whether the database is ready"
+//+kubebuilder:printcolumn:name="Drifted",type=string,JSONPath=`.status.conditions[?(@.type=="Drifted")].status`,description="Whether the database differs from the spec"
+//+kubebuilder:printcolumn:name="State",type=string,JSONPath=`.status.observed.state`,description="state_desc of the database"
+//+kubebuilder:printcolumn:name="Instance",type=string,JSONPath=`.spec.connection.sqlManagedInstance`,description="SQL managed instance hosting the database",priority=1
+//+kubebuilder:printcolumn:name="Drift Policy",type=string,JSONPath=`.spec.sync.driftPolicy`,description="What the scheduled sync does about drift",priority=1
+//+kubebuilder:printcolumn:name="Compatibility",type=integer,JSONPath=`.status.observed.compatibilityLevel`,description="Compatibility level of the database",priority=1
+//+kubebuilder:printcolumn:name="Recovery Model",type=string,JSONPath=`.status.observed.recoveryModel`,description="Recovery model of the database",priority=1
+//+kubebuilder:printcolumn:name="Data Size",type=string,JSONPath=`.status.observed.dataSize`,description="Size of the data files",priority=1
+//+kubebuilder:printcolumn:name="Last Sync Result",type=string,JSONPath=`.status.lastSyncRun.result`,description="Result of the last scheduled sync",priority=1
+//+kubebuilder:printcolumn:name="Last Sync",type=date,JSONPath=`.status.lastSyncTime`,description="When the database was last read from the server"
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// Database is the Schema for the databases API
+type Database struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   DatabaseSpec   `json:"spec,omitempty"`
+	Status DatabaseStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// DatabaseList contains a list of Database
+type DatabaseList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Database `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Database{}, &DatabaseList{})
+}
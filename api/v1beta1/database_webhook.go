@@ -0,0 +1,233 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+
+	"github.com/pplavetzki/azure-sql-mi/internal/validation"
+)
+
+// Defaults of the DatabaseSpec set by the mutating webhook
+const (
+	// DefaultPort the port sql server listens on
+	DefaultPort = 1433
+	// DefaultSchedule the schedule of the sync job, every 12 hours
+	DefaultSchedule = "0 */12 * * *"
+	// DefaultParameterization the PARAMETERIZATION of a new database
+	DefaultParameterization = "simple"
+)
+
+// Annotations of a Database guarding its deletion
+const (
+	// DeletionProtectionAnnotation set to "true" protects the Database like spec.deletionProtection
+	DeletionProtectionAnnotation = "actions.msft.isd.coe.io/deletion-protection"
+	// AllowNamespaceDeletionAnnotation set to "true" on the Database or its Namespace lets the Database be
+	// deleted with its Namespace
+	AllowNamespaceDeletionAnnotation = "actions.msft.isd.coe.io/allow-namespace-deletion"
+)
+
+// reservedDatabaseNames the system databases that can never be managed by a Database
+var reservedDatabaseNames = map[string]bool{
+	"master": true,
+	"model":  true,
+	"msdb":   true,
+	"tempdb": true,
+}
+
+// log is for logging in this package.
+var databaselog = logf.Log.WithName("database-resource")
+
+func (r *Database) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	deletion, err := newNamespaceDeletionValidator(mgr.GetClient(), mgr.GetScheme())
+	if err != nil {
+		return err
+	}
+	mgr.GetWebhookServer().Register(namespaceDeletionPath, &webhook.Admission{Handler: deletion})
+
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-actions-msft-isd-coe-io-v1beta1-database,mutating=true,failurePolicy=fail,sideEffects=None,groups=actions.msft.isd.coe.io,resources=databases,verbs=create;update,versions=v1beta1,name=mdatabase.kb.io,admissionReviewVersions={v1,v1beta1}
+
+var _ webhook.Defaulter = &Database{}
+
+// Default implements webhook.Defaulter so a webhook will be registered for the type
+func (r *Database) Default() {
+	databaselog.Info("default", "name", r.Name)
+
+	if r.Spec.Connection.Port == 0 {
+		r.Spec.Connection.Port = DefaultPort
+	}
+	if r.Spec.Sync.Schedule == "" {
+		r.Spec.Sync.Schedule = DefaultSchedule
+	}
+	if r.Spec.Options.Parameterization == "" {
+		r.Spec.Options.Parameterization = DefaultParameterization
+	}
+}
+
+//+kubebuilder:webhook:path=/validate-actions-msft-isd-coe-io-v1beta1-database,mutating=false,failurePolicy=fail,sideEffects=None,groups=actions.msft.isd.coe.io,resources=databases,verbs=create;update;delete,versions=v1beta1,name=vdatabase.kb.io,admissionReviewVersions={v1,v1beta1}
+
+var _ webhook.Validator = &Database{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *Database) ValidateCreate() error {
+	databaselog.Info("validate create", "name", r.Name)
+
+	return r.invalid(r.validateSpec())
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *Database) ValidateUpdate(old runtime.Object) error {
+	databaselog.Info("validate update", "name", r.Name)
+
+	curr, ok := old.(*Database)
+	if !ok || curr == nil {
+		return fmt.Errorf("could not convert runtime.Object to Database")
+	}
+
+	// the finalizer of a deleted Database must always be removable, even if it no longer passes validation
+	if !r.DeletionTimestamp.IsZero() {
+		return nil
+	}
+
+	allErrs := r.validateSpec()
+	specPath := field.NewPath("spec")
+	if r.Spec.Name != curr.Spec.Name {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("name"), r.Spec.Name, "cannot rename the database"))
+	}
+	if r.Spec.Options.Collation != curr.Spec.Options.Collation {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("options", "collation"), r.Spec.Options.Collation, "cannot change the collation of the database"))
+	}
+	return r.invalid(allErrs)
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *Database) ValidateDelete() error {
+	databaselog.Info("validate delete", "name", r.Name)
+
+	if r.DeletionProtected() {
+		return apierrors.NewForbidden(GroupVersion.WithResource("databases").GroupResource(), r.Name,
+			fmt.Errorf("deletion protection is enabled, clear spec.deletionProtection and the %s annotation first", DeletionProtectionAnnotation))
+	}
+	return nil
+}
+
+// DeletionProtected whether spec.deletionProtection or the deletion protection annotation is set
+func (r *Database) DeletionProtected() bool {
+	return r.Spec.DeletionProtection || annotationTrue(r.Annotations, DeletionProtectionAnnotation)
+}
+
+// annotationTrue whether the annotation is set to true
+func annotationTrue(annotations map[string]string, key string) bool {
+	return strings.EqualFold(annotations[key], "true")
+}
+
+// validateSpec checks the spec with the same rules the T-SQL builders apply so an invalid Database is
+// refused at admission instead of failing in Reconcile
+func (r *Database) validateSpec() field.ErrorList {
+	var allErrs field.ErrorList
+	specPath := field.NewPath("spec")
+
+	if err := validation.ValidateIdentifier(r.Spec.Name); err != nil {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("name"), r.Spec.Name, err.Error()))
+	} else if reservedDatabaseNames[strings.ToLower(r.Spec.Name)] {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("name"), fmt.Sprintf("%s is a system database", r.Spec.Name)))
+	}
+	allErrs = append(allErrs, validateConnection(&r.Spec.Connection, specPath.Child("connection"))...)
+	allErrs = append(allErrs, validateOptions(&r.Spec.Options, specPath.Child("options"))...)
+	if r.Spec.Sync.Schedule != "" {
+		if _, err := validation.ParseSchedule(r.Spec.Sync.Schedule); err != nil {
+			allErrs = append(allErrs, field.Invalid(specPath.Child("sync", "schedule"), r.Spec.Sync.Schedule, err.Error()))
+		}
+	}
+	if r.Spec.SoftDeleteGracePeriod != nil && r.Spec.SoftDeleteGracePeriod.Duration < 0 {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("softDeleteGracePeriod"), r.Spec.SoftDeleteGracePeriod.Duration.String(), "cannot be negative"))
+	}
+	return allErrs
+}
+
+// validateConnection the instance is required, the port must be a tcp port and the secret keys must be set
+func validateConnection(connection *ConnectionSpec, path *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if connection.SQLManagedInstance == "" {
+		allErrs = append(allErrs, field.Required(path.Child("sqlManagedInstance"), "the sql managed instance hosting the database is required"))
+	}
+	if connection.Port != 0 && (connection.Port < 1 || connection.Port > 65535) {
+		allErrs = append(allErrs, field.Invalid(path.Child("port"), connection.Port, "must be between 1 and 65535"))
+	}
+	if connection.Credentials != nil {
+		credentialsPath := path.Child("credentials")
+		selectors := []struct {
+			name     string
+			selector corev1.SecretKeySelector
+		}{
+			{"username", connection.Credentials.Username},
+			{"password", connection.Credentials.Password},
+		}
+		for _, s := range selectors {
+			if s.selector.Name == "" {
+				allErrs = append(allErrs, field.Required(credentialsPath.Child(s.name, "name"), "the name of the secret is required"))
+			}
+			if s.selector.Key == "" {
+				allErrs = append(allErrs, field.Required(credentialsPath.Child(s.name, "key"), "the key within the secret is required"))
+			}
+		}
+	}
+	return allErrs
+}
+
+// validateOptions the options must be accepted by the T-SQL builders
+func validateOptions(options *DatabaseOptions, path *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if options.Collation != "" {
+		if err := validation.ValidateCollation(options.Collation); err != nil {
+			allErrs = append(allErrs, field.Invalid(path.Child("collation"), options.Collation, err.Error()))
+		}
+	}
+	if options.Parameterization != "" {
+		if err := validation.ValidateParameterization(options.Parameterization); err != nil {
+			allErrs = append(allErrs, field.NotSupported(path.Child("parameterization"), options.Parameterization, []string{"simple", "forced"}))
+		}
+	}
+	if options.CompatibilityLevel != 0 {
+		if err := validation.ValidateCompatibilityLevel(options.CompatibilityLevel); err != nil {
+			allErrs = append(allErrs, field.NotSupported(path.Child("compatibilityLevel"), options.CompatibilityLevel, validation.CompatibilityLevels()))
+		}
+	}
+	return allErrs
+}
+
+// invalid the Invalid status error of the Database, nil when there are no errors
+func (r *Database) invalid(allErrs field.ErrorList) error {
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("Database").GroupKind(), r.Name, allErrs)
+}
@@ -0,0 +1,144 @@
+package v1beta1
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newValidDatabase() *Database {
+	return &Database{
+		ObjectMeta: metav1.ObjectMeta{Name: "database", Namespace: "default"},
+		Spec: DatabaseSpec{
+			Name: "Database",
+			Connection: ConnectionSpec{
+				SQLManagedInstance: "sqlmi",
+				Port:               1433,
+			},
+			Options: DatabaseOptions{
+				Collation:          "SQL_Latin1_General_CP1_CI_AS",
+				Parameterization:   "forced",
+				CompatibilityLevel: 150,
+			},
+			Sync: SyncSpec{Schedule: "*/30 * * * *"},
+		},
+	}
+}
+
+func TestDatabaseDefault(t *testing.T) {
+	db := &Database{Spec: DatabaseSpec{Name: "Database", Connection: ConnectionSpec{SQLManagedInstance: "sqlmi"}}}
+	db.Default()
+	if db.Spec.Connection.Port != DefaultPort || db.Spec.Sync.Schedule != DefaultSchedule || db.Spec.Options.Parameterization != DefaultParameterization {
+		t.Errorf("unexpected defaults: %+v", db.Spec)
+	}
+	if err := db.ValidateCreate(); err != nil {
+		t.Errorf("expected the defaulted Database to be valid: %v", err)
+	}
+
+	db = newValidDatabase()
+	db.Default()
+	if db.Spec.Sync.Schedule != "*/30 * * * *" || db.Spec.Options.Parameterization != "forced" {
+		t.Errorf("expected the values of the spec to be kept: %+v", db.Spec)
+	}
+}
+
+func TestDatabaseValidateCreate(t *testing.T) {
+	if err := newValidDatabase().ValidateCreate(); err != nil {
+		t.Fatalf("expected the Database to be valid: %v", err)
+	}
+
+	tests := []struct {
+		field  string
+		modify func(*DatabaseSpec)
+	}{
+		{"spec.name", func(s *DatabaseSpec) { s.Name = "" }},
+		{"spec.name", func(s *DatabaseSpec) { s.Name = strings.Repeat("a", 129) }},
+		{"spec.name", func(s *DatabaseSpec) { s.Name = "master" }},
+		{"spec.name", func(s *DatabaseSpec) { s.Name = "TempDB" }},
+		{"spec.connection.sqlManagedInstance", func(s *DatabaseSpec) { s.Connection.SQLManagedInstance = "" }},
+		{"spec.connection.port", func(s *DatabaseSpec) { s.Connection.Port = 70000 }},
+		{"spec.connection.port", func(s *DatabaseSpec) { s.Connection.Port = -1 }},
+		{"spec.connection.credentials.password.key", func(s *DatabaseSpec) {
+			s.Connection.Credentials = &Credentials{
+				Username: corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "login"}, Key: "username"},
+				Password: corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "login"}},
+			}
+		}},
+		{"spec.options.collation", func(s *DatabaseSpec) { s.Options.Collation = "Latin1_General_CI_AS; DROP DATABASE x" }},
+		{"spec.options.parameterization", func(s *DatabaseSpec) { s.Options.Parameterization = "sometimes" }},
+		{"spec.options.compatibilityLevel", func(s *DatabaseSpec) { s.Options.CompatibilityLevel = 90 }},
+		{"spec.sync.schedule", func(s *DatabaseSpec) { s.Sync.Schedule = "every day" }},
+		{"spec.sync.schedule", func(s *DatabaseSpec) { s.Sync.Schedule = "0 25 * * *" }},
+		{"spec.softDeleteGracePeriod", func(s *DatabaseSpec) { s.SoftDeleteGracePeriod = &metav1.Duration{Duration: -time.Hour} }},
+	}
+	for _, tt := range tests {
+		db := newValidDatabase()
+		tt.modify(&db.Spec)
+		err := db.ValidateCreate()
+		if !apierrors.IsInvalid(err) {
+			t.Errorf("expected %s to be invalid for %+v, got %v", tt.field, db.Spec, err)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.field) {
+			t.Errorf("expected the error to name %s: %v", tt.field, err)
+		}
+	}
+}
+
+func TestDatabaseValidateUpdate(t *testing.T) {
+	old := newValidDatabase()
+
+	db := newValidDatabase()
+	db.Spec.Options.CompatibilityLevel = 160
+	if err := db.ValidateUpdate(old); err != nil {
+		t.Errorf("expected the compatibility level to be changeable: %v", err)
+	}
+
+	db = newValidDatabase()
+	db.Spec.Name = "Renamed"
+	db.Spec.Options.Collation = "Latin1_General_CS_AS"
+	err := db.ValidateUpdate(old)
+	if !apierrors.IsInvalid(err) || !strings.Contains(err.Error(), "spec.name") || !strings.Contains(err.Error(), "spec.options.collation") {
+		t.Errorf("expected the rename and the collation change to be refused: %v", err)
+	}
+}
+
+func TestDatabaseValidateDelete(t *testing.T) {
+	db := newValidDatabase()
+	if err := db.ValidateDelete(); err != nil {
+		t.Errorf("expected an unprotected Database to be deletable: %v", err)
+	}
+
+	db.Spec.DeletionProtection = true
+	if err := db.ValidateDelete(); !apierrors.IsForbidden(err) {
+		t.Errorf("expected spec.deletionProtection to refuse the deletion, got %v", err)
+	}
+
+	db = newValidDatabase()
+	db.Annotations = map[string]string{DeletionProtectionAnnotation: "True"}
+	if err := db.ValidateDelete(); !apierrors.IsForbidden(err) {
+		t.Errorf("expected the annotation to refuse the deletion, got %v", err)
+	}
+
+	db.Annotations[DeletionProtectionAnnotation] = "false"
+	if err := db.ValidateDelete(); err != nil {
+		t.Errorf("expected a cleared annotation to allow the deletion: %v", err)
+	}
+}
+
+func TestDatabaseValidateUpdateOfDeletedDatabase(t *testing.T) {
+	old := newValidDatabase()
+	old.Spec.Sync.Schedule = "not a schedule"
+	now := metav1.Now()
+	old.DeletionTimestamp = &now
+
+	db := old.DeepCopy()
+	db.Finalizers = nil
+	if err := db.ValidateUpdate(old); err != nil {
+		t.Errorf("expected the finalizer of a deleted Database to be removable: %v", err)
+	}
+}
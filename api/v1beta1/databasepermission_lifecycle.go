@@ -0,0 +1,84 @@
+package v1beta1
+
+import (
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Condition types of a DatabasePermission
+const (
+	// DatabasePermissionConditionReady the permissions of the principal match the spec, it is True when
+	// DatabaseReady and Synced are True
+	DatabasePermissionConditionReady string = ConditionReady
+	// DatabasePermissionConditionDatabaseReady the Database of the permissions is ready and its sql managed
+	// instance is reachable
+	DatabasePermissionConditionDatabaseReady string = ConditionDatabaseReady
+	// DatabasePermissionConditionSynced the last reconcile granted, denied and revoked the permissions of the spec
+	DatabasePermissionConditionSynced string = ConditionSynced
+)
+
+// Condition reasons of a DatabasePermission
+const (
+	// DatabasePermissionReasonDatabaseReady DatabaseReady is True
+	DatabasePermissionReasonDatabaseReady string = "DatabaseReady"
+	// DatabasePermissionReasonDatabaseNotFound DatabaseReady is False, the Database of the permissions does not
+	// exist
+	DatabasePermissionReasonDatabaseNotFound string = "DatabaseNotFound"
+	// DatabasePermissionReasonDatabaseNotReady DatabaseReady is False, the Database of the permissions is not ready
+	DatabasePermissionReasonDatabaseNotReady string = "DatabaseNotReady"
+	// DatabasePermissionReasonInstanceNotReady DatabaseReady is False, the instance is not in a `Ready` state
+	DatabasePermissionReasonInstanceNotReady string = "InstanceNotReady"
+	// DatabasePermissionReasonInstanceNotFound DatabaseReady is False, the instance could not be read
+	DatabasePermissionReasonInstanceNotFound string = "InstanceNotFound"
+	// DatabasePermissionReasonCredentialsNotFound Synced is False, the sql login of the connection could not be
+	// read
+	DatabasePermissionReasonCredentialsNotFound string = "CredentialsNotFound"
+	// DatabasePermissionReasonSynced Synced is True, the permissions of the principal were compared with the spec
+	// and applied where needed
+	DatabasePermissionReasonSynced string = "PermissionsSynced"
+	// DatabasePermissionReasonSyncFailed Synced is False, reading or applying the permissions failed
+	DatabasePermissionReasonSyncFailed string = "SyncFailed"
+	// DatabasePermissionReasonReady Ready is True
+	DatabasePermissionReasonReady string = "PermissionsReady"
+	// DatabasePermissionReasonNotReady Ready is False, the message names the condition that is not True
+	DatabasePermissionReasonNotReady string = "PermissionsNotReady"
+)
+
+// databasePermissionReadiness Ready is True when the database is ready and the permissions are synced
+var databasePermissionReadiness = dependentReadiness(DatabasePermissionReasonReady, "Permissions are ready", DatabasePermissionReasonNotReady,
+	"Permissions are not synced")
+
+// SetCondition sets the condition for the current generation of the DatabasePermission and recomputes Ready
+func (p *DatabasePermission) SetCondition(conditionType string, status metav1.ConditionStatus, reason, message string) {
+	databasePermissionReadiness.setCondition(&p.Status.Conditions, p.Generation, conditionType, status, reason, message)
+}
+
+// IsConditionTrue whether the condition is set and True
+func (p *DatabasePermission) IsConditionTrue(conditionType string) bool {
+	return meta.IsStatusConditionTrue(p.Status.Conditions, conditionType)
+}
+
+// IsReady whether the Ready condition is True
+func (p *DatabasePermission) IsReady() bool {
+	return p.IsConditionTrue(DatabasePermissionConditionReady)
+}
+
+// MarkDatabaseReady sets DatabaseReady to True
+func (p *DatabasePermission) MarkDatabaseReady() {
+	p.SetCondition(DatabasePermissionConditionDatabaseReady, metav1.ConditionTrue, DatabasePermissionReasonDatabaseReady, "Database is ready")
+}
+
+// MarkDatabaseNotReady sets DatabaseReady to False
+func (p *DatabasePermission) MarkDatabaseNotReady(reason, message string) {
+	p.SetCondition(DatabasePermissionConditionDatabaseReady, metav1.ConditionFalse, reason, message)
+}
+
+// MarkSynced sets Synced to True
+func (p *DatabasePermission) MarkSynced(reason, message string) {
+	p.SetCondition(DatabasePermissionConditionSynced, metav1.ConditionTrue, reason, message)
+}
+
+// MarkSyncFailed sets Synced to False
+func (p *DatabasePermission) MarkSyncFailed(reason string, err error) {
+	p.SetCondition(DatabasePermissionConditionSynced, metav1.ConditionFalse, reason, err.Error())
+}
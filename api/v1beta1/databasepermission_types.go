@@ -0,0 +1,158 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PermissionState whether the permissions of an entry are granted or denied
+// +kubebuilder:validation:Enum=Grant;Deny
+type PermissionState string
+
+const (
+	// PermissionStateGrant GRANT the permissions
+	PermissionStateGrant PermissionState = "Grant"
+	// PermissionStateDeny DENY the permissions
+	PermissionStateDeny PermissionState = "Deny"
+)
+
+// SecurableType the class of the securable the permissions of an entry are on
+// +kubebuilder:validation:Enum=Database;Schema;Object
+type SecurableType string
+
+const (
+	// SecurableTypeDatabase the database of the Database
+	SecurableTypeDatabase SecurableType = "Database"
+	// SecurableTypeSchema a schema of the database
+	SecurableTypeSchema SecurableType = "Schema"
+	// SecurableTypeObject a table, view, function or procedure of the database
+	SecurableTypeObject SecurableType = "Object"
+)
+
+// Securable the database, a schema or an object of the database
+type Securable struct {
+	// Type of the securable
+	// +kubebuilder:default=Database
+	// +optional
+	Type SecurableType `json:"type,omitempty"`
+	// Schema the schema, or the schema of the object
+	// +kubebuilder:validation:MaxLength=128
+	// +optional
+	Schema string `json:"schema,omitempty"`
+	// Object the name of the object
+	// +kubebuilder:validation:MaxLength=128
+	// +optional
+	Object string `json:"object,omitempty"`
+}
+
+// PermissionEntry permissions granted or denied on a securable
+type PermissionEntry struct {
+	// State whether the permissions are granted or denied
+	// +kubebuilder:default=Grant
+	// +optional
+	State PermissionState `json:"state,omitempty"`
+	// Permissions the names of the permissions e.g. SELECT, EXECUTE or VIEW DEFINITION
+	// +kubebuilder:validation:MinItems=1
+	// +listType=set
+	Permissions []string `json:"permissions"`
+	// On the securable, the database when not set
+	// +optional
+	On Securable `json:"on,omitempty"`
+	// WithGrantOption lets the principal grant the permissions to other principals, only for Grant
+	// +optional
+	WithGrantOption bool `json:"withGrantOption,omitempty"`
+}
+
+// DatabasePermissionSpec defines the desired state of DatabasePermission
+type DatabasePermissionSpec struct {
+	// DatabaseRef the Database in the namespace of the DatabasePermission the permissions are applied in, the sql
+	// server is reached through the connection of the Database
+	DatabaseRef corev1.LocalObjectReference `json:"databaseRef"`
+	// Principal the name of the user or role of the database the permissions are granted or denied to
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=128
+	Principal string `json:"principal"`
+	// Permissions the full list of the permissions of the principal managed by the DatabasePermission, the
+	// permissions it applied that are no longer listed are revoked
+	// +kubebuilder:validation:MinItems=1
+	Permissions []PermissionEntry `json:"permissions"`
+}
+
+// ObservedPermission a row of sys.database_permissions
+type ObservedPermission struct {
+	// Principal the name of the grantee
+	Principal string `json:"principal,omitempty"`
+	// Class the class_desc of the securable: DATABASE, SCHEMA or OBJECT_OR_COLUMN
+	Class string `json:"class"`
+	// Schema the schema, or the schema of the object
+	Schema string `json:"schema,omitempty"`
+	// Object the name of the object
+	Object string `json:"object,omitempty"`
+	// Permission the permission_name
+	Permission string `json:"permission"`
+	// State the state_desc of the permission: GRANT, GRANT_WITH_GRANT_OPTION or DENY
+	State string `json:"state"`
+}
+
+// DatabasePermissionStatus defines the observed state of DatabasePermission
+type DatabasePermissionStatus struct {
+	// Applied the permissions granted or denied by the controller, they are revoked when they are no longer
+	// listed in the spec or when the DatabasePermission is deleted
+	Applied []ObservedPermission `json:"applied,omitempty"`
+	// Effective the permissions of the principal as last read from sys.database_permissions, including those
+	// granted outside of the DatabasePermission
+	Effective []ObservedPermission `json:"effective,omitempty"`
+	// ObservedGeneration the generation of the DatabasePermission last reconciled by the controller
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// LastSyncTime when the permissions were last read from the server
+	LastSyncTime *metav1.Time `json:"lastSyncTime,omitempty"`
+	// LastDrift when the permissions were last found drifted from the spec and applied again
+	LastDrift *metav1.Time `json:"lastDrift,omitempty"`
+	// Conditions the array of conditions of the object
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Principal",type=string,JSONPath=`.spec.principal`,description="Principal the permissions are granted or denied to"
+//+kubebuilder:printcolumn:name="Database",type=string,JSONPath=`.spec.databaseRef.name`,description="Database the permissions are applied in"
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`,description="Whether the permissions are applied"
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// DatabasePermission is the Schema for the databasepermissions API
+type DatabasePermission struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   DatabasePermissionSpec   `json:"spec,omitempty"`
+	Status DatabasePermissionStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// DatabasePermissionList contains a list of DatabasePermission
+type DatabasePermissionList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []DatabasePermission `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&DatabasePermission{}, &DatabasePermissionList{})
+}
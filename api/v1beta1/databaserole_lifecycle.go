@@ -0,0 +1,84 @@
+package v1beta1
+
+import (
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Condition types of a DatabaseRole
+const (
+	// DatabaseRoleConditionReady the role exists in the database and its membership matches the spec, it is True
+	// when DatabaseReady and Synced are True
+	DatabaseRoleConditionReady string = ConditionReady
+	// DatabaseRoleConditionDatabaseReady the Database of the role is ready and its sql managed instance is reachable
+	DatabaseRoleConditionDatabaseReady string = ConditionDatabaseReady
+	// DatabaseRoleConditionSynced the last reconcile created the role and changed its membership to the spec
+	DatabaseRoleConditionSynced string = ConditionSynced
+)
+
+// Condition reasons of a DatabaseRole
+const (
+	// DatabaseRoleReasonDatabaseReady DatabaseReady is True
+	DatabaseRoleReasonDatabaseReady string = "DatabaseReady"
+	// DatabaseRoleReasonDatabaseNotFound DatabaseReady is False, the Database of the role does not exist
+	DatabaseRoleReasonDatabaseNotFound string = "DatabaseNotFound"
+	// DatabaseRoleReasonDatabaseNotReady DatabaseReady is False, the Database of the role is not ready
+	DatabaseRoleReasonDatabaseNotReady string = "DatabaseNotReady"
+	// DatabaseRoleReasonInstanceNotReady DatabaseReady is False, the instance is not in a `Ready` state
+	DatabaseRoleReasonInstanceNotReady string = "InstanceNotReady"
+	// DatabaseRoleReasonInstanceNotFound DatabaseReady is False, the instance could not be read
+	DatabaseRoleReasonInstanceNotFound string = "InstanceNotFound"
+	// DatabaseRoleReasonCredentialsNotFound Synced is False, the sql login of the connection could not be read
+	DatabaseRoleReasonCredentialsNotFound string = "CredentialsNotFound"
+	// DatabaseRoleReasonCreated Synced is True, the role was created
+	DatabaseRoleReasonCreated string = "RoleCreated"
+	// DatabaseRoleReasonAdopted Synced is True, an existing role was adopted
+	DatabaseRoleReasonAdopted string = "RoleAdopted"
+	// DatabaseRoleReasonSynced Synced is True, the membership of the role was compared with the spec and changed
+	// where needed
+	DatabaseRoleReasonSynced string = "RoleSynced"
+	// DatabaseRoleReasonSyncFailed Synced is False, creating the role or changing its membership failed
+	DatabaseRoleReasonSyncFailed string = "SyncFailed"
+	// DatabaseRoleReasonReady Ready is True
+	DatabaseRoleReasonReady string = "RoleReady"
+	// DatabaseRoleReasonNotReady Ready is False, the message names the condition that is not True
+	DatabaseRoleReasonNotReady string = "RoleNotReady"
+)
+
+// databaseRoleReadiness Ready is True when the database is ready and the role is synced
+var databaseRoleReadiness = dependentReadiness(DatabaseRoleReasonReady, "Role is ready", DatabaseRoleReasonNotReady, "Role is not synced")
+
+// SetCondition sets the condition for the current generation of the DatabaseRole and recomputes Ready
+func (r *DatabaseRole) SetCondition(conditionType string, status metav1.ConditionStatus, reason, message string) {
+	databaseRoleReadiness.setCondition(&r.Status.Conditions, r.Generation, conditionType, status, reason, message)
+}
+
+// IsConditionTrue whether the condition is set and True
+func (r *DatabaseRole) IsConditionTrue(conditionType string) bool {
+	return meta.IsStatusConditionTrue(r.Status.Conditions, conditionType)
+}
+
+// IsReady whether the Ready condition is True
+func (r *DatabaseRole) IsReady() bool {
+	return r.IsConditionTrue(DatabaseRoleConditionReady)
+}
+
+// MarkDatabaseReady sets DatabaseReady to True
+func (r *DatabaseRole) MarkDatabaseReady() {
+	r.SetCondition(DatabaseRoleConditionDatabaseReady, metav1.ConditionTrue, DatabaseRoleReasonDatabaseReady, "Database is ready")
+}
+
+// MarkDatabaseNotReady sets DatabaseReady to False
+func (r *DatabaseRole) MarkDatabaseNotReady(reason, message string) {
+	r.SetCondition(DatabaseRoleConditionDatabaseReady, metav1.ConditionFalse, reason, message)
+}
+
+// MarkSynced sets Synced to True
+func (r *DatabaseRole) MarkSynced(reason, message string) {
+	r.SetCondition(DatabaseRoleConditionSynced, metav1.ConditionTrue, reason, message)
+}
+
+// MarkSyncFailed sets Synced to False
+func (r *DatabaseRole) MarkSyncFailed(reason string, err error) {
+	r.SetCondition(DatabaseRoleConditionSynced, metav1.ConditionFalse, reason, err.Error())
+}
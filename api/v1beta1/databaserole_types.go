@@ -0,0 +1,98 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DatabaseRoleSpec defines the desired state of DatabaseRole
+type DatabaseRoleSpec struct {
+	// Name of the role in the database, the fixed roles cannot be managed, a role is added to them with memberOf
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=128
+	Name string `json:"name"`
+	// DatabaseRef the Database in the namespace of the DatabaseRole the role is created in, the sql server is
+	// reached through the connection of the Database
+	DatabaseRef corev1.LocalObjectReference `json:"databaseRef"`
+	// Members the full list of the users and roles that are members of the role, members that are not listed are
+	// dropped from the role unless another DatabaseRole of the Database lists the role in its memberOf
+	// +listType=set
+	Members []string `json:"members,omitempty"`
+	// MemberOf the full list of the roles the role is a member of, fixed roles such as db_datareader and
+	// db_datawriter included, the role is dropped from the roles that are not listed unless another DatabaseRole
+	// of the Database lists the role in its members
+	// +listType=set
+	MemberOf []string `json:"memberOf,omitempty"`
+	// AdoptExisting takes over the management of a role that already exists in the database instead of failing to
+	// create it, the membership of the adopted role is changed to the spec
+	AdoptExisting bool `json:"adoptExisting,omitempty"`
+}
+
+// DatabaseRoleStatus defines the observed state of DatabaseRole
+type DatabaseRoleStatus struct {
+	// PrincipalID principal_id of the role in the database
+	PrincipalID int `json:"principalID,omitempty"`
+	// Owner name of the principal owning the role
+	Owner string `json:"owner,omitempty"`
+	// CreateDate when the role was created
+	CreateDate *metav1.Time `json:"createDate,omitempty"`
+	// Members the members of the role as last read from sys.database_role_members
+	Members []string `json:"members,omitempty"`
+	// MemberOf the roles the role is a member of as last read from sys.database_role_members
+	MemberOf []string `json:"memberOf,omitempty"`
+	// ObservedGeneration the generation of the DatabaseRole last reconciled by the controller
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// LastSyncTime when the role was last read from the server
+	LastSyncTime *metav1.Time `json:"lastSyncTime,omitempty"`
+	// LastDrift when the membership of the role was last found drifted from the spec and changed back
+	LastDrift *metav1.Time `json:"lastDrift,omitempty"`
+	// Conditions the array of conditions of the object
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Role Name",type=string,JSONPath=`.spec.name`,description="Name of the role in the database"
+//+kubebuilder:printcolumn:name="Database",type=string,JSONPath=`.spec.databaseRef.name`,description="Database the role is created in"
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`,description="Whether the role is ready"
+//+kubebuilder:printcolumn:name="Members",type=string,JSONPath=`.status.members`,description="Members of the role",priority=1
+//+kubebuilder:printcolumn:name="Member Of",type=string,JSONPath=`.status.memberOf`,description="Roles the role is a member of",priority=1
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// DatabaseRole is the Schema for the databaseroles API
+type DatabaseRole struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   DatabaseRoleSpec   `json:"spec,omitempty"`
+	Status DatabaseRoleStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// DatabaseRoleList contains a list of DatabaseRole
+type DatabaseRoleList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []DatabaseRole `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&DatabaseRole{}, &DatabaseRoleList{})
+}
@@ -0,0 +1,87 @@
+package v1beta1
+
+import (
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Condition types of a DatabaseSchema
+const (
+	// DatabaseSchemaConditionReady the schema exists in the database and is owned as declared, it is True when
+	// DatabaseReady and Synced are True
+	DatabaseSchemaConditionReady string = ConditionReady
+	// DatabaseSchemaConditionDatabaseReady the Database of the schema is ready and its sql managed instance is
+	// reachable
+	DatabaseSchemaConditionDatabaseReady string = ConditionDatabaseReady
+	// DatabaseSchemaConditionSynced the last reconcile created the schema and transferred its ownership to the spec
+	DatabaseSchemaConditionSynced string = ConditionSynced
+)
+
+// Condition reasons of a DatabaseSchema
+const (
+	// DatabaseSchemaReasonDatabaseReady DatabaseReady is True
+	DatabaseSchemaReasonDatabaseReady string = "DatabaseReady"
+	// DatabaseSchemaReasonDatabaseNotFound DatabaseReady is False, the Database of the schema does not exist
+	DatabaseSchemaReasonDatabaseNotFound string = "DatabaseNotFound"
+	// DatabaseSchemaReasonDatabaseNotReady DatabaseReady is False, the Database of the schema is not ready
+	DatabaseSchemaReasonDatabaseNotReady string = "DatabaseNotReady"
+	// DatabaseSchemaReasonInstanceNotReady DatabaseReady is False, the instance is not in a `Ready` state
+	DatabaseSchemaReasonInstanceNotReady string = "InstanceNotReady"
+	// DatabaseSchemaReasonInstanceNotFound DatabaseReady is False, the instance could not be read
+	DatabaseSchemaReasonInstanceNotFound string = "InstanceNotFound"
+	// DatabaseSchemaReasonCredentialsNotFound Synced is False, the sql login of the connection could not be read
+	DatabaseSchemaReasonCredentialsNotFound string = "CredentialsNotFound"
+	// DatabaseSchemaReasonCreated Synced is True, the schema was created
+	DatabaseSchemaReasonCreated string = "SchemaCreated"
+	// DatabaseSchemaReasonAdopted Synced is True, an existing schema was adopted
+	DatabaseSchemaReasonAdopted string = "SchemaAdopted"
+	// DatabaseSchemaReasonSynced Synced is True, the owner of the schema was compared with the spec and changed
+	// where needed
+	DatabaseSchemaReasonSynced string = "SchemaSynced"
+	// DatabaseSchemaReasonSyncFailed Synced is False, creating the schema or changing its owner failed
+	DatabaseSchemaReasonSyncFailed string = "SyncFailed"
+	// DatabaseSchemaReasonNotEmpty Synced is False, the deleted schema still contains objects and is not dropped
+	DatabaseSchemaReasonNotEmpty string = "SchemaNotEmpty"
+	// DatabaseSchemaReasonReady Ready is True
+	DatabaseSchemaReasonReady string = "SchemaReady"
+	// DatabaseSchemaReasonNotReady Ready is False, the message names the condition that is not True
+	DatabaseSchemaReasonNotReady string = "SchemaNotReady"
+)
+
+// databaseSchemaReadiness Ready is True when the database is ready and the schema is synced
+var databaseSchemaReadiness = dependentReadiness(DatabaseSchemaReasonReady, "Schema is ready", DatabaseSchemaReasonNotReady, "Schema is not synced")
+
+// SetCondition sets the condition for the current generation of the DatabaseSchema and recomputes Ready
+func (s *DatabaseSchema) SetCondition(conditionType string, status metav1.ConditionStatus, reason, message string) {
+	databaseSchemaReadiness.setCondition(&s.Status.Conditions, s.Generation, conditionType, status, reason, message)
+}
+
+// IsConditionTrue whether the condition is set and True
+func (s *DatabaseSchema) IsConditionTrue(conditionType string) bool {
+	return meta.IsStatusConditionTrue(s.Status.Conditions, conditionType)
+}
+
+// IsReady whether the Ready condition is True
+func (s *DatabaseSchema) IsReady() bool {
+	return s.IsConditionTrue(DatabaseSchemaConditionReady)
+}
+
+// MarkDatabaseReady sets DatabaseReady to True
+func (s *DatabaseSchema) MarkDatabaseReady() {
+	s.SetCondition(DatabaseSchemaConditionDatabaseReady, metav1.ConditionTrue, DatabaseSchemaReasonDatabaseReady, "Database is ready")
+}
+
+// MarkDatabaseNotReady sets DatabaseReady to False
+func (s *DatabaseSchema) MarkDatabaseNotReady(reason, message string) {
+	s.SetCondition(DatabaseSchemaConditionDatabaseReady, metav1.ConditionFalse, reason, message)
+}
+
+// MarkSynced sets Synced to True
+func (s *DatabaseSchema) MarkSynced(reason, message string) {
+	s.SetCondition(DatabaseSchemaConditionSynced, metav1.ConditionTrue, reason, message)
+}
+
+// MarkSyncFailed sets Synced to False
+func (s *DatabaseSchema) MarkSyncFailed(reason string, err error) {
+	s.SetCondition(DatabaseSchemaConditionSynced, metav1.ConditionFalse, reason, err.Error())
+}
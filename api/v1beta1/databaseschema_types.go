@@ -0,0 +1,91 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DatabaseSchemaSpec defines the desired state of DatabaseSchema
+type DatabaseSchemaSpec struct {
+	// Name of the schema in the database, the built-in schemas such as dbo and sys cannot be managed
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=128
+	Name string `json:"name"`
+	// DatabaseRef the Database in the namespace of the DatabaseSchema the schema is created in, the sql server is
+	// reached through the connection of the Database
+	DatabaseRef corev1.LocalObjectReference `json:"databaseRef"`
+	// Owner the user or role the schema is authorized to, the ownership is transferred back to it when it changes.
+	// The schema is owned by dbo when not set and its owner is then left alone
+	// +kubebuilder:validation:MaxLength=128
+	// +optional
+	Owner string `json:"owner,omitempty"`
+	// AdoptExisting takes over the management of a schema that already exists in the database instead of failing
+	// to create it, the owner of the adopted schema is changed to the spec
+	AdoptExisting bool `json:"adoptExisting,omitempty"`
+}
+
+// DatabaseSchemaStatus defines the observed state of DatabaseSchema
+type DatabaseSchemaStatus struct {
+	// SchemaID schema_id of the schema in the database
+	SchemaID int `json:"schemaID,omitempty"`
+	// Owner name of the principal owning the schema
+	Owner string `json:"owner,omitempty"`
+	// ObjectCount the number of tables, views, procedures and other objects in the schema, a schema is only dropped
+	// once it is empty
+	ObjectCount int `json:"objectCount"`
+	// ObservedGeneration the generation of the DatabaseSchema last reconciled by the controller
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// LastSyncTime when the schema was last read from the server
+	LastSyncTime *metav1.Time `json:"lastSyncTime,omitempty"`
+	// LastDrift when the owner of the schema was last found drifted from the spec and changed back
+	LastDrift *metav1.Time `json:"lastDrift,omitempty"`
+	// Conditions the array of conditions of the object
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Schema Name",type=string,JSONPath=`.spec.name`,description="Name of the schema in the database"
+//+kubebuilder:printcolumn:name="Database",type=string,JSONPath=`.spec.databaseRef.name`,description="Database the schema is created in"
+//+kubebuilder:printcolumn:name="Owner",type=string,JSONPath=`.status.owner`,description="Principal owning the schema"
+//+kubebuilder:printcolumn:name="Objects",type=integer,JSONPath=`.status.objectCount`,description="Number of objects in the schema"
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`,description="Whether the schema is ready"
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// DatabaseSchema is the Schema for the databaseschemas API
+type DatabaseSchema struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   DatabaseSchemaSpec   `json:"spec,omitempty"`
+	Status DatabaseSchemaStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// DatabaseSchemaList contains a list of DatabaseSchema
+type DatabaseSchemaList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []DatabaseSchema `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&DatabaseSchema{}, &DatabaseSchemaList{})
+}
@@ -0,0 +1,86 @@
+package v1beta1
+
+import (
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Condition types of a DatabaseUser
+const (
+	// DatabaseUserConditionReady the user exists in the database and matches the spec, it is True when
+	// DatabaseReady and Synced are True
+	DatabaseUserConditionReady string = ConditionReady
+	// DatabaseUserConditionDatabaseReady the Database of the user is ready and its sql managed instance is reachable
+	DatabaseUserConditionDatabaseReady string = ConditionDatabaseReady
+	// DatabaseUserConditionSynced the last reconcile created or altered the user to the spec
+	DatabaseUserConditionSynced string = ConditionSynced
+)
+
+// Condition reasons of a DatabaseUser
+const (
+	// DatabaseUserReasonDatabaseReady DatabaseReady is True
+	DatabaseUserReasonDatabaseReady string = "DatabaseReady"
+	// DatabaseUserReasonDatabaseNotFound DatabaseReady is False, the Database of the user does not exist
+	DatabaseUserReasonDatabaseNotFound string = "DatabaseNotFound"
+	// DatabaseUserReasonDatabaseNotReady DatabaseReady is False, the Database of the user is not ready
+	DatabaseUserReasonDatabaseNotReady string = "DatabaseNotReady"
+	// DatabaseUserReasonInstanceNotReady DatabaseReady is False, the instance is not in a `Ready` state
+	DatabaseUserReasonInstanceNotReady string = "InstanceNotReady"
+	// DatabaseUserReasonInstanceNotFound DatabaseReady is False, the instance could not be read
+	DatabaseUserReasonInstanceNotFound string = "InstanceNotFound"
+	// DatabaseUserReasonCredentialsNotFound Synced is False, the sql login of the connection could not be read
+	DatabaseUserReasonCredentialsNotFound string = "CredentialsNotFound"
+	// DatabaseUserReasonPasswordNotFound Synced is False, the password of a contained user could not be read from
+	// its secret
+	DatabaseUserReasonPasswordNotFound string = "PasswordNotFound"
+	// DatabaseUserReasonCreated Synced is True, the user was created
+	DatabaseUserReasonCreated string = "UserCreated"
+	// DatabaseUserReasonAdopted Synced is True, an existing user was adopted
+	DatabaseUserReasonAdopted string = "UserAdopted"
+	// DatabaseUserReasonSynced Synced is True, the user was compared with the spec and altered where needed
+	DatabaseUserReasonSynced string = "UserSynced"
+	// DatabaseUserReasonSyncFailed Synced is False, creating or altering the user failed
+	DatabaseUserReasonSyncFailed string = "SyncFailed"
+	// DatabaseUserReasonReady Ready is True
+	DatabaseUserReasonReady string = "UserReady"
+	// DatabaseUserReasonNotReady Ready is False, the message names the condition that is not True
+	DatabaseUserReasonNotReady string = "UserNotReady"
+)
+
+// databaseUserReadiness Ready is True when the database is ready and the user is synced
+var databaseUserReadiness = dependentReadiness(DatabaseUserReasonReady, "User is ready", DatabaseUserReasonNotReady, "User is not synced")
+
+// SetCondition sets the condition for the current generation of the DatabaseUser and recomputes Ready
+func (u *DatabaseUser) SetCondition(conditionType string, status metav1.ConditionStatus, reason, message string) {
+	databaseUserReadiness.setCondition(&u.Status.Conditions, u.Generation, conditionType, status, reason, message)
+}
+
+// IsConditionTrue whether the condition is set and True
+func (u *DatabaseUser) IsConditionTrue(conditionType string) bool {
+	return meta.IsStatusConditionTrue(u.Status.Conditions, conditionType)
+}
+
+// IsReady whether the Ready condition is True
+func (u *DatabaseUser) IsReady() bool {
+	return u.IsConditionTrue(DatabaseUserConditionReady)
+}
+
+// MarkDatabaseReady sets DatabaseReady to True
+func (u *DatabaseUser) MarkDatabaseReady() {
+	u.SetCondition(DatabaseUserConditionDatabaseReady, metav1.ConditionTrue, DatabaseUserReasonDatabaseReady, "Database is ready")
+}
+
+// MarkDatabaseNotReady sets DatabaseReady to False
+func (u *DatabaseUser) MarkDatabaseNotReady(reason, message string) {
+	u.SetCondition(DatabaseUserConditionDatabaseReady, metav1.ConditionFalse, reason, message)
+}
+
+// MarkSynced sets Synced to True
+func (u *DatabaseUser) MarkSynced(reason, message string) {
+	u.SetCondition(DatabaseUserConditionSynced, metav1.ConditionTrue, reason, message)
+}
+
+// MarkSyncFailed sets Synced to False
+func (u *DatabaseUser) MarkSyncFailed(reason string, err error) {
+	u.SetCondition(DatabaseUserConditionSynced, metav1.ConditionFalse, reason, err.Error())
+}
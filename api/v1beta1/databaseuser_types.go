@@ -0,0 +1,127 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// UserType how a database user authenticates
+// +kubebuilder:validation:Enum=Login;WithoutLogin;Contained
+type UserType string
+
+const (
+	// UserTypeLogin the user is mapped to a sql login, CREATE USER ... FOR LOGIN
+	UserTypeLogin UserType = "Login"
+	// UserTypeWithoutLogin the user cannot connect, CREATE USER ... WITHOUT LOGIN, it can own schemas and be
+	// impersonated
+	UserTypeWithoutLogin UserType = "WithoutLogin"
+	// UserTypeContained the user connects to the database with its own password, CREATE USER ... WITH PASSWORD, the
+	// database must be contained
+	UserTypeContained UserType = "Contained"
+)
+
+// DatabaseUserSpec defines the desired state of DatabaseUser
+type DatabaseUserSpec struct {
+	// Name of the user in the database
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=128
+	Name string `json:"name"`
+	// DatabaseRef the Database in the namespace of the DatabaseUser the user is created in, the sql server is
+	// reached through the connection of the Database
+	DatabaseRef corev1.LocalObjectReference `json:"databaseRef"`
+	// Type how the user authenticates, defaults to Login
+	// +kubebuilder:default=Login
+	Type UserType `json:"type,omitempty"`
+	// Login name of the sql login the user is mapped to, required by the Login type only
+	Login string `json:"login,omitempty"`
+	// Password selects the password of the user from a secret in the namespace of the DatabaseUser, required by
+	// the Contained type only, the user is altered to the new password when the secret changes
+	Password *corev1.SecretKeySelector `json:"password,omitempty"`
+	// DefaultSchema the schema of the objects the user names without a schema, defaults to dbo
+	// +kubebuilder:default=dbo
+	DefaultSchema string `json:"defaultSchema,omitempty"`
+	// AdoptExisting takes over the management of a user that already exists in the database instead of failing to
+	// create it, the adopted user is altered to the spec
+	AdoptExisting bool `json:"adoptExisting,omitempty"`
+}
+
+// ObservedDatabaseUser the user as last read from sys.database_principals
+type ObservedDatabaseUser struct {
+	// AuthenticationType authentication_type_desc of the user, INSTANCE, DATABASE or NONE
+	AuthenticationType string `json:"authenticationType,omitempty"`
+	// Login name of the login with the sid of the user
+	Login string `json:"login,omitempty"`
+	// DefaultSchema default_schema_name of the user
+	DefaultSchema string `json:"defaultSchema,omitempty"`
+	// CreateDate when the user was created
+	CreateDate *metav1.Time `json:"createDate,omitempty"`
+}
+
+// DatabaseUserStatus defines the observed state of DatabaseUser
+type DatabaseUserStatus struct {
+	// SID security identifier of the user as a hex string, the sid of the login for a user mapped to a login
+	SID string `json:"sid,omitempty"`
+	// PrincipalID principal_id of the user in the database
+	PrincipalID int `json:"principalID,omitempty"`
+	// ObservedGeneration the generation of the DatabaseUser last reconciled by the controller
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Observed the user as last read from the server
+	Observed *ObservedDatabaseUser `json:"observed,omitempty"`
+	// PasswordVersion resourceVersion of the password secret last set on a contained user, the password cannot be
+	// read back from the server so it is set again whenever the secret changes
+	PasswordVersion string `json:"passwordVersion,omitempty"`
+	// LastSyncTime when the user was last read from the server
+	LastSyncTime *metav1.Time `json:"lastSyncTime,omitempty"`
+	// LastDrift when the user was last found drifted from the spec and altered back
+	LastDrift *metav1.Time `json:"lastDrift,omitempty"`
+	// Conditions the array of conditions of the object
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="User Name",type=string,JSONPath=`.spec.name`,description="Name of the user in the database"
+//+kubebuilder:printcolumn:name="Database",type=string,JSONPath=`.spec.databaseRef.name`,description="Database the user is created in"
+//+kubebuilder:printcolumn:name="Type",type=string,JSONPath=`.spec.type`,description="How the user authenticates"
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`,description="Whether the user is ready"
+//+kubebuilder:printcolumn:name="SID",type=string,JSONPath=`.status.sid`,description="Security identifier of the user",priority=1
+//+kubebuilder:printcolumn:name="Principal ID",type=integer,JSONPath=`.status.principalID`,description="principal_id of the user",priority=1
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// DatabaseUser is the Schema for the databaseusers API
+type DatabaseUser struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   DatabaseUserSpec   `json:"spec,omitempty"`
+	Status DatabaseUserStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// DatabaseUserList contains a list of DatabaseUser
+type DatabaseUserList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []DatabaseUser `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&DatabaseUser{}, &DatabaseUserList{})
+}
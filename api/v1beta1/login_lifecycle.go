@@ -0,0 +1,89 @@
+package v1beta1
+
+import (
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Condition types of a Login
+const (
+	// LoginConditionReady the login exists on the server and matches the spec, it is True when InstanceReady and
+	// Synced are True
+	LoginConditionReady string = ConditionReady
+	// LoginConditionInstanceReady the sql managed instance hosting the login is in a `Ready` state
+	LoginConditionInstanceReady string = ConditionInstanceReady
+	// LoginConditionSynced the last reconcile created or altered the login to the spec
+	LoginConditionSynced string = ConditionSynced
+)
+
+// Condition reasons of a Login
+const (
+	// LoginReasonInstanceReady InstanceReady is True
+	LoginReasonInstanceReady string = "InstanceReady"
+	// LoginReasonInstanceNotReady InstanceReady is False, the instance is not in a `Ready` state
+	LoginReasonInstanceNotReady string = "InstanceNotReady"
+	// LoginReasonInstanceNotFound InstanceReady is False, the instance could not be read
+	LoginReasonInstanceNotFound string = "InstanceNotFound"
+	// LoginReasonCredentialsNotFound Synced is False, the sql login of the connection could not be read
+	LoginReasonCredentialsNotFound string = "CredentialsNotFound"
+	// LoginReasonPasswordNotFound Synced is False, the password of the Login could not be read from its secret
+	LoginReasonPasswordNotFound string = "PasswordNotFound"
+	// LoginReasonCreated Synced is True, the login was created
+	LoginReasonCreated string = "LoginCreated"
+	// LoginReasonAdopted Synced is True, an existing login was adopted
+	LoginReasonAdopted string = "LoginAdopted"
+	// LoginReasonSynced Synced is True, the login was compared with the spec and altered where needed
+	LoginReasonSynced string = "LoginSynced"
+	// LoginReasonSyncFailed Synced is False, creating or altering the login failed
+	LoginReasonSyncFailed string = "SyncFailed"
+	// LoginReasonReady Ready is True
+	LoginReasonReady string = "LoginReady"
+	// LoginReasonNotReady Ready is False, the message names the condition that is not True
+	LoginReasonNotReady string = "LoginNotReady"
+)
+
+// loginReadiness Ready is True when the instance is ready and the login is synced
+var loginReadiness = &readiness{
+	readyReason:    LoginReasonReady,
+	readyMessage:   "Login is ready",
+	notReadyReason: LoginReasonNotReady,
+	prerequisites: []readyPrerequisite{
+		{conditionType: LoginConditionInstanceReady, notReady: "SQL managed instance is not ready"},
+		{conditionType: LoginConditionSynced, notReady: "Login is not synced"},
+	},
+}
+
+// SetCondition sets the condition for the current generation of the Login and recomputes Ready
+func (l *Login) SetCondition(conditionType string, status metav1.ConditionStatus, reason, message string) {
+	loginReadiness.setCondition(&l.Status.Conditions, l.Generation, conditionType, status, reason, message)
+}
+
+// IsConditionTrue whether the condition is set and True
+func (l *Login) IsConditionTrue(conditionType string) bool {
+	return meta.IsStatusConditionTrue(l.Status.Conditions, conditionType)
+}
+
+// IsReady whether the Ready condition is True
+func (l *Login) IsReady() bool {
+	return l.IsConditionTrue(LoginConditionReady)
+}
+
+// MarkInstanceReady sets InstanceReady to True
+func (l *Login) MarkInstanceReady() {
+	l.SetCondition(LoginConditionInstanceReady, metav1.ConditionTrue, LoginReasonInstanceReady, "SQL managed instance is ready")
+}
+
+// MarkInstanceNotReady sets InstanceReady to False
+func (l *Login) MarkInstanceNotReady(reason, message string) {
+	l.SetCondition(LoginConditionInstanceReady, metav1.ConditionFalse, reason, message)
+}
+
+// MarkSynced sets Synced to True
+func (l *Login) MarkSynced(reason, message string) {
+	l.SetCondition(LoginConditionSynced, metav1.ConditionTrue, reason, message)
+}
+
+// MarkSyncFailed sets Synced to False
+func (l *Login) MarkSyncFailed(reason string, err error) {
+	l.SetCondition(LoginConditionSynced, metav1.ConditionFalse, reason, err.Error())
+}
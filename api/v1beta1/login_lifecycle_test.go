@@ -0,0 +1,35 @@
+package v1beta1
+
+import (
+	"fmt"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestLoginReadyCondition(t *testing.T) {
+	login := &Login{ObjectMeta: metav1.ObjectMeta{Generation: 2}}
+
+	login.MarkSynced(LoginReasonCreated, "Login was created")
+	if login.IsReady() {
+		t.Error("expected the login not to be ready before the instance is ready")
+	}
+	login.MarkInstanceReady()
+	if !login.IsReady() {
+		t.Fatal("expected the login to be ready")
+	}
+	ready := meta.FindStatusCondition(login.Status.Conditions, LoginConditionReady)
+	if ready.ObservedGeneration != 2 || ready.Reason != LoginReasonReady {
+		t.Errorf("unexpected Ready condition: %+v", ready)
+	}
+
+	login.MarkSyncFailed(LoginReasonPasswordNotFound, fmt.Errorf("secret not found"))
+	if login.IsReady() {
+		t.Error("expected a failed sync to flip Ready to False")
+	}
+	ready = meta.FindStatusCondition(login.Status.Conditions, LoginConditionReady)
+	if ready.Message != "Login is not synced" {
+		t.Errorf("unexpected Ready condition: %+v", ready)
+	}
+}
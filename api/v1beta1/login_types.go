@@ -0,0 +1,116 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// LoginSpec defines the desired state of Login
+type LoginSpec struct {
+	// Name of the sql login on the server
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=128
+	Name string `json:"name"`
+	// Connection how the sql server is reached
+	Connection ConnectionSpec `json:"connection"`
+	// Password selects the password of the login from a secret in the namespace of the Login, the login is
+	// altered to the new password when the secret changes
+	Password corev1.SecretKeySelector `json:"password"`
+	// DefaultDatabase the database the login connects to when the connection names none, defaults to master
+	// +kubebuilder:default=master
+	DefaultDatabase string `json:"defaultDatabase,omitempty"`
+	// DefaultLanguage name of the default language of the login as listed in sys.syslanguages, the server
+	// default is kept when not set
+	DefaultLanguage string `json:"defaultLanguage,omitempty"`
+	// CheckPolicy whether the password policy of the server applies to the login, defaults to true
+	// +kubebuilder:default=true
+	CheckPolicy *bool `json:"checkPolicy,omitempty"`
+	// CheckExpiration whether the password of the login expires, it can only be set along with CheckPolicy,
+	// defaults to false
+	// +kubebuilder:default=false
+	CheckExpiration *bool `json:"checkExpiration,omitempty"`
+	// AdoptExisting takes over the management of a login that already exists on the server instead of failing to
+	// create it, the adopted login is altered to the spec and its password is replaced
+	AdoptExisting bool `json:"adoptExisting,omitempty"`
+}
+
+// ObservedLogin the login as last read from sys.sql_logins
+type ObservedLogin struct {
+	// DefaultDatabase default_database_name of the login
+	DefaultDatabase string `json:"defaultDatabase,omitempty"`
+	// DefaultLanguage default_language_name of the login
+	DefaultLanguage string `json:"defaultLanguage,omitempty"`
+	// CheckPolicy whether the password policy applies to the login
+	CheckPolicy bool `json:"checkPolicy"`
+	// CheckExpiration whether the password of the login expires
+	CheckExpiration bool `json:"checkExpiration"`
+	// IsDisabled whether the login is disabled
+	IsDisabled bool `json:"isDisabled"`
+	// CreateDate when the login was created
+	CreateDate *metav1.Time `json:"createDate,omitempty"`
+}
+
+// LoginStatus defines the observed state of Login
+type LoginStatus struct {
+	// SID security identifier of the login as a hex string
+	SID string `json:"sid,omitempty"`
+	// PrincipalID principal_id of the login
+	PrincipalID int `json:"principalID,omitempty"`
+	// ObservedGeneration the generation of the Login last reconciled by the controller
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Observed the login as last read from the server
+	Observed *ObservedLogin `json:"observed,omitempty"`
+	// LastSyncTime when the login was last read from the server
+	LastSyncTime *metav1.Time `json:"lastSyncTime,omitempty"`
+	// LastDrift when the login was last found drifted from the spec and altered back
+	LastDrift *metav1.Time `json:"lastDrift,omitempty"`
+	// Conditions the array of conditions of the object
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Login Name",type=string,JSONPath=`.spec.name`,description="Name of the sql login"
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`,description="Whether the login is ready"
+//+kubebuilder:printcolumn:name="Instance",type=string,JSONPath=`.spec.connection.sqlManagedInstance`,description="SQL managed instance hosting the login",priority=1
+//+kubebuilder:printcolumn:name="SID",type=string,JSONPath=`.status.sid`,description="Security identifier of the login",priority=1
+//+kubebuilder:printcolumn:name="Last Sync",type=date,JSONPath=`.status.lastSyncTime`,description="When the login was last read from the server"
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// Login is the Schema for the logins API
+type Login struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   LoginSpec   `json:"spec,omitempty"`
+	Status LoginStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// LoginList contains a list of Login
+type LoginList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Login `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Login{}, &LoginList{})
+}
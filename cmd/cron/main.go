@@ -10,19 +10,20 @@ import (
 	"github.com/go-logr/zapr"
 	ms "github.com/pplavetzki/azure-sql-mi/internal"
 	"go.uber.org/zap"
-	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/client-go/kubernetes"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
-	actionsv1alpha1 "github.com/pplavetzki/azure-sql-mi/api/v1alpha1"
+	arcdatav1 "github.com/pplavetzki/azure-sql-mi/api/arcdata/v1"
+	actionsv1beta1 "github.com/pplavetzki/azure-sql-mi/api/v1beta1"
+	"github.com/pplavetzki/azure-sql-mi/internal/dbsync"
 )
 
 var (
-	logger    logr.Logger
-	clientset *kubernetes.Clientset
+	logger logr.Logger
 )
 
 type DBResult struct {
@@ -30,15 +31,15 @@ type DBResult struct {
 	Error  error
 }
 
-func getEnvOrFail(key string) string {
-	var val string
-	if val = os.Getenv(key); val == "" {
-		panic(fmt.Errorf("failed to get required env variable: %s", key))
+func requiredEnv(key string) (string, error) {
+	val := os.Getenv(key)
+	if val == "" {
+		return "", fmt.Errorf("failed to get required env variable: %s", key)
 	}
-	return val
+	return val, nil
 }
 
-func getDatabaseID(ctx context.Context, msSQL *ms.MSSql, name string, result chan *DBResult) {
+func getDatabaseID(ctx context.Context, msSQL ms.Provider, name string, result chan *DBResult) {
 	dbID, err := msSQL.FindDatabaseID(ctx, name)
 	result <- &DBResult{
 		Result: dbID,
@@ -46,7 +47,7 @@ func getDatabaseID(ctx context.Context, msSQL *ms.MSSql, name string, result cha
 	}
 }
 
-func getDatabaseName(ctx context.Context, msSQL *ms.MSSql, id string, result chan *DBResult) {
+func getDatabaseName(ctx context.Context, msSQL ms.Provider, id string, result chan *DBResult) {
 	if id != "" {
 		dbName, err := msSQL.FindDatabaseName(ctx, id)
 		result <- &DBResult{
@@ -61,27 +62,21 @@ func getDatabaseName(ctx context.Context, msSQL *ms.MSSql, id string, result cha
 	}
 }
 
-func performSync(msSQL *ms.MSSql, db *actionsv1alpha1.Database) error {
+func performSync(ctx context.Context, msSQL ms.Provider, db *actionsv1beta1.Database) (*ms.DatabaseDiff, error) {
 	dbNameResult := make(chan *DBResult)
 	dbIDResult := make(chan *DBResult)
 
-	defer func() {
-		if msSQL.DB != nil {
-			msSQL.DB.Close()
-		}
-	}()
-
-	go getDatabaseID(context.TODO(), msSQL, db.Spec.Name, dbIDResult)
-	go getDatabaseName(context.TODO(), msSQL, db.Status.DatabaseID, dbNameResult)
+	go getDatabaseID(ctx, msSQL, db.Spec.Name, dbIDResult)
+	go getDatabaseName(ctx, msSQL, db.Status.DatabaseID, dbNameResult)
 
 	dbNameR := <-dbNameResult
 	dbIDR := <-dbIDResult
 
 	if dbNameR.Error != nil {
-		panic(fmt.Errorf("failed to query name: %v", dbNameR.Error))
+		return nil, fmt.Errorf("failed to query name: %w", dbNameR.Error)
 	}
 	if dbIDR.Error != nil {
-		panic(fmt.Errorf("failed to query db id: %v", dbIDR.Error))
+		return nil, fmt.Errorf("failed to query db id: %w", dbIDR.Error)
 	}
 	if dbIDR.Result != nil {
 		logger.V(1).Info("found database ID", "database-id", *dbIDR.Result)
@@ -93,123 +88,186 @@ func performSync(msSQL *ms.MSSql, db *actionsv1alpha1.Database) error {
 	if db.Status.DatabaseID == "" && dbIDR.Result == nil {
 		logger.V(0).Info("database does not exist and is not managed by database controller -- serious error", "databaseName", db.Spec.Name)
 	} else if db.Status.DatabaseID == "" && dbIDR.Result != nil {
-		logger.V(0).Info("database exists on server but not managed by database controller", "databaseName", db.Spec.Name, "guid", *dbIDR.Result)
+		logger.V(0).Info("database exists on server but not managed by database controller, set spec.adoptExisting to adopt it", "databaseName", db.Spec.Name, "guid", *dbIDR.Result)
 	} else if db.Status.DatabaseID != "" && (dbIDR.Result != nil && *dbIDR.Result != db.Status.DatabaseID) {
 		logger.V(0).Info("database on server does not match what database controller is expecting", "databaseName", db.Spec.Name, "databaseGuid", *dbIDR.Result, "controllerGuid", db.Status.DatabaseID)
 	}
 	// Now let's sync
-	params := &ms.DatabaseConfig{
-		DatabaseName:               db.Spec.Name,
-		DatabaseID:                 db.Status.DatabaseID,
-		CompatibilityLevel:         db.Spec.CompatibilityLevel,
-		Collation:                  db.Spec.Collation,
-		Parameterization:           db.Spec.Parameterization,
-		AllowSnapshotIsolation:     db.Spec.AllowSnapshotIsolation,
-		AllowReadCommittedSnapshot: db.Spec.AllowReadCommittedSnapshot,
-	}
-	syncResponse, err := msSQL.SyncNeeded(context.TODO(), params, ms.Database)
+	params := dbsync.DatabaseConfig(db)
+	diff, err := msSQL.SyncNeeded(ctx, params)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if syncResponse != nil {
-		logger.V(0).Info("database is out-of-sync with database controller", "database", syncResponse)
+	if diff != nil && diff.HasDrift() {
+		for _, f := range diff.Drifted() {
+			logger.V(0).Info("database is out-of-sync with database controller", "field", f.Field, "desired", f.Desired, "observed", f.Observed, "remediable", f.Remediable)
+		}
 	} else {
 		logger.V(0).Info("database sync not needed")
 	}
+	return diff, nil
+}
+
+// checkDrift compares the database with the spec and applies the drift policy of the Database, the outcome, the
+// observed database and the permissions granted outside of the DatabasePermissions of the Database are recorded in
+// the status of db
+func checkDrift(ctx context.Context, cl client.Reader, msSQL ms.Provider, db *actionsv1beta1.Database) error {
+	diff, err := performSync(ctx, msSQL, db)
+	if err != nil {
+		return err
+	}
+	if diff != nil && diff.HasDrift() && db.Spec.Sync.DriftPolicy == actionsv1beta1.DriftPolicyRemediate {
+		logger.V(0).Info("remediating database drift", "databaseName", db.Spec.Name)
+	}
+	if err = dbsync.ApplyDriftPolicy(ctx, msSQL, db, diff); err != nil {
+		return err
+	}
+	if err = dbsync.FlagManualPermissions(ctx, cl, msSQL, db); err != nil {
+		return err
+	}
+	for _, p := range db.Status.ManualPermissions {
+		logger.V(0).Info("permission not applied by a DatabasePermission", "databaseName", db.Spec.Name, "principal", p.Principal,
+			"state", p.State, "permission", p.Permission, "class", p.Class, "schema", p.Schema, "object", p.Object)
+	}
+	if err = dbsync.ObserveDatabase(ctx, msSQL, db); err != nil {
+		return err
+	}
+	now := metav1.Now()
+	db.Status.LastSyncTime = &now
 	return nil
 }
 
-func connectionInfo(db *actionsv1alpha1.Database) (string, string, error) {
+func connectionInfo(ctx context.Context, cl client.Reader, db *actionsv1beta1.Database) (string, string, error) {
 	/*******************************************************************************************************************
 	* Quering the defined secret for the database connection
 	*******************************************************************************************************************/
-	mi, err := ms.QuerySQLManagedInstance(context.TODO(), db.Namespace, db.Spec.SQLManagedInstance)
+	mi, err := ms.QuerySQLManagedInstance(ctx, cl, db.Namespace, db.Spec.Connection.SQLManagedInstance)
 	if err != nil {
 		return "", "", err
 	}
-	logger.V(1).Info("successfully found managed instance", "sql-managed-instance", db.Spec.SQLManagedInstance)
-	if mi.Status.State != "Ready" {
+	logger.V(1).Info("successfully found managed instance", "sql-managed-instance", db.Spec.Connection.SQLManagedInstance)
+	if !mi.IsReady() {
 		return "", "", fmt.Errorf("the sql managed instance is not in a `Ready` state, current status is: %v", mi.Status)
 	}
 
-	sec, err := clientset.CoreV1().Secrets(mi.Spec.LoginRef.Namespace).Get(context.TODO(), mi.Spec.LoginRef.Name, v1.GetOptions{})
+	var ref *ms.CredentialsRef
+	if credentials := db.Spec.Connection.Credentials; credentials != nil {
+		ref = &ms.CredentialsRef{
+			Name:         credentials.Username.Name,
+			Namespace:    db.Namespace,
+			UsernameKey:  credentials.Username.Key,
+			PasswordName: credentials.Password.Name,
+			PasswordKey:  credentials.Password.Key,
+		}
+	}
+	creds, err := ms.ResolveCredentials(ctx, cl, ref, mi)
 	if err != nil {
-		logger.Error(err, "secrets credentials resource not found", "secret-name", mi.Spec.LoginRef.Name)
+		logger.Error(err, "secrets credentials resource not found", "database", db.Name)
 		return "", "", err
 	}
-
-	username := sec.Data["username"]
-	password := sec.Data["password"]
 	/******************************************************************************************************************/
-	return string(username), string(password), nil
+	return creds.Username, creds.Password, nil
 }
 
 func main() {
-	var config *rest.Config
-
 	zapLog, err := zap.NewDevelopment()
 	if err != nil {
 		panic(fmt.Sprintf("failed starting logger (%v)?", err))
 	}
 	logger = zapr.NewLogger(zapLog)
 
-	namespace := getEnvOrFail("NAMESPACE")
-	databaseCRD := getEnvOrFail("DATABASE_CRD")
-	password := getEnvOrFail("DATABASE_PASSWORD")
-	user := getEnvOrFail("DATABASE_USER")
-	port := getEnvOrFail("DATABASE_PORT")
-
-	if os.Getenv("KUBECONFIG") != "" {
-		path := os.Getenv("KUBECONFIG")
-		config, err = clientcmd.BuildConfigFromFlags("", path)
-		if err != nil {
-			panic(fmt.Errorf("could not load kubeconfig"))
-		}
-		clientset, err = kubernetes.NewForConfig(config)
-		if err != nil {
-			panic(fmt.Errorf("failed to create clientset"))
-		}
-	} else {
-		config, err = rest.InClusterConfig()
-		if err != nil {
-			panic(err.Error())
-		}
-		// creates the clientset
-		clientset, err = kubernetes.NewForConfig(config)
-		if err != nil {
-			panic(err.Error())
-		}
+	// a failed sync exits non-zero so the job is recorded as failed
+	if err := run(context.Background()); err != nil {
+		logger.Error(err, "database sync failed")
+		os.Exit(1)
 	}
+}
 
-	crScheme := runtime.NewScheme()
-	actionsv1alpha1.AddToScheme(crScheme)
+// run syncs the Database of the job and records the outcome in its status
+func run(ctx context.Context) error {
+	namespace, err := requiredEnv("NAMESPACE")
+	if err != nil {
+		return err
+	}
+	databaseCRD, err := requiredEnv("DATABASE_CRD")
+	if err != nil {
+		return err
+	}
 
-	cl, _ := client.New(config, client.Options{
-		Scheme: crScheme,
-	})
+	var config *rest.Config
+	if path := os.Getenv("KUBECONFIG"); path != "" {
+		if config, err = clientcmd.BuildConfigFromFlags("", path); err != nil {
+			return fmt.Errorf("could not load kubeconfig: %w", err)
+		}
+	} else if config, err = rest.InClusterConfig(); err != nil {
+		return err
+	}
 
-	list := &actionsv1alpha1.DatabaseList{}
-	err = cl.List(context.TODO(), list, &client.ListOptions{})
+	crScheme := runtime.NewScheme()
+	if err = clientgoscheme.AddToScheme(crScheme); err != nil {
+		return err
+	}
+	if err = arcdatav1.AddToScheme(crScheme); err != nil {
+		return err
+	}
+	if err = actionsv1beta1.AddToScheme(crScheme); err != nil {
+		return err
+	}
+	cl, err := client.New(config, client.Options{Scheme: crScheme})
 	if err != nil {
-		panic(err.Error())
+		return err
+	}
+
+	db := &actionsv1beta1.Database{}
+	if err = cl.Get(ctx, client.ObjectKey{Namespace: namespace, Name: databaseCRD}, db); err != nil {
+		return fmt.Errorf("failed to get the Database %s/%s: %w", namespace, databaseCRD, err)
 	}
-	db := &actionsv1alpha1.Database{}
 
-	cl.Get(context.TODO(), client.ObjectKey{
-		Namespace: namespace,
-		Name:      databaseCRD,
-	}, db)
+	patch := client.MergeFrom(db.DeepCopy())
+	syncErr := syncDatabase(ctx, cl, db)
+	db.RecordSyncRun(syncErr)
+	if err = cl.Status().Patch(ctx, db, patch); err != nil {
+		if syncErr != nil {
+			logger.Error(syncErr, "database sync failed")
+		}
+		return fmt.Errorf("failed to record the sync in the status: %w", err)
+	}
+	return syncErr
+}
 
+// syncDatabase connects to the sql server of the Database and checks it for drift
+func syncDatabase(ctx context.Context, cl client.Reader, db *actionsv1beta1.Database) error {
+	port, err := requiredEnv("DATABASE_PORT")
+	if err != nil {
+		return err
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		return fmt.Errorf("invalid DATABASE_PORT: %w", err)
+	}
 	var server string
 	if os.Getenv("MS_SERVER") != "" {
 		server = os.Getenv("MS_SERVER")
 	} else {
-		server = fmt.Sprintf("%s-p-svc", db.Spec.SQLManagedInstance)
+		server = fmt.Sprintf("%s-p-svc", db.Spec.Connection.SQLManagedInstance)
 	}
-	p, err := strconv.Atoi(port)
-	if err != nil {
-		panic(err)
+	// credentials handed to the job take precedence, otherwise they are resolved from the Database's
+	// credentials secret falling back to the login of the sql managed instance
+	user := os.Getenv("DATABASE_USER")
+	password := os.Getenv("DATABASE_PASSWORD")
+	if user == "" || password == "" {
+		if user, password, err = connectionInfo(ctx, cl, db); err != nil {
+			return err
+		}
+	}
+	if db.Spec.Sync.DriftPolicy == actionsv1beta1.DriftPolicyIgnore {
+		logger.V(0).Info("drift policy is Ignore, skipping the sync", "databaseName", db.Spec.Name)
+		return nil
 	}
-	msSQL := ms.NewMSSql(server, user, password, p)
-	performSync(msSQL, db)
+
+	connections := ms.NewConnectionManager(ms.DefaultPoolOptions)
+	defer connections.Close()
+
+	newProvider := ms.NewMSSqlFactory(connections)
+	return checkDrift(ctx, cl, newProvider(server, user, password, p), db)
 }
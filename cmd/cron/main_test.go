@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	fakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	actionsv1beta1 "github.com/pplavetzki/azure-sql-mi/api/v1beta1"
+	ms "github.com/pplavetzki/azure-sql-mi/internal"
+	"github.com/pplavetzki/azure-sql-mi/internal/fake"
+)
+
+// newClient a client of the objects the sync job reads
+func newClient(t *testing.T, objs ...client.Object) client.Reader {
+	scheme := runtime.NewScheme()
+	if err := actionsv1beta1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return fakeclient.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+}
+
+func driftedDatabase(t *testing.T, policy actionsv1beta1.DriftPolicy) (*fake.Server, *actionsv1beta1.Database) {
+	logger = logr.Discard()
+	server := fake.NewServer()
+	id := server.AddDatabase("MyDatabase")
+	if err := server.UpdateDatabase("MyDatabase", func(d *fake.Database) {
+		d.AllowSnapshotIsolation = true
+		d.Collation = "Latin1_General_100_CI_AS"
+	}); err != nil {
+		t.Fatal(err)
+	}
+	db := &actionsv1beta1.Database{
+		ObjectMeta: metav1.ObjectMeta{Name: "mydatabase", Namespace: "default"},
+		Spec: actionsv1beta1.DatabaseSpec{
+			Name: "MyDatabase",
+			Options: actionsv1beta1.DatabaseOptions{
+				Collation:          fake.DefaultCollation,
+				CompatibilityLevel: fake.DefaultCompatibilityLevel,
+				Parameterization:   fake.DefaultParameterization,
+			},
+			Sync: actionsv1beta1.SyncSpec{DriftPolicy: policy},
+		},
+		Status: actionsv1beta1.DatabaseStatus{DatabaseID: id},
+	}
+	return server, db
+}
+
+func TestCheckDriftReport(t *testing.T) {
+	server, db := driftedDatabase(t, actionsv1beta1.DriftPolicyReport)
+	if err := checkDrift(context.TODO(), newClient(t), server.Factory()("server", "sa", "secret", 1433), db); err != nil {
+		t.Fatal(err)
+	}
+	if db.Status.LastChecked == nil || db.Status.LastDrift == nil {
+		t.Errorf("expected the check and the drift to be recorded, got %+v", db.Status)
+	}
+	if len(db.Status.Drift) != 2 {
+		t.Errorf("expected the collation and snapshot isolation drift, got %+v", db.Status.Drift)
+	}
+	if d, _ := server.Database("MyDatabase"); !d.AllowSnapshotIsolation {
+		t.Error("expected Report not to alter the database")
+	}
+	if db.Status.Observed == nil || !db.Status.Observed.AllowSnapshotIsolation || db.Status.LastSyncTime == nil {
+		t.Errorf("expected the observed database to be recorded, got %+v", db.Status.Observed)
+	}
+}
+
+func TestCheckDriftRemediate(t *testing.T) {
+	server, db := driftedDatabase(t, actionsv1beta1.DriftPolicyRemediate)
+	if err := checkDrift(context.TODO(), newClient(t), server.Factory()("server", "sa", "secret", 1433), db); err != nil {
+		t.Fatal(err)
+	}
+	if d, _ := server.Database("MyDatabase"); d.AllowSnapshotIsolation {
+		t.Error("expected Remediate to alter the database")
+	}
+	expected := []actionsv1beta1.DriftField{{Field: "collation", Desired: fake.DefaultCollation, Observed: "Latin1_General_100_CI_AS"}}
+	if len(db.Status.Drift) != 1 || db.Status.Drift[0] != expected[0] {
+		t.Errorf("expected only the collation drift to remain, got %+v", db.Status.Drift)
+	}
+	if db.Status.LastDrift == nil {
+		t.Error("expected the drift to be recorded")
+	}
+
+	lastDrift := db.Status.LastDrift
+	db.Spec.Options.Collation = ""
+	if err := checkDrift(context.TODO(), newClient(t), server.Factory()("server", "sa", "secret", 1433), db); err != nil {
+		t.Fatal(err)
+	}
+	if db.Status.Drift != nil || db.Status.LastDrift != lastDrift {
+		t.Errorf("expected the drift to be cleared and the last drift to be kept, got %+v", db.Status)
+	}
+}
+
+func TestCheckDriftReturnsQueryErrors(t *testing.T) {
+	server, db := driftedDatabase(t, actionsv1beta1.DriftPolicyReport)
+	server.FailOn("FindDatabaseID", errors.New("login failed"))
+	err := checkDrift(context.TODO(), newClient(t), server.Factory()("server", "sa", "secret", 1433), db)
+	if err == nil || !strings.Contains(err.Error(), "login failed") {
+		t.Fatalf("expected the query error to be returned, got %v", err)
+	}
+	db.RecordSyncRun(err)
+	if db.Status.LastSyncRun.Result != actionsv1beta1.SyncResultFailed {
+		t.Errorf("expected the failed sync to be recorded, got %+v", db.Status.LastSyncRun)
+	}
+}
+
+func TestCheckDriftFlagsManualPermissions(t *testing.T) {
+	server, db := driftedDatabase(t, actionsv1beta1.DriftPolicyReport)
+	provider := server.Factory()("server", "sa", "secret", 1433)
+	if err := checkDrift(context.TODO(), newClient(t), provider, db); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.AddUser("MyDatabase", "app"); err != nil {
+		t.Fatal(err)
+	}
+	applied := ms.Permission{Principal: "app", Class: ms.PermissionClassSchema, Schema: "sales", Permission: "SELECT", State: ms.PermissionStateGrant}
+	manual := ms.Permission{Principal: "app", Class: ms.PermissionClassDatabase, Permission: "DELETE", State: ms.PermissionStateGrant}
+	for _, p := range []ms.Permission{applied, manual} {
+		if err := server.Grant("MyDatabase", p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := checkDrift(context.TODO(), newClient(t), provider, db); err != nil {
+		t.Fatal(err)
+	}
+	if db.Status.ManualPermissions != nil {
+		t.Errorf("expected the permissions not to be checked without DatabasePermissions, got %+v", db.Status.ManualPermissions)
+	}
+
+	permission := &actionsv1beta1.DatabasePermission{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: db.Namespace},
+		Spec: actionsv1beta1.DatabasePermissionSpec{
+			DatabaseRef: corev1.LocalObjectReference{Name: db.Name},
+			Principal:   "app",
+		},
+		Status: actionsv1beta1.DatabasePermissionStatus{Applied: []actionsv1beta1.ObservedPermission{actionsv1beta1.ObservedPermission(applied)}},
+	}
+	if err := checkDrift(context.TODO(), newClient(t, permission), provider, db); err != nil {
+		t.Fatal(err)
+	}
+	expected := []actionsv1beta1.ObservedPermission{actionsv1beta1.ObservedPermission(manual)}
+	if !reflect.DeepEqual(db.Status.ManualPermissions, expected) {
+		t.Errorf("expected only the manual GRANT to be flagged, got %+v", db.Status.ManualPermissions)
+	}
+}
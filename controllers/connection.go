@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	arcdatav1 "github.com/pplavetzki/azure-sql-mi/api/arcdata/v1"
+	actionsv1beta1 "github.com/pplavetzki/azure-sql-mi/api/v1beta1"
+	ms "github.com/pplavetzki/azure-sql-mi/internal"
+)
+
+// connectionError why the sql server of a connection cannot be reached, the reason is one of the InstanceNotFound,
+// InstanceNotReady or CredentialsNotFound event reasons which double as condition reasons
+type connectionError struct {
+	reason string
+	err    error
+}
+
+func (e *connectionError) Error() string {
+	return e.err.Error()
+}
+
+func (e *connectionError) Unwrap() error {
+	return e.err
+}
+
+// instanceNotReady whether the sql managed instance could not be read or is not ready, as opposed to the login
+// of the connection
+func (e *connectionError) instanceNotReady() bool {
+	return e.reason == EventReasonInstanceNotFound || e.reason == EventReasonInstanceNotReady
+}
+
+// connectionCredentialsRef the secret holding the sql login of the connection, nil when the login of the sql
+// managed instance should be used
+func connectionCredentialsRef(namespace string, connection actionsv1beta1.ConnectionSpec) *ms.CredentialsRef {
+	credentials := connection.Credentials
+	if credentials == nil {
+		return nil
+	}
+	return &ms.CredentialsRef{
+		Name:         credentials.Username.Name,
+		Namespace:    namespace,
+		UsernameKey:  credentials.Username.Key,
+		PasswordName: credentials.Password.Name,
+		PasswordKey:  credentials.Password.Key,
+	}
+}
+
+// connect looks up the sql managed instance of the connection and builds the measured Provider with the sql
+// login of the connection, the error is a *connectionError
+func connect(ctx context.Context, c client.Reader, newProvider ms.ProviderFactory, namespace string, connection actionsv1beta1.ConnectionSpec) (ms.Provider, *arcdatav1.SQLManagedInstance, error) {
+	mi, err := ms.QuerySQLManagedInstance(ctx, c, namespace, connection.SQLManagedInstance)
+	if err != nil {
+		return nil, nil, &connectionError{reason: EventReasonInstanceNotFound, err: err}
+	}
+	if !mi.IsReady() {
+		return nil, nil, &connectionError{reason: EventReasonInstanceNotReady,
+			err: fmt.Errorf("the sql managed instance is not in a `Ready` state, current status is: %v", mi.Status.State)}
+	}
+	creds, err := ms.ResolveCredentials(ctx, c, connectionCredentialsRef(namespace, connection), mi)
+	if err != nil {
+		return nil, nil, &connectionError{reason: EventReasonCredentialsNotFound, err: err}
+	}
+	return instrumentProvider(newProvider(connection.Server, creds.Username, creds.Password, connection.Port),
+		namespace, connection.SQLManagedInstance), mi, nil
+}
+
+// instancesWithLogin the sql managed instances whose login is held by the secret, the Databases and Logins without
+// credentials of their own connect with it
+func instancesWithLogin(c client.Reader, logger logr.Logger, secret client.Object) []*arcdatav1.SQLManagedInstance {
+	instances := &arcdatav1.SQLManagedInstanceList{}
+	if err := c.List(context.Background(), instances); err != nil {
+		logger.Error(err, "failed to list the sql managed instances", "secret", client.ObjectKeyFromObject(secret))
+		return nil
+	}
+	matching := []*arcdatav1.SQLManagedInstance{}
+	for i := range instances.Items {
+		if mi := &instances.Items[i]; mi.LoginSecret() == client.ObjectKeyFromObject(secret) {
+			matching = append(matching, mi)
+		}
+	}
+	return matching
+}
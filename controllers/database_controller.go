@@ -20,33 +20,57 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
 
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	corev1 "k8s.io/api/core/v1"
 
 	"github.com/go-logr/logr"
-	actionsv1alpha1 "github.com/pplavetzki/azure-sql-mi/api/v1alpha1"
+	arcdatav1 "github.com/pplavetzki/azure-sql-mi/api/arcdata/v1"
+	actionsv1beta1 "github.com/pplavetzki/azure-sql-mi/api/v1beta1"
 	ms "github.com/pplavetzki/azure-sql-mi/internal"
+	"github.com/pplavetzki/azure-sql-mi/internal/dbsync"
+	"github.com/pplavetzki/azure-sql-mi/internal/validation"
 	batch "k8s.io/api/batch/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-const databaseFinalizer = "actions.msft.isd.coe.io/finalizer"
-const defaultSchedule = "0 */12 * * *"
+const defaultSchedule = actionsv1beta1.DefaultSchedule
+const defaultBackupDirectory = "/var/opt/mssql/backups"
+const defaultSoftDeleteGracePeriod = 24 * time.Hour
 
 // DatabaseReconciler reconciles a Database object
 type DatabaseReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
 	Logger logr.Logger
+	// NewProvider builds the sql server Provider of the connection of a Database
+	NewProvider ms.ProviderFactory
+	// Recorder emits the events of the Databases, it is expected to deduplicate them
+	Recorder record.EventRecorder
+	// SyncMode how the scheduled sync runs, a CronJob per Database when not set
+	SyncMode SyncMode
+	// ResyncPeriod how long the sync times of an unchanged Database are kept when it is compared with the server
+	// again, they are updated on every check when not set
+	ResyncPeriod time.Duration
 }
 
 type AnnotationPatch struct {
@@ -67,12 +91,15 @@ func (a AnnotationPatch) Data(obj client.Object) ([]byte, error) {
 	return json.Marshal(obj)
 }
 
-func (r *DatabaseReconciler) updateDatabaseStatus(db *actionsv1alpha1.Database, status, databaseID string) error {
+func (r *DatabaseReconciler) updateDatabaseStatus(ctx context.Context, db *actionsv1beta1.Database, status string) error {
 	db.Status.Status = status
-	if databaseID != "" {
-		db.Status.DatabaseID = databaseID
-	}
-	return r.Status().Update(context.TODO(), db)
+	return r.Status().Update(ctx, db)
+}
+
+// syncFailed sets the Error status summary along with the failure
+func (r *DatabaseReconciler) syncFailed(ctx context.Context, db *actionsv1beta1.Database, reason string, err error) (ctrl.Result, error) {
+	db.Status.Status = actionsv1beta1.DatabaseStatusError
+	return syncFailed(ctx, r.Client, r.Recorder, db, reason, err)
 }
 
 //+kubebuilder:rbac:groups=actions.msft.isd.coe.io,resources=databases,verbs=get;list;watch;create;update;patch;delete
@@ -82,6 +109,7 @@ func (r *DatabaseReconciler) updateDatabaseStatus(db *actionsv1alpha1.Database,
 //+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch
 //+kubebuilder:rbac:groups=batch,resources=cronjobs,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=batch,resources=cronjobs/status,verbs=get
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -92,219 +120,513 @@ func (r *DatabaseReconciler) updateDatabaseStatus(db *actionsv1alpha1.Database,
 //
 // For more details, check Reconcile and its Result here:
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.9.2/pkg/reconcile
-func (r *DatabaseReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+func (r *DatabaseReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
 	_ = log.FromContext(ctx)
 	logger := r.Logger
 	logger.Info("reconciling database")
 
-	db := &actionsv1alpha1.Database{}
-	err := r.Get(ctx, req.NamespacedName, db)
+	db := &actionsv1beta1.Database{}
+	err = r.Get(ctx, req.NamespacedName, db)
 	if err != nil {
 		if errors.IsNotFound(err) {
 			// Request object not found, could have been deleted after reconcile request.
 			// Owned objects are automatically garbage collected. For additional cleanup logic use finalizers.
 			// Return and don't requeue
 			logger.Info("Database resource not found. Ignoring since object must be deleted")
+			forgetReconciles(req.Namespace, req.Name)
 			return ctrl.Result{}, client.IgnoreNotFound(err)
 		}
 		// Error reading the object - requeue the request.
 		logger.Error(err, "failed to get Database")
 		return ctrl.Result{}, err
 	}
-
-	/*******************************************************************************************************************
-	* Quering the defined secret for the database connection
-	*******************************************************************************************************************/
-	mi, err := ms.QuerySQLManagedInstance(ctx, db.Namespace, db.Spec.SQLManagedInstance)
-	if err != nil {
-		return ctrl.Result{}, err
-	}
-	logger.V(1).Info("successfully found managed instance", "sql-managed-instance", db.Spec.SQLManagedInstance)
-	if mi.Status.State != "Ready" {
-		meta.SetStatusCondition(&db.Status.Conditions, *db.ErroredCondition())
-		r.updateDatabaseStatus(db, "Error", "")
-		return ctrl.Result{}, fmt.Errorf("the sql managed instance is not in a `Ready` state, current status is: %v", mi.Status)
+	defer func() { observeReconcile(db, err) }()
+	read := db.Status.DeepCopy()
+
+	// a retained database is left alone, there is no need to reach the sql managed instance
+	if !db.ObjectMeta.DeletionTimestamp.IsZero() && db.Spec.DeletionPolicy == actionsv1beta1.DeletionPolicyRetain {
+		if controllerutil.ContainsFinalizer(db, finalizer) {
+			logger.Info("retaining the database", "name", db.Spec.Name)
+			r.Recorder.Eventf(db, corev1.EventTypeNormal, EventReasonDatabaseRetained, "Database %s was retained on the server", db.Spec.Name)
+		}
+		return ctrl.Result{}, removeFinalizer(ctx, r.Client, db)
 	}
-	sec := &corev1.Secret{}
 
-	err = r.Client.Get(context.TODO(), types.NamespacedName{Name: mi.Spec.LoginRef.Name, Namespace: mi.Spec.LoginRef.Namespace}, sec)
+	msSQL, mi, err := connect(ctx, r.Client, r.NewProvider, db.Namespace, db.Spec.Connection)
 	if err != nil {
-		logger.Error(err, "secrets credentials resource not found", "secret-name", mi.Spec.LoginRef.Name)
-		return ctrl.Result{}, err
+		db.Status.Status = actionsv1beta1.DatabaseStatusError
+		return connectionFailed(ctx, r.Client, r.Recorder, db, err)
 	}
+	db.MarkInstanceReady()
 
-	username := sec.Data["username"]
-	password := sec.Data["password"]
-	/******************************************************************************************************************/
-
-	// This is the creating a MSSql Server `Provider`
-	// db.Spec.Server
-	// msSQL := ms.NewMSSql(fmt.Sprintf("%s-p-svc", db.Spec.SQLManagedInstance), string(username), string(password), db.Spec.Port)
-	msSQL := ms.NewMSSql(db.Spec.Server, string(username), string(password), db.Spec.Port)
-	// Let's look at the status here first
-
-	/*******************************************************************************************************************
-	* Finalizer to check what to do if we're deleting the resource
-	*******************************************************************************************************************/
 	if db.ObjectMeta.DeletionTimestamp.IsZero() {
-		// Add finalizer for this CR
-		if !controllerutil.ContainsFinalizer(db, databaseFinalizer) {
-			controllerutil.AddFinalizer(db, databaseFinalizer)
-			err = r.Update(ctx, db)
-			if err != nil {
-				return ctrl.Result{}, err
-			}
+		if err = addFinalizer(ctx, r.Client, db); err != nil {
+			return ctrl.Result{}, err
 		}
 	} else {
-		if controllerutil.ContainsFinalizer(db, databaseFinalizer) {
-			if err = r.finalizeDatabase(ctx, db, msSQL); err != nil {
+		if controllerutil.ContainsFinalizer(db, finalizer) {
+			if !db.IsConditionTrue(actionsv1beta1.DatabaseConditionDeleting) {
+				db.MarkDeleting(actionsv1beta1.DatabaseReasonDeleting, fmt.Sprintf("Applying the %s deletion policy", deletionPolicy(db)))
+				if err = r.updateDatabaseStatus(ctx, db, actionsv1beta1.DatabaseStatusDeleting); err != nil {
+					return ctrl.Result{}, err
+				}
+			}
+			requeueAfter, err := r.finalizeDatabase(ctx, db, msSQL)
+			if err != nil {
 				return ctrl.Result{}, err
 			}
+			if requeueAfter > 0 {
+				// soft deleted, the finalizer stays until the grace period elapsed
+				return ctrl.Result{RequeueAfter: requeueAfter}, nil
+			}
 		}
-		controllerutil.RemoveFinalizer(db, databaseFinalizer)
-		if err := r.Update(ctx, db); err != nil {
-			return ctrl.Result{}, err
-		}
-
-		// Stop reconciliation as the item is being deleted
-		return ctrl.Result{}, nil
+		return ctrl.Result{}, removeFinalizer(ctx, r.Client, db)
 	}
-	/******************************************************************************************************************/
 
 	/*******************************************************************************************************************
 	* Let's do sync logic here...
 	/******************************************************************************************************************/
-	status := "Pending"
-	condition := *db.PendingCondition()
-	var databaseId *string
-
-	databaseId = &db.Status.DatabaseID
+	status := actionsv1beta1.DatabaseStatusSynced
+	// the drift policy Ignore leaves a Database that did not change unchecked
+	checked := true
+	reason := actionsv1beta1.DatabaseReasonSynced
+	message := "Database was compared with the spec and altered where needed"
+
+	var schedule *ms.Schedule
+	if r.SyncMode == SyncModeController {
+		if schedule, err = ms.ParseSchedule(syncSchedule(db)); err != nil {
+			return r.syncFailed(ctx, db, actionsv1beta1.DatabaseReasonSyncFailed, fmt.Errorf("invalid sync schedule: %w", err))
+		}
+	}
 
 	if db.Status.DatabaseID == "" {
-		databaseId, err = msSQL.CreateDatabase(ctx, db.Spec.Name, &ms.DatabaseParams{Collation: ms.SetString(db.Spec.Collation),
-			AllowSnapshotIsolation:     &db.Spec.AllowSnapshotIsolation,
-			AllowReadCommittedSnapshot: &db.Spec.AllowReadCommittedSnapshot,
-			Parameterization:           &db.Spec.Parameterization,
-			CompatibilityLevel:         &db.Spec.CompatibilityLevel})
+		existing, err := msSQL.FindDatabaseID(ctx, db.Spec.Name)
 		if err != nil {
-			return ctrl.Result{}, err
+			return r.syncFailed(ctx, db, actionsv1beta1.DatabaseReasonSyncFailed, err)
 		}
-		condition = *db.CreatedCondition()
-		status = actionsv1alpha1.DatabaseConditionCreated
-	} else {
-		syncResponse, err := msSQL.SyncNeeded(ctx, &ms.DatabaseConfig{DatabaseName: db.Spec.Name, DatabaseID: db.Status.DatabaseID,
-			CompatibilityLevel:         db.Spec.CompatibilityLevel,
-			AllowSnapshotIsolation:     db.Spec.AllowSnapshotIsolation,
-			AllowReadCommittedSnapshot: db.Spec.AllowReadCommittedSnapshot,
-			Parameterization:           db.Spec.Parameterization}, ms.State)
-		if err != nil {
-			return ctrl.Result{}, err
-		}
-		if syncResponse != nil {
-			err = msSQL.AlterDatabase(ctx, db.Spec.Name, &ms.DatabaseParams{
-				AllowSnapshotIsolation:     syncResponse.AllowSnapshotIsolation,
-				AllowReadCommittedSnapshot: syncResponse.AllowReadCommittedSnapshot,
-				Parameterization:           syncResponse.Parameterization,
-				CompatibilityLevel:         syncResponse.CompatibilityLevel})
+		switch {
+		case existing == nil:
+			params := &ms.DatabaseParams{Collation: ms.SetString(db.Spec.Options.Collation),
+				AllowSnapshotIsolation:     &db.Spec.Options.AllowSnapshotIsolation,
+				AllowReadCommittedSnapshot: &db.Spec.Options.AllowReadCommittedSnapshot,
+				Parameterization:           &db.Spec.Options.Parameterization,
+				CompatibilityLevel:         &db.Spec.Options.CompatibilityLevel}
+			create, err := ms.CreateDatabaseStatement(db.Spec.Name, params)
 			if err != nil {
-				return ctrl.Result{}, err
+				return r.syncFailed(ctx, db, actionsv1beta1.DatabaseReasonSyncFailed, err)
+			}
+			id, err := msSQL.CreateDatabase(ctx, db.Spec.Name, params)
+			if err != nil {
+				return r.syncFailed(ctx, db, actionsv1beta1.DatabaseReasonSyncFailed, err)
+			}
+			r.Recorder.Eventf(db, corev1.EventTypeNormal, EventReasonDatabaseCreated, "Executed %s", statementsSummary(create))
+			// the recovery_fork_guid is recorded before the options are altered, a database created without it
+			// would look like one to adopt on the next reconcile
+			if err = recordCreated(ctx, r.Client, db, func() { db.Status.DatabaseID = ms.SafeString(id) }); err != nil {
+				return r.syncFailed(ctx, db, actionsv1beta1.DatabaseReasonSyncFailed, err)
 			}
+			if err = msSQL.AlterDatabase(ctx, db.Spec.Name, params); err != nil {
+				return r.syncFailed(ctx, db, actionsv1beta1.DatabaseReasonSyncFailed, err)
+			}
+			db.Status.Drift = nil
+			db.MarkDrift()
+			status = actionsv1beta1.DatabaseStatusCreated
+			reason = actionsv1beta1.DatabaseReasonCreated
+			message = "Database was created"
+		case db.Spec.AdoptExisting:
+			logger.Info("adopting existing database", "name", db.Spec.Name, "database-id", *existing)
+			r.Recorder.Eventf(db, corev1.EventTypeNormal, EventReasonDatabaseAdopted, "Adopted existing database %s with recovery_fork_guid %s", db.Spec.Name, *existing)
+			db.Status.DatabaseID = *existing
+			if _, err = r.checkDrift(ctx, db, msSQL); err != nil {
+				return r.syncFailed(ctx, db, actionsv1beta1.DatabaseReasonSyncFailed, err)
+			}
+			status = actionsv1beta1.DatabaseStatusAdopted
+			reason = actionsv1beta1.DatabaseReasonAdopted
+			message = "Existing database was adopted"
+		default:
+			return r.syncFailed(ctx, db, actionsv1beta1.DatabaseReasonSyncFailed,
+				fmt.Errorf("database %s already exists on the server, set spec.adoptExisting to manage it", db.Spec.Name))
 		}
-
-		condition = *db.SyncedCondition()
-		status = actionsv1alpha1.DatabaseConditionSynced
-	}
-
-	// Check if the cronjob already exists, if not create a new one
-	found := &batch.CronJob{}
-	err = r.Get(ctx, types.NamespacedName{Name: db.Name, Namespace: db.Namespace}, found)
-	if err != nil && errors.IsNotFound(err) {
-		// Define a new cronjob
-		dep, err := r.createSyncJob(db, mi, msSQL)
+	} else if schedule != nil && db.Status.ObservedGeneration == db.Generation && syncDue(db, schedule, time.Now()) {
+		// the Database did not change since it was last reconciled, the scheduled sync runs the drift check of
+		// the sync job with the drift policy of the Database
+		checked = db.Spec.Sync.DriftPolicy != actionsv1beta1.DriftPolicyIgnore
+		err = r.scheduledSync(ctx, db, msSQL)
+		db.RecordSyncRun(err)
 		if err != nil {
-			logger.Error(err, "Failed to create new CronJob")
+			return r.syncFailed(ctx, db, actionsv1beta1.DatabaseReasonSyncFailed, err)
 		}
-		logger.Info("Creating a new CronJob", "CronJob.Namespace", dep.Namespace, "CronJob.Name", dep.Name)
-		err = r.Create(ctx, dep)
+		message = "Database was compared with the spec by the scheduled sync"
+	} else if db.Status.ObservedGeneration != db.Generation {
+		diff, err := msSQL.SyncNeeded(ctx, dbsync.DatabaseConfig(db))
 		if err != nil {
-			logger.Error(err, "Failed to create new CronJob", "CronJob.Namespace", dep.Namespace, "CronJob.Name", dep.Name)
+			return r.syncFailed(ctx, db, actionsv1beta1.DatabaseReasonSyncFailed, err)
+		}
+		if diff != nil {
+			for _, f := range diff.Drifted() {
+				if !f.Remediable {
+					logger.Info("database option drifted and cannot be remediated", "field", f.Field, "desired", f.Desired, "observed", f.Observed)
+				}
+			}
+		}
+		// a change of the Database is always applied, the drift policy only governs the database left as is
+		if err = dbsync.ReconcileDrift(ctx, msSQL, db, diff, true); err != nil {
+			return r.syncFailed(ctx, db, actionsv1beta1.DatabaseReasonSyncFailed, err)
+		}
+		r.recordDrift(db, diff, true)
+	} else if schedule != nil {
+		// the scheduled sync is not due, a Database that did not change is only compared with the spec on its
+		// schedule and its Synced condition is kept as is
+		checked = false
+		if synced := meta.FindStatusCondition(db.Status.Conditions, actionsv1beta1.DatabaseConditionSynced); synced != nil && synced.Status == metav1.ConditionTrue {
+			reason, message = synced.Reason, synced.Message
+		}
+	} else {
+		// nothing changed since the last reconcile, a drifted database is only altered with the Remediate policy
+		checked = db.Spec.Sync.DriftPolicy != actionsv1beta1.DriftPolicyIgnore
+		lastChecked, lastDrift := db.Status.LastChecked, db.Status.LastDrift
+		if _, err = r.checkDrift(ctx, db, msSQL); err != nil {
+			return r.syncFailed(ctx, db, actionsv1beta1.DatabaseReasonSyncFailed, err)
+		}
+		if checked {
+			db.Status.LastChecked = syncTime(lastChecked, r.ResyncPeriod)
+			if db.Status.LastDrift != lastDrift {
+				db.Status.LastDrift = syncTime(lastDrift, r.ResyncPeriod)
+			}
+		}
+	}
+	if checked {
+		if err = dbsync.ObserveDatabase(ctx, msSQL, db); err != nil {
+			return r.syncFailed(ctx, db, actionsv1beta1.DatabaseReasonSyncFailed, err)
+		}
+		db.Status.LastSyncTime = syncTime(db.Status.LastSyncTime, r.ResyncPeriod)
+	}
+	db.MarkSynced(reason, message)
+	db.Status.ObservedGeneration = db.Generation
+
+	if r.SyncMode == SyncModeController {
+		if err = r.deleteSyncJob(ctx, db); err != nil {
+			logger.Error(err, "Failed to delete CronJob")
 			return ctrl.Result{}, err
 		}
-		if status == actionsv1alpha1.DatabaseConditionCreated {
-			meta.SetStatusCondition(&db.Status.Conditions, condition)
-			r.updateDatabaseStatus(db, status, ms.SafeString(databaseId))
+		db.Status.Status = status
+		if err = updateStatusIfChanged(ctx, r.Client, db, read, &db.Status); err != nil {
+			return ctrl.Result{}, err
 		}
-		// CronJob created successfully - return and requeue
-		return ctrl.Result{Requeue: true}, nil
-	} else if err != nil {
+		return ctrl.Result{RequeueAfter: nextSync(schedule, time.Now())}, nil
+	}
+
+	if err = r.ensureSyncServiceAccount(ctx, db.Namespace); err != nil {
+		logger.Error(err, "Failed to provision the sync ServiceAccount", "ServiceAccount.Namespace", db.Namespace)
+		return ctrl.Result{}, err
+	}
+
+	// Converge the cronjob with the spec through a server-side apply, the fields the controller no longer sets
+	// are removed from the cronjob
+	desired, err := r.createSyncJob(db, mi)
+	if err != nil {
+		logger.Error(err, "Failed to build CronJob")
+		return ctrl.Result{}, err
+	}
+	found := &batch.CronJob{}
+	err = r.Get(ctx, types.NamespacedName{Name: db.Name, Namespace: db.Namespace}, found)
+	if err != nil && !errors.IsNotFound(err) {
 		logger.Error(err, "Failed to get CronJob")
 		return ctrl.Result{}, err
 	}
+	created := errors.IsNotFound(err)
+	if err = r.Patch(ctx, desired, client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership); err != nil {
+		logger.Error(err, "Failed to apply CronJob", "CronJob.Namespace", desired.Namespace, "CronJob.Name", desired.Name)
+		return ctrl.Result{}, err
+	}
+	switch {
+	case created:
+		logger.Info("Created a new CronJob", "CronJob.Namespace", desired.Namespace, "CronJob.Name", desired.Name)
+		r.Recorder.Eventf(db, corev1.EventTypeNormal, EventReasonCronJobCreated, "Created sync CronJob %s with schedule %s", desired.Name, desired.Spec.Schedule)
+	case desired.ResourceVersion != found.ResourceVersion:
+		// an apply without changes leaves the resource version as is
+		logger.Info("Updated the CronJob", "CronJob.Namespace", desired.Namespace, "CronJob.Name", desired.Name)
+		r.Recorder.Eventf(db, corev1.EventTypeNormal, EventReasonCronJobUpdated, "Updated sync CronJob %s with schedule %s", desired.Name, desired.Spec.Schedule)
+	}
 
-	// Ensure the deployment size is the same as the spec
-	sched := db.Spec.Schedule
-	if sched == "" {
-		sched = defaultSchedule
+	db.Status.Status = status
+	if err = updateStatusIfChanged(ctx, r.Client, db, read, &db.Status); err != nil {
+		return ctrl.Result{}, err
 	}
-	if found.Spec.Schedule != sched {
-		found.Spec.Schedule = sched
-		err = r.Update(ctx, found)
-		if err != nil {
-			logger.Error(err, "Failed to update Deployment", "Deployment.Namespace", found.Namespace, "Deployment.Name", found.Name)
-			return ctrl.Result{}, err
+	return ctrl.Result{}, nil
+}
+
+// deletionPolicy the deletion policy of the Database, Delete when not set
+func deletionPolicy(db *actionsv1beta1.Database) actionsv1beta1.DeletionPolicy {
+	if db.Spec.DeletionPolicy == "" {
+		return actionsv1beta1.DeletionPolicyDelete
+	}
+	return db.Spec.DeletionPolicy
+}
+
+// databaseCredentialsRef the secret holding the sql login of the Database, nil when the login of the
+// sql managed instance should be used
+func databaseCredentialsRef(db *actionsv1beta1.Database) *ms.CredentialsRef {
+	return connectionCredentialsRef(db.Namespace, db.Spec.Connection)
+}
+
+// syncCredentials the secret keys the sync job reads the sql server login from, the login of the sql managed
+// instance is used when the Database has no credentials
+func syncCredentials(db *actionsv1beta1.Database, mi *arcdatav1.SQLManagedInstance) (username, password *corev1.SecretKeySelector, err error) {
+	ref := databaseCredentialsRef(db)
+	if ref == nil {
+		// a pod can only reference the secrets of its own namespace
+		secret := mi.LoginSecret()
+		if secret.Namespace != db.Namespace {
+			return nil, nil, fmt.Errorf("the login secret %s of the sql managed instance is not in the namespace of the Database", secret)
 		}
-		// Spec updated - return and requeue
-		return ctrl.Result{Requeue: true}, nil
+		ref = &ms.CredentialsRef{Name: secret.Name, Namespace: db.Namespace}
+	}
+	passwordName, usernameKey, passwordKey := ref.PasswordName, ref.UsernameKey, ref.PasswordKey
+	if passwordName == "" {
+		passwordName = ref.Name
 	}
+	if usernameKey == "" {
+		usernameKey = ms.DefaultUsernameKey
+	}
+	if passwordKey == "" {
+		passwordKey = ms.DefaultPasswordKey
+	}
+	username = &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: ref.Name}, Key: usernameKey}
+	password = &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: passwordName}, Key: passwordKey}
+	return username, password, nil
+}
 
-	meta.SetStatusCondition(&db.Status.Conditions, condition)
-	r.updateDatabaseStatus(db, status, ms.SafeString(databaseId))
+// checkDrift compares the database with the spec and reports or remediates the drift per the drift policy of the
+// Database, the diff is nil when the drift policy is Ignore
+func (r *DatabaseReconciler) checkDrift(ctx context.Context, db *actionsv1beta1.Database, msSQL ms.Provider) (*ms.DatabaseDiff, error) {
+	if db.Spec.Sync.DriftPolicy == actionsv1beta1.DriftPolicyIgnore {
+		db.MarkDriftNotChecked()
+		return nil, nil
+	}
+	diff, err := msSQL.SyncNeeded(ctx, dbsync.DatabaseConfig(db))
+	if err != nil {
+		return nil, err
+	}
+	if err = dbsync.ApplyDriftPolicy(ctx, msSQL, db, diff); err != nil {
+		return nil, err
+	}
+	r.recordDrift(db, diff, db.Spec.Sync.DriftPolicy == actionsv1beta1.DriftPolicyRemediate)
+	return diff, nil
+}
 
-	return ctrl.Result{}, nil
+// recordDrift emits a Warning event for the drift of the diff and a Normal event with the ALTERs executed when
+// the drift was remediated
+func (r *DatabaseReconciler) recordDrift(db *actionsv1beta1.Database, diff *ms.DatabaseDiff, remediated bool) {
+	if diff == nil || !diff.HasDrift() {
+		return
+	}
+	drifted := []string{}
+	for _, f := range diff.Drifted() {
+		drifted = append(drifted, fmt.Sprintf("%s (desired %s, observed %s)", f.Field, f.Desired, f.Observed))
+	}
+	r.Recorder.Eventf(db, corev1.EventTypeWarning, EventReasonDriftDetected, "Database differs from the spec: %s", strings.Join(drifted, ", "))
+
+	if !remediated || diff.Remediation() == nil {
+		return
+	}
+	alters, err := ms.AlterDatabaseStatements(db.Spec.Name, diff.Remediation())
+	if err != nil {
+		return
+	}
+	r.Recorder.Eventf(db, corev1.EventTypeNormal, EventReasonDatabaseAltered, "Executed %s", statementsSummary(alters...))
+}
+
+// finalizeDatabase applies the deletion policy of the Database, a positive duration means the database is
+// soft deleted and the finalizer must be kept for that long
+func (r *DatabaseReconciler) finalizeDatabase(ctx context.Context, db *actionsv1beta1.Database, mssql ms.Provider) (time.Duration, error) {
+	switch deletionPolicy(db) {
+	case actionsv1beta1.DeletionPolicyRetain:
+		return 0, nil
+	case actionsv1beta1.DeletionPolicyBackupThenDelete:
+		if err := r.backupDatabase(ctx, db, mssql); err != nil {
+			return 0, err
+		}
+		return 0, r.dropDatabase(ctx, db, mssql, db.Spec.Name)
+	case actionsv1beta1.DeletionPolicySoftDelete:
+		return r.softDeleteDatabase(ctx, db, mssql)
+	default:
+		return 0, r.dropDatabase(ctx, db, mssql, db.Spec.Name)
+	}
 }
 
-func (r *DatabaseReconciler) finalizeDatabase(ctx context.Context, db *actionsv1alpha1.Database, mssql *ms.MSSql) error {
-	if err := mssql.DeleteDatabase(ctx, db.Spec.Name); err != nil {
+// backupDatabase takes the backup of the BackupThenDelete policy, the backup is recorded in the status so a retried
+// drop doesn't take it again
+func (r *DatabaseReconciler) backupDatabase(ctx context.Context, db *actionsv1beta1.Database, mssql ms.Provider) error {
+	if db.Status.BackupPath != "" {
+		return nil
+	}
+	id, err := mssql.FindDatabaseID(ctx, db.Spec.Name)
+	if err != nil || id == nil {
+		return err
+	}
+	directory := db.Spec.BackupDirectory
+	if directory == "" {
+		directory = defaultBackupDirectory
+	}
+	path := backupPath(directory, db.Spec.Name, time.Now())
+	backup, err := ms.BackupDatabaseStatement(db.Spec.Name, path)
+	if err != nil {
 		return err
 	}
+	if err = mssql.BackupDatabase(ctx, db.Spec.Name, path); err != nil {
+		return err
+	}
+	r.Recorder.Eventf(db, corev1.EventTypeNormal, EventReasonDatabaseBackedUp, "Executed %s to %s", statementsSummary(backup), path)
+	db.Status.BackupPath = path
+	return r.Status().Update(ctx, db)
+}
+
+// dropDatabase drops the database and emits an event with the DROP executed
+func (r *DatabaseReconciler) dropDatabase(ctx context.Context, db *actionsv1beta1.Database, mssql ms.Provider, databaseName string) error {
+	drop, err := ms.DropDatabaseStatement(databaseName)
+	if err != nil {
+		return err
+	}
+	if err = mssql.DeleteDatabase(ctx, databaseName); err != nil {
+		return err
+	}
+	r.Recorder.Eventf(db, corev1.EventTypeNormal, EventReasonDatabaseDropped, "Executed %s", statementsSummary(drop))
 	return nil
 }
 
+// softDeleteDatabase renames the database on the first call and drops the renamed database once the grace
+// period elapsed. The new name is recorded in the status before the rename so it survives restarts of the
+// controller, a retry finding the database still under its own name renames it again to the recorded name
+func (r *DatabaseReconciler) softDeleteDatabase(ctx context.Context, db *actionsv1beta1.Database, mssql ms.Provider) (time.Duration, error) {
+	gracePeriod := defaultSoftDeleteGracePeriod
+	if db.Spec.SoftDeleteGracePeriod != nil {
+		gracePeriod = db.Spec.SoftDeleteGracePeriod.Duration
+	}
+
+	id, err := mssql.FindDatabaseID(ctx, db.Spec.Name)
+	if err != nil {
+		return 0, err
+	}
+	// a database created under the name since the rename belongs to someone else
+	renamed := id == nil || (db.Status.DatabaseID != "" && *id != db.Status.DatabaseID)
+	if db.Status.SoftDeletedName == "" {
+		if renamed {
+			return 0, nil
+		}
+		now := metav1.Now()
+		name := softDeletedName(db.Spec.Name, now.Time)
+		db.Status.SoftDeletedName = name
+		db.Status.SoftDeletedAt = &now
+		db.MarkDeleting(actionsv1beta1.DatabaseReasonSoftDeleted,
+			fmt.Sprintf("Database was renamed to %s and is dropped after %s", name, now.Add(gracePeriod).UTC().Format(time.RFC3339)))
+		if err = r.Status().Update(ctx, db); err != nil {
+			return 0, err
+		}
+	}
+	if !renamed {
+		name := db.Status.SoftDeletedName
+		rename, err := ms.RenameDatabaseStatement(db.Spec.Name, name)
+		if err != nil {
+			return 0, err
+		}
+		if err = mssql.RenameDatabase(ctx, db.Spec.Name, name); err != nil {
+			return 0, err
+		}
+		r.Recorder.Eventf(db, corev1.EventTypeNormal, EventReasonDatabaseRenamed, "Executed %s", statementsSummary(rename))
+	}
+	if db.Status.SoftDeletedAt != nil {
+		if remaining := time.Until(db.Status.SoftDeletedAt.Add(gracePeriod)); remaining > 0 {
+			return remaining, nil
+		}
+	}
+	return 0, r.dropDatabase(ctx, db, mssql, db.Status.SoftDeletedName)
+}
+
+var unsafeFileCharacters = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+// backupPath the file of the backup taken before the database is dropped
+func backupPath(directory, databaseName string, now time.Time) string {
+	file := fmt.Sprintf("%s_%s.bak", unsafeFileCharacters.ReplaceAllString(databaseName, "_"), now.UTC().Format("20060102150405"))
+	return path.Join(directory, file)
+}
+
+// softDeletedName the name of the soft deleted database, the database name is shortened when the suffix would
+// make it longer than an identifier may be
+func softDeletedName(databaseName string, now time.Time) string {
+	suffix := "_deleted_" + now.UTC().Format("20060102150405")
+	name := []rune(databaseName)
+	if len(name)+len(suffix) > validation.MaxIdentifierLength {
+		name = name[:validation.MaxIdentifierLength-len(suffix)]
+	}
+	return string(name) + suffix
+}
+
+// DefaultSyncImage the image of the sync container when the Database does not set one
+const DefaultSyncImage = "paulplavetzki/sync:v0.0.11"
+
+// fieldManager the field manager of the objects the controller applies
+const fieldManager = "azure-sql-mi"
+
 var (
-	jobOwnerKey = ".metadata.controller"
-	apiGVStr    = actionsv1alpha1.GroupVersion.String()
+	jobOwnerKey          = ".metadata.controller"
+	credentialsSecretKey = ".spec.connection.credentials"
+	managedInstanceKey   = ".spec.sqlManagedInstance"
+	databaseRefKey       = ".spec.databaseRef.name"
+	apiGVStr             = actionsv1beta1.GroupVersion.String()
 )
 
-func (r *DatabaseReconciler) createSyncJob(db *actionsv1alpha1.Database, mi *ms.SQLManagedInstance, msSQL *ms.MSSql) (*batch.CronJob, error) {
+func (r *DatabaseReconciler) createSyncJob(db *actionsv1beta1.Database, mi *arcdatav1.SQLManagedInstance) (*batch.CronJob, error) {
 	// We want job names for a given nominal start time to have a deterministic name to avoid the same job being created twice
 	// sched := time.Now()
 	// name := fmt.Sprintf("%s-%d", db.Name, sched.Unix())
-	cronSchedule := defaultSchedule
+	cronSchedule := syncSchedule(db)
+	username, password, err := syncCredentials(db, mi)
+	if err != nil {
+		return nil, err
+	}
 
-	if db.Spec.Schedule != "" {
-		cronSchedule = db.Spec.Schedule
+	settings := db.Spec.SyncJob
+	if settings == nil {
+		settings = &actionsv1beta1.SyncJobSpec{}
+	}
+	image := DefaultSyncImage
+	if settings.Image != "" {
+		image = settings.Image
+	}
+	concurrencyPolicy := batch.ForbidConcurrent
+	if settings.ConcurrencyPolicy != "" {
+		concurrencyPolicy = settings.ConcurrencyPolicy
 	}
 
 	job := &batch.CronJob{
+		// the type is required by the server-side apply
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: batch.SchemeGroupVersion.String(),
+			Kind:       "CronJob",
+		},
 		ObjectMeta: metav1.ObjectMeta{
-			Labels:      make(map[string]string),
-			Annotations: make(map[string]string),
-			Name:        db.Name,
-			Namespace:   db.Namespace,
+			Name:      db.Name,
+			Namespace: db.Namespace,
 		},
 		Spec: batch.CronJobSpec{
-			Schedule: cronSchedule,
+			Schedule:                   cronSchedule,
+			Suspend:                    settings.Suspend,
+			ConcurrencyPolicy:          concurrencyPolicy,
+			SuccessfulJobsHistoryLimit: settings.SuccessfulJobsHistoryLimit,
+			FailedJobsHistoryLimit:     settings.FailedJobsHistoryLimit,
 			JobTemplate: batch.JobTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
-					Labels:      make(map[string]string),
-					Annotations: make(map[string]string),
-					Name:        db.Name,
-					Namespace:   db.Namespace,
+					Name:      db.Name,
+					Namespace: db.Namespace,
 				},
 				Spec: batch.JobSpec{
+					ActiveDeadlineSeconds: settings.ActiveDeadlineSeconds,
 					Template: corev1.PodTemplateSpec{
 						Spec: corev1.PodSpec{
-							ServiceAccountName: "azure-sql-mi-controller-manager",
+							ServiceAccountName: SyncServiceAccountName,
+							NodeSelector:       settings.NodeSelector,
+							Tolerations:        settings.Tolerations,
 							Containers: []corev1.Container{
 								// {
 								// 	Name:  "proxy",
@@ -316,8 +638,9 @@ func (r *DatabaseReconciler) createSyncJob(db *actionsv1alpha1.Database, mi *ms.
 								// 	},
 								// },
 								{
-									Name:  "sync",
-									Image: "paulplavetzki/sync:v0.0.11",
+									Name:      "sync",
+									Image:     image,
+									Resources: settings.Resources,
 									Env: []corev1.EnvVar{
 										{
 											Name:  "DATABASE_CRD",
@@ -328,16 +651,16 @@ func (r *DatabaseReconciler) createSyncJob(db *actionsv1alpha1.Database, mi *ms.
 											Value: db.Namespace,
 										},
 										{
-											Name:  "DATABASE_PASSWORD",
-											Value: msSQL.Password,
+											Name:      "DATABASE_PASSWORD",
+											ValueFrom: &corev1.EnvVarSource{SecretKeyRef: password},
 										},
 										{
-											Name:  "DATABASE_USER",
-											Value: msSQL.User,
+											Name:      "DATABASE_USER",
+											ValueFrom: &corev1.EnvVarSource{SecretKeyRef: username},
 										},
 										{
 											Name:  "DATABASE_PORT",
-											Value: fmt.Sprintf("%d", msSQL.Port),
+											Value: fmt.Sprintf("%d", db.Spec.Connection.Port),
 										},
 										// {
 										// 	Name: "NAMESPACE",
@@ -399,8 +722,55 @@ func (r *DatabaseReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		return err
 	}
 
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &actionsv1beta1.Database{}, credentialsSecretKey, func(rawObj client.Object) []string {
+		ref := databaseCredentialsRef(rawObj.(*actionsv1beta1.Database))
+		if ref == nil {
+			return nil
+		}
+		return ref.SecretNames()
+	}); err != nil {
+		return err
+	}
+
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &actionsv1beta1.Database{}, managedInstanceKey, func(rawObj client.Object) []string {
+		db := rawObj.(*actionsv1beta1.Database)
+		return []string{db.Spec.Connection.SQLManagedInstance}
+	}); err != nil {
+		return err
+	}
+
+	if err := metrics.Registry.Register(newStateCollector(mgr.GetClient())); err != nil {
+		return err
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&actionsv1alpha1.Database{}).
+		// the status written by the controller and the sync job doesn't change the generation, an annotation can
+		// still be changed to reconcile a Database on demand
+		For(&actionsv1beta1.Database{}, builder.WithPredicates(
+			predicate.Or(predicate.GenerationChangedPredicate{}, predicate.AnnotationChangedPredicate{}))).
 		Owns(&batch.CronJob{}).
+		Watches(&source.Kind{Type: &corev1.Secret{}}, handler.EnqueueRequestsFromMapFunc(r.databasesForSecret)).
+		Watches(&source.Kind{Type: &arcdatav1.SQLManagedInstance{}}, handler.EnqueueRequestsFromMapFunc(r.databasesForManagedInstance)).
 		Complete(r)
 }
+
+// databasesForManagedInstance maps a sql managed instance to the Databases hosted on it so the databases
+// are reconciled when the instance becomes ready
+func (r *DatabaseReconciler) databasesForManagedInstance(obj client.Object) []reconcile.Request {
+	return r.databasesMatching(obj, managedInstanceKey)
+}
+
+// databasesForSecret maps a credentials secret to the Databases using it, including the Databases on the sql
+// managed instances whose login it holds, so a rotated password triggers reconciliation
+func (r *DatabaseReconciler) databasesForSecret(obj client.Object) []reconcile.Request {
+	requests := r.databasesMatching(obj, credentialsSecretKey)
+	for _, mi := range instancesWithLogin(r.Client, r.Logger, obj) {
+		requests = append(requests, r.databasesMatching(mi, managedInstanceKey)...)
+	}
+	return requests
+}
+
+// databasesMatching lists the Databases in the namespace of obj whose indexed field matches the name of obj
+func (r *DatabaseReconciler) databasesMatching(obj client.Object, field string) []reconcile.Request {
+	return requestsMatching(r.Client, r.Logger, &actionsv1beta1.DatabaseList{}, obj.GetNamespace(), field, obj.GetName())
+}
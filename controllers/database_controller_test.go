@@ -0,0 +1,522 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	batch "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	actionsv1beta1 "github.com/pplavetzki/azure-sql-mi/api/v1beta1"
+	"github.com/pplavetzki/azure-sql-mi/internal/fake"
+	"github.com/pplavetzki/azure-sql-mi/internal/validation"
+)
+
+// newDatabase a Database CR with a unique name hosted on the test sql managed instance
+func newDatabase() *actionsv1beta1.Database {
+	n := nextIndex()
+	return &actionsv1beta1.Database{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("database-%d", n),
+			Namespace: "default",
+		},
+		Spec: actionsv1beta1.DatabaseSpec{
+			Name: fmt.Sprintf("Database%d", n),
+			Connection: actionsv1beta1.ConnectionSpec{
+				Server:             "sqlmi-p-svc",
+				Port:               1433,
+				SQLManagedInstance: "sqlmi",
+			},
+			Options: actionsv1beta1.DatabaseOptions{
+				Parameterization:   "simple",
+				CompatibilityLevel: 150,
+			},
+		},
+	}
+}
+
+var _ = Describe("Database controller", func() {
+	BeforeEach(ensureManagedInstance)
+
+	Context("when a Database is created", func() {
+		It("creates the database, records its recovery_fork_guid and the sync CronJob", func() {
+			db := newDatabase()
+			key := objectKey(db)
+			Expect(k8sClient.Create(ctx, db)).To(Succeed())
+
+			created := &actionsv1beta1.Database{}
+			Eventually(func() string {
+				if err := k8sClient.Get(ctx, key, created); err != nil {
+					return ""
+				}
+				return created.Status.DatabaseID
+			}, timeout, interval).ShouldNot(BeEmpty())
+
+			sqlDB, ok := sqlServer.Database(db.Spec.Name)
+			Expect(ok).To(BeTrue())
+			Expect(created.Status.DatabaseID).To(Equal(sqlDB.RecoveryForkGUID))
+			Expect(sqlDB.CompatibilityLevel).To(Equal(150))
+			Expect(controllerutil.ContainsFinalizer(created, finalizer)).To(BeTrue())
+			Expect(created.Status.ObservedGeneration).To(Equal(created.Generation))
+			Expect(created.IsReady()).To(BeTrue())
+			synced := meta.FindStatusCondition(created.Status.Conditions, actionsv1beta1.DatabaseConditionSynced)
+			Expect(synced.Reason).To(Equal(actionsv1beta1.DatabaseReasonCreated))
+			Expect(created.IsConditionTrue(actionsv1beta1.DatabaseConditionDrifted)).To(BeFalse())
+			Expect(created.Status.LastSyncTime).NotTo(BeNil())
+			Expect(created.Status.Observed).NotTo(BeNil())
+			Expect(created.Status.Observed.State).To(Equal("ONLINE"))
+			Expect(created.Status.Observed.CompatibilityLevel).To(Equal(150))
+			Expect(created.Status.Observed.DataSize.Value()).To(BeEquivalentTo(fake.DefaultFileSize))
+
+			cronJob := &batch.CronJob{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, key, cronJob)
+			}, timeout, interval).Should(Succeed())
+			Expect(cronJob.Spec.Schedule).To(Equal(defaultSchedule))
+
+			By("referencing the login secret instead of embedding the password")
+			pod := cronJob.Spec.JobTemplate.Spec.Template.Spec
+			Expect(pod.ServiceAccountName).To(Equal(SyncServiceAccountName))
+			for _, env := range pod.Containers[0].Env {
+				if env.Name == "DATABASE_PASSWORD" || env.Name == "DATABASE_USER" {
+					Expect(env.Value).To(BeEmpty())
+					Expect(env.ValueFrom.SecretKeyRef.Name).To(Equal("sqlmi-login-secret"))
+				}
+			}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: SyncServiceAccountName, Namespace: db.Namespace}, &corev1.ServiceAccount{})).To(Succeed())
+			role := &rbacv1.Role{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: SyncServiceAccountName, Namespace: db.Namespace}, role)).To(Succeed())
+			Expect(role.Rules).To(Equal(syncRoleRules()))
+
+			By("emitting an event with the CREATE DATABASE executed")
+			Eventually(func() []string {
+				return eventReasons(created)
+			}, timeout, interval).Should(ContainElements(EventReasonDatabaseCreated, EventReasonCronJobCreated))
+		})
+	})
+
+	Context("when the sync job settings change", func() {
+		It("converges the whole CronJob spec", func() {
+			db := newDatabase()
+			key := objectKey(db)
+			limit := int32(1)
+			db.Spec.SyncJob = &actionsv1beta1.SyncJobSpec{
+				Image:                  "example.com/sync:test",
+				NodeSelector:           map[string]string{"kubernetes.io/os": "linux"},
+				Tolerations:            []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpExists}},
+				FailedJobsHistoryLimit: &limit,
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("10m")},
+				},
+			}
+			Expect(k8sClient.Create(ctx, db)).To(Succeed())
+
+			cronJob := &batch.CronJob{}
+			Eventually(func() error {
+				return k8sClient.Get(ctx, key, cronJob)
+			}, timeout, interval).Should(Succeed())
+			pod := cronJob.Spec.JobTemplate.Spec.Template.Spec
+			Expect(pod.Containers[0].Image).To(Equal("example.com/sync:test"))
+			Expect(pod.Containers[0].Resources.Requests.Cpu().String()).To(Equal("10m"))
+			Expect(pod.NodeSelector).To(HaveKeyWithValue("kubernetes.io/os", "linux"))
+			Expect(pod.Tolerations).To(HaveLen(1))
+			Expect(cronJob.Spec.ConcurrencyPolicy).To(Equal(batch.ForbidConcurrent))
+			Expect(*cronJob.Spec.FailedJobsHistoryLimit).To(BeEquivalentTo(1))
+
+			By("suspending the sync and dropping the node selector")
+			suspend := true
+			Eventually(func() error {
+				updated := &actionsv1beta1.Database{}
+				if err := k8sClient.Get(ctx, key, updated); err != nil {
+					return err
+				}
+				updated.Spec.SyncJob.Suspend = &suspend
+				updated.Spec.SyncJob.NodeSelector = nil
+				updated.Spec.SyncJob.ConcurrencyPolicy = batch.ReplaceConcurrent
+				return k8sClient.Update(ctx, updated)
+			}, timeout, interval).Should(Succeed())
+			Eventually(func() bool {
+				if err := k8sClient.Get(ctx, key, cronJob); err != nil {
+					return false
+				}
+				return cronJob.Spec.Suspend != nil && *cronJob.Spec.Suspend &&
+					cronJob.Spec.ConcurrencyPolicy == batch.ReplaceConcurrent &&
+					cronJob.Spec.JobTemplate.Spec.Template.Spec.NodeSelector == nil
+			}, timeout, interval).Should(BeTrue())
+		})
+	})
+
+	Context("when the database already exists on the server", func() {
+		It("refuses to manage it unless adoptExisting is set", func() {
+			db := newDatabase()
+			key := objectKey(db)
+			id := sqlServer.AddDatabase(db.Spec.Name)
+			Expect(k8sClient.Create(ctx, db)).To(Succeed())
+
+			Consistently(func() string {
+				created := &actionsv1beta1.Database{}
+				Expect(k8sClient.Get(ctx, key, created)).To(Succeed())
+				return created.Status.DatabaseID
+			}, time.Second*2, interval).Should(BeEmpty())
+
+			By("setting adoptExisting")
+			Eventually(func() error {
+				created := &actionsv1beta1.Database{}
+				if err := k8sClient.Get(ctx, key, created); err != nil {
+					return err
+				}
+				created.Spec.AdoptExisting = true
+				return k8sClient.Update(ctx, created)
+			}, timeout, interval).Should(Succeed())
+
+			Eventually(func() string {
+				adopted := &actionsv1beta1.Database{}
+				if err := k8sClient.Get(ctx, key, adopted); err != nil {
+					return ""
+				}
+				return adopted.Status.DatabaseID
+			}, timeout, interval).Should(Equal(id))
+		})
+
+		It("reports the drift of the adopted database", func() {
+			db := newDatabase()
+			db.Spec.AdoptExisting = true
+			db.Spec.Options.AllowSnapshotIsolation = true
+			key := objectKey(db)
+			id := sqlServer.AddDatabase(db.Spec.Name)
+			Expect(k8sClient.Create(ctx, db)).To(Succeed())
+
+			adopted := &actionsv1beta1.Database{}
+			Eventually(func() string {
+				if err := k8sClient.Get(ctx, key, adopted); err != nil {
+					return ""
+				}
+				return adopted.Status.DatabaseID
+			}, timeout, interval).Should(Equal(id))
+			Expect(adopted.Status.Drift).To(ContainElement(actionsv1beta1.DriftField{
+				Field: "allowSnapshotIsolation", Desired: "true", Observed: "false", Remediable: true}))
+			Expect(adopted.Status.LastDrift).NotTo(BeNil())
+
+			By("reconciling the adopted Database again")
+			touch(key)
+			Consistently(func() bool {
+				reconciled := &actionsv1beta1.Database{}
+				if err := k8sClient.Get(ctx, key, reconciled); err != nil {
+					return false
+				}
+				sqlDB, _ := sqlServer.Database(db.Spec.Name)
+				return reconciled.IsConditionTrue(actionsv1beta1.DatabaseConditionDrifted) && len(reconciled.Status.Drift) == 1 &&
+					!sqlDB.AllowSnapshotIsolation
+			}, time.Second*2, interval).Should(BeTrue())
+		})
+	})
+
+	Context("when the database drifts", func() {
+		It("alters the database back to the spec with the Remediate drift policy", func() {
+			db := newDatabase()
+			db.Spec.Sync.DriftPolicy = actionsv1beta1.DriftPolicyRemediate
+			key := objectKey(db)
+			Expect(k8sClient.Create(ctx, db)).To(Succeed())
+			Eventually(func() bool {
+				_, ok := sqlServer.Database(db.Spec.Name)
+				return ok
+			}, timeout, interval).Should(BeTrue())
+
+			By("changing the database outside of the controller")
+			Expect(sqlServer.UpdateDatabase(db.Spec.Name, func(d *fake.Database) {
+				d.AllowSnapshotIsolation = true
+				d.AllowReadCommittedSnapshot = true
+				d.CompatibilityLevel = 130
+				d.Parameterization = "forced"
+			})).To(Succeed())
+			touch(key)
+
+			Eventually(func() bool {
+				sqlDB, _ := sqlServer.Database(db.Spec.Name)
+				return !sqlDB.AllowSnapshotIsolation && !sqlDB.AllowReadCommittedSnapshot &&
+					sqlDB.CompatibilityLevel == 150 && sqlDB.Parameterization == "simple"
+			}, timeout, interval).Should(BeTrue())
+		})
+	})
+
+	Context("when the database is renamed on the server", func() {
+		It("does not create a second database", func() {
+			db := newDatabase()
+			key := objectKey(db)
+			Expect(k8sClient.Create(ctx, db)).To(Succeed())
+
+			created := &actionsv1beta1.Database{}
+			Eventually(func() string {
+				if err := k8sClient.Get(ctx, key, created); err != nil {
+					return ""
+				}
+				return created.Status.DatabaseID
+			}, timeout, interval).ShouldNot(BeEmpty())
+
+			By("renaming the database outside of the controller")
+			Expect(sqlServer.RenameDatabase(db.Spec.Name, db.Spec.Name+"_renamed")).To(Succeed())
+			touch(key)
+
+			Consistently(func() bool {
+				_, ok := sqlServer.Database(db.Spec.Name)
+				return ok
+			}, time.Second*2, interval).Should(BeFalse())
+			renamed, ok := sqlServer.Database(db.Spec.Name + "_renamed")
+			Expect(ok).To(BeTrue())
+			Expect(renamed.RecoveryForkGUID).To(Equal(created.Status.DatabaseID))
+		})
+	})
+
+	Context("when a Database with a deletion policy is deleted", func() {
+		// createDatabase creates the Database and waits for the database to be created
+		createDatabase := func(db *actionsv1beta1.Database) types.NamespacedName {
+			key := objectKey(db)
+			Expect(k8sClient.Create(ctx, db)).To(Succeed())
+			Eventually(func() string {
+				created := &actionsv1beta1.Database{}
+				if err := k8sClient.Get(ctx, key, created); err != nil {
+					return ""
+				}
+				return created.Status.DatabaseID
+			}, timeout, interval).ShouldNot(BeEmpty())
+			return key
+		}
+
+		It("retains the database with Retain", func() {
+			db := newDatabase()
+			db.Spec.DeletionPolicy = actionsv1beta1.DeletionPolicyRetain
+			key := createDatabase(db)
+
+			Expect(k8sClient.Delete(ctx, db)).To(Succeed())
+			waitForDeletion(key, &actionsv1beta1.Database{})
+			_, ok := sqlServer.Database(db.Spec.Name)
+			Expect(ok).To(BeTrue())
+		})
+
+		It("backs up the database before dropping it with BackupThenDelete", func() {
+			db := newDatabase()
+			db.Spec.DeletionPolicy = actionsv1beta1.DeletionPolicyBackupThenDelete
+			db.Spec.BackupDirectory = "/backups"
+			key := createDatabase(db)
+
+			Expect(k8sClient.Delete(ctx, db)).To(Succeed())
+			waitForDeletion(key, &actionsv1beta1.Database{})
+			_, ok := sqlServer.Database(db.Spec.Name)
+			Expect(ok).To(BeFalse())
+
+			backups := []string{}
+			for path, name := range sqlServer.Backups() {
+				if name == db.Spec.Name {
+					backups = append(backups, path)
+				}
+			}
+			Expect(backups).To(ConsistOf(HavePrefix("/backups/" + db.Spec.Name + "_")))
+		})
+
+		It("renames the database and drops it after the grace period with SoftDelete", func() {
+			db := newDatabase()
+			db.Spec.DeletionPolicy = actionsv1beta1.DeletionPolicySoftDelete
+			db.Spec.SoftDeleteGracePeriod = &metav1.Duration{Duration: 3 * time.Second}
+			key := createDatabase(db)
+			sqlDB, _ := sqlServer.Database(db.Spec.Name)
+
+			Expect(k8sClient.Delete(ctx, db)).To(Succeed())
+			softDeleted := &actionsv1beta1.Database{}
+			Eventually(func() string {
+				if err := k8sClient.Get(ctx, key, softDeleted); err != nil {
+					return ""
+				}
+				return softDeleted.Status.SoftDeletedName
+			}, timeout, interval).ShouldNot(BeEmpty())
+
+			renamed, ok := sqlServer.Database(softDeleted.Status.SoftDeletedName)
+			Expect(ok).To(BeTrue())
+			Expect(renamed.RecoveryForkGUID).To(Equal(sqlDB.RecoveryForkGUID))
+			_, ok = sqlServer.Database(db.Spec.Name)
+			Expect(ok).To(BeFalse())
+
+			waitForDeletion(key, &actionsv1beta1.Database{})
+			_, ok = sqlServer.Database(softDeleted.Status.SoftDeletedName)
+			Expect(ok).To(BeFalse())
+		})
+	})
+
+	Context("soft deleted names", func() {
+		It("suffixes the name with the deletion time and keeps it a valid identifier", func() {
+			now := time.Date(2021, 10, 16, 12, 0, 0, 0, time.UTC)
+			Expect(softDeletedName("MyDatabase", now)).To(Equal("MyDatabase_deleted_20211016120000"))
+
+			long := softDeletedName(strings.Repeat("a", validation.MaxIdentifierLength), now)
+			Expect(long).To(HaveLen(validation.MaxIdentifierLength))
+			Expect(long).To(HaveSuffix("_deleted_20211016120000"))
+		})
+
+		It("keeps the backup file within the backup directory", func() {
+			now := time.Date(2021, 10, 16, 12, 0, 0, 0, time.UTC)
+			Expect(backupPath("/backups", "../../etc/My Db", now)).To(Equal("/backups/.._.._etc_My_Db_20211016120000.bak"))
+		})
+	})
+
+	Context("when a Database is deleted", func() {
+		It("drops the database and removes the finalizer", func() {
+			db := newDatabase()
+			key := objectKey(db)
+			Expect(k8sClient.Create(ctx, db)).To(Succeed())
+			Eventually(func() bool {
+				created := &actionsv1beta1.Database{}
+				if err := k8sClient.Get(ctx, key, created); err != nil {
+					return false
+				}
+				return created.Status.DatabaseID != ""
+			}, timeout, interval).Should(BeTrue())
+
+			Expect(k8sClient.Delete(ctx, db)).To(Succeed())
+
+			waitForDeletion(key, &actionsv1beta1.Database{})
+			_, ok := sqlServer.Database(db.Spec.Name)
+			Expect(ok).To(BeFalse())
+		})
+	})
+})
+
+var _ = Describe("Database deletion retries", func() {
+	var (
+		server *fake.Server
+		r      *DatabaseReconciler
+		db     *actionsv1beta1.Database
+	)
+
+	BeforeEach(func() {
+		server = fake.NewServer()
+		db = newDatabase()
+		db.Spec.BackupDirectory = "/backups"
+		db.Status.DatabaseID = server.AddDatabase(db.Spec.Name)
+		r = &DatabaseReconciler{Client: newFakeClient(db), Recorder: record.NewFakeRecorder(10)}
+	})
+
+	// finalize applies the deletion policy to the Database as last written, as a retried reconcile does
+	finalize := func() (time.Duration, error) {
+		Expect(r.Get(context.Background(), objectKey(db), db)).To(Succeed())
+		return r.finalizeDatabase(context.Background(), db, server.Factory()("server", "sa", "P@ssw0rd", 1433))
+	}
+
+	It("renames the database to the recorded name when the rename is retried", func() {
+		db.Spec.DeletionPolicy = actionsv1beta1.DeletionPolicySoftDelete
+		Expect(r.Update(context.Background(), db)).To(Succeed())
+		server.FailOn("RenameDatabase", errors.New("database is in use"))
+		_, err := finalize()
+		Expect(err).To(HaveOccurred())
+		name := db.Status.SoftDeletedName
+		Expect(name).NotTo(BeEmpty())
+
+		server.FailOn("RenameDatabase", nil)
+		remaining, err := finalize()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(remaining).To(BeNumerically(">", 0))
+		Expect(db.Status.SoftDeletedName).To(Equal(name))
+		_, ok := server.Database(name)
+		Expect(ok).To(BeTrue())
+	})
+
+	It("doesn't back up the database again when the drop is retried", func() {
+		db.Spec.DeletionPolicy = actionsv1beta1.DeletionPolicyBackupThenDelete
+		Expect(r.Update(context.Background(), db)).To(Succeed())
+		server.FailOn("DeleteDatabase", errors.New("database is in use"))
+		_, err := finalize()
+		Expect(err).To(HaveOccurred())
+		Expect(db.Status.BackupPath).To(HavePrefix("/backups/" + db.Spec.Name + "_"))
+
+		server.FailOn("DeleteDatabase", nil)
+		server.FailOn("BackupDatabase", errors.New("backup device is full"))
+		_, err = finalize()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(server.Backups()).To(HaveLen(1))
+		_, ok := server.Database(db.Spec.Name)
+		Expect(ok).To(BeFalse())
+	})
+})
+
+var _ = Describe("Database created before a failed reconcile", func() {
+	var (
+		server *fake.Server
+		c      client.Client
+		r      *DatabaseReconciler
+		db     *actionsv1beta1.Database
+	)
+
+	BeforeEach(func() {
+		server = fake.NewServer()
+		db = newDatabase()
+		db.Generation = 1
+		db.Spec.Options.CompatibilityLevel = 140
+		db.Spec.Options.AllowSnapshotIsolation = true
+		c = newFakeClient(db)
+		r = &DatabaseReconciler{Client: c, Scheme: c.Scheme(), Logger: logr.Discard(), NewProvider: server.Factory(),
+			Recorder: record.NewFakeRecorder(20)}
+	})
+
+	// reconcileAgain reconciles the Database with the CronJob applied and checks it manages the database it created
+	reconcileAgain := func() {
+		r.Client = serverSideApply{Client: c}
+		_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: objectKey(db)})
+		Expect(err).NotTo(HaveOccurred())
+		reconciled := &actionsv1beta1.Database{}
+		Expect(c.Get(context.Background(), objectKey(db), reconciled)).To(Succeed())
+		d, ok := server.Database(db.Spec.Name)
+		Expect(ok).To(BeTrue())
+		Expect(reconciled.Status.DatabaseID).To(Equal(d.RecoveryForkGUID))
+		Expect(reconciled.IsReady()).To(BeTrue())
+		Expect(d.CompatibilityLevel).To(Equal(140))
+		Expect(d.AllowSnapshotIsolation).To(BeTrue())
+	}
+
+	It("manages the database it created when the CronJob apply failed", func() {
+		r.Client = serverSideApply{Client: c, err: errors.New("the server is currently unable to handle the request")}
+		_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: objectKey(db)})
+		Expect(err).To(MatchError(ContainSubstring("unable to handle the request")))
+		reconcileAgain()
+	})
+
+	It("alters the database it created when the options failed to apply", func() {
+		server.FailOn("AlterDatabase", errors.New("lock request time out period exceeded"))
+		r.Client = serverSideApply{Client: c}
+		_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: objectKey(db)})
+		Expect(err).To(HaveOccurred())
+		d, _ := server.Database(db.Spec.Name)
+		Expect(d.AllowSnapshotIsolation).To(BeFalse())
+
+		server.FailOn("AlterDatabase", nil)
+		reconcileAgain()
+	})
+})
@@ -0,0 +1,329 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	actionsv1beta1 "github.com/pplavetzki/azure-sql-mi/api/v1beta1"
+	ms "github.com/pplavetzki/azure-sql-mi/internal"
+	"github.com/pplavetzki/azure-sql-mi/internal/dbsync"
+)
+
+// DatabasePermissionReconciler reconciles a DatabasePermission object, its fields are those of the LoginReconciler
+type DatabasePermissionReconciler struct {
+	client.Client
+	Scheme       *runtime.Scheme
+	Logger       logr.Logger
+	NewProvider  ms.ProviderFactory
+	Recorder     record.EventRecorder
+	ResyncPeriod time.Duration
+}
+
+//+kubebuilder:rbac:groups=actions.msft.isd.coe.io,resources=databasepermissions,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=actions.msft.isd.coe.io,resources=databasepermissions/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=actions.msft.isd.coe.io,resources=databasepermissions/finalizers,verbs=update
+//+kubebuilder:rbac:groups=actions.msft.isd.coe.io,resources=databases,verbs=get;list;watch
+//+kubebuilder:rbac:groups=actions.msft.isd.coe.io,resources=databaseusers,verbs=get;list;watch
+//+kubebuilder:rbac:groups=actions.msft.isd.coe.io,resources=databaseroles,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+
+// Reconcile grants and denies the permissions of the DatabasePermission to its principal in the database of its
+// Database on every change and resync, the permissions it applied that are no longer in the spec are revoked and
+// all of them are revoked when the DatabasePermission is deleted. Permissions of the principal granted by someone
+// else are left alone
+func (r *DatabasePermissionReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+
+	permission := &actionsv1beta1.DatabasePermission{}
+	if err := r.Get(ctx, req.NamespacedName, permission); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	read := permission.Status.DeepCopy()
+	db, msSQL, err := connectDatabase(ctx, r.Client, r.Recorder, r.NewProvider, permission, permission.Spec.DatabaseRef.Name)
+	if db == nil || err != nil {
+		return ctrl.Result{}, err
+	}
+	databaseName := db.Spec.Name
+
+	if permission.ObjectMeta.DeletionTimestamp.IsZero() {
+		if err = addFinalizer(ctx, r.Client, permission); err != nil {
+			return ctrl.Result{}, err
+		}
+	} else {
+		if controllerutil.ContainsFinalizer(permission, finalizer) && len(permission.Status.Applied) > 0 {
+			if err = r.revokeApplied(ctx, permission, msSQL, databaseName); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		return ctrl.Result{}, removeFinalizer(ctx, r.Client, permission)
+	}
+
+	desired, err := DesiredPermissions(permission)
+	if err != nil {
+		return syncFailed(ctx, r.Client, r.Recorder, permission, actionsv1beta1.DatabasePermissionReasonSyncFailed, err)
+	}
+	owned := dbsync.AppliedPermissions(permission)
+	observed, err := observePrincipals(ctx, msSQL, databaseName, append([]ms.Permission{{Principal: permission.Spec.Principal}}, owned...))
+	if err != nil {
+		return syncFailed(ctx, r.Client, r.Recorder, permission, actionsv1beta1.DatabasePermissionReasonSyncFailed, err)
+	}
+
+	// differences are drift unless the spec changed since the last sync
+	reportDrift := permission.Status.ObservedGeneration != 0 && permission.Status.ObservedGeneration == permission.Generation
+	if err = r.applyPermissions(ctx, permission, msSQL, databaseName, desired, observed, reportDrift); err != nil {
+		return syncFailed(ctx, r.Client, r.Recorder, permission, actionsv1beta1.DatabasePermissionReasonSyncFailed, err)
+	}
+
+	effective, err := msSQL.Permissions(ctx, databaseName, permission.Spec.Principal)
+	if err != nil {
+		return syncFailed(ctx, r.Client, r.Recorder, permission, actionsv1beta1.DatabasePermissionReasonSyncFailed, err)
+	}
+	permission.Status.LastSyncTime = syncTime(permission.Status.LastSyncTime, r.ResyncPeriod)
+	permission.Status.Effective = dbsync.ObservedPermissions(effective)
+	permission.MarkSynced(actionsv1beta1.DatabasePermissionReasonSynced,
+		"Permissions were compared with the spec and applied where needed")
+	permission.Status.ObservedGeneration = permission.Generation
+	if err = updateStatusIfChanged(ctx, r.Client, permission, read, &permission.Status); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: r.ResyncPeriod}, nil
+}
+
+// DesiredPermissions the rows of sys.database_permissions declared by the entries of the DatabasePermission, a
+// permission cannot be declared in two states
+func DesiredPermissions(permission *actionsv1beta1.DatabasePermission) ([]ms.Permission, error) {
+	desired := []ms.Permission{}
+	byKey := map[string]string{}
+	for _, entry := range permission.Spec.Permissions {
+		state := ms.PermissionStateGrant
+		switch {
+		case entry.State == actionsv1beta1.PermissionStateDeny && entry.WithGrantOption:
+			return nil, fmt.Errorf("denied permissions %s cannot have the grant option", strings.Join(entry.Permissions, ", "))
+		case entry.State == actionsv1beta1.PermissionStateDeny:
+			state = ms.PermissionStateDeny
+		case entry.WithGrantOption:
+			state = ms.PermissionStateGrantWithGrantOption
+		}
+		class := ms.PermissionClassDatabase
+		switch entry.On.Type {
+		case actionsv1beta1.SecurableTypeSchema:
+			class = ms.PermissionClassSchema
+		case actionsv1beta1.SecurableTypeObject:
+			class = ms.PermissionClassObject
+		}
+		for _, name := range entry.Permissions {
+			p := ms.Permission{
+				Principal:  permission.Spec.Principal,
+				Class:      class,
+				Schema:     entry.On.Schema,
+				Object:     entry.On.Object,
+				Permission: strings.ToUpper(strings.TrimSpace(name)),
+				State:      state,
+			}
+			if err := ms.ValidatePermission(&p); err != nil {
+				return nil, err
+			}
+			if declared, ok := byKey[p.Key()]; ok {
+				if declared != p.State {
+					return nil, fmt.Errorf("permission %s is declared as both %s and %s", p.String(), declared, p.State)
+				}
+				continue
+			}
+			byKey[p.Key()] = p.State
+			desired = append(desired, p)
+		}
+	}
+	ms.SortPermissions(desired)
+	return desired, nil
+}
+
+// observePrincipals the rows of sys.database_permissions of the distinct principals of the permissions
+func observePrincipals(ctx context.Context, msSQL ms.Provider, databaseName string, permissions []ms.Permission) ([]ms.Permission, error) {
+	var observed []ms.Permission
+	seen := map[string]bool{}
+	for _, p := range permissions {
+		principal := strings.ToLower(p.Principal)
+		if seen[principal] {
+			continue
+		}
+		seen[principal] = true
+		rows, err := msSQL.Permissions(ctx, databaseName, p.Principal)
+		if err != nil {
+			return nil, err
+		}
+		observed = append(observed, rows...)
+	}
+	return observed, nil
+}
+
+// applyPermissions grants and denies the desired permissions that are missing or in another state and revokes the
+// applied permissions that are no longer desired, emitting a Normal event with the statements executed. When
+// reportDrift is set the differences are reported with a Warning event and recorded as the last drift. The
+// permissions applied so far are recorded in the status even when applying one fails
+func (r *DatabasePermissionReconciler) applyPermissions(ctx context.Context, permission *actionsv1beta1.DatabasePermission, msSQL ms.Provider, databaseName string, desired, observed []ms.Permission, reportDrift bool) error {
+	diff := ms.DiffPermissions(desired, observed, dbsync.AppliedPermissions(permission))
+
+	// the permissions that are already as desired are managed from now on, the applied ones that were revoked by
+	// someone else are forgotten
+	observedKeys := map[string]bool{}
+	for _, o := range observed {
+		observedKeys[o.Key()] = true
+	}
+	changed := map[string]bool{}
+	for _, c := range diff.Changes {
+		if c.Desired != nil {
+			changed[c.Desired.Key()] = true
+		}
+	}
+	applied := map[string]ms.Permission{}
+	for _, p := range dbsync.AppliedPermissions(permission) {
+		if observedKeys[p.Key()] {
+			applied[p.Key()] = p
+		}
+	}
+	for _, d := range desired {
+		if !changed[d.Key()] {
+			applied[d.Key()] = d
+		}
+	}
+
+	if diff.HasDrift() && reportDrift {
+		r.Recorder.Eventf(permission, corev1.EventTypeWarning, EventReasonDriftDetected, "Permissions differ from the spec: %s", permissionsSummary(diff))
+		now := metav1.Now()
+		permission.Status.LastDrift = &now
+	}
+
+	executed := []*ms.Statement{}
+	var err error
+	for _, c := range diff.Changes {
+		var statement *ms.Statement
+		if statement, err = ms.ApplyPermissionStatement(databaseName, c.Desired, c.Observed); err != nil {
+			break
+		}
+		if err = msSQL.ApplyPermission(ctx, databaseName, c.Desired, c.Observed); err != nil {
+			break
+		}
+		executed = append(executed, statement)
+		if c.Desired != nil {
+			applied[c.Desired.Key()] = *c.Desired
+		} else {
+			delete(applied, c.Observed.Key())
+		}
+	}
+	if len(executed) > 0 {
+		r.Recorder.Eventf(permission, corev1.EventTypeNormal, EventReasonPermissionsChanged, "Executed %s", statementsSummary(executed...))
+	}
+
+	rows := make([]ms.Permission, 0, len(applied))
+	for _, p := range applied {
+		rows = append(rows, p)
+	}
+	ms.SortPermissions(rows)
+	permission.Status.Applied = dbsync.ObservedPermissions(rows)
+	return err
+}
+
+// permissionsSummary describes the changes of the permissions of a principal for an event
+func permissionsSummary(diff *ms.PermissionDiff) string {
+	summary := make([]string, 0, len(diff.Changes))
+	for _, c := range diff.Changes {
+		switch {
+		case c.Desired == nil:
+			summary = append(summary, fmt.Sprintf("unexpected %s", c.Observed))
+		case c.Observed == nil:
+			summary = append(summary, fmt.Sprintf("missing %s", c.Desired))
+		default:
+			summary = append(summary, fmt.Sprintf("%s instead of %s", c.Observed, c.Desired))
+		}
+	}
+	return strings.Join(summary, "; ")
+}
+
+// revokeApplied revokes the permissions applied by the controller that are still in place and emits an event with
+// the REVOKEs executed, nothing is revoked when the database no longer exists
+func (r *DatabasePermissionReconciler) revokeApplied(ctx context.Context, permission *actionsv1beta1.DatabasePermission, msSQL ms.Provider, databaseName string) error {
+	id, err := msSQL.FindDatabaseID(ctx, databaseName)
+	if err != nil {
+		return err
+	}
+	if id == nil {
+		return nil
+	}
+	applied := dbsync.AppliedPermissions(permission)
+	observed, err := observePrincipals(ctx, msSQL, databaseName, applied)
+	if err != nil {
+		return err
+	}
+	diff := ms.DiffPermissions(nil, observed, applied)
+	executed := []*ms.Statement{}
+	for _, c := range diff.Changes {
+		var statement *ms.Statement
+		if statement, err = ms.ApplyPermissionStatement(databaseName, nil, c.Observed); err != nil {
+			break
+		}
+		if err = msSQL.ApplyPermission(ctx, databaseName, nil, c.Observed); err != nil {
+			break
+		}
+		executed = append(executed, statement)
+	}
+	if len(executed) > 0 {
+		r.Recorder.Eventf(permission, corev1.EventTypeNormal, EventReasonPermissionsRevoked, "Executed %s", statementsSummary(executed...))
+	}
+	return err
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *DatabasePermissionReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &actionsv1beta1.DatabasePermission{}, databaseRefKey, func(rawObj client.Object) []string {
+		permission := rawObj.(*actionsv1beta1.DatabasePermission)
+		return []string{permission.Spec.DatabaseRef.Name}
+	}); err != nil {
+		return err
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&actionsv1beta1.DatabasePermission{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(&source.Kind{Type: &actionsv1beta1.Database{}}, handler.EnqueueRequestsFromMapFunc(r.permissionsForDatabase),
+			builder.WithPredicates(databaseReadyChanged)).
+		Watches(&source.Kind{Type: &actionsv1beta1.DatabaseUser{}}, handler.EnqueueRequestsFromMapFunc(r.permissionsForPrincipal)).
+		Watches(&source.Kind{Type: &actionsv1beta1.DatabaseRole{}}, handler.EnqueueRequestsFromMapFunc(r.permissionsForPrincipal)).
+		Complete(r)
+}
+
+// permissionsForDatabase maps a Database to its DatabasePermissions so the permissions are reconciled when the
+// Database becomes ready
+func (r *DatabasePermissionReconciler) permissionsForDatabase(obj client.Object) []reconcile.Request {
+	return r.permissionsOfDatabase(obj.GetNamespace(), obj.GetName())
+}
+
+// permissionsForPrincipal maps a DatabaseUser or a DatabaseRole to the DatabasePermissions of its Database so
+// permissions waiting for their principal to exist are reconciled once it is created
+func (r *DatabasePermissionReconciler) permissionsForPrincipal(obj client.Object) []reconcile.Request {
+	switch principal := obj.(type) {
+	case *actionsv1beta1.DatabaseUser:
+		return r.permissionsOfDatabase(principal.Namespace, principal.Spec.DatabaseRef.Name)
+	case *actionsv1beta1.DatabaseRole:
+		return r.permissionsOfDatabase(principal.Namespace, principal.Spec.DatabaseRef.Name)
+	}
+	return nil
+}
+
+// permissionsOfDatabase lists the DatabasePermissions in the namespace referencing the Database
+func (r *DatabasePermissionReconciler) permissionsOfDatabase(namespace, databaseName string) []reconcile.Request {
+	return requestsMatching(r.Client, r.Logger, &actionsv1beta1.DatabasePermissionList{}, namespace, databaseRefKey, databaseName)
+}
@@ -0,0 +1,187 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	actionsv1beta1 "github.com/pplavetzki/azure-sql-mi/api/v1beta1"
+	ms "github.com/pplavetzki/azure-sql-mi/internal"
+	"github.com/pplavetzki/azure-sql-mi/internal/dbsync"
+	"github.com/pplavetzki/azure-sql-mi/internal/fake"
+)
+
+// newDatabasePermission a DatabasePermission CR with a unique name granting SELECT on the schema sales to the
+// principal in the Database named databaseName
+func newDatabasePermission(databaseName, principal string) *actionsv1beta1.DatabasePermission {
+	n := nextIndex()
+	return &actionsv1beta1.DatabasePermission{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("permission-%d", n),
+			Namespace: "default",
+		},
+		Spec: actionsv1beta1.DatabasePermissionSpec{
+			DatabaseRef: corev1.LocalObjectReference{Name: databaseName},
+			Principal:   principal,
+			Permissions: []actionsv1beta1.PermissionEntry{{
+				State:       actionsv1beta1.PermissionStateGrant,
+				Permissions: []string{"SELECT"},
+				On:          actionsv1beta1.Securable{Type: actionsv1beta1.SecurableTypeSchema, Schema: "sales"},
+			}},
+		},
+	}
+}
+
+// selectOnSales the row of sys.database_permissions of SELECT on the schema sales in the state
+func selectOnSales(principal, state string) ms.Permission {
+	return ms.Permission{Principal: principal, Class: ms.PermissionClassSchema, Schema: "sales", Permission: "SELECT", State: state}
+}
+
+// waitForApplied waits for the DatabasePermission to record the permissions it applied
+func waitForApplied(key types.NamespacedName) *actionsv1beta1.DatabasePermission {
+	permission := &actionsv1beta1.DatabasePermission{ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace}}
+	waitFor(permission, func() bool { return len(permission.Status.Applied) > 0 })
+	return permission
+}
+
+var _ = Describe("DatabasePermission controller", func() {
+	BeforeEach(ensureManagedInstance)
+
+	Context("when a DatabasePermission is created", func() {
+		It("grants the permissions and records the effective permissions of the principal", func() {
+			db := createReadyDatabase()
+			_, err := sqlServer.AddUser(db.Spec.Name, "app")
+			Expect(err).NotTo(HaveOccurred())
+			permission := newDatabasePermission(db.Name, "app")
+			permission.Spec.Permissions = append(permission.Spec.Permissions, actionsv1beta1.PermissionEntry{
+				State:       actionsv1beta1.PermissionStateDeny,
+				Permissions: []string{"DELETE"},
+				On:          actionsv1beta1.Securable{Type: actionsv1beta1.SecurableTypeObject, Schema: "sales", Object: "orders"},
+			})
+			key := objectKey(permission)
+			Expect(k8sClient.Create(ctx, permission)).To(Succeed())
+
+			created := waitForApplied(key)
+			Expect(created.Status.Applied).To(HaveLen(2))
+			Expect(sqlServer.Permissions(db.Spec.Name, "app")).To(ContainElement(selectOnSales("app", ms.PermissionStateGrant)))
+			Expect(created.Status.Effective).To(HaveLen(3))
+			Expect(controllerutil.ContainsFinalizer(created, finalizer)).To(BeTrue())
+			Expect(created.IsReady()).To(BeTrue())
+			Expect(eventReasons(created)).To(ContainElement(EventReasonPermissionsChanged))
+		})
+	})
+
+	Context("when a permission is removed from the spec", func() {
+		It("revokes it and leaves the permissions granted by someone else", func() {
+			db := createReadyDatabase()
+			_, err := sqlServer.AddUser(db.Spec.Name, "app")
+			Expect(err).NotTo(HaveOccurred())
+			manual := ms.Permission{Principal: "app", Class: ms.PermissionClassDatabase, Permission: "SHOWPLAN", State: ms.PermissionStateGrant}
+			Expect(sqlServer.Grant(db.Spec.Name, manual)).To(Succeed())
+			permission := newDatabasePermission(db.Name, "app")
+			key := objectKey(permission)
+			Expect(k8sClient.Create(ctx, permission)).To(Succeed())
+			waitForApplied(key)
+
+			Eventually(func() error {
+				existing := &actionsv1beta1.DatabasePermission{}
+				if err := k8sClient.Get(ctx, key, existing); err != nil {
+					return err
+				}
+				existing.Spec.Permissions[0].Permissions = []string{"EXECUTE"}
+				return k8sClient.Update(ctx, existing)
+			}, timeout, interval).Should(Succeed())
+
+			Eventually(func() []ms.Permission {
+				return sqlServer.Permissions(db.Spec.Name, "app")
+			}, timeout, interval).ShouldNot(ContainElement(selectOnSales("app", ms.PermissionStateGrant)))
+			Expect(sqlServer.Permissions(db.Spec.Name, "app")).To(ContainElement(manual))
+		})
+	})
+
+	Context("when a DatabasePermission is deleted", func() {
+		It("revokes the permissions it applied and removes the finalizer", func() {
+			db := createReadyDatabase()
+			_, err := sqlServer.AddUser(db.Spec.Name, "app")
+			Expect(err).NotTo(HaveOccurred())
+			permission := newDatabasePermission(db.Name, "app")
+			key := objectKey(permission)
+			Expect(k8sClient.Create(ctx, permission)).To(Succeed())
+			waitForApplied(key)
+
+			Expect(k8sClient.Delete(ctx, permission)).To(Succeed())
+
+			waitForDeletion(key, &actionsv1beta1.DatabasePermission{})
+			Expect(sqlServer.Permissions(db.Spec.Name, "app")).NotTo(ContainElement(selectOnSales("app", ms.PermissionStateGrant)))
+		})
+	})
+})
+
+var _ = Describe("DatabasePermission drift", func() {
+	var (
+		server   *fake.Server
+		provider ms.Provider
+		recorder *record.FakeRecorder
+		r        *DatabasePermissionReconciler
+	)
+
+	BeforeEach(func() {
+		server, provider = newFakeDatabase("app", "reporting")
+		recorder = record.NewFakeRecorder(10)
+		r = &DatabasePermissionReconciler{Recorder: recorder}
+	})
+
+	apply := func(permission *actionsv1beta1.DatabasePermission, reportDrift bool) error {
+		desired, err := DesiredPermissions(permission)
+		Expect(err).NotTo(HaveOccurred())
+		observed, err := observePrincipals(context.Background(), provider, "App",
+			append([]ms.Permission{{Principal: permission.Spec.Principal}}, dbsync.AppliedPermissions(permission)...))
+		Expect(err).NotTo(HaveOccurred())
+		return r.applyPermissions(context.Background(), permission, provider, "App", desired, observed, reportDrift)
+	}
+
+	It("reports a permission changed by hand as drift and applies it again", func() {
+		permission := newDatabasePermission("app", "app")
+		Expect(apply(permission, false)).To(Succeed())
+		Expect(<-recorder.Events).To(HavePrefix(corev1.EventTypeNormal + " " + EventReasonPermissionsChanged))
+		Expect(server.Grant("App", selectOnSales("app", ms.PermissionStateDeny))).To(Succeed())
+
+		Expect(apply(permission, true)).To(Succeed())
+
+		Expect(server.Permissions("App", "app")).To(ContainElement(selectOnSales("app", ms.PermissionStateGrant)))
+		Expect(permission.Status.LastDrift).NotTo(BeNil())
+		Expect(<-recorder.Events).To(ContainSubstring("DENY SELECT ON SCHEMA::sales TO app instead of GRANT SELECT ON SCHEMA::sales TO app"))
+	})
+
+	It("revokes the permissions of the previous principal", func() {
+		permission := newDatabasePermission("app", "app")
+		Expect(apply(permission, false)).To(Succeed())
+		permission.Spec.Principal = "reporting"
+
+		Expect(apply(permission, false)).To(Succeed())
+
+		Expect(server.Permissions("App", "app")).NotTo(ContainElement(selectOnSales("app", ms.PermissionStateGrant)))
+		Expect(server.Permissions("App", "reporting")).To(ContainElement(selectOnSales("reporting", ms.PermissionStateGrant)))
+		Expect(permission.Status.Applied).To(Equal([]actionsv1beta1.ObservedPermission{
+			actionsv1beta1.ObservedPermission(selectOnSales("reporting", ms.PermissionStateGrant)),
+		}))
+	})
+
+	It("refuses a permission declared both granted and denied", func() {
+		permission := newDatabasePermission("app", "app")
+		permission.Spec.Permissions = append(permission.Spec.Permissions, actionsv1beta1.PermissionEntry{
+			State:       actionsv1beta1.PermissionStateDeny,
+			Permissions: []string{"select"},
+			On:          actionsv1beta1.Securable{Type: actionsv1beta1.SecurableTypeSchema, Schema: "sales"},
+		})
+		_, err := DesiredPermissions(permission)
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,315 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	actionsv1beta1 "github.com/pplavetzki/azure-sql-mi/api/v1beta1"
+	ms "github.com/pplavetzki/azure-sql-mi/internal"
+)
+
+// DatabaseRoleReconciler reconciles a DatabaseRole object, its fields are those of the LoginReconciler
+type DatabaseRoleReconciler struct {
+	client.Client
+	Scheme       *runtime.Scheme
+	Logger       logr.Logger
+	NewProvider  ms.ProviderFactory
+	Recorder     record.EventRecorder
+	ResyncPeriod time.Duration
+}
+
+//+kubebuilder:rbac:groups=actions.msft.isd.coe.io,resources=databaseroles,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=actions.msft.isd.coe.io,resources=databaseroles/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=actions.msft.isd.coe.io,resources=databaseroles/finalizers,verbs=update
+//+kubebuilder:rbac:groups=actions.msft.isd.coe.io,resources=databases,verbs=get;list;watch
+//+kubebuilder:rbac:groups=actions.msft.isd.coe.io,resources=databaseusers,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+
+// Reconcile creates the role of the DatabaseRole in the database of its Database and adds and drops members until
+// sys.database_role_members matches the spec exactly on every change and resync, the role is dropped when the
+// DatabaseRole is deleted
+func (r *DatabaseRoleReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := r.Logger.WithValues("databaserole", req.NamespacedName)
+
+	role := &actionsv1beta1.DatabaseRole{}
+	if err := r.Get(ctx, req.NamespacedName, role); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	read := role.Status.DeepCopy()
+	db, msSQL, err := connectDatabase(ctx, r.Client, r.Recorder, r.NewProvider, role, role.Spec.DatabaseRef.Name)
+	if db == nil || err != nil {
+		return ctrl.Result{}, err
+	}
+	databaseName := db.Spec.Name
+
+	if role.ObjectMeta.DeletionTimestamp.IsZero() {
+		if err = addFinalizer(ctx, r.Client, role); err != nil {
+			return ctrl.Result{}, err
+		}
+	} else {
+		if controllerutil.ContainsFinalizer(role, finalizer) && role.Status.PrincipalID != 0 {
+			if err = r.dropRole(ctx, role, msSQL, databaseName); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		return ctrl.Result{}, removeFinalizer(ctx, r.Client, role)
+	}
+
+	params := RoleParams(role)
+	if err = ms.ValidateRoleParams(role.Spec.Name, params); err != nil {
+		return syncFailed(ctx, r.Client, r.Recorder, role, actionsv1beta1.DatabaseRoleReasonSyncFailed, err)
+	}
+	if err = r.otherRoleMemberships(ctx, role, params); err != nil {
+		return ctrl.Result{}, err
+	}
+	state, err := msSQL.RoleState(ctx, databaseName, role.Spec.Name)
+	if err != nil {
+		return syncFailed(ctx, r.Client, r.Recorder, role, actionsv1beta1.DatabaseRoleReasonSyncFailed, err)
+	}
+
+	// differences are drift unless the spec changed since the last sync, an adopted role is compared as it is
+	reportDrift := state != nil && (role.Status.PrincipalID == 0 || role.Status.ObservedGeneration == role.Generation)
+	reason := actionsv1beta1.DatabaseRoleReasonSynced
+	message := "Role membership was compared with the spec and changed where needed"
+	switch {
+	case state == nil:
+		create, err := ms.CreateRoleStatement(databaseName, role.Spec.Name)
+		if err != nil {
+			return syncFailed(ctx, r.Client, r.Recorder, role, actionsv1beta1.DatabaseRoleReasonSyncFailed, err)
+		}
+		if err = msSQL.CreateRole(ctx, databaseName, role.Spec.Name); err != nil {
+			return syncFailed(ctx, r.Client, r.Recorder, role, actionsv1beta1.DatabaseRoleReasonSyncFailed, err)
+		}
+		r.Recorder.Eventf(role, corev1.EventTypeNormal, EventReasonRoleCreated, "Executed %s", statementsSummary(create))
+		if err = r.recordCreated(ctx, role, msSQL, databaseName); err != nil {
+			return syncFailed(ctx, r.Client, r.Recorder, role, actionsv1beta1.DatabaseRoleReasonSyncFailed, err)
+		}
+		reason = actionsv1beta1.DatabaseRoleReasonCreated
+		message = "Role was created"
+	case role.Status.PrincipalID == 0 && !role.Spec.AdoptExisting:
+		return syncFailed(ctx, r.Client, r.Recorder, role, actionsv1beta1.DatabaseRoleReasonSyncFailed,
+			fmt.Errorf("role %s already exists in database %s, set spec.adoptExisting to manage it", role.Spec.Name, databaseName))
+	case role.Status.PrincipalID == 0:
+		logger.Info("adopting existing role", "database", databaseName, "name", role.Spec.Name, "principalID", state.PrincipalID)
+		r.Recorder.Eventf(role, corev1.EventTypeNormal, EventReasonRoleAdopted, "Adopted existing role %s of database %s with principal_id %d",
+			role.Spec.Name, databaseName, state.PrincipalID)
+		reason = actionsv1beta1.DatabaseRoleReasonAdopted
+		message = "Existing role was adopted"
+	}
+
+	if err = r.syncMembership(ctx, role, msSQL, databaseName, ms.DiffRole(params, state), reportDrift); err != nil {
+		return syncFailed(ctx, r.Client, r.Recorder, role, actionsv1beta1.DatabaseRoleReasonSyncFailed, err)
+	}
+
+	if state, err = msSQL.RoleState(ctx, databaseName, role.Spec.Name); err != nil {
+		return syncFailed(ctx, r.Client, r.Recorder, role, actionsv1beta1.DatabaseRoleReasonSyncFailed, err)
+	}
+	role.Status.LastSyncTime = syncTime(role.Status.LastSyncTime, r.ResyncPeriod)
+	observeRole(role, state)
+	role.MarkSynced(reason, message)
+	role.Status.ObservedGeneration = role.Generation
+	if err = updateStatusIfChanged(ctx, r.Client, role, read, &role.Status); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: r.ResyncPeriod}, nil
+}
+
+// RoleParams the membership declared by the DatabaseRole as compared with sys.database_role_members
+func RoleParams(role *actionsv1beta1.DatabaseRole) *ms.RoleParams {
+	return &ms.RoleParams{
+		Members:  role.Spec.Members,
+		MemberOf: role.Spec.MemberOf,
+	}
+}
+
+// recordCreated records the principal_id of the role just created in the status right away, so the role is managed
+// as created by the DatabaseRole even when the status written at the end of the reconcile is lost
+func (r *DatabaseRoleReconciler) recordCreated(ctx context.Context, role *actionsv1beta1.DatabaseRole, msSQL ms.Provider, databaseName string) error {
+	state, err := msSQL.RoleState(ctx, databaseName, role.Spec.Name)
+	if err != nil || state == nil {
+		return err
+	}
+	return recordCreated(ctx, r.Client, role, func() { role.Status.PrincipalID = state.PrincipalID })
+}
+
+// otherRoleMemberships sets the memberships of the role declared from the other side by the other DatabaseRoles of
+// its Database, the role keeps them even when its own spec doesn't list them
+func (r *DatabaseRoleReconciler) otherRoleMemberships(ctx context.Context, role *actionsv1beta1.DatabaseRole, params *ms.RoleParams) error {
+	roles := &actionsv1beta1.DatabaseRoleList{}
+	if err := r.List(ctx, roles, client.InNamespace(role.Namespace), client.MatchingFields{databaseRefKey: role.Spec.DatabaseRef.Name}); err != nil {
+		return err
+	}
+	for _, other := range roles.Items {
+		if other.Name == role.Name || other.Spec.DatabaseRef.Name != role.Spec.DatabaseRef.Name || !other.DeletionTimestamp.IsZero() {
+			continue
+		}
+		if containsFold(other.Spec.Members, role.Spec.Name) {
+			params.OtherMemberOf = append(params.OtherMemberOf, other.Spec.Name)
+		}
+		if containsFold(other.Spec.MemberOf, role.Spec.Name) {
+			params.OtherMembers = append(params.OtherMembers, other.Spec.Name)
+		}
+	}
+	return nil
+}
+
+// containsFold whether the principal is in names, compared case insensitive like diffs of the membership
+func containsFold(names []string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// syncMembership adds the missing and drops the unexpected members of the role and of the roles it is a member of,
+// emitting a Normal event with the statements executed. When reportDrift is set the differences are reported with a
+// Warning event and recorded as the last drift
+func (r *DatabaseRoleReconciler) syncMembership(ctx context.Context, role *actionsv1beta1.DatabaseRole, msSQL ms.Provider, databaseName string, diff *ms.RoleDiff, reportDrift bool) error {
+	if !diff.HasDrift() {
+		return nil
+	}
+	if reportDrift {
+		r.Recorder.Eventf(role, corev1.EventTypeWarning, EventReasonDriftDetected, "Role membership differs from the spec: %s", membershipSummary(diff))
+		now := metav1.Now()
+		role.Status.LastDrift = &now
+	}
+
+	type change struct {
+		role, member string
+		add          bool
+	}
+	changes := []change{}
+	for _, member := range diff.Members.Missing {
+		changes = append(changes, change{role: role.Spec.Name, member: member, add: true})
+	}
+	for _, member := range diff.Members.Unexpected {
+		changes = append(changes, change{role: role.Spec.Name, member: member})
+	}
+	for _, other := range diff.MemberOf.Missing {
+		changes = append(changes, change{role: other, member: role.Spec.Name, add: true})
+	}
+	for _, other := range diff.MemberOf.Unexpected {
+		changes = append(changes, change{role: other, member: role.Spec.Name})
+	}
+
+	executed := []*ms.Statement{}
+	var err error
+	for _, c := range changes {
+		var statement *ms.Statement
+		if c.add {
+			if statement, err = ms.AddRoleMemberStatement(databaseName, c.role, c.member); err == nil {
+				err = msSQL.AddRoleMember(ctx, databaseName, c.role, c.member)
+			}
+		} else {
+			if statement, err = ms.DropRoleMemberStatement(databaseName, c.role, c.member); err == nil {
+				err = msSQL.DropRoleMember(ctx, databaseName, c.role, c.member)
+			}
+		}
+		if err != nil {
+			break
+		}
+		executed = append(executed, statement)
+	}
+	if len(executed) > 0 {
+		r.Recorder.Eventf(role, corev1.EventTypeNormal, EventReasonRoleMembersChanged, "Executed %s", statementsSummary(executed...))
+	}
+	return err
+}
+
+// membershipSummary describes the differences of the membership of a role for an event
+func membershipSummary(diff *ms.RoleDiff) string {
+	summary := []string{}
+	add := func(label string, names []string) {
+		if len(names) > 0 {
+			summary = append(summary, fmt.Sprintf("%s %s", label, strings.Join(names, ", ")))
+		}
+	}
+	add("unexpected members", diff.Members.Unexpected)
+	add("missing members", diff.Members.Missing)
+	add("unexpected memberOf", diff.MemberOf.Unexpected)
+	add("missing memberOf", diff.MemberOf.Missing)
+	return strings.Join(summary, "; ")
+}
+
+// dropRole empties and drops the role and emits an event with the DROP executed
+func (r *DatabaseRoleReconciler) dropRole(ctx context.Context, role *actionsv1beta1.DatabaseRole, msSQL ms.Provider, databaseName string) error {
+	drop, err := ms.DropRoleStatement(databaseName, role.Spec.Name)
+	if err != nil {
+		return err
+	}
+	if err = msSQL.DeleteRole(ctx, databaseName, role.Spec.Name); err != nil {
+		return err
+	}
+	r.Recorder.Eventf(role, corev1.EventTypeNormal, EventReasonRoleDropped, "Executed %s", statementsSummary(drop))
+	return nil
+}
+
+// observeRole maps the role and its rows of sys.database_role_members to the status of the DatabaseRole
+func observeRole(role *actionsv1beta1.DatabaseRole, state *ms.RoleState) {
+	if state == nil {
+		return
+	}
+	role.Status.PrincipalID = state.PrincipalID
+	role.Status.Owner = state.Owner
+	role.Status.Members = state.MemberNames()
+	role.Status.MemberOf = state.MemberOfNames()
+	if created, err := state.Created(); err == nil {
+		createDate := metav1.NewTime(created)
+		role.Status.CreateDate = &createDate
+	}
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *DatabaseRoleReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &actionsv1beta1.DatabaseRole{}, databaseRefKey, func(rawObj client.Object) []string {
+		role := rawObj.(*actionsv1beta1.DatabaseRole)
+		return []string{role.Spec.DatabaseRef.Name}
+	}); err != nil {
+		return err
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&actionsv1beta1.DatabaseRole{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(&source.Kind{Type: &actionsv1beta1.Database{}}, handler.EnqueueRequestsFromMapFunc(r.rolesForDatabase),
+			builder.WithPredicates(databaseReadyChanged)).
+		Watches(&source.Kind{Type: &actionsv1beta1.DatabaseUser{}}, handler.EnqueueRequestsFromMapFunc(r.rolesForUser)).
+		Complete(r)
+}
+
+// rolesForDatabase maps a Database to its DatabaseRoles so the roles are reconciled when the Database becomes ready
+func (r *DatabaseRoleReconciler) rolesForDatabase(obj client.Object) []reconcile.Request {
+	return r.rolesOfDatabase(obj.GetNamespace(), obj.GetName())
+}
+
+// rolesForUser maps a DatabaseUser to the DatabaseRoles of its Database so a role waiting for the user to exist is
+// reconciled once it is created
+func (r *DatabaseRoleReconciler) rolesForUser(obj client.Object) []reconcile.Request {
+	user, ok := obj.(*actionsv1beta1.DatabaseUser)
+	if !ok {
+		return nil
+	}
+	return r.rolesOfDatabase(user.Namespace, user.Spec.DatabaseRef.Name)
+}
+
+// rolesOfDatabase lists the DatabaseRoles in the namespace referencing the Database
+func (r *DatabaseRoleReconciler) rolesOfDatabase(namespace, databaseName string) []reconcile.Request {
+	return requestsMatching(r.Client, r.Logger, &actionsv1beta1.DatabaseRoleList{}, namespace, databaseRefKey, databaseName)
+}
@@ -0,0 +1,239 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	actionsv1beta1 "github.com/pplavetzki/azure-sql-mi/api/v1beta1"
+	ms "github.com/pplavetzki/azure-sql-mi/internal"
+	"github.com/pplavetzki/azure-sql-mi/internal/fake"
+)
+
+// newDatabaseRole a DatabaseRole CR with a unique name in the Database named databaseName
+func newDatabaseRole(databaseName string) *actionsv1beta1.DatabaseRole {
+	n := nextIndex()
+	return &actionsv1beta1.DatabaseRole{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("role-%d", n),
+			Namespace: "default",
+		},
+		Spec: actionsv1beta1.DatabaseRoleSpec{
+			Name:        fmt.Sprintf("role%d", n),
+			DatabaseRef: corev1.LocalObjectReference{Name: databaseName},
+		},
+	}
+}
+
+// waitForRolePrincipalID waits for the DatabaseRole to record the principal_id of its role
+func waitForRolePrincipalID(key types.NamespacedName) *actionsv1beta1.DatabaseRole {
+	role := &actionsv1beta1.DatabaseRole{ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace}}
+	waitFor(role, func() bool { return role.Status.PrincipalID != 0 })
+	return role
+}
+
+var _ = Describe("DatabaseRole controller", func() {
+	BeforeEach(ensureManagedInstance)
+
+	Context("when a DatabaseRole is created", func() {
+		It("creates the role with its members and adds it to the fixed roles", func() {
+			db := createReadyDatabase()
+			_, err := sqlServer.AddUser(db.Spec.Name, "app")
+			Expect(err).NotTo(HaveOccurred())
+			role := newDatabaseRole(db.Name)
+			role.Spec.Members = []string{"app"}
+			role.Spec.MemberOf = []string{"db_datareader", "db_datawriter"}
+			key := objectKey(role)
+			Expect(k8sClient.Create(ctx, role)).To(Succeed())
+
+			created := waitForRolePrincipalID(key)
+			Expect(created.Status.Members).To(Equal([]string{"app"}))
+			Expect(created.Status.MemberOf).To(Equal([]string{"db_datareader", "db_datawriter"}))
+			Expect(sqlServer.RoleMembers(db.Spec.Name, role.Spec.Name)).To(Equal([]string{"app"}))
+			Expect(sqlServer.RoleMembers(db.Spec.Name, "db_datareader")).To(ContainElement(role.Spec.Name))
+			Expect(controllerutil.ContainsFinalizer(created, finalizer)).To(BeTrue())
+			Expect(created.IsReady()).To(BeTrue())
+			Expect(eventReasons(created)).To(ContainElements(EventReasonRoleCreated, EventReasonRoleMembersChanged))
+		})
+	})
+
+	Context("when a member is removed from the spec", func() {
+		It("drops the member from the role", func() {
+			db := createReadyDatabase()
+			for _, user := range []string{"app", "reporting"} {
+				_, err := sqlServer.AddUser(db.Spec.Name, user)
+				Expect(err).NotTo(HaveOccurred())
+			}
+			role := newDatabaseRole(db.Name)
+			role.Spec.Members = []string{"app", "reporting"}
+			key := objectKey(role)
+			Expect(k8sClient.Create(ctx, role)).To(Succeed())
+			waitForRolePrincipalID(key)
+
+			Eventually(func() error {
+				existing := &actionsv1beta1.DatabaseRole{}
+				if err := k8sClient.Get(ctx, key, existing); err != nil {
+					return err
+				}
+				existing.Spec.Members = []string{"app"}
+				return k8sClient.Update(ctx, existing)
+			}, timeout, interval).Should(Succeed())
+
+			Eventually(func() []string {
+				return sqlServer.RoleMembers(db.Spec.Name, role.Spec.Name)
+			}, timeout, interval).Should(Equal([]string{"app"}))
+		})
+	})
+
+	Context("when a role is a member of another DatabaseRole", func() {
+		It("keeps the membership declared by the other DatabaseRole", func() {
+			db := createReadyDatabase()
+			member := newDatabaseRole(db.Name)
+			Expect(k8sClient.Create(ctx, member)).To(Succeed())
+			memberKey := objectKey(member)
+			waitForRolePrincipalID(memberKey)
+			role := newDatabaseRole(db.Name)
+			role.Spec.Members = []string{member.Spec.Name}
+			Expect(k8sClient.Create(ctx, role)).To(Succeed())
+			waitForRolePrincipalID(objectKey(role))
+
+			Eventually(func() error {
+				existing := &actionsv1beta1.DatabaseRole{}
+				if err := k8sClient.Get(ctx, memberKey, existing); err != nil {
+					return err
+				}
+				existing.Spec.MemberOf = []string{"db_datareader"}
+				return k8sClient.Update(ctx, existing)
+			}, timeout, interval).Should(Succeed())
+
+			Eventually(func() []string {
+				return sqlServer.RoleMembers(db.Spec.Name, "db_datareader")
+			}, timeout, interval).Should(ContainElement(member.Spec.Name))
+			Consistently(func() []string {
+				return sqlServer.RoleMembers(db.Spec.Name, role.Spec.Name)
+			}, 2*time.Second, interval).Should(Equal([]string{member.Spec.Name}))
+		})
+	})
+
+	Context("when a member does not exist yet", func() {
+		It("fails the sync until the DatabaseUser of the member is created", func() {
+			db := createReadyDatabase()
+			user := newDatabaseUser(db.Name, actionsv1beta1.UserTypeWithoutLogin)
+			role := newDatabaseRole(db.Name)
+			role.Spec.Members = []string{user.Spec.Name}
+			key := objectKey(role)
+			Expect(k8sClient.Create(ctx, role)).To(Succeed())
+
+			Eventually(func() []string {
+				return eventReasons(role)
+			}, timeout, interval).Should(ContainElement(EventReasonSyncFailed))
+
+			Expect(k8sClient.Create(ctx, user)).To(Succeed())
+			Eventually(func() []string {
+				synced := &actionsv1beta1.DatabaseRole{}
+				if err := k8sClient.Get(ctx, key, synced); err != nil {
+					return nil
+				}
+				return synced.Status.Members
+			}, timeout, interval).Should(Equal([]string{user.Spec.Name}))
+		})
+	})
+
+	Context("when a DatabaseRole is deleted", func() {
+		It("empties and drops the role and removes the finalizer", func() {
+			db := createReadyDatabase()
+			_, err := sqlServer.AddUser(db.Spec.Name, "app")
+			Expect(err).NotTo(HaveOccurred())
+			role := newDatabaseRole(db.Name)
+			role.Spec.Members = []string{"app"}
+			key := objectKey(role)
+			Expect(k8sClient.Create(ctx, role)).To(Succeed())
+			waitForRolePrincipalID(key)
+
+			Expect(k8sClient.Delete(ctx, role)).To(Succeed())
+
+			waitForDeletion(key, &actionsv1beta1.DatabaseRole{})
+			_, ok := sqlServer.Role(db.Spec.Name, role.Spec.Name)
+			Expect(ok).To(BeFalse())
+		})
+	})
+})
+
+var _ = Describe("DatabaseRole drift", func() {
+	var (
+		server   *fake.Server
+		provider ms.Provider
+		recorder *record.FakeRecorder
+		r        *DatabaseRoleReconciler
+	)
+
+	BeforeEach(func() {
+		server, provider = newFakeDatabase("app", "intruder")
+		recorder = record.NewFakeRecorder(10)
+		r = &DatabaseRoleReconciler{Recorder: recorder}
+	})
+
+	It("reports unexpected members as drift and drops them", func() {
+		role := newDatabaseRole("app")
+		role.Spec.Members = []string{"app"}
+		Expect(provider.CreateRole(context.Background(), "App", role.Spec.Name)).To(Succeed())
+		Expect(server.AddRoleMember("App", role.Spec.Name, "app")).To(Succeed())
+		Expect(server.AddRoleMember("App", role.Spec.Name, "intruder")).To(Succeed())
+		Expect(server.AddRoleMember("App", "db_owner", role.Spec.Name)).To(Succeed())
+
+		state, err := provider.RoleState(context.Background(), "App", role.Spec.Name)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.syncMembership(context.Background(), role, provider, "App", ms.DiffRole(RoleParams(role), state), true)).To(Succeed())
+
+		Expect(server.RoleMembers("App", role.Spec.Name)).To(Equal([]string{"app"}))
+		Expect(server.RoleMembers("App", "db_owner")).To(BeEmpty())
+		Expect(role.Status.LastDrift).NotTo(BeNil())
+		Expect(<-recorder.Events).To(ContainSubstring("unexpected members intruder; unexpected memberOf db_owner"))
+	})
+
+	It("keeps the memberships declared by the other DatabaseRoles of the Database", func() {
+		role := newDatabaseRole("app")
+		owners := newDatabaseRole("app")
+		owners.Spec.Members = []string{role.Spec.Name}
+		readers := newDatabaseRole("app")
+		readers.Spec.MemberOf = []string{role.Spec.Name}
+		r.Client = newFakeClient(role, owners, readers)
+		for _, name := range []string{role.Spec.Name, owners.Spec.Name, readers.Spec.Name} {
+			Expect(provider.CreateRole(context.Background(), "App", name)).To(Succeed())
+		}
+		Expect(server.AddRoleMember("App", owners.Spec.Name, role.Spec.Name)).To(Succeed())
+		Expect(server.AddRoleMember("App", role.Spec.Name, readers.Spec.Name)).To(Succeed())
+
+		params := RoleParams(role)
+		Expect(r.otherRoleMemberships(context.Background(), role, params)).To(Succeed())
+		state, err := provider.RoleState(context.Background(), "App", role.Spec.Name)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.syncMembership(context.Background(), role, provider, "App", ms.DiffRole(params, state), true)).To(Succeed())
+
+		Expect(server.RoleMembers("App", role.Spec.Name)).To(Equal([]string{readers.Spec.Name}))
+		Expect(server.RoleMembers("App", owners.Spec.Name)).To(Equal([]string{role.Spec.Name}))
+		Expect(role.Status.LastDrift).To(BeNil())
+	})
+
+	It("changes the membership without reporting drift after a change of the spec", func() {
+		role := newDatabaseRole("app")
+		role.Spec.MemberOf = []string{"db_datareader"}
+		Expect(provider.CreateRole(context.Background(), "App", role.Spec.Name)).To(Succeed())
+
+		state, err := provider.RoleState(context.Background(), "App", role.Spec.Name)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.syncMembership(context.Background(), role, provider, "App", ms.DiffRole(RoleParams(role), state), false)).To(Succeed())
+
+		Expect(server.RoleMembers("App", "db_datareader")).To(Equal([]string{role.Spec.Name}))
+		Expect(role.Status.LastDrift).To(BeNil())
+		Expect(<-recorder.Events).To(HavePrefix(corev1.EventTypeNormal + " " + EventReasonRoleMembersChanged))
+	})
+})
@@ -0,0 +1,254 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	actionsv1beta1 "github.com/pplavetzki/azure-sql-mi/api/v1beta1"
+	ms "github.com/pplavetzki/azure-sql-mi/internal"
+)
+
+// DatabaseSchemaReconciler reconciles a DatabaseSchema object, its fields are those of the LoginReconciler
+type DatabaseSchemaReconciler struct {
+	client.Client
+	Scheme       *runtime.Scheme
+	Logger       logr.Logger
+	NewProvider  ms.ProviderFactory
+	Recorder     record.EventRecorder
+	ResyncPeriod time.Duration
+}
+
+//+kubebuilder:rbac:groups=actions.msft.isd.coe.io,resources=databaseschemas,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=actions.msft.isd.coe.io,resources=databaseschemas/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=actions.msft.isd.coe.io,resources=databaseschemas/finalizers,verbs=update
+//+kubebuilder:rbac:groups=actions.msft.isd.coe.io,resources=databases,verbs=get;list;watch
+//+kubebuilder:rbac:groups=actions.msft.isd.coe.io,resources=databaseusers,verbs=get;list;watch
+//+kubebuilder:rbac:groups=actions.msft.isd.coe.io,resources=databaseroles,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+
+// Reconcile creates the schema of the DatabaseSchema in the database of its Database authorized to its owner and
+// transfers the ownership back to the owner of the spec on every change and resync. The schema is dropped when the
+// DatabaseSchema is deleted, unless it still contains objects in which case the deletion waits for them to be
+// dropped
+func (r *DatabaseSchemaReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := r.Logger.WithValues("databaseschema", req.NamespacedName)
+
+	schema := &actionsv1beta1.DatabaseSchema{}
+	if err := r.Get(ctx, req.NamespacedName, schema); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	read := schema.Status.DeepCopy()
+	db, msSQL, err := connectDatabase(ctx, r.Client, r.Recorder, r.NewProvider, schema, schema.Spec.DatabaseRef.Name)
+	if db == nil || err != nil {
+		return ctrl.Result{}, err
+	}
+	databaseName := db.Spec.Name
+
+	if schema.ObjectMeta.DeletionTimestamp.IsZero() {
+		if err = addFinalizer(ctx, r.Client, schema); err != nil {
+			return ctrl.Result{}, err
+		}
+	} else {
+		if controllerutil.ContainsFinalizer(schema, finalizer) && schema.Status.SchemaID != 0 {
+			if result, err := r.dropSchema(ctx, schema, msSQL, databaseName); err != nil {
+				return result, err
+			}
+		}
+		return ctrl.Result{}, removeFinalizer(ctx, r.Client, schema)
+	}
+
+	if err = ms.ValidateSchema(schema.Spec.Name, schema.Spec.Owner); err != nil {
+		return syncFailed(ctx, r.Client, r.Recorder, schema, actionsv1beta1.DatabaseSchemaReasonSyncFailed, err)
+	}
+	state, err := msSQL.SchemaState(ctx, databaseName, schema.Spec.Name)
+	if err != nil {
+		return syncFailed(ctx, r.Client, r.Recorder, schema, actionsv1beta1.DatabaseSchemaReasonSyncFailed, err)
+	}
+
+	// a different owner is drift unless the spec changed since the last sync, an adopted schema is compared as it is
+	reportDrift := state != nil && (schema.Status.SchemaID == 0 || schema.Status.ObservedGeneration == schema.Generation)
+	reason := actionsv1beta1.DatabaseSchemaReasonSynced
+	message := "Schema owner was compared with the spec and changed where needed"
+	switch {
+	case state == nil:
+		create, err := ms.CreateSchemaStatement(databaseName, schema.Spec.Name, schema.Spec.Owner)
+		if err != nil {
+			return syncFailed(ctx, r.Client, r.Recorder, schema, actionsv1beta1.DatabaseSchemaReasonSyncFailed, err)
+		}
+		if err = msSQL.CreateSchema(ctx, databaseName, schema.Spec.Name, schema.Spec.Owner); err != nil {
+			return syncFailed(ctx, r.Client, r.Recorder, schema, actionsv1beta1.DatabaseSchemaReasonSyncFailed, err)
+		}
+		r.Recorder.Eventf(schema, corev1.EventTypeNormal, EventReasonSchemaCreated, "Executed %s", statementsSummary(create))
+		if err = r.recordCreated(ctx, schema, msSQL, databaseName); err != nil {
+			return syncFailed(ctx, r.Client, r.Recorder, schema, actionsv1beta1.DatabaseSchemaReasonSyncFailed, err)
+		}
+		reason = actionsv1beta1.DatabaseSchemaReasonCreated
+		message = "Schema was created"
+	case schema.Status.SchemaID == 0 && !schema.Spec.AdoptExisting:
+		return syncFailed(ctx, r.Client, r.Recorder, schema, actionsv1beta1.DatabaseSchemaReasonSyncFailed,
+			fmt.Errorf("schema %s already exists in database %s, set spec.adoptExisting to manage it", schema.Spec.Name, databaseName))
+	case schema.Status.SchemaID == 0:
+		logger.Info("adopting existing schema", "database", databaseName, "name", schema.Spec.Name, "schemaID", state.SchemaID)
+		r.Recorder.Eventf(schema, corev1.EventTypeNormal, EventReasonSchemaAdopted, "Adopted existing schema %s of database %s with schema_id %d",
+			schema.Spec.Name, databaseName, state.SchemaID)
+		reason = actionsv1beta1.DatabaseSchemaReasonAdopted
+		message = "Existing schema was adopted"
+	}
+
+	if state != nil {
+		if err = r.syncOwner(ctx, schema, msSQL, databaseName, state, reportDrift); err != nil {
+			return syncFailed(ctx, r.Client, r.Recorder, schema, actionsv1beta1.DatabaseSchemaReasonSyncFailed, err)
+		}
+	}
+
+	if state, err = msSQL.SchemaState(ctx, databaseName, schema.Spec.Name); err != nil {
+		return syncFailed(ctx, r.Client, r.Recorder, schema, actionsv1beta1.DatabaseSchemaReasonSyncFailed, err)
+	}
+	schema.Status.LastSyncTime = syncTime(schema.Status.LastSyncTime, r.ResyncPeriod)
+	observeSchema(schema, state)
+	schema.MarkSynced(reason, message)
+	schema.Status.ObservedGeneration = schema.Generation
+	if err = updateStatusIfChanged(ctx, r.Client, schema, read, &schema.Status); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: r.ResyncPeriod}, nil
+}
+
+// recordCreated records the schema_id of the schema just created in the status right away, so the schema is
+// managed as created by the DatabaseSchema even when the status written at the end of the reconcile is lost
+func (r *DatabaseSchemaReconciler) recordCreated(ctx context.Context, schema *actionsv1beta1.DatabaseSchema, msSQL ms.Provider, databaseName string) error {
+	state, err := msSQL.SchemaState(ctx, databaseName, schema.Spec.Name)
+	if err != nil || state == nil {
+		return err
+	}
+	return recordCreated(ctx, r.Client, schema, func() { schema.Status.SchemaID = state.SchemaID })
+}
+
+// syncOwner transfers the ownership of the schema to the owner of the spec when another principal owns it, emitting
+// a Normal event with the statement executed. When reportDrift is set the difference is reported with a Warning
+// event and recorded as the last drift. A schema without a declared owner keeps the owner it has
+func (r *DatabaseSchemaReconciler) syncOwner(ctx context.Context, schema *actionsv1beta1.DatabaseSchema, msSQL ms.Provider, databaseName string, state *ms.SchemaState, reportDrift bool) error {
+	if schema.Spec.Owner == "" || strings.EqualFold(state.Owner, schema.Spec.Owner) {
+		return nil
+	}
+	if reportDrift {
+		r.Recorder.Eventf(schema, corev1.EventTypeWarning, EventReasonDriftDetected, "Schema owner differs from the spec: owned by %s instead of %s",
+			state.Owner, schema.Spec.Owner)
+		now := metav1.Now()
+		schema.Status.LastDrift = &now
+	}
+	alter, err := ms.AlterSchemaOwnerStatement(databaseName, schema.Spec.Name, schema.Spec.Owner)
+	if err != nil {
+		return err
+	}
+	if err = msSQL.AlterSchemaOwner(ctx, databaseName, schema.Spec.Name, schema.Spec.Owner); err != nil {
+		return err
+	}
+	r.Recorder.Eventf(schema, corev1.EventTypeNormal, EventReasonSchemaOwnerChanged, "Executed %s", statementsSummary(alter))
+	return nil
+}
+
+// dropSchema drops the schema and emits an event with the DROP executed. A schema that still contains objects is
+// refused with the SchemaNotEmpty reason and its object count is recorded, the deletion is retried until the
+// objects are dropped or moved
+func (r *DatabaseSchemaReconciler) dropSchema(ctx context.Context, schema *actionsv1beta1.DatabaseSchema, msSQL ms.Provider, databaseName string) (ctrl.Result, error) {
+	id, err := msSQL.FindDatabaseID(ctx, databaseName)
+	if err != nil || id == nil {
+		return ctrl.Result{}, err
+	}
+	state, err := msSQL.SchemaState(ctx, databaseName, schema.Spec.Name)
+	if err != nil || state == nil {
+		return ctrl.Result{}, err
+	}
+	if !state.IsEmpty() {
+		schema.Status.LastSyncTime = syncTime(schema.Status.LastSyncTime, r.ResyncPeriod)
+		observeSchema(schema, state)
+		return syncFailed(ctx, r.Client, r.Recorder, schema, actionsv1beta1.DatabaseSchemaReasonNotEmpty,
+			fmt.Errorf("schema %s of database %s still contains %d objects, drop or transfer them to delete the schema",
+				schema.Spec.Name, databaseName, state.ObjectCount))
+	}
+	drop, err := ms.DropSchemaStatement(databaseName, schema.Spec.Name)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if err = msSQL.DeleteSchema(ctx, databaseName, schema.Spec.Name); err != nil {
+		return ctrl.Result{}, err
+	}
+	r.Recorder.Eventf(schema, corev1.EventTypeNormal, EventReasonSchemaDropped, "Executed %s", statementsSummary(drop))
+	return ctrl.Result{}, nil
+}
+
+// observeSchema maps the row of sys.schemas and the number of its objects to the status of the DatabaseSchema
+func observeSchema(schema *actionsv1beta1.DatabaseSchema, state *ms.SchemaState) {
+	if state == nil {
+		return
+	}
+	schema.Status.SchemaID = state.SchemaID
+	schema.Status.Owner = state.Owner
+	schema.Status.ObjectCount = state.ObjectCount
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *DatabaseSchemaReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &actionsv1beta1.DatabaseSchema{}, databaseRefKey, func(rawObj client.Object) []string {
+		schema := rawObj.(*actionsv1beta1.DatabaseSchema)
+		return []string{schema.Spec.DatabaseRef.Name}
+	}); err != nil {
+		return err
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&actionsv1beta1.DatabaseSchema{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(&source.Kind{Type: &actionsv1beta1.Database{}}, handler.EnqueueRequestsFromMapFunc(r.schemasForDatabase),
+			builder.WithPredicates(databaseReadyChanged)).
+		Watches(&source.Kind{Type: &actionsv1beta1.DatabaseUser{}}, handler.EnqueueRequestsFromMapFunc(r.schemasForUser)).
+		Watches(&source.Kind{Type: &actionsv1beta1.DatabaseRole{}}, handler.EnqueueRequestsFromMapFunc(r.schemasForRole)).
+		Complete(r)
+}
+
+// schemasForDatabase maps a Database to its DatabaseSchemas so the schemas are reconciled when the Database becomes
+// ready
+func (r *DatabaseSchemaReconciler) schemasForDatabase(obj client.Object) []reconcile.Request {
+	return r.schemasOfDatabase(obj.GetNamespace(), obj.GetName())
+}
+
+// schemasForUser maps a DatabaseUser to the DatabaseSchemas of its Database so a schema waiting for its owner to
+// exist is reconciled once it is created
+func (r *DatabaseSchemaReconciler) schemasForUser(obj client.Object) []reconcile.Request {
+	user, ok := obj.(*actionsv1beta1.DatabaseUser)
+	if !ok {
+		return nil
+	}
+	return r.schemasOfDatabase(user.Namespace, user.Spec.DatabaseRef.Name)
+}
+
+// schemasForRole maps a DatabaseRole to the DatabaseSchemas of its Database so a schema owned by the role is
+// reconciled once it is created
+func (r *DatabaseSchemaReconciler) schemasForRole(obj client.Object) []reconcile.Request {
+	role, ok := obj.(*actionsv1beta1.DatabaseRole)
+	if !ok {
+		return nil
+	}
+	return r.schemasOfDatabase(role.Namespace, role.Spec.DatabaseRef.Name)
+}
+
+// schemasOfDatabase lists the DatabaseSchemas in the namespace referencing the Database
+func (r *DatabaseSchemaReconciler) schemasOfDatabase(namespace, databaseName string) []reconcile.Request {
+	return requestsMatching(r.Client, r.Logger, &actionsv1beta1.DatabaseSchemaList{}, namespace, databaseRefKey, databaseName)
+}
@@ -0,0 +1,156 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	fakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	actionsv1beta1 "github.com/pplavetzki/azure-sql-mi/api/v1beta1"
+	ms "github.com/pplavetzki/azure-sql-mi/internal"
+	"github.com/pplavetzki/azure-sql-mi/internal/fake"
+)
+
+// newDatabaseSchema a DatabaseSchema CR with a unique name in the Database named databaseName
+func newDatabaseSchema(databaseName string) *actionsv1beta1.DatabaseSchema {
+	n := nextIndex()
+	return &actionsv1beta1.DatabaseSchema{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("schema-%d", n),
+			Namespace: "default",
+		},
+		Spec: actionsv1beta1.DatabaseSchemaSpec{
+			Name:        fmt.Sprintf("schema%d", n),
+			DatabaseRef: corev1.LocalObjectReference{Name: databaseName},
+		},
+	}
+}
+
+// waitForSchemaID waits for the DatabaseSchema to record the schema_id of its schema
+func waitForSchemaID(key types.NamespacedName) *actionsv1beta1.DatabaseSchema {
+	schema := &actionsv1beta1.DatabaseSchema{ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace}}
+	waitFor(schema, func() bool { return schema.Status.SchemaID != 0 })
+	return schema
+}
+
+var _ = Describe("DatabaseSchema controller", func() {
+	BeforeEach(ensureManagedInstance)
+
+	Context("when a DatabaseSchema is created", func() {
+		It("creates the schema authorized to its owner", func() {
+			db := createReadyDatabase()
+			_, err := sqlServer.AddUser(db.Spec.Name, "app")
+			Expect(err).NotTo(HaveOccurred())
+			schema := newDatabaseSchema(db.Name)
+			schema.Spec.Owner = "app"
+			key := objectKey(schema)
+			Expect(k8sClient.Create(ctx, schema)).To(Succeed())
+
+			created := waitForSchemaID(key)
+			Expect(created.Status.Owner).To(Equal("app"))
+			Expect(created.Status.ObjectCount).To(BeZero())
+			observed, ok := sqlServer.Schema(db.Spec.Name, schema.Spec.Name)
+			Expect(ok).To(BeTrue())
+			Expect(observed.Owner).To(Equal("app"))
+			Expect(controllerutil.ContainsFinalizer(created, finalizer)).To(BeTrue())
+			Expect(created.IsReady()).To(BeTrue())
+			Expect(eventReasons(created)).To(ContainElement(EventReasonSchemaCreated))
+		})
+	})
+
+	Context("when a DatabaseSchema is deleted", func() {
+		It("refuses to drop the schema while it contains objects", func() {
+			db := createReadyDatabase()
+			schema := newDatabaseSchema(db.Name)
+			key := objectKey(schema)
+			Expect(k8sClient.Create(ctx, schema)).To(Succeed())
+			waitForSchemaID(key)
+			Expect(sqlServer.UpdateSchema(db.Spec.Name, schema.Spec.Name, func(s *fake.Schema) { s.ObjectCount = 3 })).To(Succeed())
+
+			Expect(k8sClient.Delete(ctx, schema)).To(Succeed())
+
+			Eventually(func() []string {
+				return eventReasons(schema)
+			}, timeout, interval).Should(ContainElement(actionsv1beta1.DatabaseSchemaReasonNotEmpty))
+			refused := &actionsv1beta1.DatabaseSchema{}
+			Expect(k8sClient.Get(ctx, key, refused)).To(Succeed())
+			Expect(refused.Status.ObjectCount).To(Equal(3))
+			_, ok := sqlServer.Schema(db.Spec.Name, schema.Spec.Name)
+			Expect(ok).To(BeTrue())
+
+			Expect(sqlServer.UpdateSchema(db.Spec.Name, schema.Spec.Name, func(s *fake.Schema) { s.ObjectCount = 0 })).To(Succeed())
+			waitForDeletion(key, &actionsv1beta1.DatabaseSchema{})
+			_, ok = sqlServer.Schema(db.Spec.Name, schema.Spec.Name)
+			Expect(ok).To(BeFalse())
+		})
+	})
+})
+
+var _ = Describe("DatabaseSchema drift", func() {
+	var (
+		server   *fake.Server
+		provider ms.Provider
+		recorder *record.FakeRecorder
+		r        *DatabaseSchemaReconciler
+	)
+
+	BeforeEach(func() {
+		server, provider = newFakeDatabase("app", "intruder")
+		recorder = record.NewFakeRecorder(10)
+		r = &DatabaseSchemaReconciler{Recorder: recorder}
+	})
+
+	It("reports a different owner as drift and transfers the schema back", func() {
+		schema := newDatabaseSchema("app")
+		schema.Spec.Owner = "app"
+		Expect(server.AddSchema("App", schema.Spec.Name, "intruder")).To(Succeed())
+
+		state, err := provider.SchemaState(context.Background(), "App", schema.Spec.Name)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.syncOwner(context.Background(), schema, provider, "App", state, true)).To(Succeed())
+
+		observed, _ := server.Schema("App", schema.Spec.Name)
+		Expect(observed.Owner).To(Equal("app"))
+		Expect(schema.Status.LastDrift).NotTo(BeNil())
+		Expect(<-recorder.Events).To(ContainSubstring("owned by intruder instead of app"))
+		Expect(<-recorder.Events).To(HavePrefix(corev1.EventTypeNormal + " " + EventReasonSchemaOwnerChanged))
+	})
+
+	It("leaves the owner alone when the spec declares none", func() {
+		schema := newDatabaseSchema("app")
+		Expect(server.AddSchema("App", schema.Spec.Name, "intruder")).To(Succeed())
+
+		state, err := provider.SchemaState(context.Background(), "App", schema.Spec.Name)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.syncOwner(context.Background(), schema, provider, "App", state, true)).To(Succeed())
+
+		observed, _ := server.Schema("App", schema.Spec.Name)
+		Expect(observed.Owner).To(Equal("intruder"))
+		Expect(recorder.Events).To(BeEmpty())
+	})
+
+	It("refuses to drop a schema with objects and records their count", func() {
+		schema := newDatabaseSchema("app")
+		Expect(server.AddSchema("App", schema.Spec.Name, "app")).To(Succeed())
+		Expect(server.UpdateSchema("App", schema.Spec.Name, func(s *fake.Schema) { s.ObjectCount = 2 })).To(Succeed())
+		scheme := runtime.NewScheme()
+		Expect(actionsv1beta1.AddToScheme(scheme)).To(Succeed())
+		r.Client = fakeclient.NewClientBuilder().WithScheme(scheme).WithObjects(schema).Build()
+
+		_, err := r.dropSchema(context.Background(), schema, provider, "App")
+
+		Expect(err).To(MatchError(ContainSubstring("still contains 2 objects")))
+		Expect(schema.Status.ObjectCount).To(Equal(2))
+		_, ok := server.Schema("App", schema.Spec.Name)
+		Expect(ok).To(BeTrue())
+		Expect(<-recorder.Events).To(HavePrefix(corev1.EventTypeWarning + " " + actionsv1beta1.DatabaseSchemaReasonNotEmpty))
+	})
+})
@@ -0,0 +1,295 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	actionsv1beta1 "github.com/pplavetzki/azure-sql-mi/api/v1beta1"
+	ms "github.com/pplavetzki/azure-sql-mi/internal"
+)
+
+// userAuthentications the authentication_type_desc of the users of each UserType
+var userAuthentications = map[actionsv1beta1.UserType]string{
+	actionsv1beta1.UserTypeLogin:        ms.AuthenticationInstance,
+	actionsv1beta1.UserTypeWithoutLogin: ms.AuthenticationNone,
+	actionsv1beta1.UserTypeContained:    ms.AuthenticationDatabase,
+}
+
+// DatabaseUserReconciler reconciles a DatabaseUser object, its fields are those of the LoginReconciler
+type DatabaseUserReconciler struct {
+	client.Client
+	Scheme       *runtime.Scheme
+	Logger       logr.Logger
+	NewProvider  ms.ProviderFactory
+	Recorder     record.EventRecorder
+	ResyncPeriod time.Duration
+}
+
+//+kubebuilder:rbac:groups=actions.msft.isd.coe.io,resources=databaseusers,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=actions.msft.isd.coe.io,resources=databaseusers/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=actions.msft.isd.coe.io,resources=databaseusers/finalizers,verbs=update
+//+kubebuilder:rbac:groups=actions.msft.isd.coe.io,resources=databases,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+
+// Reconcile creates the user of the DatabaseUser in the database of its Database and alters it back to the spec on
+// every change and resync, the user is dropped when the DatabaseUser is deleted
+func (r *DatabaseUserReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := r.Logger.WithValues("databaseuser", req.NamespacedName)
+
+	user := &actionsv1beta1.DatabaseUser{}
+	if err := r.Get(ctx, req.NamespacedName, user); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	read := user.Status.DeepCopy()
+	db, msSQL, err := connectDatabase(ctx, r.Client, r.Recorder, r.NewProvider, user, user.Spec.DatabaseRef.Name)
+	if db == nil || err != nil {
+		return ctrl.Result{}, err
+	}
+	databaseName := db.Spec.Name
+
+	if user.ObjectMeta.DeletionTimestamp.IsZero() {
+		if err = addFinalizer(ctx, r.Client, user); err != nil {
+			return ctrl.Result{}, err
+		}
+	} else {
+		if controllerutil.ContainsFinalizer(user, finalizer) && user.Status.SID != "" {
+			if err = r.dropUser(ctx, user, msSQL, databaseName); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		return ctrl.Result{}, removeFinalizer(ctx, r.Client, user)
+	}
+
+	params := UserParams(user)
+	if err = ms.ValidateUserParams(params); err != nil {
+		return syncFailed(ctx, r.Client, r.Recorder, user, actionsv1beta1.DatabaseUserReasonSyncFailed, err)
+	}
+	password, passwordVersion, err := r.userPassword(ctx, user)
+	if err != nil {
+		return syncFailed(ctx, r.Client, r.Recorder, user, actionsv1beta1.DatabaseUserReasonPasswordNotFound, err)
+	}
+	state, err := msSQL.UserState(ctx, databaseName, user.Spec.Name)
+	if err != nil {
+		return syncFailed(ctx, r.Client, r.Recorder, user, actionsv1beta1.DatabaseUserReasonSyncFailed, err)
+	}
+
+	reason := actionsv1beta1.DatabaseUserReasonSynced
+	message := "User was compared with the spec and altered where needed"
+	switch {
+	case state == nil:
+		create, err := ms.CreateUserStatement(databaseName, user.Spec.Name, password, params)
+		if err != nil {
+			return syncFailed(ctx, r.Client, r.Recorder, user, actionsv1beta1.DatabaseUserReasonSyncFailed, err)
+		}
+		if err = msSQL.CreateUser(ctx, databaseName, user.Spec.Name, password, params); err != nil {
+			return syncFailed(ctx, r.Client, r.Recorder, user, actionsv1beta1.DatabaseUserReasonSyncFailed, err)
+		}
+		r.Recorder.Eventf(user, corev1.EventTypeNormal, EventReasonUserCreated, "Executed %s", statementsSummary(create))
+		if err = r.recordCreated(ctx, user, msSQL, databaseName, passwordVersion); err != nil {
+			return syncFailed(ctx, r.Client, r.Recorder, user, actionsv1beta1.DatabaseUserReasonSyncFailed, err)
+		}
+		reason = actionsv1beta1.DatabaseUserReasonCreated
+		message = "User was created"
+	case user.Status.SID == "" && !user.Spec.AdoptExisting:
+		return syncFailed(ctx, r.Client, r.Recorder, user, actionsv1beta1.DatabaseUserReasonSyncFailed,
+			fmt.Errorf("user %s already exists in database %s, set spec.adoptExisting to manage it", user.Spec.Name, databaseName))
+	default:
+		if user.Status.SID == "" {
+			logger.Info("adopting existing user", "database", databaseName, "name", user.Spec.Name, "sid", state.SID)
+			r.Recorder.Eventf(user, corev1.EventTypeNormal, EventReasonUserAdopted, "Adopted existing user %s of database %s with sid %s",
+				user.Spec.Name, databaseName, state.SID)
+			reason = actionsv1beta1.DatabaseUserReasonAdopted
+			message = "Existing user was adopted"
+		}
+		if err = r.remediateUser(ctx, user, msSQL, databaseName, ms.DiffUser(params, state)); err != nil {
+			return syncFailed(ctx, r.Client, r.Recorder, user, actionsv1beta1.DatabaseUserReasonSyncFailed, err)
+		}
+		if passwordVersion != user.Status.PasswordVersion {
+			if err = msSQL.AlterUserPassword(ctx, databaseName, user.Spec.Name, password); err != nil {
+				return syncFailed(ctx, r.Client, r.Recorder, user, actionsv1beta1.DatabaseUserReasonSyncFailed, err)
+			}
+			r.Recorder.Eventf(user, corev1.EventTypeNormal, EventReasonUserPasswordChanged, "Changed the password of user %s to the password of secret %s",
+				user.Spec.Name, user.Spec.Password.Name)
+			user.Status.PasswordVersion = passwordVersion
+		}
+	}
+
+	if state, err = msSQL.UserState(ctx, databaseName, user.Spec.Name); err != nil {
+		return syncFailed(ctx, r.Client, r.Recorder, user, actionsv1beta1.DatabaseUserReasonSyncFailed, err)
+	}
+	user.Status.LastSyncTime = syncTime(user.Status.LastSyncTime, r.ResyncPeriod)
+	observeUser(user, state)
+	user.MarkSynced(reason, message)
+	user.Status.ObservedGeneration = user.Generation
+	if err = updateStatusIfChanged(ctx, r.Client, user, read, &user.Status); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: r.ResyncPeriod}, nil
+}
+
+// UserParams the desired authentication and options of the DatabaseUser as compared with
+// sys.database_principals
+func UserParams(user *actionsv1beta1.DatabaseUser) *ms.UserParams {
+	userType := user.Spec.Type
+	if userType == "" {
+		userType = actionsv1beta1.UserTypeLogin
+	}
+	params := &ms.UserParams{
+		Authentication: userAuthentications[userType],
+		DefaultSchema:  ms.SetString(user.Spec.DefaultSchema),
+	}
+	if userType == actionsv1beta1.UserTypeLogin {
+		params.Login = &user.Spec.Login
+	}
+	return params
+}
+
+// userPassword the password of a contained user and the resourceVersion of its secret, both are empty for the
+// other types of users
+func (r *DatabaseUserReconciler) userPassword(ctx context.Context, user *actionsv1beta1.DatabaseUser) (string, string, error) {
+	if user.Spec.Type != actionsv1beta1.UserTypeContained {
+		return "", "", nil
+	}
+	if user.Spec.Password == nil {
+		return "", "", fmt.Errorf("a contained user needs spec.password")
+	}
+	return ms.QuerySecretKeyVersion(ctx, r.Client, user.Namespace, user.Spec.Password.Name, user.Spec.Password.Key)
+}
+
+// recordCreated records the sid of the user just created and the version of its password in the status right
+// away, so the user is managed as created by the DatabaseUser even when the status written at the end of the
+// reconcile is lost
+func (r *DatabaseUserReconciler) recordCreated(ctx context.Context, user *actionsv1beta1.DatabaseUser, msSQL ms.Provider, databaseName, passwordVersion string) error {
+	state, err := msSQL.UserState(ctx, databaseName, user.Spec.Name)
+	if err != nil {
+		return err
+	}
+	return recordCreated(ctx, r.Client, user, func() {
+		if state != nil {
+			user.Status.SID, user.Status.PrincipalID = state.SID, state.PrincipalID
+		}
+		user.Status.PasswordVersion = passwordVersion
+	})
+}
+
+// remediateUser alters the drifted options of the user back to the spec, emitting a Warning event for the drift and
+// a Normal event for the change. The type of a user cannot be altered, a user of another type fails the sync
+func (r *DatabaseUserReconciler) remediateUser(ctx context.Context, user *actionsv1beta1.DatabaseUser, msSQL ms.Provider, databaseName string, diff *ms.UserDiff) error {
+	if !diff.HasDrift() {
+		return nil
+	}
+	drifted := []string{}
+	for _, f := range diff.Drifted() {
+		if !f.Remediable {
+			return fmt.Errorf("user %s is of authentication type %s while the spec asks for %s, drop the user or change spec.type",
+				user.Spec.Name, f.Observed, f.Desired)
+		}
+		drifted = append(drifted, fmt.Sprintf("%s (desired %s, observed %s)", f.Field, f.Desired, f.Observed))
+	}
+	r.Recorder.Eventf(user, corev1.EventTypeWarning, EventReasonDriftDetected, "User differs from the spec: %s", strings.Join(drifted, ", "))
+	now := metav1.Now()
+	user.Status.LastDrift = &now
+
+	remediation := diff.Remediation()
+	alters, err := ms.AlterUserStatements(databaseName, user.Spec.Name, remediation)
+	if err != nil {
+		return err
+	}
+	if err = msSQL.AlterUser(ctx, databaseName, user.Spec.Name, remediation); err != nil {
+		return err
+	}
+	r.Recorder.Eventf(user, corev1.EventTypeNormal, EventReasonUserAltered, "Executed %s", statementsSummary(alters...))
+	return nil
+}
+
+// dropUser drops the user and emits an event with the DROP executed
+func (r *DatabaseUserReconciler) dropUser(ctx context.Context, user *actionsv1beta1.DatabaseUser, msSQL ms.Provider, databaseName string) error {
+	drop, err := ms.DropUserStatement(databaseName, user.Spec.Name)
+	if err != nil {
+		return err
+	}
+	if err = msSQL.DeleteUser(ctx, databaseName, user.Spec.Name); err != nil {
+		return err
+	}
+	r.Recorder.Eventf(user, corev1.EventTypeNormal, EventReasonUserDropped, "Executed %s", statementsSummary(drop))
+	return nil
+}
+
+// observeUser maps the row of sys.database_principals to the status of the DatabaseUser
+func observeUser(user *actionsv1beta1.DatabaseUser, state *ms.UserState) {
+	if state == nil {
+		user.Status.Observed = nil
+		return
+	}
+	user.Status.SID = state.SID
+	user.Status.PrincipalID = state.PrincipalID
+	user.Status.Observed = &actionsv1beta1.ObservedDatabaseUser{
+		AuthenticationType: state.AuthenticationType,
+		Login:              state.Login,
+		DefaultSchema:      state.DefaultSchema,
+	}
+	if created, err := state.Created(); err == nil {
+		createDate := metav1.NewTime(created)
+		user.Status.Observed.CreateDate = &createDate
+	}
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *DatabaseUserReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &actionsv1beta1.DatabaseUser{}, credentialsSecretKey, func(rawObj client.Object) []string {
+		user := rawObj.(*actionsv1beta1.DatabaseUser)
+		if user.Spec.Password == nil {
+			return nil
+		}
+		return []string{user.Spec.Password.Name}
+	}); err != nil {
+		return err
+	}
+
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &actionsv1beta1.DatabaseUser{}, databaseRefKey, func(rawObj client.Object) []string {
+		user := rawObj.(*actionsv1beta1.DatabaseUser)
+		return []string{user.Spec.DatabaseRef.Name}
+	}); err != nil {
+		return err
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&actionsv1beta1.DatabaseUser{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(&source.Kind{Type: &corev1.Secret{}}, handler.EnqueueRequestsFromMapFunc(r.usersForSecret)).
+		Watches(&source.Kind{Type: &actionsv1beta1.Database{}}, handler.EnqueueRequestsFromMapFunc(r.usersForDatabase),
+			builder.WithPredicates(databaseReadyChanged)).
+		Complete(r)
+}
+
+// usersForSecret maps a secret to the DatabaseUsers reading it so a changed password is applied to the user
+func (r *DatabaseUserReconciler) usersForSecret(obj client.Object) []reconcile.Request {
+	return r.usersMatching(obj, credentialsSecretKey)
+}
+
+// usersForDatabase maps a Database to its DatabaseUsers so the users are reconciled when the Database becomes
+// ready
+func (r *DatabaseUserReconciler) usersForDatabase(obj client.Object) []reconcile.Request {
+	return r.usersMatching(obj, databaseRefKey)
+}
+
+// usersMatching lists the DatabaseUsers in the namespace of obj whose indexed field matches the name of obj
+func (r *DatabaseUserReconciler) usersMatching(obj client.Object, field string) []reconcile.Request {
+	return requestsMatching(r.Client, r.Logger, &actionsv1beta1.DatabaseUserList{}, obj.GetNamespace(), field, obj.GetName())
+}
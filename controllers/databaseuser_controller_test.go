@@ -0,0 +1,215 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	actionsv1beta1 "github.com/pplavetzki/azure-sql-mi/api/v1beta1"
+	ms "github.com/pplavetzki/azure-sql-mi/internal"
+	"github.com/pplavetzki/azure-sql-mi/internal/fake"
+)
+
+// newDatabaseUser a DatabaseUser CR with a unique name of the type in the Database named databaseName
+func newDatabaseUser(databaseName string, userType actionsv1beta1.UserType) *actionsv1beta1.DatabaseUser {
+	n := nextIndex()
+	return &actionsv1beta1.DatabaseUser{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("user-%d", n),
+			Namespace: "default",
+		},
+		Spec: actionsv1beta1.DatabaseUserSpec{
+			Name:          fmt.Sprintf("user%d", n),
+			DatabaseRef:   corev1.LocalObjectReference{Name: databaseName},
+			Type:          userType,
+			DefaultSchema: fake.DefaultSchema,
+		},
+	}
+}
+
+// waitForUserSID waits for the DatabaseUser to record the sid of its user
+func waitForUserSID(key types.NamespacedName) *actionsv1beta1.DatabaseUser {
+	user := &actionsv1beta1.DatabaseUser{ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace}}
+	waitFor(user, func() bool { return user.Status.SID != "" })
+	return user
+}
+
+var _ = Describe("DatabaseUser controller", func() {
+	BeforeEach(ensureManagedInstance)
+
+	Context("when a DatabaseUser of a login is created", func() {
+		It("creates the user for the login and records its sid and principal_id", func() {
+			db := createReadyDatabase()
+			user := newDatabaseUser(db.Name, actionsv1beta1.UserTypeLogin)
+			user.Spec.Login = fmt.Sprintf("login-of-%s", user.Spec.Name)
+			sid := sqlServer.AddLogin(user.Spec.Login, "Str0ng!Passw0rd")
+			key := objectKey(user)
+			Expect(k8sClient.Create(ctx, user)).To(Succeed())
+
+			created := waitForUserSID(key)
+			Expect(created.Status.SID).To(Equal(sid))
+			sqlUser, ok := sqlServer.User(db.Spec.Name, user.Spec.Name)
+			Expect(ok).To(BeTrue())
+			Expect(sqlUser.AuthenticationType).To(Equal(ms.AuthenticationInstance))
+			Expect(created.Status.PrincipalID).To(Equal(sqlUser.PrincipalID))
+			Expect(created.Status.Observed.Login).To(Equal(user.Spec.Login))
+			Expect(created.Status.Observed.DefaultSchema).To(Equal(fake.DefaultSchema))
+			Expect(controllerutil.ContainsFinalizer(created, finalizer)).To(BeTrue())
+			Expect(created.IsReady()).To(BeTrue())
+			Expect(eventReasons(created)).To(ContainElement(EventReasonUserCreated))
+		})
+	})
+
+	Context("when a contained DatabaseUser is created", func() {
+		It("creates the user with the password of its secret and changes it with the secret", func() {
+			db := createReadyDatabase()
+			user := newDatabaseUser(db.Name, actionsv1beta1.UserTypeContained)
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("%s-password", user.Name), Namespace: "default"},
+				StringData: map[string]string{"password": "Str0ng!Passw0rd"},
+			}
+			user.Spec.Password = &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: secret.Name},
+				Key:                  "password",
+			}
+			key := objectKey(user)
+			Expect(k8sClient.Create(ctx, secret)).To(Succeed())
+			Expect(k8sClient.Create(ctx, user)).To(Succeed())
+
+			created := waitForUserSID(key)
+			Expect(created.Status.PasswordVersion).NotTo(BeEmpty())
+			sqlUser, _ := sqlServer.User(db.Spec.Name, user.Spec.Name)
+			Expect(sqlUser.AuthenticationType).To(Equal(ms.AuthenticationDatabase))
+			Expect(sqlUser.Password).To(Equal("Str0ng!Passw0rd"))
+
+			secret.StringData = map[string]string{"password": "R0tated!Passw0rd"}
+			Expect(k8sClient.Update(ctx, secret)).To(Succeed())
+
+			Eventually(func() string {
+				sqlUser, _ := sqlServer.User(db.Spec.Name, user.Spec.Name)
+				return sqlUser.Password
+			}, timeout, interval).Should(Equal("R0tated!Passw0rd"))
+		})
+	})
+
+	Context("when the Database of the DatabaseUser does not exist yet", func() {
+		It("waits for the Database and creates the user once it is ready", func() {
+			db := newDatabase()
+			user := newDatabaseUser(db.Name, actionsv1beta1.UserTypeWithoutLogin)
+			key := objectKey(user)
+			Expect(k8sClient.Create(ctx, user)).To(Succeed())
+
+			Eventually(func() string {
+				pending := &actionsv1beta1.DatabaseUser{}
+				if err := k8sClient.Get(ctx, key, pending); err != nil {
+					return ""
+				}
+				condition := meta.FindStatusCondition(pending.Status.Conditions, actionsv1beta1.DatabaseUserConditionDatabaseReady)
+				if condition == nil {
+					return ""
+				}
+				return condition.Reason
+			}, timeout, interval).Should(Equal(actionsv1beta1.DatabaseUserReasonDatabaseNotFound))
+
+			Expect(k8sClient.Create(ctx, db)).To(Succeed())
+			waitForUserSID(key)
+			sqlUser, ok := sqlServer.User(db.Spec.Name, user.Spec.Name)
+			Expect(ok).To(BeTrue())
+			Expect(sqlUser.AuthenticationType).To(Equal(ms.AuthenticationNone))
+		})
+	})
+
+	Context("when the user already exists in the database", func() {
+		It("refuses to manage it unless adoptExisting is set", func() {
+			db := createReadyDatabase()
+			user := newDatabaseUser(db.Name, actionsv1beta1.UserTypeWithoutLogin)
+			key := objectKey(user)
+			sid, err := sqlServer.AddUser(db.Spec.Name, user.Spec.Name)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Create(ctx, user)).To(Succeed())
+
+			Eventually(func() []string {
+				return eventReasons(user)
+			}, timeout, interval).Should(ContainElement(EventReasonSyncFailed))
+
+			By("adopting the user")
+			Eventually(func() error {
+				existing := &actionsv1beta1.DatabaseUser{}
+				if err := k8sClient.Get(ctx, key, existing); err != nil {
+					return err
+				}
+				existing.Spec.AdoptExisting = true
+				return k8sClient.Update(ctx, existing)
+			}, timeout, interval).Should(Succeed())
+			Expect(waitForUserSID(key).Status.SID).To(Equal(sid))
+		})
+	})
+
+	Context("when a DatabaseUser is deleted", func() {
+		It("drops the user and removes the finalizer", func() {
+			db := createReadyDatabase()
+			user := newDatabaseUser(db.Name, actionsv1beta1.UserTypeWithoutLogin)
+			key := objectKey(user)
+			Expect(k8sClient.Create(ctx, user)).To(Succeed())
+			waitForUserSID(key)
+
+			Expect(k8sClient.Delete(ctx, user)).To(Succeed())
+
+			waitForDeletion(key, &actionsv1beta1.DatabaseUser{})
+			_, ok := sqlServer.User(db.Spec.Name, user.Spec.Name)
+			Expect(ok).To(BeFalse())
+		})
+	})
+})
+
+var _ = Describe("DatabaseUser drift", func() {
+	var (
+		server   *fake.Server
+		provider ms.Provider
+		r        *DatabaseUserReconciler
+	)
+
+	BeforeEach(func() {
+		server, provider = newFakeDatabase()
+		r = &DatabaseUserReconciler{Recorder: record.NewFakeRecorder(10)}
+	})
+
+	It("alters the default schema and the login back to the spec", func() {
+		user := newDatabaseUser("app", actionsv1beta1.UserTypeLogin)
+		user.Spec.Login = "app"
+		server.AddLogin("app", "Str0ng!Passw0rd")
+		Expect(provider.CreateUser(context.Background(), "App", user.Spec.Name, "", UserParams(user))).To(Succeed())
+		Expect(server.UpdateUser("App", user.Spec.Name, func(u *fake.User) {
+			u.DefaultSchema = "sales"
+			u.SID = "0x01"
+		})).To(Succeed())
+
+		state, err := provider.UserState(context.Background(), "App", user.Spec.Name)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.remediateUser(context.Background(), user, provider, "App", ms.DiffUser(UserParams(user), state))).To(Succeed())
+
+		sqlUser, _ := server.User("App", user.Spec.Name)
+		Expect(sqlUser.DefaultSchema).To(Equal(fake.DefaultSchema))
+		l, _ := server.Login("app")
+		Expect(sqlUser.SID).To(Equal(l.SID))
+		Expect(user.Status.LastDrift).NotTo(BeNil())
+	})
+
+	It("fails when the user is of another type", func() {
+		user := newDatabaseUser("app", actionsv1beta1.UserTypeContained)
+		_, err := server.AddUser("App", user.Spec.Name)
+		Expect(err).NotTo(HaveOccurred())
+
+		state, err := provider.UserState(context.Background(), "App", user.Spec.Name)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.remediateUser(context.Background(), user, provider, "App", ms.DiffUser(UserParams(user), state))).NotTo(Succeed())
+	})
+})
@@ -0,0 +1,182 @@
+package controllers
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+
+	ms "github.com/pplavetzki/azure-sql-mi/internal"
+)
+
+// Reasons of the events emitted for a Database, the instance, credentials, sync and drift reasons are used for
+// the other kinds as well
+const (
+	EventReasonInstanceNotFound    = "InstanceNotFound"
+	EventReasonInstanceNotReady    = "InstanceNotReady"
+	EventReasonCredentialsNotFound = "CredentialsNotFound"
+	EventReasonSyncFailed          = "SyncFailed"
+	EventReasonDatabaseCreated     = "DatabaseCreated"
+	EventReasonDatabaseAdopted     = "DatabaseAdopted"
+	EventReasonDatabaseAltered     = "DatabaseAltered"
+	EventReasonDatabaseBackedUp    = "DatabaseBackedUp"
+	EventReasonDatabaseRenamed     = "DatabaseRenamed"
+	EventReasonDatabaseDropped     = "DatabaseDropped"
+	EventReasonDatabaseRetained    = "DatabaseRetained"
+	EventReasonDriftDetected       = "DriftDetected"
+	EventReasonCronJobCreated      = "CronJobCreated"
+	EventReasonCronJobUpdated      = "CronJobUpdated"
+	EventReasonCronJobDeleted      = "CronJobDeleted"
+)
+
+// Reasons of the events emitted for a Login
+const (
+	EventReasonPasswordNotFound     = "PasswordNotFound"
+	EventReasonLoginCreated         = "LoginCreated"
+	EventReasonLoginAdopted         = "LoginAdopted"
+	EventReasonLoginAltered         = "LoginAltered"
+	EventReasonLoginPasswordChanged = "LoginPasswordChanged"
+	EventReasonLoginDropped         = "LoginDropped"
+)
+
+// Reasons of the events emitted for a DatabaseUser
+const (
+	EventReasonDatabaseNotFound    = "DatabaseNotFound"
+	EventReasonDatabaseNotReady    = "DatabaseNotReady"
+	EventReasonUserCreated         = "UserCreated"
+	EventReasonUserAdopted         = "UserAdopted"
+	EventReasonUserAltered         = "UserAltered"
+	EventReasonUserPasswordChanged = "UserPasswordChanged"
+	EventReasonUserDropped         = "UserDropped"
+)
+
+// Reasons of the events emitted for a DatabaseRole
+const (
+	EventReasonRoleCreated        = "RoleCreated"
+	EventReasonRoleAdopted        = "RoleAdopted"
+	EventReasonRoleMembersChanged = "RoleMembersChanged"
+	EventReasonRoleDropped        = "RoleDropped"
+)
+
+// Reasons of the events emitted for a DatabaseSchema, a schema that cannot be dropped is reported with the
+// SchemaNotEmpty condition reason
+const (
+	EventReasonSchemaCreated      = "SchemaCreated"
+	EventReasonSchemaAdopted      = "SchemaAdopted"
+	EventReasonSchemaOwnerChanged = "SchemaOwnerChanged"
+	EventReasonSchemaDropped      = "SchemaDropped"
+)
+
+// Reasons of the events emitted for a DatabasePermission, and for a Database when its scheduled sync finds
+// permissions granted outside of the DatabasePermissions
+const (
+	EventReasonPermissionsChanged = "PermissionsChanged"
+	EventReasonPermissionsRevoked = "PermissionsRevoked"
+	EventReasonManualPermissions  = "ManualPermissions"
+)
+
+// statementsSummary joins the T-SQL executed for an event, the statements hold quoted identifiers and allow-listed
+// options only while the values of their parameters are left out
+func statementsSummary(statements ...*ms.Statement) string {
+	summary := make([]string, 0, len(statements))
+	for _, statement := range statements {
+		if statement != nil {
+			summary = append(summary, statement.SQL)
+		}
+	}
+	return strings.Join(summary, "; ")
+}
+
+// DefaultEventDedupWindow how long an identical warning of an object is suppressed
+const DefaultEventDedupWindow = time.Hour
+
+type eventKey struct {
+	uid       types.UID
+	eventtype string
+	reason    string
+	message   string
+}
+
+// dedupedReasons the reasons of the Warning events repeated on every resync for as long as the condition lasts, the
+// events of the statements executed are always emitted
+var dedupedReasons = map[string]bool{
+	EventReasonInstanceNotReady:    true,
+	EventReasonCredentialsNotFound: true,
+	EventReasonSyncFailed:          true,
+	EventReasonDriftDetected:       true,
+}
+
+// dedupingRecorder suppresses a Warning event of the dedupedReasons when the object already got the same event
+// within the window, so a database that stays unready or drifted doesn't get an event on every resync
+type dedupingRecorder struct {
+	record.EventRecorder
+	window time.Duration
+	now    func() time.Time
+
+	mu      sync.Mutex
+	emitted map[eventKey]time.Time
+}
+
+// NewDedupingRecorder wraps the recorder so identical warnings of an object are emitted once per window
+func NewDedupingRecorder(recorder record.EventRecorder, window time.Duration) record.EventRecorder {
+	return &dedupingRecorder{
+		EventRecorder: recorder,
+		window:        window,
+		now:           time.Now,
+		emitted:       map[eventKey]time.Time{},
+	}
+}
+
+// Event implements record.EventRecorder
+func (r *dedupingRecorder) Event(object runtime.Object, eventtype, reason, message string) {
+	if r.duplicate(object, eventtype, reason, message) {
+		return
+	}
+	r.EventRecorder.Event(object, eventtype, reason, message)
+}
+
+// Eventf implements record.EventRecorder
+func (r *dedupingRecorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	r.Event(object, eventtype, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+// AnnotatedEventf implements record.EventRecorder
+func (r *dedupingRecorder) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventtype, reason, messageFmt string, args ...interface{}) {
+	message := fmt.Sprintf(messageFmt, args...)
+	if r.duplicate(object, eventtype, reason, message) {
+		return
+	}
+	r.EventRecorder.AnnotatedEventf(object, annotations, eventtype, reason, "%s", message)
+}
+
+// duplicate records the event and reports whether it was already emitted within the window
+func (r *dedupingRecorder) duplicate(object runtime.Object, eventtype, reason, message string) bool {
+	if eventtype != corev1.EventTypeWarning || !dedupedReasons[reason] {
+		return false
+	}
+	accessor, err := meta.Accessor(object)
+	if err != nil {
+		return false
+	}
+	key := eventKey{uid: accessor.GetUID(), eventtype: eventtype, reason: reason, message: message}
+	now := r.now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if emitted, ok := r.emitted[key]; ok && now.Sub(emitted) < r.window {
+		return true
+	}
+	for k, emitted := range r.emitted {
+		if now.Sub(emitted) >= r.window {
+			delete(r.emitted, k)
+		}
+	}
+	r.emitted[key] = now
+	return false
+}
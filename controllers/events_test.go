@@ -0,0 +1,60 @@
+package controllers
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	actionsv1beta1 "github.com/pplavetzki/azure-sql-mi/api/v1beta1"
+)
+
+var _ = Describe("Deduplicating event recorder", func() {
+	var (
+		fakeRecorder *record.FakeRecorder
+		recorder     *dedupingRecorder
+		now          time.Time
+		db           *actionsv1beta1.Database
+	)
+
+	BeforeEach(func() {
+		fakeRecorder = record.NewFakeRecorder(10)
+		recorder = NewDedupingRecorder(fakeRecorder, time.Minute).(*dedupingRecorder)
+		now = time.Date(2021, 9, 1, 12, 0, 0, 0, time.UTC)
+		recorder.now = func() time.Time { return now }
+		db = &actionsv1beta1.Database{ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default", UID: "uid-1"}}
+	})
+
+	It("Should suppress identical events within the window", func() {
+		recorder.Eventf(db, corev1.EventTypeWarning, EventReasonInstanceNotReady, "instance %s is not ready", "sqlmi")
+		recorder.Eventf(db, corev1.EventTypeWarning, EventReasonInstanceNotReady, "instance %s is not ready", "sqlmi")
+		Expect(fakeRecorder.Events).To(HaveLen(1))
+		Expect(<-fakeRecorder.Events).To(Equal("Warning InstanceNotReady instance sqlmi is not ready"))
+
+		By("emitting again once the window has passed")
+		now = now.Add(time.Minute)
+		recorder.Event(db, corev1.EventTypeWarning, EventReasonInstanceNotReady, "instance sqlmi is not ready")
+		Expect(fakeRecorder.Events).To(HaveLen(1))
+	})
+
+	It("Should always emit the events of the statements executed", func() {
+		for i := 0; i < 2; i++ {
+			recorder.Event(db, corev1.EventTypeNormal, EventReasonDatabaseAltered, "Executed ALTER DATABASE [db] SET PARAMETERIZATION SIMPLE")
+			recorder.Event(db, corev1.EventTypeWarning, EventReasonManualPermissions, "Permissions not applied by a DatabasePermission: GRANT ALTER TO app")
+		}
+		Expect(fakeRecorder.Events).To(HaveLen(4))
+	})
+
+	It("Should emit events that differ or belong to another object", func() {
+		recorder.Event(db, corev1.EventTypeWarning, EventReasonSyncFailed, "login failed")
+		recorder.Event(db, corev1.EventTypeWarning, EventReasonSyncFailed, "database is offline")
+
+		other := db.DeepCopy()
+		other.UID = "uid-2"
+		recorder.Event(other, corev1.EventTypeWarning, EventReasonSyncFailed, "login failed")
+		Expect(fakeRecorder.Events).To(HaveLen(3))
+	})
+})
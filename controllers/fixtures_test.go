@@ -0,0 +1,191 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	fakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	arcdatav1 "github.com/pplavetzki/azure-sql-mi/api/arcdata/v1"
+	actionsv1beta1 "github.com/pplavetzki/azure-sql-mi/api/v1beta1"
+	ms "github.com/pplavetzki/azure-sql-mi/internal"
+	"github.com/pplavetzki/azure-sql-mi/internal/fake"
+)
+
+const (
+	timeout  = time.Second * 10
+	interval = time.Millisecond * 250
+)
+
+var objectCount = 0
+
+// nextIndex a number unique to the test run, the fixtures build the names of their objects with it
+func nextIndex() int {
+	objectCount++
+	return objectCount
+}
+
+// objectKey the key to get obj with
+func objectKey(obj client.Object) types.NamespacedName {
+	return types.NamespacedName{Name: obj.GetName(), Namespace: obj.GetNamespace()}
+}
+
+// waitFor gets obj until done reports the state the test waits for, done reads obj
+func waitFor(obj client.Object, done func() bool) {
+	key := objectKey(obj)
+	Eventually(func() bool {
+		if err := k8sClient.Get(ctx, key, obj); err != nil {
+			return false
+		}
+		return done()
+	}, timeout, interval).Should(BeTrue())
+}
+
+// waitForDeletion waits for the object of the key to be gone, obj is of its kind
+func waitForDeletion(key types.NamespacedName, obj client.Object) {
+	Eventually(func() bool {
+		return apierrors.IsNotFound(k8sClient.Get(ctx, key, obj))
+	}, timeout, interval).Should(BeTrue())
+}
+
+// newFakeDatabase a fake sql server with the database App holding the users, and a Provider connected to it
+func newFakeDatabase(users ...string) (*fake.Server, ms.Provider) {
+	server := fake.NewServer()
+	server.AddDatabase("App")
+	for _, user := range users {
+		_, err := server.AddUser("App", user)
+		Expect(err).NotTo(HaveOccurred())
+	}
+	return server, server.Factory()("server", "sa", "P@ssw0rd", 1433)
+}
+
+// createReadyDatabase creates a Database on the test sql managed instance and waits for it to be ready
+func createReadyDatabase() *actionsv1beta1.Database {
+	db := newDatabase()
+	Expect(k8sClient.Create(ctx, db)).To(Succeed())
+	waitFor(db, db.IsReady)
+	return db
+}
+
+// touch changes an annotation of the Database to trigger a reconcile
+func touch(key types.NamespacedName) {
+	Eventually(func() error {
+		db := &actionsv1beta1.Database{}
+		if err := k8sClient.Get(ctx, key, db); err != nil {
+			return err
+		}
+		if db.Annotations == nil {
+			db.Annotations = map[string]string{}
+		}
+		db.Annotations["test/touched"] = time.Now().Format(time.RFC3339Nano)
+		return k8sClient.Update(ctx, db)
+	}, timeout, interval).Should(Succeed())
+}
+
+// eventReasons the reasons of the events of the object
+func eventReasons(obj client.Object) []string {
+	events := &corev1.EventList{}
+	if err := k8sClient.List(ctx, events, client.InNamespace(obj.GetNamespace())); err != nil {
+		return nil
+	}
+	reasons := []string{}
+	for _, event := range events.Items {
+		if event.InvolvedObject.UID == obj.GetUID() {
+			reasons = append(reasons, event.Reason)
+		}
+	}
+	return reasons
+}
+
+// ensureManagedInstance creates the ready test sql managed instance and its login unless they exist
+func ensureManagedInstance() {
+	mi := &arcdatav1.SQLManagedInstance{}
+	err := k8sClient.Get(ctx, types.NamespacedName{Name: "sqlmi", Namespace: "default"}, mi)
+	if err == nil {
+		return
+	}
+	Expect(apierrors.IsNotFound(err)).To(BeTrue())
+
+	By("creating a ready sql managed instance and its login")
+	Expect(k8sClient.Create(ctx, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "sqlmi-login-secret", Namespace: "default"},
+		StringData: map[string]string{"username": "sa", "password": "P@ssw0rd"},
+	})).To(Succeed())
+	Expect(k8sClient.Create(ctx, &arcdatav1.SQLManagedInstance{
+		ObjectMeta: metav1.ObjectMeta{Name: "sqlmi", Namespace: "default"},
+		Spec: arcdatav1.SQLManagedInstanceSpec{
+			LoginRef: arcdatav1.LoginRef{Kind: "Secret", Name: "sqlmi-login-secret", Namespace: "default"},
+		},
+		Status: arcdatav1.SQLManagedInstanceStatus{State: arcdatav1.SQLManagedInstanceStateReady},
+	})).To(Succeed())
+}
+
+// newFakeClient a fake client holding objs along with the sql managed instance sqlmi and the secret of its login
+// in the namespace default
+func newFakeClient(objs ...client.Object) client.Client {
+	scheme := runtime.NewScheme()
+	Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	Expect(arcdatav1.AddToScheme(scheme)).To(Succeed())
+	Expect(actionsv1beta1.AddToScheme(scheme)).To(Succeed())
+	objs = append(objs, &arcdatav1.SQLManagedInstance{
+		ObjectMeta: metav1.ObjectMeta{Name: "sqlmi", Namespace: "default"},
+		Spec:       arcdatav1.SQLManagedInstanceSpec{LoginRef: arcdatav1.LoginRef{Name: "sqlmi-login-secret", Namespace: "default"}},
+		Status:     arcdatav1.SQLManagedInstanceStatus{State: arcdatav1.SQLManagedInstanceStateReady},
+	}, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "sqlmi-login-secret", Namespace: "default"},
+		Data:       map[string][]byte{"username": []byte("sa"), "password": []byte("P@ssw0rd")},
+	})
+	return fakeclient.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+}
+
+// lostStatusUpdates a client whose status updates fail, as if the write at the end of a reconcile was lost
+type lostStatusUpdates struct {
+	client.Client
+}
+
+func (c lostStatusUpdates) Status() client.StatusWriter {
+	return lostStatusWriter{c.Client.Status()}
+}
+
+type lostStatusWriter struct {
+	client.StatusWriter
+}
+
+func (w lostStatusWriter) Update(context.Context, client.Object, ...client.UpdateOption) error {
+	return errors.New("connection reset by peer")
+}
+
+// serverSideApply a client that stores the server-side applies of the controller as creates and updates since the
+// fake client rejects apply patches, or fails them with err when set
+type serverSideApply struct {
+	client.Client
+	err error
+}
+
+func (c serverSideApply) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if patch != client.Apply {
+		return c.Client.Patch(ctx, obj, patch, opts...)
+	}
+	if c.err != nil {
+		return c.err
+	}
+	existing := obj.DeepCopyObject().(client.Object)
+	if err := c.Get(ctx, client.ObjectKeyFromObject(obj), existing); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return err
+		}
+		return c.Create(ctx, obj)
+	}
+	obj.SetResourceVersion(existing.GetResourceVersion())
+	return c.Update(ctx, obj)
+}
@@ -0,0 +1,287 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	arcdatav1 "github.com/pplavetzki/azure-sql-mi/api/arcdata/v1"
+	actionsv1beta1 "github.com/pplavetzki/azure-sql-mi/api/v1beta1"
+	ms "github.com/pplavetzki/azure-sql-mi/internal"
+)
+
+// DefaultResyncPeriod how often the logins are compared with their spec when nothing changed
+const DefaultResyncPeriod = 10 * time.Minute
+
+// LoginReconciler reconciles a Login object
+type LoginReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	Logger logr.Logger
+	// NewProvider builds the sql server Provider of a login
+	NewProvider ms.ProviderFactory
+	// Recorder emits the events of the Logins, it is expected to deduplicate them
+	Recorder record.EventRecorder
+	// ResyncPeriod how often an unchanged Login is compared with the server, it is only compared on changes when
+	// not set
+	ResyncPeriod time.Duration
+}
+
+//+kubebuilder:rbac:groups=actions.msft.isd.coe.io,resources=logins,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=actions.msft.isd.coe.io,resources=logins/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=actions.msft.isd.coe.io,resources=logins/finalizers,verbs=update
+//+kubebuilder:rbac:groups=sql.arcdata.microsoft.com,resources=sqlmanagedinstances,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+
+// Reconcile creates the sql login of the Login and alters it back to the spec, including the password of its
+// secret, on every change and resync
+func (r *LoginReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := r.Logger.WithValues("login", req.NamespacedName)
+
+	login := &actionsv1beta1.Login{}
+	if err := r.Get(ctx, req.NamespacedName, login); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	read := login.Status.DeepCopy()
+
+	msSQL, _, err := connect(ctx, r.Client, r.NewProvider, login.Namespace, login.Spec.Connection)
+	if err != nil {
+		return connectionFailed(ctx, r.Client, r.Recorder, login, err)
+	}
+	login.MarkInstanceReady()
+
+	if login.ObjectMeta.DeletionTimestamp.IsZero() {
+		if err = addFinalizer(ctx, r.Client, login); err != nil {
+			return ctrl.Result{}, err
+		}
+	} else {
+		// a login that was never created nor adopted is not dropped, it belongs to someone else
+		if controllerutil.ContainsFinalizer(login, finalizer) && login.Status.SID != "" {
+			if err = r.dropLogin(ctx, login, msSQL); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		return ctrl.Result{}, removeFinalizer(ctx, r.Client, login)
+	}
+
+	password, err := ms.QuerySecretKey(ctx, r.Client, login.Namespace, login.Spec.Password.Name, login.Spec.Password.Key)
+	if err != nil {
+		return syncFailed(ctx, r.Client, r.Recorder, login, actionsv1beta1.LoginReasonPasswordNotFound, err)
+	}
+	params := LoginParams(login)
+	state, err := msSQL.LoginState(ctx, login.Spec.Name, password)
+	if err != nil {
+		return syncFailed(ctx, r.Client, r.Recorder, login, actionsv1beta1.LoginReasonSyncFailed, err)
+	}
+
+	reason := actionsv1beta1.LoginReasonSynced
+	message := "Login was compared with the spec and altered where needed"
+	switch {
+	case state == nil:
+		name, err := ms.QuoteName(login.Spec.Name)
+		if err != nil {
+			return syncFailed(ctx, r.Client, r.Recorder, login, actionsv1beta1.LoginReasonSyncFailed, err)
+		}
+		if err = msSQL.CreateLogin(ctx, login.Spec.Name, password, params); err != nil {
+			return syncFailed(ctx, r.Client, r.Recorder, login, actionsv1beta1.LoginReasonSyncFailed, err)
+		}
+		if err = r.recordCreated(ctx, login, msSQL, password); err != nil {
+			return syncFailed(ctx, r.Client, r.Recorder, login, actionsv1beta1.LoginReasonSyncFailed, err)
+		}
+		r.Recorder.Eventf(login, corev1.EventTypeNormal, EventReasonLoginCreated, "Created login %s with the password of secret %s", name, login.Spec.Password.Name)
+		reason = actionsv1beta1.LoginReasonCreated
+		message = "Login was created"
+	case login.Status.SID == "" && !login.Spec.AdoptExisting:
+		return syncFailed(ctx, r.Client, r.Recorder, login, actionsv1beta1.LoginReasonSyncFailed,
+			fmt.Errorf("login %s already exists on the server, set spec.adoptExisting to manage it", login.Spec.Name))
+	default:
+		if login.Status.SID == "" {
+			logger.Info("adopting existing login", "name", login.Spec.Name, "sid", state.SID)
+			r.Recorder.Eventf(login, corev1.EventTypeNormal, EventReasonLoginAdopted, "Adopted existing login %s with sid %s", login.Spec.Name, state.SID)
+			reason = actionsv1beta1.LoginReasonAdopted
+			message = "Existing login was adopted"
+		}
+		if err = r.remediateLogin(ctx, login, msSQL, password, ms.DiffLogin(params, state)); err != nil {
+			return syncFailed(ctx, r.Client, r.Recorder, login, actionsv1beta1.LoginReasonSyncFailed, err)
+		}
+	}
+
+	if state, err = msSQL.LoginState(ctx, login.Spec.Name, password); err != nil {
+		return syncFailed(ctx, r.Client, r.Recorder, login, actionsv1beta1.LoginReasonSyncFailed, err)
+	}
+	login.Status.LastSyncTime = syncTime(login.Status.LastSyncTime, r.ResyncPeriod)
+	observeLogin(login, state)
+	login.MarkSynced(reason, message)
+	login.Status.ObservedGeneration = login.Generation
+	if err = updateStatusIfChanged(ctx, r.Client, login, read, &login.Status); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: r.ResyncPeriod}, nil
+}
+
+// LoginParams the desired options of the Login as compared with sys.sql_logins
+func LoginParams(login *actionsv1beta1.Login) *ms.LoginParams {
+	return &ms.LoginParams{
+		DefaultDatabase: ms.SetString(login.Spec.DefaultDatabase),
+		DefaultLanguage: ms.SetString(login.Spec.DefaultLanguage),
+		CheckPolicy:     login.Spec.CheckPolicy,
+		CheckExpiration: login.Spec.CheckExpiration,
+	}
+}
+
+// recordCreated records the sid of the login just created in the status right away, so the login is managed as
+// created by the Login even when the status written at the end of the reconcile is lost
+func (r *LoginReconciler) recordCreated(ctx context.Context, login *actionsv1beta1.Login, msSQL ms.Provider, password string) error {
+	state, err := msSQL.LoginState(ctx, login.Spec.Name, password)
+	if err != nil || state == nil {
+		return err
+	}
+	return recordCreated(ctx, r.Client, login, func() { login.Status.SID, login.Status.PrincipalID = state.SID, state.PrincipalID })
+}
+
+// remediateLogin alters the drifted options and the password of the login back to the spec, emitting a Warning
+// event for the drift and a Normal event for each change
+func (r *LoginReconciler) remediateLogin(ctx context.Context, login *actionsv1beta1.Login, msSQL ms.Provider, password string, diff *ms.LoginDiff) error {
+	if !diff.HasDrift() {
+		return nil
+	}
+	drifted := []string{}
+	for _, f := range diff.Drifted() {
+		if f.Field == ms.OptionPassword {
+			drifted = append(drifted, f.Field)
+			continue
+		}
+		drifted = append(drifted, fmt.Sprintf("%s (desired %s, observed %s)", f.Field, f.Desired, f.Observed))
+	}
+	r.Recorder.Eventf(login, corev1.EventTypeWarning, EventReasonDriftDetected, "Login differs from the spec: %s", strings.Join(drifted, ", "))
+	now := metav1.Now()
+	login.Status.LastDrift = &now
+
+	if remediation := diff.Remediation(); remediation != nil {
+		alters, err := ms.AlterLoginStatements(login.Spec.Name, remediation)
+		if err != nil {
+			return err
+		}
+		if err = msSQL.AlterLogin(ctx, login.Spec.Name, remediation); err != nil {
+			return err
+		}
+		r.Recorder.Eventf(login, corev1.EventTypeNormal, EventReasonLoginAltered, "Executed %s", statementsSummary(alters...))
+	}
+	if diff.PasswordDrifted() {
+		name, err := ms.QuoteName(login.Spec.Name)
+		if err != nil {
+			return err
+		}
+		if err = msSQL.AlterLoginPassword(ctx, login.Spec.Name, password); err != nil {
+			return err
+		}
+		r.Recorder.Eventf(login, corev1.EventTypeNormal, EventReasonLoginPasswordChanged, "Changed the password of login %s to the password of secret %s", name, login.Spec.Password.Name)
+	}
+	return nil
+}
+
+// dropLogin drops the login and emits an event with the DROP executed
+func (r *LoginReconciler) dropLogin(ctx context.Context, login *actionsv1beta1.Login, msSQL ms.Provider) error {
+	drop, err := ms.DropLoginStatement(login.Spec.Name)
+	if err != nil {
+		return err
+	}
+	if err = msSQL.DeleteLogin(ctx, login.Spec.Name); err != nil {
+		return err
+	}
+	r.Recorder.Eventf(login, corev1.EventTypeNormal, EventReasonLoginDropped, "Executed %s", statementsSummary(drop))
+	return nil
+}
+
+// observeLogin maps the row of sys.sql_logins to the status of the Login
+func observeLogin(login *actionsv1beta1.Login, state *ms.LoginState) {
+	if state == nil {
+		login.Status.Observed = nil
+		return
+	}
+	login.Status.SID = state.SID
+	login.Status.PrincipalID = state.PrincipalID
+	login.Status.Observed = &actionsv1beta1.ObservedLogin{
+		DefaultDatabase: state.DefaultDatabase,
+		DefaultLanguage: state.DefaultLanguage,
+		CheckPolicy:     state.CheckPolicy,
+		CheckExpiration: state.CheckExpiration,
+		IsDisabled:      state.IsDisabled,
+	}
+	if created, err := state.Created(); err == nil {
+		createDate := metav1.NewTime(created)
+		login.Status.Observed.CreateDate = &createDate
+	}
+}
+
+// loginSecretNames the secrets the Login reads, the secret of its password and the sql login of its connection
+func loginSecretNames(login *actionsv1beta1.Login) []string {
+	names := []string{login.Spec.Password.Name}
+	if ref := connectionCredentialsRef(login.Namespace, login.Spec.Connection); ref != nil {
+		for _, name := range ref.SecretNames() {
+			if name != login.Spec.Password.Name {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *LoginReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &actionsv1beta1.Login{}, credentialsSecretKey, func(rawObj client.Object) []string {
+		return loginSecretNames(rawObj.(*actionsv1beta1.Login))
+	}); err != nil {
+		return err
+	}
+
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &actionsv1beta1.Login{}, managedInstanceKey, func(rawObj client.Object) []string {
+		login := rawObj.(*actionsv1beta1.Login)
+		return []string{login.Spec.Connection.SQLManagedInstance}
+	}); err != nil {
+		return err
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&actionsv1beta1.Login{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(&source.Kind{Type: &corev1.Secret{}}, handler.EnqueueRequestsFromMapFunc(r.loginsForSecret)).
+		Watches(&source.Kind{Type: &arcdatav1.SQLManagedInstance{}}, handler.EnqueueRequestsFromMapFunc(r.loginsForManagedInstance)).
+		Complete(r)
+}
+
+// loginsForSecret maps a secret to the Logins reading it, including the Logins on the sql managed instances whose
+// login it holds, so a changed password is applied to the login
+func (r *LoginReconciler) loginsForSecret(obj client.Object) []reconcile.Request {
+	requests := r.loginsMatching(obj, credentialsSecretKey)
+	for _, mi := range instancesWithLogin(r.Client, r.Logger, obj) {
+		requests = append(requests, r.loginsMatching(mi, managedInstanceKey)...)
+	}
+	return requests
+}
+
+// loginsForManagedInstance maps a sql managed instance to the Logins on it so the logins are reconciled when the
+// instance becomes ready
+func (r *LoginReconciler) loginsForManagedInstance(obj client.Object) []reconcile.Request {
+	return r.loginsMatching(obj, managedInstanceKey)
+}
+
+// loginsMatching lists the Logins in the namespace of obj whose indexed field matches the name of obj
+func (r *LoginReconciler) loginsMatching(obj client.Object, field string) []reconcile.Request {
+	return requestsMatching(r.Client, r.Logger, &actionsv1beta1.LoginList{}, obj.GetNamespace(), field, obj.GetName())
+}
@@ -0,0 +1,206 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	actionsv1beta1 "github.com/pplavetzki/azure-sql-mi/api/v1beta1"
+	ms "github.com/pplavetzki/azure-sql-mi/internal"
+	"github.com/pplavetzki/azure-sql-mi/internal/fake"
+)
+
+// newLogin a Login CR with a unique name on the test sql managed instance along with the secret of its password
+func newLogin(password string) (*actionsv1beta1.Login, *corev1.Secret) {
+	n := nextIndex()
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("login-%d-password", n), Namespace: "default"},
+		StringData: map[string]string{"password": password},
+	}
+	policy, expiration := true, false
+	login := &actionsv1beta1.Login{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("login-%d", n),
+			Namespace: "default",
+		},
+		Spec: actionsv1beta1.LoginSpec{
+			Name: fmt.Sprintf("app%d", n),
+			Connection: actionsv1beta1.ConnectionSpec{
+				Server:             "sqlmi-p-svc",
+				Port:               1433,
+				SQLManagedInstance: "sqlmi",
+			},
+			Password: corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: secret.Name},
+				Key:                  "password",
+			},
+			DefaultDatabase: fake.DefaultLoginDatabase,
+			CheckPolicy:     &policy,
+			CheckExpiration: &expiration,
+		},
+	}
+	return login, secret
+}
+
+var _ = Describe("Login controller", func() {
+	BeforeEach(ensureManagedInstance)
+
+	Context("when a Login is created", func() {
+		It("creates the login with the password of its secret and records its sid", func() {
+			login, secret := newLogin("Str0ng!Passw0rd")
+			key := objectKey(login)
+			Expect(k8sClient.Create(ctx, secret)).To(Succeed())
+			Expect(k8sClient.Create(ctx, login)).To(Succeed())
+
+			created := &actionsv1beta1.Login{}
+			Eventually(func() string {
+				if err := k8sClient.Get(ctx, key, created); err != nil {
+					return ""
+				}
+				return created.Status.SID
+			}, timeout, interval).ShouldNot(BeEmpty())
+
+			sqlLogin, ok := sqlServer.Login(login.Spec.Name)
+			Expect(ok).To(BeTrue())
+			Expect(sqlLogin.Password).To(Equal("Str0ng!Passw0rd"))
+			Expect(created.Status.SID).To(Equal(sqlLogin.SID))
+			Expect(created.Status.PrincipalID).To(Equal(sqlLogin.PrincipalID))
+			Expect(controllerutil.ContainsFinalizer(created, finalizer)).To(BeTrue())
+			Expect(created.IsReady()).To(BeTrue())
+			Expect(created.Status.Observed.DefaultDatabase).To(Equal(fake.DefaultLoginDatabase))
+			Expect(eventReasons(created)).To(ContainElement(EventReasonLoginCreated))
+		})
+	})
+
+	Context("when the password secret changes", func() {
+		It("alters the login to the new password", func() {
+			login, secret := newLogin("Str0ng!Passw0rd")
+			Expect(k8sClient.Create(ctx, secret)).To(Succeed())
+			Expect(k8sClient.Create(ctx, login)).To(Succeed())
+			Eventually(func() bool {
+				_, ok := sqlServer.Login(login.Spec.Name)
+				return ok
+			}, timeout, interval).Should(BeTrue())
+
+			secret.StringData = map[string]string{"password": "R0tated!Passw0rd"}
+			Expect(k8sClient.Update(ctx, secret)).To(Succeed())
+
+			Eventually(func() string {
+				sqlLogin, _ := sqlServer.Login(login.Spec.Name)
+				return sqlLogin.Password
+			}, timeout, interval).Should(Equal("R0tated!Passw0rd"))
+		})
+	})
+
+	Context("when the login already exists on the server", func() {
+		It("refuses to manage it unless adoptExisting is set", func() {
+			login, secret := newLogin("Str0ng!Passw0rd")
+			key := objectKey(login)
+			sid := sqlServer.AddLogin(login.Spec.Name, "Manual!Passw0rd")
+			Expect(k8sClient.Create(ctx, secret)).To(Succeed())
+			Expect(k8sClient.Create(ctx, login)).To(Succeed())
+
+			Eventually(func() []string {
+				return eventReasons(login)
+			}, timeout, interval).Should(ContainElement(EventReasonSyncFailed))
+			sqlLogin, _ := sqlServer.Login(login.Spec.Name)
+			Expect(sqlLogin.Password).To(Equal("Manual!Passw0rd"))
+
+			By("adopting the login")
+			Eventually(func() error {
+				existing := &actionsv1beta1.Login{}
+				if err := k8sClient.Get(ctx, key, existing); err != nil {
+					return err
+				}
+				existing.Spec.AdoptExisting = true
+				return k8sClient.Update(ctx, existing)
+			}, timeout, interval).Should(Succeed())
+			Eventually(func() string {
+				adopted := &actionsv1beta1.Login{}
+				if err := k8sClient.Get(ctx, key, adopted); err != nil {
+					return ""
+				}
+				return adopted.Status.SID
+			}, timeout, interval).Should(Equal(sid))
+			sqlLogin, _ = sqlServer.Login(login.Spec.Name)
+			Expect(sqlLogin.Password).To(Equal("Str0ng!Passw0rd"))
+		})
+	})
+
+	Context("when a Login is deleted", func() {
+		It("drops the login and removes the finalizer", func() {
+			login, secret := newLogin("Str0ng!Passw0rd")
+			key := objectKey(login)
+			Expect(k8sClient.Create(ctx, secret)).To(Succeed())
+			Expect(k8sClient.Create(ctx, login)).To(Succeed())
+			Eventually(func() string {
+				created := &actionsv1beta1.Login{}
+				if err := k8sClient.Get(ctx, key, created); err != nil {
+					return ""
+				}
+				return created.Status.SID
+			}, timeout, interval).ShouldNot(BeEmpty())
+
+			Expect(k8sClient.Delete(ctx, login)).To(Succeed())
+
+			waitForDeletion(key, &actionsv1beta1.Login{})
+			_, ok := sqlServer.Login(login.Spec.Name)
+			Expect(ok).To(BeFalse())
+		})
+	})
+})
+
+var _ = Describe("Login drift", func() {
+	It("alters the drifted options and the password back to the spec", func() {
+		server := fake.NewServer()
+		provider := server.Factory()("server", "sa", "P@ssw0rd", 1433)
+		r := &LoginReconciler{Recorder: record.NewFakeRecorder(10)}
+		login, _ := newLogin("Str0ng!Passw0rd")
+		server.AddLogin(login.Spec.Name, "Str0ng!Passw0rd")
+		Expect(server.UpdateLogin(login.Spec.Name, func(l *fake.Login) {
+			l.Password = "Manual!Passw0rd"
+			l.CheckPolicy = false
+			l.DefaultDatabase = "tempdb"
+		})).To(Succeed())
+
+		state, err := provider.LoginState(context.Background(), login.Spec.Name, "Str0ng!Passw0rd")
+		Expect(err).NotTo(HaveOccurred())
+		diff := ms.DiffLogin(LoginParams(login), state)
+		Expect(r.remediateLogin(context.Background(), login, provider, "Str0ng!Passw0rd", diff)).To(Succeed())
+
+		sqlLogin, _ := server.Login(login.Spec.Name)
+		Expect(sqlLogin.Password).To(Equal("Str0ng!Passw0rd"))
+		Expect(sqlLogin.CheckPolicy).To(BeTrue())
+		Expect(sqlLogin.DefaultDatabase).To(Equal(fake.DefaultLoginDatabase))
+		Expect(login.Status.LastDrift).NotTo(BeNil())
+	})
+})
+
+var _ = Describe("Login created before a lost status write", func() {
+	It("manages the login it created on the next reconcile", func() {
+		server := fake.NewServer()
+		login, secret := newLogin("Str0ng!Passw0rd")
+		secret.Data = map[string][]byte{"password": []byte("Str0ng!Passw0rd")}
+		c := newFakeClient(login, secret)
+		r := &LoginReconciler{Client: lostStatusUpdates{c}, Logger: logr.Discard(), NewProvider: server.Factory(), Recorder: record.NewFakeRecorder(10)}
+		_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: objectKey(login)})
+		Expect(err).To(HaveOccurred())
+
+		r.Client = c
+		_, err = r.Reconcile(context.Background(), ctrl.Request{NamespacedName: objectKey(login)})
+		Expect(err).NotTo(HaveOccurred())
+		reconciled := &actionsv1beta1.Login{}
+		Expect(c.Get(context.Background(), objectKey(login), reconciled)).To(Succeed())
+		sqlLogin, _ := server.Login(login.Spec.Name)
+		Expect(reconciled.Status.SID).To(Equal(sqlLogin.SID))
+		Expect(reconciled.IsReady()).To(BeTrue())
+	})
+})
@@ -0,0 +1,289 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	arcdatav1 "github.com/pplavetzki/azure-sql-mi/api/arcdata/v1"
+	actionsv1beta1 "github.com/pplavetzki/azure-sql-mi/api/v1beta1"
+	ms "github.com/pplavetzki/azure-sql-mi/internal"
+)
+
+const metricsNamespace = "azure_sql_mi"
+
+// Results of a reconcile of a Database
+const (
+	reconcileResultSuccess = "success"
+	reconcileResultError   = "error"
+)
+
+// Operations of the sql server Provider that are measured
+const (
+	operationCreateDatabase   = "CreateDatabase"
+	operationAlterDatabase    = "AlterDatabase"
+	operationDeleteDatabase   = "DeleteDatabase"
+	operationSyncNeeded       = "SyncNeeded"
+	operationCreateLogin      = "CreateLogin"
+	operationAlterLogin       = "AlterLogin"
+	operationDeleteLogin      = "DeleteLogin"
+	operationCreateUser       = "CreateUser"
+	operationAlterUser        = "AlterUser"
+	operationDeleteUser       = "DeleteUser"
+	operationCreateRole       = "CreateRole"
+	operationAddRoleMember    = "AddRoleMember"
+	operationDropRoleMember   = "DropRoleMember"
+	operationDeleteRole       = "DeleteRole"
+	operationApplyPermission  = "ApplyPermission"
+	operationCreateSchema     = "CreateSchema"
+	operationAlterSchemaOwner = "AlterSchemaOwner"
+	operationDeleteSchema     = "DeleteSchema"
+)
+
+var (
+	reconcileTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "database",
+		Name:      "reconcile_total",
+		Help:      "Number of reconciles of a Database by result.",
+	}, []string{"namespace", "database", "result"})
+
+	sqlOperationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "sql",
+		Name:      "operation_duration_seconds",
+		Help:      "Latency of the sql server operations by sql managed instance.",
+		Buckets:   []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"namespace", "instance", "operation"})
+
+	sqlOperationErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "sql",
+		Name:      "operation_errors_total",
+		Help:      "Number of failed sql server operations by sql managed instance.",
+	}, []string{"namespace", "instance", "operation"})
+
+	databaseDriftedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "database", "drifted"),
+		"Whether the database differs from the spec of its Database.",
+		[]string{"namespace", "database", "instance"}, nil)
+
+	databaseSinceLastSyncDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "database", "seconds_since_last_sync"),
+		"Seconds since the database was last synced successfully by the controller or the sync job.",
+		[]string{"namespace", "database", "instance"}, nil)
+
+	instanceReadyDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "instance", "ready"),
+		"Whether the sql managed instance is in a `Ready` state.",
+		[]string{"namespace", "instance"}, nil)
+)
+
+func init() {
+	metrics.Registry.MustRegister(reconcileTotal, sqlOperationDuration, sqlOperationErrors)
+}
+
+// observeReconcile counts the reconcile of the Database by its result
+func observeReconcile(db *actionsv1beta1.Database, err error) {
+	result := reconcileResultSuccess
+	if err != nil {
+		result = reconcileResultError
+	}
+	reconcileTotal.WithLabelValues(db.Namespace, db.Name, result).Inc()
+}
+
+// forgetReconciles removes the reconcile series of a Database that no longer exists
+func forgetReconciles(namespace, name string) {
+	for _, result := range []string{reconcileResultSuccess, reconcileResultError} {
+		reconcileTotal.DeleteLabelValues(namespace, name, result)
+	}
+}
+
+// instrumentedProvider measures the latency and the errors of the operations of a Provider
+type instrumentedProvider struct {
+	ms.Provider
+	namespace string
+	instance  string
+}
+
+// instrumentProvider wraps the Provider of the sql managed instance so its operations are measured
+func instrumentProvider(provider ms.Provider, namespace, instance string) ms.Provider {
+	return &instrumentedProvider{Provider: provider, namespace: namespace, instance: instance}
+}
+
+// observe records the latency of the operation started at start and whether it failed
+func (p *instrumentedProvider) observe(operation string, start time.Time, err error) {
+	sqlOperationDuration.WithLabelValues(p.namespace, p.instance, operation).Observe(time.Since(start).Seconds())
+	if err != nil {
+		sqlOperationErrors.WithLabelValues(p.namespace, p.instance, operation).Inc()
+	}
+}
+
+// CreateDatabase implements ms.Provider
+func (p *instrumentedProvider) CreateDatabase(ctx context.Context, databaseName string, params *ms.DatabaseParams) (id *string, err error) {
+	defer func(start time.Time) { p.observe(operationCreateDatabase, start, err) }(time.Now())
+	return p.Provider.CreateDatabase(ctx, databaseName, params)
+}
+
+// AlterDatabase implements ms.Provider
+func (p *instrumentedProvider) AlterDatabase(ctx context.Context, databaseName string, params *ms.DatabaseParams) (err error) {
+	defer func(start time.Time) { p.observe(operationAlterDatabase, start, err) }(time.Now())
+	return p.Provider.AlterDatabase(ctx, databaseName, params)
+}
+
+// DeleteDatabase implements ms.Provider
+func (p *instrumentedProvider) DeleteDatabase(ctx context.Context, databaseName string) (err error) {
+	defer func(start time.Time) { p.observe(operationDeleteDatabase, start, err) }(time.Now())
+	return p.Provider.DeleteDatabase(ctx, databaseName)
+}
+
+// SyncNeeded implements ms.Provider
+func (p *instrumentedProvider) SyncNeeded(ctx context.Context, params *ms.DatabaseConfig) (diff *ms.DatabaseDiff, err error) {
+	defer func(start time.Time) { p.observe(operationSyncNeeded, start, err) }(time.Now())
+	return p.Provider.SyncNeeded(ctx, params)
+}
+
+// CreateLogin implements ms.Provider
+func (p *instrumentedProvider) CreateLogin(ctx context.Context, loginName, password string, params *ms.LoginParams) (err error) {
+	defer func(start time.Time) { p.observe(operationCreateLogin, start, err) }(time.Now())
+	return p.Provider.CreateLogin(ctx, loginName, password, params)
+}
+
+// AlterLogin implements ms.Provider
+func (p *instrumentedProvider) AlterLogin(ctx context.Context, loginName string, params *ms.LoginParams) (err error) {
+	defer func(start time.Time) { p.observe(operationAlterLogin, start, err) }(time.Now())
+	return p.Provider.AlterLogin(ctx, loginName, params)
+}
+
+// DeleteLogin implements ms.Provider
+func (p *instrumentedProvider) DeleteLogin(ctx context.Context, loginName string) (err error) {
+	defer func(start time.Time) { p.observe(operationDeleteLogin, start, err) }(time.Now())
+	return p.Provider.DeleteLogin(ctx, loginName)
+}
+
+// CreateUser implements ms.Provider
+func (p *instrumentedProvider) CreateUser(ctx context.Context, databaseName, userName, password string, params *ms.UserParams) (err error) {
+	defer func(start time.Time) { p.observe(operationCreateUser, start, err) }(time.Now())
+	return p.Provider.CreateUser(ctx, databaseName, userName, password, params)
+}
+
+// AlterUser implements ms.Provider
+func (p *instrumentedProvider) AlterUser(ctx context.Context, databaseName, userName string, params *ms.UserParams) (err error) {
+	defer func(start time.Time) { p.observe(operationAlterUser, start, err) }(time.Now())
+	return p.Provider.AlterUser(ctx, databaseName, userName, params)
+}
+
+// DeleteUser implements ms.Provider
+func (p *instrumentedProvider) DeleteUser(ctx context.Context, databaseName, userName string) (err error) {
+	defer func(start time.Time) { p.observe(operationDeleteUser, start, err) }(time.Now())
+	return p.Provider.DeleteUser(ctx, databaseName, userName)
+}
+
+// CreateRole implements ms.Provider
+func (p *instrumentedProvider) CreateRole(ctx context.Context, databaseName, roleName string) (err error) {
+	defer func(start time.Time) { p.observe(operationCreateRole, start, err) }(time.Now())
+	return p.Provider.CreateRole(ctx, databaseName, roleName)
+}
+
+// AddRoleMember implements ms.Provider
+func (p *instrumentedProvider) AddRoleMember(ctx context.Context, databaseName, roleName, memberName string) (err error) {
+	defer func(start time.Time) { p.observe(operationAddRoleMember, start, err) }(time.Now())
+	return p.Provider.AddRoleMember(ctx, databaseName, roleName, memberName)
+}
+
+// DropRoleMember implements ms.Provider
+func (p *instrumentedProvider) DropRoleMember(ctx context.Context, databaseName, roleName, memberName string) (err error) {
+	defer func(start time.Time) { p.observe(operationDropRoleMember, start, err) }(time.Now())
+	return p.Provider.DropRoleMember(ctx, databaseName, roleName, memberName)
+}
+
+// DeleteRole implements ms.Provider
+func (p *instrumentedProvider) DeleteRole(ctx context.Context, databaseName, roleName string) (err error) {
+	defer func(start time.Time) { p.observe(operationDeleteRole, start, err) }(time.Now())
+	return p.Provider.DeleteRole(ctx, databaseName, roleName)
+}
+
+// ApplyPermission implements ms.Provider
+func (p *instrumentedProvider) ApplyPermission(ctx context.Context, databaseName string, desired, observed *ms.Permission) (err error) {
+	defer func(start time.Time) { p.observe(operationApplyPermission, start, err) }(time.Now())
+	return p.Provider.ApplyPermission(ctx, databaseName, desired, observed)
+}
+
+// CreateSchema implements ms.Provider
+func (p *instrumentedProvider) CreateSchema(ctx context.Context, databaseName, schemaName, ownerName string) (err error) {
+	defer func(start time.Time) { p.observe(operationCreateSchema, start, err) }(time.Now())
+	return p.Provider.CreateSchema(ctx, databaseName, schemaName, ownerName)
+}
+
+// AlterSchemaOwner implements ms.Provider
+func (p *instrumentedProvider) AlterSchemaOwner(ctx context.Context, databaseName, schemaName, ownerName string) (err error) {
+	defer func(start time.Time) { p.observe(operationAlterSchemaOwner, start, err) }(time.Now())
+	return p.Provider.AlterSchemaOwner(ctx, databaseName, schemaName, ownerName)
+}
+
+// DeleteSchema implements ms.Provider
+func (p *instrumentedProvider) DeleteSchema(ctx context.Context, databaseName, schemaName string) (err error) {
+	defer func(start time.Time) { p.observe(operationDeleteSchema, start, err) }(time.Now())
+	return p.Provider.DeleteSchema(ctx, databaseName, schemaName)
+}
+
+// stateCollector reports the drift and the last sync of the Databases and the readiness of the sql managed
+// instances from the cache at scrape time, so the status patched by the sync job is reported as well and the
+// series of deleted objects disappear with them
+type stateCollector struct {
+	reader client.Reader
+	now    func() time.Time
+}
+
+// newStateCollector a collector of the state of the objects read from reader
+func newStateCollector(reader client.Reader) *stateCollector {
+	return &stateCollector{reader: reader, now: time.Now}
+}
+
+// Describe implements prometheus.Collector
+func (c *stateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- databaseDriftedDesc
+	ch <- databaseSinceLastSyncDesc
+	ch <- instanceReadyDesc
+}
+
+// Collect implements prometheus.Collector
+func (c *stateCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx := context.Background()
+
+	databases := &actionsv1beta1.DatabaseList{}
+	if err := c.reader.List(ctx, databases); err != nil {
+		ch <- prometheus.NewInvalidMetric(databaseDriftedDesc, err)
+	} else {
+		for i := range databases.Items {
+			db := &databases.Items[i]
+			drifted := 0.0
+			if db.IsConditionTrue(actionsv1beta1.DatabaseConditionDrifted) {
+				drifted = 1
+			}
+			ch <- prometheus.MustNewConstMetric(databaseDriftedDesc, prometheus.GaugeValue, drifted,
+				db.Namespace, db.Name, db.Spec.Connection.SQLManagedInstance)
+			if last := db.LastSuccessfulSync(); last != nil {
+				ch <- prometheus.MustNewConstMetric(databaseSinceLastSyncDesc, prometheus.GaugeValue,
+					c.now().Sub(last.Time).Seconds(), db.Namespace, db.Name, db.Spec.Connection.SQLManagedInstance)
+			}
+		}
+	}
+
+	instances := &arcdatav1.SQLManagedInstanceList{}
+	if err := c.reader.List(ctx, instances); err != nil {
+		ch <- prometheus.NewInvalidMetric(instanceReadyDesc, err)
+		return
+	}
+	for i := range instances.Items {
+		mi := &instances.Items[i]
+		ready := 0.0
+		if mi.IsReady() {
+			ready = 1
+		}
+		ch <- prometheus.MustNewConstMetric(instanceReadyDesc, prometheus.GaugeValue, ready, mi.Namespace, mi.Name)
+	}
+}
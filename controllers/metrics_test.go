@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	fakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	arcdatav1 "github.com/pplavetzki/azure-sql-mi/api/arcdata/v1"
+	actionsv1beta1 "github.com/pplavetzki/azure-sql-mi/api/v1beta1"
+	ms "github.com/pplavetzki/azure-sql-mi/internal"
+	"github.com/pplavetzki/azure-sql-mi/internal/fake"
+)
+
+var _ = Describe("Metrics", func() {
+	Context("of the sql server operations", func() {
+		It("measures the latency and counts the errors per sql managed instance", func() {
+			server := fake.NewServer()
+			provider := instrumentProvider(server.Factory()("server", "sa", "P@ssw0rd", 1433), "metrics", "sqlmi-metrics")
+			ctx := context.Background()
+
+			_, err := provider.CreateDatabase(ctx, "MetricsDatabase", &ms.DatabaseParams{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(testutil.ToFloat64(sqlOperationErrors.WithLabelValues("metrics", "sqlmi-metrics", operationCreateDatabase))).To(BeZero())
+
+			server.FailOn(operationDeleteDatabase, errors.New("login failed"))
+			Expect(provider.DeleteDatabase(ctx, "MetricsDatabase")).NotTo(Succeed())
+			Expect(testutil.ToFloat64(sqlOperationErrors.WithLabelValues("metrics", "sqlmi-metrics", operationDeleteDatabase))).To(Equal(1.0))
+			Expect(testutil.CollectAndCount(sqlOperationDuration, "azure_sql_mi_sql_operation_duration_seconds")).To(BeNumerically(">=", 2))
+		})
+	})
+
+	Context("of the state of the Databases and the sql managed instances", func() {
+		It("reports the drift, the time since the last successful sync and the readiness", func() {
+			scheme := runtime.NewScheme()
+			Expect(actionsv1beta1.AddToScheme(scheme)).To(Succeed())
+			Expect(arcdatav1.AddToScheme(scheme)).To(Succeed())
+
+			now := time.Date(2021, 9, 1, 12, 0, 0, 0, time.UTC)
+			drifted := newDatabase()
+			drifted.Namespace = "metrics"
+			drifted.Status.LastSyncRun = &actionsv1beta1.SyncRun{Time: metav1.NewTime(now.Add(-30 * time.Second)),
+				Result: actionsv1beta1.SyncResultFailed, LastSucceeded: &metav1.Time{Time: now.Add(-90 * time.Second)}}
+			drifted.Status.LastSyncTime = &metav1.Time{Time: now.Add(-30 * time.Second)}
+			drifted.Status.Drift = []actionsv1beta1.DriftField{{Field: ms.OptionCollation}}
+			drifted.MarkDrift()
+			neverSynced := newDatabase()
+			neverSynced.Namespace = "metrics"
+
+			reader := fakeclient.NewClientBuilder().WithScheme(scheme).WithObjects(drifted, neverSynced,
+				&arcdatav1.SQLManagedInstance{
+					ObjectMeta: metav1.ObjectMeta{Name: "sqlmi", Namespace: "metrics"},
+					Status:     arcdatav1.SQLManagedInstanceStatus{State: arcdatav1.SQLManagedInstanceStateReady},
+				}).Build()
+			collector := newStateCollector(reader)
+			collector.now = func() time.Time { return now }
+
+			expected := `
+# HELP azure_sql_mi_database_drifted Whether the database differs from the spec of its Database.
+# TYPE azure_sql_mi_database_drifted gauge
+azure_sql_mi_database_drifted{database="` + drifted.Name + `",instance="sqlmi",namespace="metrics"} 1
+azure_sql_mi_database_drifted{database="` + neverSynced.Name + `",instance="sqlmi",namespace="metrics"} 0
+# HELP azure_sql_mi_database_seconds_since_last_sync Seconds since the database was last synced successfully by the controller or the sync job.
+# TYPE azure_sql_mi_database_seconds_since_last_sync gauge
+azure_sql_mi_database_seconds_since_last_sync{database="` + drifted.Name + `",instance="sqlmi",namespace="metrics"} 90
+# HELP azure_sql_mi_instance_ready Whether the sql managed instance is in a ` + "`Ready`" + ` state.
+# TYPE azure_sql_mi_instance_ready gauge
+azure_sql_mi_instance_ready{instance="sqlmi",namespace="metrics"} 1
+`
+			Expect(testutil.CollectAndCompare(collector, strings.NewReader(expected))).To(Succeed())
+		})
+	})
+})
@@ -0,0 +1,220 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	actionsv1beta1 "github.com/pplavetzki/azure-sql-mi/api/v1beta1"
+	ms "github.com/pplavetzki/azure-sql-mi/internal"
+)
+
+// finalizer keeps the objects of every kind until what they created on the server is dropped or retained
+const finalizer = "actions.msft.isd.coe.io/finalizer"
+
+// syncedObject an object whose failed reconciles are recorded in its Synced condition
+type syncedObject interface {
+	client.Object
+	MarkSyncFailed(reason string, err error)
+}
+
+// instanceObject a Database or a Login, its InstanceReady condition tells whether its sql managed instance is ready
+type instanceObject interface {
+	syncedObject
+	MarkInstanceReady()
+	MarkInstanceNotReady(reason, message string)
+}
+
+// dependentObject a DatabaseUser, DatabaseRole, DatabasePermission or DatabaseSchema, it is reconciled in the
+// database of a Database and its DatabaseReady condition tells whether that Database can be used
+type dependentObject interface {
+	syncedObject
+	MarkDatabaseReady()
+	MarkDatabaseNotReady(reason, message string)
+}
+
+// updateStatus writes the status of obj after a failure, an error writing it is logged as the failure is returned
+func updateStatus(ctx context.Context, c client.StatusClient, obj client.Object) {
+	if err := c.Status().Update(ctx, obj); err != nil {
+		log.FromContext(ctx).Error(err, "failed to update status", "name", obj.GetName(), "namespace", obj.GetNamespace())
+	}
+}
+
+// updateStatusIfChanged writes the status of obj at the end of a reconcile unless it is equal to read, the status
+// as it was read at the start, so a reconcile that changed nothing doesn't write
+func updateStatusIfChanged(ctx context.Context, c client.StatusClient, obj client.Object, read, status interface{}) error {
+	if equality.Semantic.DeepEqual(read, status) {
+		return nil
+	}
+	return c.Status().Update(ctx, obj)
+}
+
+// recordCreated patches the status of obj with the identity set by record as soon as what obj manages was
+// created, retrying the write since an object created without it would look like one to adopt on the next
+// reconcile. The rest of the status of obj is left to the write at the end of the reconcile
+func recordCreated(ctx context.Context, c client.StatusClient, obj client.Object, record func()) error {
+	patch := client.MergeFrom(obj.DeepCopyObject().(client.Object))
+	record()
+	patched := obj.DeepCopyObject().(client.Object)
+	if err := retry.OnError(retry.DefaultBackoff, func(err error) bool { return !apierrors.IsNotFound(err) }, func() error {
+		return c.Status().Patch(ctx, patched, patch)
+	}); err != nil {
+		return err
+	}
+	obj.SetResourceVersion(patched.GetResourceVersion())
+	return nil
+}
+
+// syncTime the LastSyncTime of a check that ran now. The previous time is kept until the resync period elapsed, a
+// reconcile triggered by a watch in between then leaves an otherwise unchanged status as is
+func syncTime(previous *metav1.Time, period time.Duration) *metav1.Time {
+	if previous != nil && time.Since(previous.Time) < period {
+		return previous
+	}
+	now := metav1.Now()
+	return &now
+}
+
+// syncFailed records the failure in the Synced condition and a Warning event and returns err so the request is
+// retried, the condition reason doubles as the event reason
+func syncFailed(ctx context.Context, c client.StatusClient, recorder record.EventRecorder, obj syncedObject, reason string, err error) (ctrl.Result, error) {
+	recorder.Event(obj, corev1.EventTypeWarning, reason, err.Error())
+	obj.MarkSyncFailed(reason, err)
+	updateStatus(ctx, c, obj)
+	return ctrl.Result{}, err
+}
+
+// connectionFailed records why the sql server of a Database or a Login cannot be reached, in InstanceReady when
+// the sql managed instance is the cause and in Synced when its login is
+func connectionFailed(ctx context.Context, c client.StatusClient, recorder record.EventRecorder, obj instanceObject, err error) (ctrl.Result, error) {
+	var connErr *connectionError
+	if errors.As(err, &connErr) && connErr.instanceNotReady() {
+		recorder.Event(obj, corev1.EventTypeWarning, connErr.reason, err.Error())
+		obj.MarkInstanceNotReady(connErr.reason, err.Error())
+		updateStatus(ctx, c, obj)
+		return ctrl.Result{}, err
+	}
+	obj.MarkInstanceReady()
+	return syncFailed(ctx, c, recorder, obj, EventReasonCredentialsNotFound, err)
+}
+
+// databaseNotReady records why the Database of obj cannot be used in the DatabaseReady condition and a Warning
+// event, the condition reason doubles as the event reason
+func databaseNotReady(ctx context.Context, c client.StatusClient, recorder record.EventRecorder, obj dependentObject, reason, message string) {
+	recorder.Event(obj, corev1.EventTypeWarning, reason, message)
+	obj.MarkDatabaseNotReady(reason, message)
+	updateStatus(ctx, c, obj)
+}
+
+// connectDatabase gets the Database of obj and connects to its sql server. The Database is nil when it cannot be
+// used, the reason is recorded in DatabaseReady and obj is reconciled again by the watch of the Databases. An obj
+// being deleted doesn't wait for its Database to be ready, and without a Database its finalizer is removed as the
+// database is dropped or retained on its own
+func connectDatabase(ctx context.Context, c client.Client, recorder record.EventRecorder, newProvider ms.ProviderFactory, obj dependentObject, databaseRef string) (*actionsv1beta1.Database, ms.Provider, error) {
+	deleting := !obj.GetDeletionTimestamp().IsZero()
+	db := &actionsv1beta1.Database{}
+	if err := c.Get(ctx, types.NamespacedName{Name: databaseRef, Namespace: obj.GetNamespace()}, db); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return nil, nil, err
+		}
+		if deleting {
+			log.FromContext(ctx).Info("Database not found, leaving its database to its deletion policy", "database", databaseRef)
+			return nil, nil, removeFinalizer(ctx, c, obj)
+		}
+		databaseNotReady(ctx, c, recorder, obj, EventReasonDatabaseNotFound, fmt.Sprintf("Database %s not found", databaseRef))
+		return nil, nil, nil
+	}
+	if !deleting && !db.IsReady() {
+		databaseNotReady(ctx, c, recorder, obj, EventReasonDatabaseNotReady, fmt.Sprintf("Database %s is not ready", db.Name))
+		return nil, nil, nil
+	}
+
+	msSQL, _, err := connect(ctx, c, newProvider, db.Namespace, db.Spec.Connection)
+	if err != nil {
+		var connErr *connectionError
+		if errors.As(err, &connErr) && connErr.instanceNotReady() {
+			databaseNotReady(ctx, c, recorder, obj, connErr.reason, err.Error())
+			return nil, nil, err
+		}
+		obj.MarkDatabaseReady()
+		_, err = syncFailed(ctx, c, recorder, obj, EventReasonCredentialsNotFound, err)
+		return nil, nil, err
+	}
+	obj.MarkDatabaseReady()
+	return db, msSQL, nil
+}
+
+// addFinalizer adds the finalizer to obj so its deletion waits for the controller
+func addFinalizer(ctx context.Context, c client.Writer, obj client.Object) error {
+	if controllerutil.ContainsFinalizer(obj, finalizer) {
+		return nil
+	}
+	controllerutil.AddFinalizer(obj, finalizer)
+	return c.Update(ctx, obj)
+}
+
+// removeFinalizer lets the deletion of obj proceed
+func removeFinalizer(ctx context.Context, c client.Writer, obj client.Object) error {
+	if !controllerutil.ContainsFinalizer(obj, finalizer) {
+		return nil
+	}
+	controllerutil.RemoveFinalizer(obj, finalizer)
+	return c.Update(ctx, obj)
+}
+
+// requestsMatching lists the objects of the kind of list in namespace whose indexed field matches value and maps
+// them to reconcile requests
+func requestsMatching(c client.Reader, logger logr.Logger, list client.ObjectList, namespace, field, value string) []reconcile.Request {
+	if err := c.List(context.Background(), list, client.InNamespace(namespace), client.MatchingFields{field: value}); err != nil {
+		logger.Error(err, "failed to list the objects to reconcile", "field", field, "value", value)
+		return nil
+	}
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		logger.Error(err, "failed to list the objects to reconcile", "field", field, "value", value)
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(items))
+	for _, item := range items {
+		obj, err := meta.Accessor(item)
+		if err != nil {
+			continue
+		}
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: obj.GetName(), Namespace: obj.GetNamespace()}})
+	}
+	return requests
+}
+
+// databaseReadyChanged lets through the updates of a Database that flip its Ready condition, the objects reconciled
+// in its database only depend on whether it is ready while its status is written on every sync
+var databaseReadyChanged = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		oldDB, ok := e.ObjectOld.(*actionsv1beta1.Database)
+		if !ok {
+			return false
+		}
+		newDB, ok := e.ObjectNew.(*actionsv1beta1.Database)
+		if !ok {
+			return false
+		}
+		return oldDB.IsReady() != newDB.IsReady()
+	},
+}
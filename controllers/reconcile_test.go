@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	arcdatav1 "github.com/pplavetzki/azure-sql-mi/api/arcdata/v1"
+	actionsv1beta1 "github.com/pplavetzki/azure-sql-mi/api/v1beta1"
+)
+
+var _ = Describe("Database watch of the database objects", func() {
+	var db *actionsv1beta1.Database
+
+	BeforeEach(func() {
+		db = &actionsv1beta1.Database{ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default", Generation: 1}}
+		db.MarkInstanceReady()
+		db.MarkSynced(actionsv1beta1.DatabaseReasonCreated, "Database was created")
+	})
+
+	It("lets through a Database that stops being ready", func() {
+		notReady := db.DeepCopy()
+		notReady.MarkSyncFailed(actionsv1beta1.DatabaseReasonSyncFailed, errors.New("login failed"))
+		Expect(databaseReadyChanged.Update(event.UpdateEvent{ObjectOld: db, ObjectNew: notReady})).To(BeTrue())
+		Expect(databaseReadyChanged.Update(event.UpdateEvent{ObjectOld: notReady, ObjectNew: db})).To(BeTrue())
+	})
+
+	It("filters out a status write of a ready Database", func() {
+		synced := db.DeepCopy()
+		now := metav1.Now()
+		synced.Status.LastSyncTime = &now
+		Expect(databaseReadyChanged.Update(event.UpdateEvent{ObjectOld: db, ObjectNew: synced})).To(BeFalse())
+	})
+})
+
+var _ = Describe("Sync time", func() {
+	It("is kept within the resync period", func() {
+		previous := metav1.NewTime(time.Now().Add(-time.Minute))
+		Expect(syncTime(&previous, 10*time.Minute)).To(Equal(&previous))
+		Expect(syncTime(&previous, 30*time.Second).After(previous.Time)).To(BeTrue())
+		Expect(syncTime(&previous, 0).After(previous.Time)).To(BeTrue())
+	})
+})
+
+var _ = Describe("Secret watch of the login of the sql managed instance", func() {
+	It("reconciles the Databases and Logins connecting with the login of the instance", func() {
+		mi := &arcdatav1.SQLManagedInstance{
+			ObjectMeta: metav1.ObjectMeta{Name: "sqlmi-shared", Namespace: "default"},
+			Spec:       arcdatav1.SQLManagedInstanceSpec{LoginRef: arcdatav1.LoginRef{Name: "sqlmi-shared-login", Namespace: "secrets"}},
+		}
+		db := newDatabase()
+		db.Spec.Connection.SQLManagedInstance = mi.Name
+		login, _ := newLogin("Str0ng!Passw0rd")
+		login.Spec.Connection.SQLManagedInstance = mi.Name
+		c := newFakeClient(mi, db, login)
+		secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "sqlmi-shared-login", Namespace: "secrets"}}
+
+		databases := (&DatabaseReconciler{Client: c, Logger: logr.Discard()}).databasesForSecret(secret)
+		Expect(databases).To(ConsistOf(reconcile.Request{NamespacedName: objectKey(db)}))
+		logins := (&LoginReconciler{Client: c, Logger: logr.Discard()}).loginsForSecret(secret)
+		Expect(logins).To(ConsistOf(reconcile.Request{NamespacedName: objectKey(login)}))
+
+		other := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "sqlmi-shared-login", Namespace: "default"}}
+		Expect(instancesWithLogin(c, logr.Discard(), other)).To(BeEmpty())
+	})
+})
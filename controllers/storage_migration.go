@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	actionsv1beta1 "github.com/pplavetzki/azure-sql-mi/api/v1beta1"
+)
+
+// DatabaseCRDName the name of the CustomResourceDefinition of Database
+const DatabaseCRDName = "databases.actions.msft.isd.coe.io"
+
+//+kubebuilder:rbac:groups=apiextensions.k8s.io,resources=customresourcedefinitions,verbs=get;list;watch
+//+kubebuilder:rbac:groups=apiextensions.k8s.io,resources=customresourcedefinitions/status,verbs=update;patch
+
+// StorageVersionMigrator rewrites every Database in the storage version (v1beta1) and then drops the
+// older versions from the stored versions of the CRD, so v1alpha1 can eventually stop being served
+type StorageVersionMigrator struct {
+	Client client.Client
+	// Reader reads the CRD and the Databases from the api server rather than the cache
+	Reader client.Reader
+	Logger logr.Logger
+	// Backoff between the attempts of a failed migration
+	Backoff wait.Backoff
+}
+
+var _ manager.LeaderElectionRunnable = &StorageVersionMigrator{}
+
+// DefaultMigrationBackoff retries a failed migration for about 10 minutes
+var DefaultMigrationBackoff = wait.Backoff{Duration: 5 * time.Second, Factor: 2, Jitter: 0.1, Steps: 8, Cap: 2 * time.Minute}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable
+func (m *StorageVersionMigrator) NeedLeaderElection() bool {
+	return true
+}
+
+// Start implements manager.Runnable, the migration runs once when the manager starts
+func (m *StorageVersionMigrator) Start(ctx context.Context) error {
+	var lastErr error
+	err := wait.ExponentialBackoff(m.Backoff, func() (bool, error) {
+		if lastErr = m.Migrate(ctx); lastErr != nil {
+			m.Logger.Error(lastErr, "storage version migration failed, retrying")
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil {
+		// a failed migration leaves the stored versions as they are, the manager keeps running
+		m.Logger.Error(lastErr, "giving up on the storage version migration")
+	}
+	return nil
+}
+
+// Migrate rewrites the Databases and records v1beta1 as the only stored version of the CRD, nothing is
+// done when the CRD already only stores v1beta1
+func (m *StorageVersionMigrator) Migrate(ctx context.Context) error {
+	crd := &apiextensionsv1.CustomResourceDefinition{}
+	if err := m.Reader.Get(ctx, types.NamespacedName{Name: DatabaseCRDName}, crd); err != nil {
+		return err
+	}
+	storageVersion := actionsv1beta1.GroupVersion.Version
+	if len(crd.Status.StoredVersions) == 1 && crd.Status.StoredVersions[0] == storageVersion {
+		return nil
+	}
+	m.Logger.Info("migrating the stored Databases", "stored-versions", crd.Status.StoredVersions, "storage-version", storageVersion)
+
+	databases := &actionsv1beta1.DatabaseList{}
+	if err := m.Reader.List(ctx, databases); err != nil {
+		return err
+	}
+	for i := range databases.Items {
+		key := client.ObjectKeyFromObject(&databases.Items[i])
+		// an update without changes is enough for the api server to write the object in the storage version
+		if err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+			db := &actionsv1beta1.Database{}
+			if err := m.Reader.Get(ctx, key, db); err != nil {
+				return client.IgnoreNotFound(err)
+			}
+			return client.IgnoreNotFound(m.Client.Update(ctx, db))
+		}); err != nil {
+			return err
+		}
+	}
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if err := m.Reader.Get(ctx, types.NamespacedName{Name: DatabaseCRDName}, crd); err != nil {
+			return err
+		}
+		crd.Status.StoredVersions = []string{storageVersion}
+		return m.Client.Status().Update(ctx, crd)
+	})
+}
@@ -0,0 +1,49 @@
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	fakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	actionsv1beta1 "github.com/pplavetzki/azure-sql-mi/api/v1beta1"
+)
+
+var _ = Describe("Storage version migration", func() {
+	It("rewrites the Databases and keeps only v1beta1 as stored version", func() {
+		scheme := runtime.NewScheme()
+		Expect(actionsv1beta1.AddToScheme(scheme)).To(Succeed())
+		Expect(apiextensionsv1.AddToScheme(scheme)).To(Succeed())
+
+		db := newDatabase()
+		db.Namespace = "migration"
+		db.ResourceVersion = "10"
+		crd := &apiextensionsv1.CustomResourceDefinition{
+			ObjectMeta: metav1.ObjectMeta{Name: DatabaseCRDName},
+			Status:     apiextensionsv1.CustomResourceDefinitionStatus{StoredVersions: []string{"v1alpha1", "v1beta1"}},
+		}
+		cl := fakeclient.NewClientBuilder().WithScheme(scheme).WithObjects(db, crd).Build()
+		migrator := &StorageVersionMigrator{Client: cl, Reader: cl, Logger: logr.Discard(), Backoff: DefaultMigrationBackoff}
+		ctx := context.Background()
+
+		Expect(migrator.Migrate(ctx)).To(Succeed())
+		migrated := &actionsv1beta1.Database{}
+		Expect(cl.Get(ctx, types.NamespacedName{Name: db.Name, Namespace: db.Namespace}, migrated)).To(Succeed())
+		Expect(migrated.ResourceVersion).NotTo(Equal("10"))
+		Expect(migrated.Spec).To(Equal(db.Spec))
+
+		Expect(cl.Get(ctx, types.NamespacedName{Name: DatabaseCRDName}, crd)).To(Succeed())
+		Expect(crd.Status.StoredVersions).To(Equal([]string{"v1beta1"}))
+
+		By("doing nothing once migrated")
+		Expect(migrator.Migrate(ctx)).To(Succeed())
+		Expect(cl.Get(ctx, types.NamespacedName{Name: db.Name, Namespace: db.Namespace}, db)).To(Succeed())
+		Expect(db.ResourceVersion).To(Equal(migrated.ResourceVersion))
+	})
+})
@@ -17,6 +17,7 @@ limitations under the License.
 package controllers
 
 import (
+	"context"
 	"path/filepath"
 	"testing"
 
@@ -24,13 +25,16 @@ import (
 	. "github.com/onsi/gomega"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/envtest"
 	"sigs.k8s.io/controller-runtime/pkg/envtest/printer"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
-	actionsv1alpha1 "github.com/pplavetzki/azure-sql-mi/api/v1alpha1"
+	arcdatav1 "github.com/pplavetzki/azure-sql-mi/api/arcdata/v1"
+	actionsv1beta1 "github.com/pplavetzki/azure-sql-mi/api/v1beta1"
+	"github.com/pplavetzki/azure-sql-mi/internal/fake"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -40,6 +44,9 @@ import (
 var cfg *rest.Config
 var k8sClient client.Client
 var testEnv *envtest.Environment
+var sqlServer *fake.Server
+var ctx context.Context
+var cancel context.CancelFunc
 
 func TestAPIs(t *testing.T) {
 	RegisterFailHandler(Fail)
@@ -54,7 +61,10 @@ var _ = BeforeSuite(func() {
 
 	By("bootstrapping test environment")
 	testEnv = &envtest.Environment{
-		CRDDirectoryPaths:     []string{filepath.Join("..", "config", "crd", "bases")},
+		CRDDirectoryPaths: []string{
+			filepath.Join("..", "config", "crd", "bases"),
+			filepath.Join("testdata", "crd"),
+		},
 		ErrorIfCRDPathMissing: true,
 	}
 
@@ -62,10 +72,10 @@ var _ = BeforeSuite(func() {
 	Expect(err).NotTo(HaveOccurred())
 	Expect(cfg).NotTo(BeNil())
 
-	err = actionsv1alpha1.AddToScheme(scheme.Scheme)
+	err = actionsv1beta1.AddToScheme(scheme.Scheme)
 	Expect(err).NotTo(HaveOccurred())
 
-	err = actionsv1alpha1.AddToScheme(scheme.Scheme)
+	err = arcdatav1.AddToScheme(scheme.Scheme)
 	Expect(err).NotTo(HaveOccurred())
 
 	//+kubebuilder:scaffold:scheme
@@ -74,9 +84,85 @@ var _ = BeforeSuite(func() {
 	Expect(err).NotTo(HaveOccurred())
 	Expect(k8sClient).NotTo(BeNil())
 
+	// run the controllers against an in-memory sql server
+	sqlServer = fake.NewServer()
+	ctx, cancel = context.WithCancel(context.TODO())
+
+	mgr, err := ctrl.NewManager(cfg, ctrl.Options{
+		Scheme:             scheme.Scheme,
+		MetricsBindAddress: "0",
+	})
+	Expect(err).NotTo(HaveOccurred())
+
+	err = (&DatabaseReconciler{
+		Client:      mgr.GetClient(),
+		Scheme:      mgr.GetScheme(),
+		Logger:      ctrl.Log.WithName("controllers").WithName("database"),
+		NewProvider: sqlServer.Factory(),
+		Recorder:    NewDedupingRecorder(mgr.GetEventRecorderFor("database-controller"), DefaultEventDedupWindow),
+	}).SetupWithManager(mgr)
+	Expect(err).NotTo(HaveOccurred())
+
+	err = (&LoginReconciler{
+		Client:       mgr.GetClient(),
+		Scheme:       mgr.GetScheme(),
+		Logger:       ctrl.Log.WithName("controllers").WithName("login"),
+		NewProvider:  sqlServer.Factory(),
+		Recorder:     NewDedupingRecorder(mgr.GetEventRecorderFor("login-controller"), DefaultEventDedupWindow),
+		ResyncPeriod: DefaultResyncPeriod,
+	}).SetupWithManager(mgr)
+	Expect(err).NotTo(HaveOccurred())
+
+	err = (&DatabaseUserReconciler{
+		Client:       mgr.GetClient(),
+		Scheme:       mgr.GetScheme(),
+		Logger:       ctrl.Log.WithName("controllers").WithName("databaseuser"),
+		NewProvider:  sqlServer.Factory(),
+		Recorder:     NewDedupingRecorder(mgr.GetEventRecorderFor("databaseuser-controller"), DefaultEventDedupWindow),
+		ResyncPeriod: DefaultResyncPeriod,
+	}).SetupWithManager(mgr)
+	Expect(err).NotTo(HaveOccurred())
+
+	err = (&DatabaseRoleReconciler{
+		Client:       mgr.GetClient(),
+		Scheme:       mgr.GetScheme(),
+		Logger:       ctrl.Log.WithName("controllers").WithName("databaserole"),
+		NewProvider:  sqlServer.Factory(),
+		Recorder:     NewDedupingRecorder(mgr.GetEventRecorderFor("databaserole-controller"), DefaultEventDedupWindow),
+		ResyncPeriod: DefaultResyncPeriod,
+	}).SetupWithManager(mgr)
+	Expect(err).NotTo(HaveOccurred())
+
+	err = (&DatabasePermissionReconciler{
+		Client:       mgr.GetClient(),
+		Scheme:       mgr.GetScheme(),
+		Logger:       ctrl.Log.WithName("controllers").WithName("databasepermission"),
+		NewProvider:  sqlServer.Factory(),
+		Recorder:     NewDedupingRecorder(mgr.GetEventRecorderFor("databasepermission-controller"), DefaultEventDedupWindow),
+		ResyncPeriod: DefaultResyncPeriod,
+	}).SetupWithManager(mgr)
+	Expect(err).NotTo(HaveOccurred())
+
+	err = (&DatabaseSchemaReconciler{
+		Client:       mgr.GetClient(),
+		Scheme:       mgr.GetScheme(),
+		Logger:       ctrl.Log.WithName("controllers").WithName("databaseschema"),
+		NewProvider:  sqlServer.Factory(),
+		Recorder:     NewDedupingRecorder(mgr.GetEventRecorderFor("databaseschema-controller"), DefaultEventDedupWindow),
+		ResyncPeriod: DefaultResyncPeriod,
+	}).SetupWithManager(mgr)
+	Expect(err).NotTo(HaveOccurred())
+
+	go func() {
+		defer GinkgoRecover()
+		err := mgr.Start(ctx)
+		Expect(err).NotTo(HaveOccurred())
+	}()
+
 }, 60)
 
 var _ = AfterSuite(func() {
+	cancel()
 	By("tearing down the test environment")
 	err := testEnv.Stop()
 	Expect(err).NotTo(HaveOccurred())
@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	actionsv1beta1 "github.com/pplavetzki/azure-sql-mi/api/v1beta1"
+)
+
+// SyncServiceAccountName the ServiceAccount, Role and RoleBinding the controller provisions in every namespace
+// with Databases for the sync CronJobs
+const SyncServiceAccountName = "azure-sql-mi-sync"
+
+// syncLabels labels of the objects provisioned for the sync CronJobs
+var syncLabels = map[string]string{
+	"app.kubernetes.io/name":       "azure-sql-mi-sync",
+	"app.kubernetes.io/managed-by": "azure-sql-mi",
+}
+
+//+kubebuilder:rbac:groups=core,resources=serviceaccounts,verbs=get;list;watch;create;update;patch
+//+kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=roles;rolebindings,verbs=get;list;watch;create;update;patch
+
+// syncRoleRules what the sync job may do within its namespace: read the Databases and their DatabasePermissions
+// and record the outcome of the sync in the status of the Databases, the sql server login is handed to the job
+// through secret references so the job cannot read secrets itself
+func syncRoleRules() []rbacv1.PolicyRule {
+	return []rbacv1.PolicyRule{
+		{
+			APIGroups: []string{actionsv1beta1.GroupVersion.Group},
+			Resources: []string{"databases"},
+			Verbs:     []string{"get"},
+		},
+		{
+			APIGroups: []string{actionsv1beta1.GroupVersion.Group},
+			Resources: []string{"databases/status"},
+			Verbs:     []string{"get", "patch"},
+		},
+		{
+			APIGroups: []string{actionsv1beta1.GroupVersion.Group},
+			Resources: []string{"databasepermissions"},
+			Verbs:     []string{"get", "list"},
+		},
+	}
+}
+
+// ensureSyncServiceAccount creates or updates the ServiceAccount of the sync CronJobs in namespace along with the
+// Role and RoleBinding granting it the rules of syncRoleRules
+func (r *DatabaseReconciler) ensureSyncServiceAccount(ctx context.Context, namespace string) error {
+	label := func(obj metav1.Object) {
+		labels := obj.GetLabels()
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		for k, v := range syncLabels {
+			labels[k] = v
+		}
+		obj.SetLabels(labels)
+	}
+
+	sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: SyncServiceAccountName, Namespace: namespace}}
+	if _, err := controllerutil.CreateOrUpdate(ctx, r.Client, sa, func() error {
+		label(sa)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	role := &rbacv1.Role{ObjectMeta: metav1.ObjectMeta{Name: SyncServiceAccountName, Namespace: namespace}}
+	if _, err := controllerutil.CreateOrUpdate(ctx, r.Client, role, func() error {
+		label(role)
+		role.Rules = syncRoleRules()
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	binding := &rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Name: SyncServiceAccountName, Namespace: namespace}}
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, binding, func() error {
+		label(binding)
+		binding.RoleRef = rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: SyncServiceAccountName}
+		binding.Subjects = []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: SyncServiceAccountName, Namespace: namespace}}
+		return nil
+	})
+	return err
+}
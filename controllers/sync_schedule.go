@@ -0,0 +1,115 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	batch "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	actionsv1beta1 "github.com/pplavetzki/azure-sql-mi/api/v1beta1"
+	ms "github.com/pplavetzki/azure-sql-mi/internal"
+	"github.com/pplavetzki/azure-sql-mi/internal/dbsync"
+)
+
+// SyncMode how the scheduled sync of the Databases runs
+type SyncMode string
+
+const (
+	// SyncModeCronJob runs the sync of every Database in a pod of its own CronJob
+	SyncModeCronJob SyncMode = "cronjob"
+	// SyncModeController runs the sync in the controller, the Databases are requeued per their schedule
+	SyncModeController SyncMode = "controller"
+)
+
+// ParseSyncMode parses the sync mode of the manager flag
+func ParseSyncMode(mode string) (SyncMode, error) {
+	switch SyncMode(mode) {
+	case SyncModeCronJob, SyncModeController:
+		return SyncMode(mode), nil
+	}
+	return "", fmt.Errorf("unsupported sync mode %q, expected %s or %s", mode, SyncModeCronJob, SyncModeController)
+}
+
+// syncJitterFactor spreads the scheduled syncs of the Databases sharing a schedule, the requeue is delayed by
+// up to this fraction of the time until the next run
+const syncJitterFactor = 0.1
+
+// syncSchedule the cron schedule of the sync of the Database
+func syncSchedule(db *actionsv1beta1.Database) string {
+	if db.Spec.Sync.Schedule != "" {
+		return db.Spec.Sync.Schedule
+	}
+	return defaultSchedule
+}
+
+// syncDue whether the scheduled sync of the Database is due at now, the schedule runs from the last drift check
+// or from the creation of the Database when it was never checked
+func syncDue(db *actionsv1beta1.Database, schedule *ms.Schedule, now time.Time) bool {
+	last := db.CreationTimestamp.Time
+	if db.Status.LastChecked != nil {
+		last = db.Status.LastChecked.Time
+	}
+	next := schedule.Next(last.UTC())
+	return !next.IsZero() && !now.Before(next)
+}
+
+// nextSync how long until the next scheduled sync after now with some jitter, zero when the schedule never
+// fires again
+func nextSync(schedule *ms.Schedule, now time.Time) time.Duration {
+	next := schedule.Next(now.UTC())
+	if next.IsZero() {
+		return 0
+	}
+	return wait.Jitter(next.Sub(now), syncJitterFactor)
+}
+
+// scheduledSync runs the drift check of the sync job in-process: the database is compared with the spec, the
+// drift policy of the Database is applied and the permissions granted outside of its DatabasePermissions are
+// flagged
+func (r *DatabaseReconciler) scheduledSync(ctx context.Context, db *actionsv1beta1.Database, msSQL ms.Provider) error {
+	if _, err := r.checkDrift(ctx, db, msSQL); err != nil || db.Spec.Sync.DriftPolicy == actionsv1beta1.DriftPolicyIgnore {
+		return err
+	}
+	if err := dbsync.FlagManualPermissions(ctx, r.Client, msSQL, db); err != nil {
+		return err
+	}
+	if manual := db.Status.ManualPermissions; len(manual) > 0 {
+		r.Recorder.Eventf(db, corev1.EventTypeWarning, EventReasonManualPermissions, "Permissions not applied by a DatabasePermission: %s",
+			manualPermissionsSummary(manual))
+	}
+	return nil
+}
+
+// manualPermissionsSummary describes the permissions granted outside of the DatabasePermissions for an event
+func manualPermissionsSummary(manual []actionsv1beta1.ObservedPermission) string {
+	summary := make([]string, len(manual))
+	for i, p := range manual {
+		permission := ms.Permission(p)
+		summary[i] = permission.String()
+	}
+	return strings.Join(summary, "; ")
+}
+
+// deleteSyncJob deletes the sync CronJob of the Database left over from the cronjob sync mode
+func (r *DatabaseReconciler) deleteSyncJob(ctx context.Context, db *actionsv1beta1.Database) error {
+	cronJob := &batch.CronJob{}
+	if err := r.Get(ctx, types.NamespacedName{Name: db.Name, Namespace: db.Namespace}, cronJob); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if !metav1.IsControlledBy(cronJob, db) {
+		return nil
+	}
+	if err := r.Delete(ctx, cronJob, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	r.Recorder.Eventf(db, corev1.EventTypeNormal, EventReasonCronJobDeleted, "Deleted sync CronJob %s, the sync runs in the controller", cronJob.Name)
+	return nil
+}
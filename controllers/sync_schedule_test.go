@@ -0,0 +1,205 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	actionsv1beta1 "github.com/pplavetzki/azure-sql-mi/api/v1beta1"
+	ms "github.com/pplavetzki/azure-sql-mi/internal"
+	"github.com/pplavetzki/azure-sql-mi/internal/fake"
+)
+
+var _ = Describe("Scheduled sync in the controller", func() {
+	var (
+		schedule *ms.Schedule
+		now      time.Time
+	)
+
+	BeforeEach(func() {
+		var err error
+		schedule, err = ms.ParseSchedule("*/30 * * * *")
+		Expect(err).NotTo(HaveOccurred())
+		now = time.Date(2021, 9, 1, 12, 10, 0, 0, time.UTC)
+	})
+
+	It("is due once the schedule fired since the last check", func() {
+		db := newDatabase()
+		db.CreationTimestamp = metav1.NewTime(now.Add(-time.Hour))
+		Expect(syncDue(db, schedule, now)).To(BeTrue())
+
+		db.Status.LastChecked = &metav1.Time{Time: now.Add(-5 * time.Minute)}
+		Expect(syncDue(db, schedule, now)).To(BeFalse())
+		Expect(syncDue(db, schedule, now.Add(20*time.Minute))).To(BeTrue())
+	})
+
+	It("requeues at the next run with some jitter", func() {
+		next := nextSync(schedule, now)
+		Expect(next).To(BeNumerically(">=", 20*time.Minute))
+		Expect(next).To(BeNumerically("<=", 22*time.Minute))
+	})
+
+	It("applies the drift policy of the Database", func() {
+		server := fake.NewServer()
+		provider := server.Factory()("server", "sa", "P@ssw0rd", 1433)
+		r := &DatabaseReconciler{Client: newFakeClient(), Recorder: record.NewFakeRecorder(10)}
+		db := newDatabase()
+		db.Spec.Options = actionsv1beta1.DatabaseOptions{
+			Collation:          fake.DefaultCollation,
+			CompatibilityLevel: fake.DefaultCompatibilityLevel,
+			Parameterization:   fake.DefaultParameterization,
+		}
+		db.Status.DatabaseID = server.AddDatabase(db.Spec.Name)
+		Expect(server.UpdateDatabase(db.Spec.Name, func(d *fake.Database) { d.AllowSnapshotIsolation = true })).To(Succeed())
+
+		db.Spec.Sync.DriftPolicy = actionsv1beta1.DriftPolicyReport
+		Expect(r.scheduledSync(context.Background(), db, provider)).To(Succeed())
+		Expect(db.Status.LastChecked).NotTo(BeNil())
+		Expect(db.Status.Drift).To(HaveLen(1))
+		d, _ := server.Database(db.Spec.Name)
+		Expect(d.AllowSnapshotIsolation).To(BeTrue())
+
+		db.Spec.Sync.DriftPolicy = actionsv1beta1.DriftPolicyRemediate
+		Expect(r.scheduledSync(context.Background(), db, provider)).To(Succeed())
+		Expect(db.Status.Drift).To(BeEmpty())
+		d, _ = server.Database(db.Spec.Name)
+		Expect(d.AllowSnapshotIsolation).To(BeFalse())
+	})
+
+	// newUnchangedReconciler a reconciler with the sync of the controller and a client holding the Database as if it
+	// did not change since it was last checked at lastChecked
+	newUnchangedReconciler := func(server *fake.Server, db *actionsv1beta1.Database, lastChecked time.Time) *DatabaseReconciler {
+		db.Generation = 2
+		db.Status.ObservedGeneration = 2
+		db.Status.LastChecked = &metav1.Time{Time: lastChecked}
+		return &DatabaseReconciler{Client: newFakeClient(db), Logger: logr.Discard(), NewProvider: server.Factory(), Recorder: record.NewFakeRecorder(10),
+			SyncMode: SyncModeController}
+	}
+
+	// reconcile reconciles the Database and returns it as written
+	reconcile := func(r *DatabaseReconciler, db *actionsv1beta1.Database) *actionsv1beta1.Database {
+		_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: objectKey(db)})
+		Expect(err).NotTo(HaveOccurred())
+		reconciled := &actionsv1beta1.Database{}
+		Expect(r.Get(context.Background(), objectKey(db), reconciled)).To(Succeed())
+		return reconciled
+	}
+
+	It("leaves a drifted Database that did not change to its drift policy", func() {
+		server := fake.NewServer()
+		db := newDatabase()
+		db.Spec.Options = actionsv1beta1.DatabaseOptions{
+			Collation:          fake.DefaultCollation,
+			CompatibilityLevel: fake.DefaultCompatibilityLevel,
+			Parameterization:   fake.DefaultParameterization,
+		}
+		db.Spec.Sync.DriftPolicy = actionsv1beta1.DriftPolicyReport
+		db.Status.DatabaseID = server.AddDatabase(db.Spec.Name)
+		Expect(server.UpdateDatabase(db.Spec.Name, func(d *fake.Database) { d.AllowSnapshotIsolation = true })).To(Succeed())
+
+		reconciled := reconcile(newUnchangedReconciler(server, db, time.Now().Add(-13*time.Hour)), db)
+
+		d, _ := server.Database(db.Spec.Name)
+		Expect(d.AllowSnapshotIsolation).To(BeTrue())
+		Expect(reconciled.IsConditionTrue(actionsv1beta1.DatabaseConditionDrifted)).To(BeTrue())
+	})
+
+	It("leaves a Database that did not change alone until its scheduled sync is due", func() {
+		server := fake.NewServer()
+		db := newDatabase()
+		db.Spec.Sync.Schedule = "0 0 1 1 *"
+		db.Spec.Sync.DriftPolicy = actionsv1beta1.DriftPolicyRemediate
+		db.Status.DatabaseID = server.AddDatabase(db.Spec.Name)
+		db.MarkSynced(actionsv1beta1.DatabaseReasonSynced, "Database was compared with the spec by the scheduled sync")
+		Expect(server.UpdateDatabase(db.Spec.Name, func(d *fake.Database) { d.AllowSnapshotIsolation = true })).To(Succeed())
+		r := newUnchangedReconciler(server, db, time.Now())
+		reconciled := reconcile(r, db)
+
+		result, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: objectKey(db)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeNumerically(">", time.Hour))
+		again := &actionsv1beta1.Database{}
+		Expect(r.Get(context.Background(), objectKey(db), again)).To(Succeed())
+		Expect(again.ResourceVersion).To(Equal(reconciled.ResourceVersion))
+		Expect(again.Status.LastChecked.Time).To(BeTemporally("~", db.Status.LastChecked.Time, time.Second))
+		d, _ := server.Database(db.Spec.Name)
+		Expect(d.AllowSnapshotIsolation).To(BeTrue())
+	})
+
+	It("doesn't write the status of a Database it did not check", func() {
+		server := fake.NewServer()
+		db := newDatabase()
+		db.Spec.Sync.DriftPolicy = actionsv1beta1.DriftPolicyIgnore
+		db.Status.DatabaseID = server.AddDatabase(db.Spec.Name)
+		r := newUnchangedReconciler(server, db, time.Now())
+		reconciled := reconcile(r, db)
+		Expect(reconciled.Status.LastSyncTime).To(BeNil())
+
+		again := reconcile(r, db)
+		Expect(again.ResourceVersion).To(Equal(reconciled.ResourceVersion))
+	})
+
+	It("keeps the sync times of a Database that did not change within the resync period", func() {
+		server := fake.NewServer()
+		db := newDatabase()
+		db.Spec.Options = actionsv1beta1.DatabaseOptions{
+			Collation:          fake.DefaultCollation,
+			CompatibilityLevel: fake.DefaultCompatibilityLevel,
+			Parameterization:   fake.DefaultParameterization,
+		}
+		db.Spec.Sync.DriftPolicy = actionsv1beta1.DriftPolicyReport
+		db.Status.DatabaseID = server.AddDatabase(db.Spec.Name)
+		r := newUnchangedReconciler(server, db, time.Now())
+		r.Client = serverSideApply{Client: r.Client}
+		r.Scheme = r.Client.Scheme()
+		r.SyncMode = SyncModeCronJob
+		r.ResyncPeriod = time.Hour
+		reconciled := reconcile(r, db)
+		Expect(reconciled.Status.LastSyncTime).NotTo(BeNil())
+
+		again := reconcile(r, db)
+		Expect(again.ResourceVersion).To(Equal(reconciled.ResourceVersion))
+		Expect(again.Status.LastChecked.Time).To(BeTemporally("~", db.Status.LastChecked.Time, time.Second))
+	})
+
+	It("flags the permissions granted outside of the DatabasePermissions of the Database", func() {
+		server := fake.NewServer()
+		provider := server.Factory()("server", "sa", "P@ssw0rd", 1433)
+		recorder := record.NewFakeRecorder(10)
+		db := newDatabase()
+		db.Spec.Options = actionsv1beta1.DatabaseOptions{
+			Collation:          fake.DefaultCollation,
+			CompatibilityLevel: fake.DefaultCompatibilityLevel,
+			Parameterization:   fake.DefaultParameterization,
+		}
+		db.Spec.Sync.DriftPolicy = actionsv1beta1.DriftPolicyReport
+		db.Status.DatabaseID = server.AddDatabase(db.Spec.Name)
+		_, err := server.AddUser(db.Spec.Name, "app")
+		Expect(err).NotTo(HaveOccurred())
+		applied := ms.Permission{Principal: "app", Class: ms.PermissionClassSchema, Schema: "sales", Permission: "SELECT", State: ms.PermissionStateGrant}
+		manual := ms.Permission{Principal: "app", Class: ms.PermissionClassDatabase, Permission: "ALTER", State: ms.PermissionStateGrant}
+		Expect(server.Grant(db.Spec.Name, applied)).To(Succeed())
+		Expect(server.Grant(db.Spec.Name, manual)).To(Succeed())
+		permission := &actionsv1beta1.DatabasePermission{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: db.Namespace},
+			Spec: actionsv1beta1.DatabasePermissionSpec{
+				DatabaseRef: corev1.LocalObjectReference{Name: db.Name},
+				Principal:   "app",
+			},
+			Status: actionsv1beta1.DatabasePermissionStatus{Applied: []actionsv1beta1.ObservedPermission{actionsv1beta1.ObservedPermission(applied)}},
+		}
+		r := &DatabaseReconciler{Client: newFakeClient(permission), Recorder: recorder}
+
+		Expect(r.scheduledSync(context.Background(), db, provider)).To(Succeed())
+		Expect(db.Status.ManualPermissions).To(Equal([]actionsv1beta1.ObservedPermission{actionsv1beta1.ObservedPermission(manual)}))
+		Expect(<-recorder.Events).To(Equal(corev1.EventTypeWarning + " " + EventReasonManualPermissions +
+			" Permissions not applied by a DatabasePermission: GRANT ALTER TO app"))
+	})
+})
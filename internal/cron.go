@@ -0,0 +1,11 @@
+package internal
+
+import "github.com/pplavetzki/azure-sql-mi/internal/validation"
+
+// Schedule a parsed standard cron schedule of the sync of a Database
+type Schedule = validation.Schedule
+
+// ParseSchedule parses a standard cron schedule
+func ParseSchedule(spec string) (*Schedule, error) {
+	return validation.ParseSchedule(spec)
+}
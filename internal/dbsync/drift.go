@@ -0,0 +1,105 @@
+// Package dbsync compares a Database with its database on the server and records the outcome in its status, it is
+// shared by the Database controller and the sync job
+package dbsync
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	actionsv1beta1 "github.com/pplavetzki/azure-sql-mi/api/v1beta1"
+	ms "github.com/pplavetzki/azure-sql-mi/internal"
+)
+
+// DatabaseConfig the desired settings of the Database as compared with sys.databases
+func DatabaseConfig(db *actionsv1beta1.Database) *ms.DatabaseConfig {
+	return &ms.DatabaseConfig{
+		DatabaseName:               db.Spec.Name,
+		DatabaseID:                 db.Status.DatabaseID,
+		CompatibilityLevel:         db.Spec.Options.CompatibilityLevel,
+		Collation:                  db.Spec.Options.Collation,
+		Parameterization:           db.Spec.Options.Parameterization,
+		AllowSnapshotIsolation:     db.Spec.Options.AllowSnapshotIsolation,
+		AllowReadCommittedSnapshot: db.Spec.Options.AllowReadCommittedSnapshot,
+	}
+}
+
+// ApplyDriftPolicy records the diff in the status of db, when the drift policy is Remediate the database is
+// altered back to the spec first and only the drift that could not be remediated is recorded
+func ApplyDriftPolicy(ctx context.Context, msSQL ms.Provider, db *actionsv1beta1.Database, diff *ms.DatabaseDiff) error {
+	return ReconcileDrift(ctx, msSQL, db, diff, db.Spec.Sync.DriftPolicy == actionsv1beta1.DriftPolicyRemediate)
+}
+
+// ReconcileDrift records the diff in the status of db and sets the Drifted condition, when remediate is set
+// the database is altered back to the spec first
+func ReconcileDrift(ctx context.Context, msSQL ms.Provider, db *actionsv1beta1.Database, diff *ms.DatabaseDiff, remediate bool) error {
+	now := metav1.Now()
+	db.Status.LastChecked = &now
+	db.Status.Drift = nil
+	defer db.MarkDrift()
+	if diff == nil || !diff.HasDrift() {
+		return nil
+	}
+	db.Status.LastDrift = &now
+	db.Status.Drift = driftFields(diff, false)
+
+	if !remediate {
+		return nil
+	}
+	remediation := diff.Remediation()
+	if remediation == nil {
+		return nil
+	}
+	if err := msSQL.AlterDatabase(ctx, db.Spec.Name, remediation); err != nil {
+		return err
+	}
+	db.Status.Drift = driftFields(diff, true)
+	return nil
+}
+
+// driftFields the drifted options of the diff, when remediated the options altered back are left out
+func driftFields(diff *ms.DatabaseDiff, remediated bool) []actionsv1beta1.DriftField {
+	var fields []actionsv1beta1.DriftField
+	for _, f := range diff.Drifted() {
+		if remediated && f.Remediable {
+			continue
+		}
+		fields = append(fields, actionsv1beta1.DriftField{
+			Field:      f.Field,
+			Desired:    f.Desired,
+			Observed:   f.Observed,
+			Remediable: f.Remediable,
+		})
+	}
+	return fields
+}
+
+// FlagManualPermissions records in the status of db the permissions of its database that were not applied by one
+// of the DatabasePermissions of the Database, such as a GRANT run by hand. The database is only checked when the
+// Database has DatabasePermissions, otherwise its permissions are not managed at all
+func FlagManualPermissions(ctx context.Context, reader client.Reader, msSQL ms.Provider, db *actionsv1beta1.Database) error {
+	permissions := &actionsv1beta1.DatabasePermissionList{}
+	if err := reader.List(ctx, permissions, client.InNamespace(db.Namespace)); err != nil {
+		return err
+	}
+	managed := false
+	var applied []ms.Permission
+	for i := range permissions.Items {
+		if permissions.Items[i].Spec.DatabaseRef.Name != db.Name {
+			continue
+		}
+		managed = true
+		applied = append(applied, AppliedPermissions(&permissions.Items[i])...)
+	}
+	db.Status.ManualPermissions = nil
+	if !managed {
+		return nil
+	}
+	observed, err := msSQL.Permissions(ctx, db.Spec.Name, "")
+	if err != nil {
+		return err
+	}
+	db.Status.ManualPermissions = ObservedPermissions(ms.ManualPermissions(observed, applied))
+	return nil
+}
@@ -0,0 +1,61 @@
+package dbsync
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	actionsv1beta1 "github.com/pplavetzki/azure-sql-mi/api/v1beta1"
+	"github.com/pplavetzki/azure-sql-mi/internal/fake"
+)
+
+func TestApplyDriftPolicy(t *testing.T) {
+	tests := []struct {
+		policy     actionsv1beta1.DriftPolicy
+		remediated bool
+	}{
+		{actionsv1beta1.DriftPolicyReport, false},
+		{actionsv1beta1.DriftPolicyRemediate, true},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			ctx := context.Background()
+			server := fake.NewServer()
+			msSQL := server.Factory()("server", "sa", "P@ssw0rd", 1433)
+			db := &actionsv1beta1.Database{ObjectMeta: metav1.ObjectMeta{Name: "app", Generation: 1}}
+			db.Spec.Name = "App"
+			db.Spec.Options = actionsv1beta1.DatabaseOptions{
+				Collation:          fake.DefaultCollation,
+				CompatibilityLevel: fake.DefaultCompatibilityLevel,
+				Parameterization:   fake.DefaultParameterization,
+			}
+			db.Spec.Sync.DriftPolicy = tt.policy
+			db.Status.DatabaseID = server.AddDatabase("App")
+			if err := server.UpdateDatabase("App", func(d *fake.Database) { d.AllowSnapshotIsolation = true }); err != nil {
+				t.Fatal(err)
+			}
+
+			diff, err := msSQL.SyncNeeded(ctx, DatabaseConfig(db))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = ApplyDriftPolicy(ctx, msSQL, db, diff); err != nil {
+				t.Fatal(err)
+			}
+			if err = ObserveDatabase(ctx, msSQL, db); err != nil {
+				t.Fatal(err)
+			}
+
+			if db.Status.LastChecked == nil || db.Status.LastDrift == nil || db.Status.Observed == nil {
+				t.Errorf("expected the check, the drift and the read to be recorded: %+v", db.Status)
+			}
+			if remediated := len(db.Status.Drift) == 0; remediated != tt.remediated {
+				t.Errorf("expected remediated to be %v, drift is %+v", tt.remediated, db.Status.Drift)
+			}
+			if db.Status.Observed.AllowSnapshotIsolation == tt.remediated {
+				t.Errorf("expected the observed snapshot isolation to follow the policy: %+v", db.Status.Observed)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package dbsync
+
+import (
+	actionsv1beta1 "github.com/pplavetzki/azure-sql-mi/api/v1beta1"
+	ms "github.com/pplavetzki/azure-sql-mi/internal"
+)
+
+// AppliedPermissions the rows of sys.database_permissions the controller applied for the DatabasePermission
+func AppliedPermissions(permission *actionsv1beta1.DatabasePermission) []ms.Permission {
+	applied := make([]ms.Permission, len(permission.Status.Applied))
+	for i, p := range permission.Status.Applied {
+		applied[i] = ms.Permission(p)
+	}
+	return applied
+}
+
+// ObservedPermissions maps rows of sys.database_permissions to the status
+func ObservedPermissions(permissions []ms.Permission) []actionsv1beta1.ObservedPermission {
+	var observed []actionsv1beta1.ObservedPermission
+	for _, p := range permissions {
+		observed = append(observed, actionsv1beta1.ObservedPermission(p))
+	}
+	return observed
+}
@@ -0,0 +1,47 @@
+package dbsync
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	actionsv1beta1 "github.com/pplavetzki/azure-sql-mi/api/v1beta1"
+	ms "github.com/pplavetzki/azure-sql-mi/internal"
+)
+
+// ObserveDatabase reads the database from the server into the observed status of db, the caller records the
+// LastSyncTime of the read
+func ObserveDatabase(ctx context.Context, msSQL ms.Provider, db *actionsv1beta1.Database) error {
+	state, err := msSQL.DatabaseState(ctx, db.Spec.Name)
+	if err != nil {
+		return err
+	}
+	db.Status.Observed = observedDatabase(state)
+	return nil
+}
+
+// observedDatabase maps the row of sys.databases to the status, nil when the database doesn't exist
+func observedDatabase(state *ms.DatabaseState) *actionsv1beta1.ObservedDatabase {
+	if state == nil {
+		return nil
+	}
+	observed := &actionsv1beta1.ObservedDatabase{
+		State:                      state.StateDesc,
+		CompatibilityLevel:         state.CompatibilityLevel,
+		Collation:                  state.Collation,
+		AllowSnapshotIsolation:     state.AllowSnapshotIsolation == "true",
+		AllowReadCommittedSnapshot: state.AllowReadCommittedSnapshot == "true",
+		Parameterization:           state.Parameterization,
+		RecoveryModel:              state.RecoveryModel,
+		DataSize:                   resource.NewQuantity(state.DataSizeBytes, resource.BinarySI),
+		LogSize:                    resource.NewQuantity(state.LogSizeBytes, resource.BinarySI),
+	}
+	if created, err := state.Created(); err == nil {
+		// the status keeps seconds, the milliseconds of create_date would make every read look like a change
+		createDate := metav1.NewTime(created.Truncate(time.Second))
+		observed.CreateDate = &createDate
+	}
+	return observed
+}
@@ -0,0 +1,170 @@
+package internal
+
+import (
+	"strconv"
+	"strings"
+)
+
+// names of the database options compared by Diff, they match the json names of the DatabaseSpec fields
+const (
+	OptionCollation                  = "collation"
+	OptionCompatibilityLevel         = "compatibilityLevel"
+	OptionAllowSnapshotIsolation     = "allowSnapshotIsolation"
+	OptionAllowReadCommittedSnapshot = "allowReadCommittedSnapshot"
+	OptionParameterization           = "parameterization"
+)
+
+// FieldDiff the comparison of a single database option
+type FieldDiff struct {
+	// Field name of the option
+	Field string `json:"field"`
+	// Desired value of the spec, empty when the option is not specified and therefore not compared
+	Desired string `json:"desired,omitempty"`
+	// Observed value of sys.databases
+	Observed string `json:"observed"`
+	// Drifted whether the observed value differs from the desired value
+	Drifted bool `json:"drifted"`
+	// Remediable whether ALTER DATABASE can converge the option
+	Remediable bool `json:"remediable"`
+}
+
+// DatabaseDiff the comparison of every supported option of a database
+type DatabaseDiff struct {
+	Fields []FieldDiff `json:"fields"`
+
+	remediation *DatabaseParams
+}
+
+// Drifted the options whose observed value differs from the desired value
+func (d *DatabaseDiff) Drifted() []FieldDiff {
+	drifted := []FieldDiff{}
+	for _, f := range d.Fields {
+		if f.Drifted {
+			drifted = append(drifted, f)
+		}
+	}
+	return drifted
+}
+
+// HasDrift whether any option drifted
+func (d *DatabaseDiff) HasDrift() bool {
+	return len(d.Drifted()) > 0
+}
+
+// Remediation the desired values of every drifted remediable option ready to be handed to AlterDatabase,
+// nil when there is nothing to remediate
+func (d *DatabaseDiff) Remediation() *DatabaseParams {
+	return d.remediation
+}
+
+// databaseOption how a single option is compared and remediated
+type databaseOption struct {
+	field      string
+	remediable bool
+	// desired the value of the spec, empty when not specified
+	desired  func(*DatabaseConfig) string
+	observed func(*DatabaseState) string
+	equal    func(desired, observed string) bool
+	// remediate sets the desired value of the option on the params of an ALTER DATABASE
+	remediate func(*DatabaseParams, *DatabaseConfig)
+}
+
+// databaseOptions every option of the DatabaseSpec that is compared with sys.databases
+var databaseOptions = []databaseOption{
+	{
+		// changing the collation needs exclusive access to the database and fails as soon as schema-bound
+		// objects depend on it, the drift is reported but never remediated
+		field:    OptionCollation,
+		desired:  func(c *DatabaseConfig) string { return c.Collation },
+		observed: func(s *DatabaseState) string { return s.Collation },
+		equal:    strings.EqualFold,
+	},
+	{
+		field:      OptionCompatibilityLevel,
+		remediable: true,
+		desired: func(c *DatabaseConfig) string {
+			if c.CompatibilityLevel == 0 {
+				return ""
+			}
+			return strconv.Itoa(c.CompatibilityLevel)
+		},
+		observed: func(s *DatabaseState) string { return strconv.Itoa(s.CompatibilityLevel) },
+		equal:    func(desired, observed string) bool { return desired == observed },
+		remediate: func(p *DatabaseParams, c *DatabaseConfig) {
+			level := c.CompatibilityLevel
+			p.CompatibilityLevel = &level
+		},
+	},
+	{
+		field:      OptionAllowSnapshotIsolation,
+		remediable: true,
+		desired:    func(c *DatabaseConfig) string { return strconv.FormatBool(c.AllowSnapshotIsolation) },
+		observed:   func(s *DatabaseState) string { return s.AllowSnapshotIsolation },
+		equal:      boolEqual,
+		remediate: func(p *DatabaseParams, c *DatabaseConfig) {
+			allow := c.AllowSnapshotIsolation
+			p.AllowSnapshotIsolation = &allow
+		},
+	},
+	{
+		field:      OptionAllowReadCommittedSnapshot,
+		remediable: true,
+		desired:    func(c *DatabaseConfig) string { return strconv.FormatBool(c.AllowReadCommittedSnapshot) },
+		observed:   func(s *DatabaseState) string { return s.AllowReadCommittedSnapshot },
+		equal:      boolEqual,
+		remediate: func(p *DatabaseParams, c *DatabaseConfig) {
+			allow := c.AllowReadCommittedSnapshot
+			p.AllowReadCommittedSnapshot = &allow
+		},
+	},
+	{
+		field:      OptionParameterization,
+		remediable: true,
+		desired:    func(c *DatabaseConfig) string { return strings.ToLower(c.Parameterization) },
+		observed:   func(s *DatabaseState) string { return s.Parameterization },
+		equal:      strings.EqualFold,
+		remediate: func(p *DatabaseParams, c *DatabaseConfig) {
+			parameterization := c.Parameterization
+			p.Parameterization = &parameterization
+		},
+	},
+}
+
+// Diff compares every supported option of the desired config with the observed state of the database,
+// options that are not specified are reported with an empty desired value and never drift
+func Diff(config *DatabaseConfig, state *DatabaseState) *DatabaseDiff {
+	diff := &DatabaseDiff{Fields: make([]FieldDiff, 0, len(databaseOptions))}
+	params := &DatabaseParams{}
+	remediate := false
+
+	for _, option := range databaseOptions {
+		f := FieldDiff{
+			Field:      option.field,
+			Desired:    option.desired(config),
+			Observed:   option.observed(state),
+			Remediable: option.remediable,
+		}
+		f.Drifted = f.Desired != "" && !option.equal(f.Desired, f.Observed)
+		if f.Drifted && f.Remediable {
+			option.remediate(params, config)
+			remediate = true
+		}
+		diff.Fields = append(diff.Fields, f)
+	}
+	if remediate {
+		diff.remediation = params
+	}
+	return diff
+}
+
+func boolEqual(desired, observed string) bool {
+	d, err := strconv.ParseBool(desired)
+	if err != nil {
+		return false
+	}
+	o, err := strconv.ParseBool(observed)
+	if err != nil {
+		return false
+	}
+	return d == o
+}
@@ -0,0 +1,118 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func observedState() *DatabaseState {
+	return &DatabaseState{
+		Name:                       "MyDatabase",
+		CompatibilityLevel:         150,
+		Collation:                  "SQL_Latin1_General_CP1_CI_AS",
+		AllowSnapshotIsolation:     "false",
+		AllowReadCommittedSnapshot: "false",
+		Parameterization:           "simple",
+	}
+}
+
+func TestDiffInSync(t *testing.T) {
+	diff := Diff(&DatabaseConfig{
+		DatabaseName:       "MyDatabase",
+		CompatibilityLevel: 150,
+		Collation:          "sql_latin1_general_cp1_ci_as",
+		Parameterization:   "SIMPLE",
+	}, observedState())
+
+	if diff.HasDrift() {
+		t.Errorf("expected no drift, got %+v", diff.Drifted())
+	}
+	if diff.Remediation() != nil {
+		t.Errorf("expected nothing to remediate, got %+v", diff.Remediation())
+	}
+	if len(diff.Fields) != len(databaseOptions) {
+		t.Errorf("expected a result for every option, got %+v", diff.Fields)
+	}
+}
+
+func TestDiffUnspecifiedOptions(t *testing.T) {
+	diff := Diff(&DatabaseConfig{DatabaseName: "MyDatabase"}, observedState())
+	if diff.HasDrift() {
+		t.Errorf("expected unspecified options not to drift, got %+v", diff.Drifted())
+	}
+	for _, f := range diff.Fields {
+		if f.Observed == "" {
+			t.Errorf("expected the observed value of %s", f.Field)
+		}
+	}
+}
+
+func TestDiffDrift(t *testing.T) {
+	diff := Diff(&DatabaseConfig{
+		DatabaseName:               "MyDatabase",
+		CompatibilityLevel:         160,
+		Collation:                  "Latin1_General_100_CI_AS",
+		AllowSnapshotIsolation:     true,
+		AllowReadCommittedSnapshot: true,
+		Parameterization:           "forced",
+	}, observedState())
+
+	expected := map[string]FieldDiff{
+		OptionCollation:                  {Field: OptionCollation, Desired: "Latin1_General_100_CI_AS", Observed: "SQL_Latin1_General_CP1_CI_AS", Drifted: true},
+		OptionCompatibilityLevel:         {Field: OptionCompatibilityLevel, Desired: "160", Observed: "150", Drifted: true, Remediable: true},
+		OptionAllowSnapshotIsolation:     {Field: OptionAllowSnapshotIsolation, Desired: "true", Observed: "false", Drifted: true, Remediable: true},
+		OptionAllowReadCommittedSnapshot: {Field: OptionAllowReadCommittedSnapshot, Desired: "true", Observed: "false", Drifted: true, Remediable: true},
+		OptionParameterization:           {Field: OptionParameterization, Desired: "forced", Observed: "simple", Drifted: true, Remediable: true},
+	}
+	drifted := diff.Drifted()
+	if len(drifted) != len(expected) {
+		t.Fatalf("expected %d drifted options, got %+v", len(expected), drifted)
+	}
+	for _, f := range drifted {
+		if f != expected[f.Field] {
+			t.Errorf("%s = %+v, expected %+v", f.Field, f, expected[f.Field])
+		}
+	}
+
+	remediation := diff.Remediation()
+	if remediation == nil {
+		t.Fatal("expected a remediation")
+	}
+	if remediation.Collation != nil {
+		t.Error("expected the collation not to be remediated")
+	}
+	if SafeInt(remediation.CompatibilityLevel) != 160 || !SafeBool(remediation.AllowSnapshotIsolation) ||
+		!SafeBool(remediation.AllowReadCommittedSnapshot) || SafeString(remediation.Parameterization) != "forced" {
+		t.Errorf("unexpected remediation: %+v", remediation)
+	}
+	stmts, err := AlterDatabaseStatements("MyDatabase", remediation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stmts) != 4 {
+		t.Errorf("expected an ALTER for every remediable option, got %v", stmts)
+	}
+}
+
+func TestDiffOnlyCollationDrifted(t *testing.T) {
+	diff := Diff(&DatabaseConfig{DatabaseName: "MyDatabase", Collation: "Latin1_General_100_CI_AS"}, observedState())
+	if !diff.HasDrift() {
+		t.Fatal("expected the collation to drift")
+	}
+	if diff.Remediation() != nil {
+		t.Errorf("expected nothing to remediate, got %+v", diff.Remediation())
+	}
+}
+
+func TestDatabaseStateCreated(t *testing.T) {
+	for _, createDate := range []string{"2021-10-16T12:30:45.123", "2021-10-16T12:30:45"} {
+		state := &DatabaseState{CreateDate: createDate}
+		created, err := state.Created()
+		if err != nil {
+			t.Fatalf("Created(%q) returned error: %v", createDate, err)
+		}
+		if created.Location() != time.UTC || created.Hour() != 12 || created.Second() != 45 {
+			t.Errorf("Created(%q) = %v", createDate, created)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package fake
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"strings"
+	"time"
+
+	ms "github.com/pplavetzki/azure-sql-mi/internal"
+)
+
+const (
+	DefaultLoginDatabase = "master"
+	DefaultLoginLanguage = "us_english"
+	// firstPrincipalID principal_id of the first login created on the server, the lower ids are taken by the
+	// fixed server roles and the system logins
+	firstPrincipalID = 256
+)
+
+// Login a row of sys.sql_logins, the password is kept in the clear in place of password_hash
+type Login struct {
+	// PrincipalID sys.sql_logins.principal_id
+	PrincipalID int
+	Name        string
+	// SID sys.sql_logins.sid formatted like CONVERT(varchar, sid, 1)
+	SID             string
+	Password        string
+	DefaultDatabase string
+	DefaultLanguage string
+	CheckPolicy     bool
+	CheckExpiration bool
+	IsDisabled      bool
+	CreateDate      time.Time
+}
+
+// Login a copy of the login with the name
+func (s *Server) Login(name string) (Login, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.logins[name]
+	if !ok {
+		return Login{}, false
+	}
+	return *l, true
+}
+
+// AddLogin creates a login outside of the controllers, returning its sid
+func (s *Server) AddLogin(name, password string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.createLogin(name, password, nil).SID
+}
+
+// UpdateLogin changes the login outside of the controllers to simulate drift
+func (s *Server) UpdateLogin(name string, update func(*Login)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.logins[name]
+	if !ok {
+		return fmt.Errorf("cannot alter the login '%s', because it does not exist or you do not have permission", name)
+	}
+	id, sid := l.PrincipalID, l.SID
+	update(l)
+	l.PrincipalID, l.SID, l.Name = id, sid, name
+	return nil
+}
+
+func (s *Server) createLogin(name, password string, params *ms.LoginParams) *Login {
+	l := &Login{
+		PrincipalID:     s.nextPrincipalID,
+		Name:            name,
+		SID:             newSID(),
+		Password:        password,
+		DefaultDatabase: DefaultLoginDatabase,
+		DefaultLanguage: DefaultLoginLanguage,
+		CheckPolicy:     true,
+		CreateDate:      time.Now().UTC(),
+	}
+	alterLogin(l, params)
+	s.nextPrincipalID++
+	s.logins[name] = l
+	return l
+}
+
+// CreateLogin implements ms.Provider
+func (p *Provider) CreateLogin(ctx context.Context, loginName, password string, params *ms.LoginParams) error {
+	if _, err := ms.CreateLoginStatement(loginName, password, params); err != nil {
+		return err
+	}
+	s := p.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("CreateLogin"); err != nil {
+		return err
+	}
+	if _, ok := s.logins[loginName]; ok {
+		return fmt.Errorf("the server principal '%s' already exists", loginName)
+	}
+	if params != nil && params.DefaultDatabase != nil {
+		if _, ok := s.databases[*params.DefaultDatabase]; !ok {
+			return fmt.Errorf("cannot open database '%s' that was specified as the default database", *params.DefaultDatabase)
+		}
+	}
+	s.createLogin(loginName, password, params)
+	return nil
+}
+
+// AlterLogin implements ms.Provider
+func (p *Provider) AlterLogin(ctx context.Context, loginName string, params *ms.LoginParams) error {
+	if _, err := ms.AlterLoginStatements(loginName, params); err != nil {
+		return err
+	}
+	s := p.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("AlterLogin"); err != nil {
+		return err
+	}
+	l, ok := s.logins[loginName]
+	if !ok {
+		return fmt.Errorf("cannot alter the login '%s', because it does not exist or you do not have permission", loginName)
+	}
+	alterLogin(l, params)
+	return nil
+}
+
+// AlterLoginPassword implements ms.Provider
+func (p *Provider) AlterLoginPassword(ctx context.Context, loginName, password string) error {
+	if _, err := ms.AlterLoginPasswordStatement(loginName, password); err != nil {
+		return err
+	}
+	s := p.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("AlterLoginPassword"); err != nil {
+		return err
+	}
+	l, ok := s.logins[loginName]
+	if !ok {
+		return fmt.Errorf("cannot alter the login '%s', because it does not exist or you do not have permission", loginName)
+	}
+	l.Password = password
+	return nil
+}
+
+// LoginState implements ms.Provider
+func (p *Provider) LoginState(ctx context.Context, loginName, password string) (*ms.LoginState, error) {
+	s := p.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("LoginState"); err != nil {
+		return nil, err
+	}
+	l, ok := s.logins[loginName]
+	if !ok {
+		return nil, nil
+	}
+	return &ms.LoginState{
+		Name:            l.Name,
+		PrincipalID:     l.PrincipalID,
+		SID:             l.SID,
+		DefaultDatabase: l.DefaultDatabase,
+		DefaultLanguage: l.DefaultLanguage,
+		CheckPolicy:     l.CheckPolicy,
+		CheckExpiration: l.CheckExpiration,
+		IsDisabled:      l.IsDisabled,
+		CreateDate:      l.CreateDate.Format("2006-01-02T15:04:05.000"),
+		PasswordMatches: l.Password == password,
+	}, nil
+}
+
+// DeleteLogin implements ms.Provider
+func (p *Provider) DeleteLogin(ctx context.Context, loginName string) error {
+	if _, err := ms.DropLoginStatement(loginName); err != nil {
+		return err
+	}
+	s := p.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("DeleteLogin"); err != nil {
+		return err
+	}
+	delete(s.logins, loginName)
+	return nil
+}
+
+func alterLogin(l *Login, params *ms.LoginParams) {
+	if params == nil {
+		return
+	}
+	if params.DefaultDatabase != nil {
+		l.DefaultDatabase = *params.DefaultDatabase
+	}
+	if params.DefaultLanguage != nil {
+		l.DefaultLanguage = *params.DefaultLanguage
+	}
+	if params.CheckPolicy != nil {
+		l.CheckPolicy = *params.CheckPolicy
+	}
+	if params.CheckExpiration != nil {
+		l.CheckExpiration = *params.CheckExpiration
+	}
+}
+
+// newSID a random sid of a sql login formatted like CONVERT(varchar, sid, 1)
+func newSID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return "0x" + strings.ToUpper(fmt.Sprintf("%x", b))
+}
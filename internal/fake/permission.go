@@ -0,0 +1,112 @@
+package fake
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	ms "github.com/pplavetzki/azure-sql-mi/internal"
+)
+
+// Permissions the sorted permissions of the principal in the database, those of every principal when principalName
+// is empty
+func (s *Server) Permissions(databaseName, principalName string) []ms.Permission {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.databases[databaseName]
+	if !ok {
+		return nil
+	}
+	return d.permissionsOf(principalName)
+}
+
+// Grant grants or denies the permission in the database outside of the controllers to simulate a manual GRANT
+func (s *Server) Grant(databaseName string, permission ms.Permission) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.databases[databaseName]
+	if !ok {
+		return fmt.Errorf("database '%s' does not exist", databaseName)
+	}
+	if !d.principalExists(permission.Principal) {
+		return fmt.Errorf("cannot find the user '%s', because it does not exist or you do not have permission", permission.Principal)
+	}
+	d.grant(permission)
+	return nil
+}
+
+func (d *Database) grant(permission ms.Permission) {
+	permission.Permission = strings.ToUpper(permission.Permission)
+	d.permissions[permission.Key()] = permission
+}
+
+// permissionsOf the sorted permissions of the principal, those of every principal but the fixed roles when
+// principalName is empty
+func (d *Database) permissionsOf(principalName string) []ms.Permission {
+	var permissions []ms.Permission
+	for _, p := range d.permissions {
+		if principalName == "" {
+			if r, ok := d.roles[p.Principal]; ok && r.IsFixedRole {
+				continue
+			}
+		} else if !strings.EqualFold(p.Principal, principalName) {
+			continue
+		}
+		permissions = append(permissions, p)
+	}
+	ms.SortPermissions(permissions)
+	return permissions
+}
+
+// dropPermissions removes the permissions of the dropped principal
+func (d *Database) dropPermissions(principalName string) {
+	for key, p := range d.permissions {
+		if strings.EqualFold(p.Principal, principalName) {
+			delete(d.permissions, key)
+		}
+	}
+}
+
+// Permissions implements ms.Provider
+func (p *Provider) Permissions(ctx context.Context, databaseName, principalName string) ([]ms.Permission, error) {
+	if _, err := ms.PermissionsStatement(databaseName, principalName); err != nil {
+		return nil, err
+	}
+	s := p.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("Permissions"); err != nil {
+		return nil, err
+	}
+	d, ok := s.databases[databaseName]
+	if !ok {
+		return nil, fmt.Errorf("database '%s' does not exist", databaseName)
+	}
+	return d.permissionsOf(principalName), nil
+}
+
+// ApplyPermission implements ms.Provider, the securables are not checked as the fake has no schemas nor objects
+func (p *Provider) ApplyPermission(ctx context.Context, databaseName string, desired, observed *ms.Permission) error {
+	if _, err := ms.ApplyPermissionStatement(databaseName, desired, observed); err != nil {
+		return err
+	}
+	s := p.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("ApplyPermission"); err != nil {
+		return err
+	}
+	d, ok := s.databases[databaseName]
+	if !ok {
+		return fmt.Errorf("database '%s' does not exist", databaseName)
+	}
+	if desired == nil {
+		delete(d.permissions, observed.Key())
+		return nil
+	}
+	if !d.principalExists(desired.Principal) {
+		return fmt.Errorf("cannot find the user '%s', because it does not exist or you do not have permission", desired.Principal)
+	}
+	d.grant(*desired)
+	return nil
+}
@@ -0,0 +1,408 @@
+// Package fake an in-memory sql server implementing internal.Provider so controllers can be tested
+// without a live sql server
+package fake
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	ms "github.com/pplavetzki/azure-sql-mi/internal"
+)
+
+const (
+	DefaultCollation          = "SQL_Latin1_General_CP1_CI_AS"
+	DefaultCompatibilityLevel = 150
+	DefaultParameterization   = "simple"
+	DefaultRecoveryModel      = "FULL"
+	// DefaultFileSize size of the data and of the log file of a new database, the size of model
+	DefaultFileSize = 8 * 1024 * 1024
+)
+
+// Database a row of sys.databases joined with its sys.database_recovery_status
+type Database struct {
+	// DatabaseID sys.databases.database_id
+	DatabaseID int
+	Name       string
+	// RecoveryForkGUID sys.database_recovery_status.recovery_fork_guid, a new guid is generated
+	// every time a database is created
+	RecoveryForkGUID           string
+	CreateDate                 time.Time
+	Collation                  string
+	CompatibilityLevel         int
+	AllowSnapshotIsolation     bool
+	AllowReadCommittedSnapshot bool
+	Parameterization           string
+	// StateDesc sys.databases.state_desc
+	StateDesc     string
+	RecoveryModel string
+	DataSizeBytes int64
+	LogSizeBytes  int64
+
+	// nextPrincipalID the principal_id of the next user or role of the database
+	nextPrincipalID int
+	users           map[string]*User
+	roles           map[string]*Role
+	// roleMembers sys.database_role_members, the names of the members of each role by the name of the role
+	roleMembers map[string]map[string]bool
+	// permissions sys.database_permissions by ms.Permission.Key
+	permissions map[string]ms.Permission
+	// nextSchemaID the schema_id of the next schema of the database
+	nextSchemaID int
+	schemas      map[string]*Schema
+}
+
+// Server in-memory sql server, every login shares the same databases
+type Server struct {
+	mu              sync.Mutex
+	nextID          int
+	nextPrincipalID int
+	databases       map[string]*Database
+	logins          map[string]*Login
+	backups         map[string]string
+	errors          map[string]error
+}
+
+var _ ms.Provider = &Provider{}
+
+// NewServer contructor pattern, the server starts with the system databases
+func NewServer() *Server {
+	s := &Server{
+		nextID:          1,
+		nextPrincipalID: firstPrincipalID,
+		databases:       map[string]*Database{},
+		logins:          map[string]*Login{},
+		backups:         map[string]string{},
+		errors:          map[string]error{},
+	}
+	for _, name := range []string{"master", "tempdb", "model", "msdb"} {
+		s.create(name, nil)
+	}
+	return s
+}
+
+// Factory ProviderFactory handing out providers of this server
+func (s *Server) Factory() ms.ProviderFactory {
+	return func(server, user, password string, port int) ms.Provider {
+		return &Provider{server: s, User: user}
+	}
+}
+
+// FailOn makes the named Provider operation e.g. `CreateDatabase` return err, a nil err clears it
+func (s *Server) FailOn(operation string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err == nil {
+		delete(s.errors, operation)
+		return
+	}
+	s.errors[operation] = err
+}
+
+// Database a copy of the database with the name
+func (s *Server) Database(name string) (Database, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.databases[name]
+	if !ok {
+		return Database{}, false
+	}
+	return *d, true
+}
+
+// Backups the names of the backed up databases by backup path
+func (s *Server) Backups() map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	backups := make(map[string]string, len(s.backups))
+	for path, name := range s.backups {
+		backups[path] = name
+	}
+	return backups
+}
+
+// AddDatabase creates a database outside of the controllers, returning its recovery_fork_guid
+func (s *Server) AddDatabase(name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.create(name, nil).RecoveryForkGUID
+}
+
+// UpdateDatabase changes the settings of a database outside of the controllers to simulate drift
+func (s *Server) UpdateDatabase(name string, update func(*Database)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.databases[name]
+	if !ok {
+		return fmt.Errorf("database '%s' does not exist", name)
+	}
+	id, guid := d.DatabaseID, d.RecoveryForkGUID
+	update(d)
+	d.DatabaseID, d.RecoveryForkGUID = id, guid
+	if d.Name != name {
+		delete(s.databases, name)
+		s.databases[d.Name] = d
+	}
+	return nil
+}
+
+// RenameDatabase ALTER DATABASE ... MODIFY NAME, the recovery_fork_guid is kept
+func (s *Server) RenameDatabase(name, newName string) error {
+	return s.UpdateDatabase(name, func(d *Database) { d.Name = newName })
+}
+
+func (s *Server) create(name string, params *ms.DatabaseParams) *Database {
+	d := &Database{
+		DatabaseID:         s.nextID,
+		Name:               name,
+		RecoveryForkGUID:   newGUID(),
+		CreateDate:         time.Now().UTC(),
+		Collation:          DefaultCollation,
+		CompatibilityLevel: DefaultCompatibilityLevel,
+		Parameterization:   DefaultParameterization,
+		StateDesc:          "ONLINE",
+		RecoveryModel:      DefaultRecoveryModel,
+		DataSizeBytes:      DefaultFileSize,
+		LogSizeBytes:       DefaultFileSize,
+		nextPrincipalID:    firstUserPrincipalID,
+		users:              map[string]*User{},
+		roles:              map[string]*Role{},
+		roleMembers:        map[string]map[string]bool{},
+		permissions:        map[string]ms.Permission{},
+		schemas:            map[string]*Schema{},
+	}
+	d.createFixedRoles()
+	d.createBuiltInSchemas()
+	if params != nil && params.Collation != nil {
+		d.Collation = *params.Collation
+	}
+	s.nextID++
+	s.databases[name] = d
+	return d
+}
+
+func (s *Server) failure(operation string) error {
+	return s.errors[operation]
+}
+
+// Provider ms.Provider backed by a Server
+type Provider struct {
+	server *Server
+	User   string
+}
+
+// CreateDatabase implements ms.Provider
+func (p *Provider) CreateDatabase(ctx context.Context, databaseName string, params *ms.DatabaseParams) (*string, error) {
+	if _, err := ms.CreateDatabaseStatement(databaseName, params); err != nil {
+		return nil, err
+	}
+	s := p.server
+	s.mu.Lock()
+	if err := s.failure("CreateDatabase"); err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	if _, ok := s.databases[databaseName]; ok {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("database '%s' already exists. Choose a different database name", databaseName)
+	}
+	s.create(databaseName, params)
+	s.mu.Unlock()
+	return p.FindDatabaseID(ctx, databaseName)
+}
+
+// AlterDatabase implements ms.Provider
+func (p *Provider) AlterDatabase(ctx context.Context, databaseName string, params *ms.DatabaseParams) error {
+	if _, err := ms.AlterDatabaseStatements(databaseName, params); err != nil {
+		return err
+	}
+	s := p.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("AlterDatabase"); err != nil {
+		return err
+	}
+	d, ok := s.databases[databaseName]
+	if !ok {
+		return fmt.Errorf("errors while running alter on database: %s", databaseName)
+	}
+	alter(d, params)
+	return nil
+}
+
+// FindDatabaseID implements ms.Provider
+func (p *Provider) FindDatabaseID(ctx context.Context, databaseName string) (*string, error) {
+	s := p.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("FindDatabaseID"); err != nil {
+		return nil, err
+	}
+	d, ok := s.databases[databaseName]
+	if !ok {
+		return nil, nil
+	}
+	id := d.RecoveryForkGUID
+	return &id, nil
+}
+
+// FindDatabaseName implements ms.Provider, like TRY_CONVERT the id is compared case-insensitively
+func (p *Provider) FindDatabaseName(ctx context.Context, id string) (*string, error) {
+	s := p.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("FindDatabaseName"); err != nil {
+		return nil, err
+	}
+	for _, d := range s.databases {
+		if strings.EqualFold(d.RecoveryForkGUID, id) {
+			name := d.Name
+			return &name, nil
+		}
+	}
+	return nil, nil
+}
+
+// SyncNeeded implements ms.Provider
+func (p *Provider) SyncNeeded(ctx context.Context, params *ms.DatabaseConfig) (*ms.DatabaseDiff, error) {
+	if params.DatabaseID != "" {
+		dn, err := p.FindDatabaseName(ctx, params.DatabaseID)
+		if err != nil {
+			return nil, err
+		}
+		if dn == nil {
+			return nil, fmt.Errorf("database id: %s does not exist", params.DatabaseID)
+		}
+		if ms.SafeString(dn) != params.DatabaseName {
+			return nil, fmt.Errorf("database name: %s does not match the name does not match the expected name %s", ms.SafeString(dn), params.DatabaseName)
+		}
+	}
+	s := p.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("SyncNeeded"); err != nil {
+		return nil, err
+	}
+	d, ok := s.databases[params.DatabaseName]
+	if !ok {
+		return nil, nil
+	}
+	return ms.Diff(params, d.state()), nil
+}
+
+// DatabaseState implements ms.Provider
+func (p *Provider) DatabaseState(ctx context.Context, databaseName string) (*ms.DatabaseState, error) {
+	s := p.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("DatabaseState"); err != nil {
+		return nil, err
+	}
+	d, ok := s.databases[databaseName]
+	if !ok {
+		return nil, nil
+	}
+	return d.state(), nil
+}
+
+// DeleteDatabase implements ms.Provider
+func (p *Provider) DeleteDatabase(ctx context.Context, databaseName string) error {
+	if _, err := ms.DropDatabaseStatement(databaseName); err != nil {
+		return err
+	}
+	s := p.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("DeleteDatabase"); err != nil {
+		return err
+	}
+	delete(s.databases, databaseName)
+	return nil
+}
+
+// RenameDatabase implements ms.Provider
+func (p *Provider) RenameDatabase(ctx context.Context, databaseName, newName string) error {
+	if _, err := ms.RenameDatabaseStatement(databaseName, newName); err != nil {
+		return err
+	}
+	s := p.server
+	s.mu.Lock()
+	if err := s.failure("RenameDatabase"); err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	if _, ok := s.databases[newName]; ok {
+		s.mu.Unlock()
+		return fmt.Errorf("database '%s' already exists. Choose a different database name", newName)
+	}
+	s.mu.Unlock()
+	return s.RenameDatabase(databaseName, newName)
+}
+
+// BackupDatabase implements ms.Provider
+func (p *Provider) BackupDatabase(ctx context.Context, databaseName, path string) error {
+	if _, err := ms.BackupDatabaseStatement(databaseName, path); err != nil {
+		return err
+	}
+	s := p.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("BackupDatabase"); err != nil {
+		return err
+	}
+	if _, ok := s.databases[databaseName]; !ok {
+		return fmt.Errorf("database '%s' does not exist", databaseName)
+	}
+	s.backups[path] = databaseName
+	return nil
+}
+
+// state the database as selected by ms.DatabaseStateStatement
+func (d *Database) state() *ms.DatabaseState {
+	return &ms.DatabaseState{
+		Name:                       d.Name,
+		StateDesc:                  d.StateDesc,
+		CreateDate:                 d.CreateDate.Format("2006-01-02T15:04:05.000"),
+		CompatibilityLevel:         d.CompatibilityLevel,
+		Collation:                  d.Collation,
+		AllowSnapshotIsolation:     strconv.FormatBool(d.AllowSnapshotIsolation),
+		AllowReadCommittedSnapshot: strconv.FormatBool(d.AllowReadCommittedSnapshot),
+		Parameterization:           d.Parameterization,
+		RecoveryModel:              d.RecoveryModel,
+		DataSizeBytes:              d.DataSizeBytes,
+		LogSizeBytes:               d.LogSizeBytes,
+	}
+}
+
+func alter(d *Database, params *ms.DatabaseParams) {
+	if params == nil {
+		return
+	}
+	if params.Parameterization != nil && *params.Parameterization != "" {
+		d.Parameterization = strings.ToLower(*params.Parameterization)
+	}
+	if params.AllowSnapshotIsolation != nil {
+		d.AllowSnapshotIsolation = *params.AllowSnapshotIsolation
+	}
+	if params.AllowReadCommittedSnapshot != nil {
+		d.AllowReadCommittedSnapshot = *params.AllowReadCommittedSnapshot
+	}
+	if params.CompatibilityLevel != nil && *params.CompatibilityLevel != 0 {
+		d.CompatibilityLevel = *params.CompatibilityLevel
+	}
+}
+
+// newGUID a random uniqueidentifier formatted like CAST(... AS char(36))
+func newGUID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return strings.ToUpper(fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]))
+}
@@ -0,0 +1,349 @@
+package fake
+
+import (
+	"context"
+	"reflect"
+	"regexp"
+	"testing"
+
+	ms "github.com/pplavetzki/azure-sql-mi/internal"
+)
+
+var guidPattern = regexp.MustCompile(`^[0-9A-F]{8}-[0-9A-F]{4}-4[0-9A-F]{3}-[89AB][0-9A-F]{3}-[0-9A-F]{12}$`)
+
+func TestProviderLifecycle(t *testing.T) {
+	ctx := context.Background()
+	server := NewServer()
+	provider := server.Factory()("server", "sa", "secret", 1433)
+
+	level := 140
+	params := &ms.DatabaseParams{CompatibilityLevel: &level}
+	id, err := provider.CreateDatabase(ctx, "MyDatabase", params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d, _ := server.Database("MyDatabase"); d.CompatibilityLevel != DefaultCompatibilityLevel {
+		t.Errorf("expected CREATE DATABASE to leave the compatibility level to AlterDatabase, got %d", d.CompatibilityLevel)
+	}
+	if err := provider.AlterDatabase(ctx, "MyDatabase", params); err != nil {
+		t.Fatal(err)
+	}
+	if !guidPattern.MatchString(ms.SafeString(id)) {
+		t.Errorf("unexpected recovery_fork_guid: %s", ms.SafeString(id))
+	}
+	if _, err := provider.CreateDatabase(ctx, "MyDatabase", nil); err == nil {
+		t.Error("expected creating an existing database to fail")
+	}
+	name, err := provider.FindDatabaseName(ctx, ms.SafeString(id))
+	if err != nil || ms.SafeString(name) != "MyDatabase" {
+		t.Errorf("FindDatabaseName = %v, %v", ms.SafeString(name), err)
+	}
+
+	config := &ms.DatabaseConfig{DatabaseName: "MyDatabase", DatabaseID: *id, CompatibilityLevel: 150,
+		AllowReadCommittedSnapshot: true, Parameterization: "simple"}
+	diff, err := provider.SyncNeeded(ctx, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.Drifted()) != 2 {
+		t.Fatalf("expected compatibility level and read committed snapshot drift, got %+v", diff.Drifted())
+	}
+	if err := provider.AlterDatabase(ctx, "MyDatabase", diff.Remediation()); err != nil {
+		t.Fatal(err)
+	}
+	diff, err = provider.SyncNeeded(ctx, config)
+	if err != nil || diff.HasDrift() {
+		t.Fatalf("expected no drift, got %+v, %v", diff, err)
+	}
+
+	if err := provider.DeleteDatabase(ctx, "MyDatabase"); err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := provider.FindDatabaseID(ctx, "MyDatabase"); id != nil {
+		t.Error("expected the database to be dropped")
+	}
+	recreated, err := provider.CreateDatabase(ctx, "MyDatabase", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *recreated == *id {
+		t.Error("expected a new recovery_fork_guid for a recreated database")
+	}
+}
+
+func TestProviderRenameProtection(t *testing.T) {
+	ctx := context.Background()
+	server := NewServer()
+	provider := server.Factory()("server", "sa", "secret", 1433)
+
+	id := server.AddDatabase("MyDatabase")
+	if err := server.RenameDatabase("MyDatabase", "Other"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := provider.SyncNeeded(ctx, &ms.DatabaseConfig{DatabaseName: "MyDatabase", DatabaseID: id}); err == nil {
+		t.Error("expected a renamed database to fail the sync")
+	}
+	renamed, ok := server.Database("Other")
+	if !ok || renamed.RecoveryForkGUID != id {
+		t.Errorf("expected the rename to keep the recovery_fork_guid, got %+v", renamed)
+	}
+}
+
+func TestProviderLogins(t *testing.T) {
+	ctx := context.Background()
+	server := NewServer()
+	provider := server.Factory()("server", "sa", "secret", 1433)
+
+	missing := "MissingDb"
+	if err := provider.CreateLogin(ctx, "MyLogin", "P@ssw0rd", &ms.LoginParams{DefaultDatabase: &missing}); err == nil {
+		t.Error("expected a missing default database to fail")
+	}
+	if err := provider.CreateLogin(ctx, "MyLogin", "P@ssw0rd", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.CreateLogin(ctx, "MyLogin", "P@ssw0rd", nil); err == nil {
+		t.Error("expected creating an existing login to fail")
+	}
+
+	state, err := provider.LoginState(ctx, "MyLogin", "rotated")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.PasswordMatches || state.DefaultDatabase != DefaultLoginDatabase || !state.CheckPolicy {
+		t.Errorf("unexpected state: %+v", state)
+	}
+	if err := provider.AlterLoginPassword(ctx, "MyLogin", "rotated"); err != nil {
+		t.Fatal(err)
+	}
+	if state, _ = provider.LoginState(ctx, "MyLogin", "rotated"); !state.PasswordMatches {
+		t.Error("expected the password to be changed")
+	}
+
+	if err := provider.DeleteLogin(ctx, "MyLogin"); err != nil {
+		t.Fatal(err)
+	}
+	if state, _ = provider.LoginState(ctx, "MyLogin", "rotated"); state != nil {
+		t.Error("expected the login to be dropped")
+	}
+	if err := provider.DeleteLogin(ctx, "MyLogin"); err != nil {
+		t.Errorf("expected dropping a missing login to succeed, got %v", err)
+	}
+}
+
+func TestProviderUsers(t *testing.T) {
+	ctx := context.Background()
+	server := NewServer()
+	provider := server.Factory()("server", "sa", "secret", 1433)
+	server.AddDatabase("App")
+	login := "app"
+	forLogin := &ms.UserParams{Authentication: ms.AuthenticationInstance, Login: &login}
+
+	if err := provider.CreateUser(ctx, "App", "app", "", forLogin); err == nil {
+		t.Error("expected a missing login to fail")
+	}
+	sid := server.AddLogin(login, "P@ssw0rd")
+	if err := provider.CreateUser(ctx, "App", "app", "", forLogin); err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.CreateUser(ctx, "App", "app", "", forLogin); err == nil {
+		t.Error("expected creating an existing user to fail")
+	}
+
+	state, err := provider.UserState(ctx, "App", "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.SID != sid || state.Login != login || state.DefaultSchema != DefaultSchema || state.PrincipalID != firstUserPrincipalID {
+		t.Errorf("unexpected state: %+v", state)
+	}
+	if state, _ = provider.UserState(ctx, "master", "app"); state != nil {
+		t.Error("expected the user to exist in its database only")
+	}
+	if _, err = provider.UserState(ctx, "MissingDb", "app"); err == nil {
+		t.Error("expected a missing database to fail")
+	}
+
+	schema := "sales"
+	if err := provider.AlterUser(ctx, "App", "app", &ms.UserParams{DefaultSchema: &schema}); err != nil {
+		t.Fatal(err)
+	}
+	if state, _ = provider.UserState(ctx, "App", "app"); state.DefaultSchema != schema {
+		t.Errorf("expected the default schema to be altered, got %+v", state)
+	}
+	if err := provider.AlterUserPassword(ctx, "App", "app", "secret"); err == nil {
+		t.Error("expected changing the password of a user mapped to a login to fail")
+	}
+
+	if err := provider.DeleteUser(ctx, "App", "app"); err != nil {
+		t.Fatal(err)
+	}
+	if state, _ = provider.UserState(ctx, "App", "app"); state != nil {
+		t.Error("expected the user to be dropped")
+	}
+	if err := provider.DeleteUser(ctx, "MissingDb", "app"); err != nil {
+		t.Errorf("expected dropping a user of a missing database to succeed, got %v", err)
+	}
+}
+
+func TestProviderRoles(t *testing.T) {
+	ctx := context.Background()
+	server := NewServer()
+	provider := server.Factory()("server", "sa", "secret", 1433)
+	server.AddDatabase("App")
+	if _, err := server.AddUser("App", "app"); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := provider.RoleState(ctx, "App", "db_datareader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state == nil || !state.IsFixedRole || state.PrincipalID != firstFixedRolePrincipalID+6 {
+		t.Errorf("expected the fixed roles to exist, got %+v", state)
+	}
+	if err := provider.CreateRole(ctx, "App", "app"); err == nil {
+		t.Error("expected a role named like a user to fail")
+	}
+	if err := provider.CreateRole(ctx, "App", "app_readers"); err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.AddRoleMember(ctx, "App", "app_readers", "missing"); err == nil {
+		t.Error("expected adding a missing principal to fail")
+	}
+	if err := provider.AddRoleMember(ctx, "App", "app_readers", "db_owner"); err == nil {
+		t.Error("expected adding a fixed role to fail")
+	}
+	if err := provider.AddRoleMember(ctx, "App", "app_readers", "app"); err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.AddRoleMember(ctx, "App", "db_datareader", "app_readers"); err != nil {
+		t.Fatal(err)
+	}
+
+	state, _ = provider.RoleState(ctx, "App", "app_readers")
+	if !reflect.DeepEqual(state.MemberNames(), []string{"app"}) || !reflect.DeepEqual(state.MemberOfNames(), []string{"db_datareader"}) {
+		t.Errorf("unexpected membership: %+v", state)
+	}
+
+	if err := provider.DeleteUser(ctx, "App", "app"); err != nil {
+		t.Fatal(err)
+	}
+	if members := server.RoleMembers("App", "app_readers"); len(members) != 0 {
+		t.Errorf("expected a dropped user to leave its roles, got %v", members)
+	}
+	if err := provider.DeleteRole(ctx, "App", "app_readers"); err != nil {
+		t.Fatal(err)
+	}
+	if state, _ = provider.RoleState(ctx, "App", "app_readers"); state != nil {
+		t.Error("expected the role to be dropped")
+	}
+	if members := server.RoleMembers("App", "db_datareader"); len(members) != 0 {
+		t.Errorf("expected a dropped role to leave its roles, got %v", members)
+	}
+	if err := provider.DeleteRole(ctx, "MissingDb", "app_readers"); err != nil {
+		t.Errorf("expected dropping a role of a missing database to succeed, got %v", err)
+	}
+}
+
+func TestProviderPermissions(t *testing.T) {
+	ctx := context.Background()
+	server := NewServer()
+	provider := server.Factory()("server", "sa", "secret", 1433)
+	server.AddDatabase("App")
+	if _, err := server.AddUser("App", "app"); err != nil {
+		t.Fatal(err)
+	}
+	connect := ms.Permission{Principal: "app", Class: ms.PermissionClassDatabase, Permission: "CONNECT", State: ms.PermissionStateGrant}
+	if permissions, _ := provider.Permissions(ctx, "App", "app"); !reflect.DeepEqual(permissions, []ms.Permission{connect}) {
+		t.Errorf("expected a new user to be granted CONNECT, got %+v", permissions)
+	}
+
+	selectSales := &ms.Permission{Principal: "app", Class: ms.PermissionClassSchema, Schema: "sales", Permission: "select", State: ms.PermissionStateGrant}
+	if err := provider.ApplyPermission(ctx, "App", &ms.Permission{Principal: "missing", Class: ms.PermissionClassDatabase, Permission: "SELECT", State: ms.PermissionStateGrant}, nil); err == nil {
+		t.Error("expected a permission of a missing principal to fail")
+	}
+	if err := provider.ApplyPermission(ctx, "App", selectSales, nil); err != nil {
+		t.Fatal(err)
+	}
+	denied := *selectSales
+	denied.State = ms.PermissionStateDeny
+	if err := provider.ApplyPermission(ctx, "App", &denied, selectSales); err != nil {
+		t.Fatal(err)
+	}
+	permissions, _ := provider.Permissions(ctx, "App", "")
+	if len(permissions) != 2 || permissions[1].State != ms.PermissionStateDeny || permissions[1].Permission != "SELECT" {
+		t.Errorf("expected the DENY to replace the GRANT, got %+v", permissions)
+	}
+	if err := provider.ApplyPermission(ctx, "App", nil, &denied); err != nil {
+		t.Fatal(err)
+	}
+	if permissions = server.Permissions("App", "app"); len(permissions) != 1 {
+		t.Errorf("expected the DENY to be revoked, got %+v", permissions)
+	}
+
+	if err := provider.DeleteUser(ctx, "App", "app"); err != nil {
+		t.Fatal(err)
+	}
+	if permissions = server.Permissions("App", ""); len(permissions) != 0 {
+		t.Errorf("expected a dropped user to lose its permissions, got %+v", permissions)
+	}
+}
+
+func TestProviderSchemas(t *testing.T) {
+	ctx := context.Background()
+	server := NewServer()
+	provider := server.Factory()("server", "sa", "secret", 1433)
+	server.AddDatabase("App")
+	if _, err := server.AddUser("App", "app"); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := provider.SchemaState(ctx, "App", "dbo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state == nil || state.SchemaID != 1 || state.Owner != "dbo" {
+		t.Errorf("expected the built-in schemas to exist, got %+v", state)
+	}
+	if err := provider.CreateSchema(ctx, "App", "sales", "missing"); err == nil {
+		t.Error("expected a schema owned by a missing principal to fail")
+	}
+	if err := provider.CreateSchema(ctx, "App", "sales", ""); err != nil {
+		t.Fatal(err)
+	}
+	if state, _ = provider.SchemaState(ctx, "App", "sales"); state == nil || state.SchemaID != firstSchemaID || state.Owner != DefaultSchemaOwner {
+		t.Errorf("expected the schema to be owned by dbo, got %+v", state)
+	}
+	if err := provider.AlterSchemaOwner(ctx, "App", "sales", "app"); err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.DeleteUser(ctx, "App", "app"); err == nil {
+		t.Error("expected dropping the owner of a schema to fail")
+	}
+
+	grant := ms.Permission{Principal: "app", Class: ms.PermissionClassSchema, Schema: "sales", Permission: "SELECT", State: ms.PermissionStateGrant}
+	if err := server.Grant("App", grant); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.UpdateSchema("App", "sales", func(s *Schema) { s.ObjectCount = 2 }); err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.DeleteSchema(ctx, "App", "sales"); err == nil {
+		t.Error("expected dropping a schema with objects to fail")
+	}
+	if err := server.UpdateSchema("App", "sales", func(s *Schema) { s.ObjectCount = 0 }); err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.DeleteSchema(ctx, "App", "sales"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := server.Schema("App", "sales"); ok {
+		t.Error("expected the schema to be dropped")
+	}
+	if permissions := server.Permissions("App", "app"); len(permissions) != 1 {
+		t.Errorf("expected the permissions on a dropped schema to be removed, got %+v", permissions)
+	}
+	if err := provider.DeleteSchema(ctx, "MissingDb", "sales"); err != nil {
+		t.Errorf("expected dropping a schema of a missing database to succeed, got %v", err)
+	}
+}
@@ -0,0 +1,270 @@
+package fake
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	ms "github.com/pplavetzki/azure-sql-mi/internal"
+)
+
+const (
+	// DefaultRoleOwner the owner of a role created without AUTHORIZATION by a login mapped to dbo
+	DefaultRoleOwner = "dbo"
+	// firstFixedRolePrincipalID the principal_id of db_owner, the other fixed roles follow it
+	firstFixedRolePrincipalID = 16384
+)
+
+// Role a row of sys.database_principals of type R
+type Role struct {
+	// PrincipalID sys.database_principals.principal_id, unique within the database
+	PrincipalID int
+	Name        string
+	IsFixedRole bool
+	Owner       string
+	CreateDate  time.Time
+}
+
+// Role a copy of the role with the name in the database
+func (s *Server) Role(databaseName, name string) (Role, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.databases[databaseName]
+	if !ok {
+		return Role{}, false
+	}
+	r, ok := d.roles[name]
+	if !ok {
+		return Role{}, false
+	}
+	return *r, true
+}
+
+// RoleMembers the sorted names of the members of the role in the database
+func (s *Server) RoleMembers(databaseName, name string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.databases[databaseName]
+	if !ok {
+		return nil
+	}
+	return d.members(name)
+}
+
+// AddRole creates a role in the database outside of the controllers
+func (s *Server) AddRole(databaseName, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.databases[databaseName]
+	if !ok {
+		return fmt.Errorf("database '%s' does not exist", databaseName)
+	}
+	d.createRole(name)
+	return nil
+}
+
+// AddRoleMember adds the member to the role outside of the controllers to simulate drift
+func (s *Server) AddRoleMember(databaseName, roleName, memberName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.alterRoleMember(databaseName, roleName, memberName, true)
+}
+
+// alterRoleMember adds the member to or drops it from the role, it fails like ALTER ROLE when the role or the
+// member doesn't exist
+func (s *Server) alterRoleMember(databaseName, roleName, memberName string, add bool) error {
+	d, ok := s.databases[databaseName]
+	if !ok {
+		return fmt.Errorf("database '%s' does not exist", databaseName)
+	}
+	if _, ok := d.roles[roleName]; !ok {
+		return fmt.Errorf("cannot alter the role '%s', because it does not exist or you do not have permission", roleName)
+	}
+	if !d.principalExists(memberName) {
+		return fmt.Errorf("cannot add the principal '%s', because it does not exist or you do not have permission", memberName)
+	}
+	if r, ok := d.roles[memberName]; ok && r.IsFixedRole {
+		return fmt.Errorf("cannot use the special principal '%s'", memberName)
+	}
+	if add {
+		d.roleMembers[roleName][memberName] = true
+	} else {
+		delete(d.roleMembers[roleName], memberName)
+	}
+	return nil
+}
+
+// principalExists whether a user or a role has the name, they share sys.database_principals
+func (d *Database) principalExists(name string) bool {
+	_, user := d.users[name]
+	_, role := d.roles[name]
+	return user || role
+}
+
+// members the sorted names of the members of the role
+func (d *Database) members(roleName string) []string {
+	names := []string{}
+	for name := range d.roleMembers[roleName] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// memberOf the sorted names of the roles the principal is a member of
+func (d *Database) memberOf(name string) []string {
+	roles := []string{}
+	for role, members := range d.roleMembers {
+		if members[name] {
+			roles = append(roles, role)
+		}
+	}
+	sort.Strings(roles)
+	return roles
+}
+
+// dropMemberships removes the dropped principal from every role
+func (d *Database) dropMemberships(name string) {
+	for _, members := range d.roleMembers {
+		delete(members, name)
+	}
+}
+
+func (d *Database) createRole(name string) *Role {
+	r := &Role{
+		PrincipalID: d.nextPrincipalID,
+		Name:        name,
+		Owner:       DefaultRoleOwner,
+		CreateDate:  time.Now().UTC(),
+	}
+	d.nextPrincipalID++
+	d.roles[name] = r
+	d.roleMembers[name] = map[string]bool{}
+	return r
+}
+
+// createFixedRoles creates the ms.FixedRoles every database starts with
+func (d *Database) createFixedRoles() {
+	for i, name := range ms.FixedRoles {
+		d.roles[name] = &Role{
+			PrincipalID: firstFixedRolePrincipalID + i,
+			Name:        name,
+			IsFixedRole: true,
+			Owner:       DefaultRoleOwner,
+			CreateDate:  d.CreateDate,
+		}
+		d.roleMembers[name] = map[string]bool{}
+	}
+}
+
+// CreateRole implements ms.Provider
+func (p *Provider) CreateRole(ctx context.Context, databaseName, roleName string) error {
+	if _, err := ms.CreateRoleStatement(databaseName, roleName); err != nil {
+		return err
+	}
+	s := p.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("CreateRole"); err != nil {
+		return err
+	}
+	d, ok := s.databases[databaseName]
+	if !ok {
+		return fmt.Errorf("database '%s' does not exist", databaseName)
+	}
+	if d.principalExists(roleName) {
+		return fmt.Errorf("user, group, or role '%s' already exists in the current database", roleName)
+	}
+	d.createRole(roleName)
+	return nil
+}
+
+// AddRoleMember implements ms.Provider
+func (p *Provider) AddRoleMember(ctx context.Context, databaseName, roleName, memberName string) error {
+	if _, err := ms.AddRoleMemberStatement(databaseName, roleName, memberName); err != nil {
+		return err
+	}
+	s := p.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("AddRoleMember"); err != nil {
+		return err
+	}
+	return s.alterRoleMember(databaseName, roleName, memberName, true)
+}
+
+// DropRoleMember implements ms.Provider
+func (p *Provider) DropRoleMember(ctx context.Context, databaseName, roleName, memberName string) error {
+	if _, err := ms.DropRoleMemberStatement(databaseName, roleName, memberName); err != nil {
+		return err
+	}
+	s := p.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("DropRoleMember"); err != nil {
+		return err
+	}
+	return s.alterRoleMember(databaseName, roleName, memberName, false)
+}
+
+// RoleState implements ms.Provider
+func (p *Provider) RoleState(ctx context.Context, databaseName, roleName string) (*ms.RoleState, error) {
+	s := p.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("RoleState"); err != nil {
+		return nil, err
+	}
+	d, ok := s.databases[databaseName]
+	if !ok {
+		return nil, fmt.Errorf("database '%s' does not exist", databaseName)
+	}
+	r, ok := d.roles[roleName]
+	if !ok {
+		return nil, nil
+	}
+	state := &ms.RoleState{
+		Name:        r.Name,
+		PrincipalID: r.PrincipalID,
+		IsFixedRole: r.IsFixedRole,
+		Owner:       r.Owner,
+		CreateDate:  r.CreateDate.Format("2006-01-02T15:04:05.000"),
+	}
+	// like FOR JSON the lists are left out when there are no rows
+	for _, name := range d.members(roleName) {
+		state.Members = append(state.Members, ms.RoleMember{Name: name})
+	}
+	for _, name := range d.memberOf(roleName) {
+		state.MemberOf = append(state.MemberOf, ms.RoleMember{Name: name})
+	}
+	return state, nil
+}
+
+// DeleteRole implements ms.Provider
+func (p *Provider) DeleteRole(ctx context.Context, databaseName, roleName string) error {
+	if _, err := ms.DropRoleStatement(databaseName, roleName); err != nil {
+		return err
+	}
+	s := p.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("DeleteRole"); err != nil {
+		return err
+	}
+	d, ok := s.databases[databaseName]
+	if !ok {
+		return nil
+	}
+	if r, ok := d.roles[roleName]; ok && r.IsFixedRole {
+		return fmt.Errorf("cannot drop the role '%s'", roleName)
+	}
+	if d.ownsSchema(roleName) {
+		return fmt.Errorf("the database principal '%s' owns a schema in the database, and cannot be dropped", roleName)
+	}
+	delete(d.roles, roleName)
+	delete(d.roleMembers, roleName)
+	d.dropMemberships(roleName)
+	d.dropPermissions(roleName)
+	return nil
+}
@@ -0,0 +1,220 @@
+package fake
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	ms "github.com/pplavetzki/azure-sql-mi/internal"
+)
+
+const (
+	// DefaultSchemaOwner the owner of a schema created without AUTHORIZATION by a login mapped to dbo
+	DefaultSchemaOwner = "dbo"
+	// firstSchemaID the schema_id of the first schema created in a database, the built-in schemas come before it
+	firstSchemaID = 5
+)
+
+// Schema a row of sys.schemas along with the number of its rows of sys.objects
+type Schema struct {
+	// SchemaID sys.schemas.schema_id, unique within the database
+	SchemaID    int
+	Name        string
+	Owner       string
+	ObjectCount int
+}
+
+// Schema a copy of the schema with the name in the database
+func (s *Server) Schema(databaseName, name string) (Schema, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.databases[databaseName]
+	if !ok {
+		return Schema{}, false
+	}
+	schema, ok := d.schemas[name]
+	if !ok {
+		return Schema{}, false
+	}
+	return *schema, true
+}
+
+// AddSchema creates a schema owned by the principal in the database outside of the controllers
+func (s *Server) AddSchema(databaseName, name, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.databases[databaseName]
+	if !ok {
+		return fmt.Errorf("database '%s' does not exist", databaseName)
+	}
+	return d.createSchema(name, owner)
+}
+
+// UpdateSchema changes the owner or the number of objects of a schema outside of the controllers to simulate
+// drift or tables created in it
+func (s *Server) UpdateSchema(databaseName, name string, update func(*Schema)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.databases[databaseName]
+	if !ok {
+		return fmt.Errorf("database '%s' does not exist", databaseName)
+	}
+	schema, ok := d.schemas[name]
+	if !ok {
+		return fmt.Errorf("cannot find the schema '%s', because it does not exist or you do not have permission", name)
+	}
+	id := schema.SchemaID
+	update(schema)
+	schema.SchemaID, schema.Name = id, name
+	return nil
+}
+
+// ownerExists whether the principal can own a schema, dbo is not a row of the fake users but exists in every
+// database
+func (d *Database) ownerExists(name string) bool {
+	return strings.EqualFold(name, DefaultSchemaOwner) || d.principalExists(name)
+}
+
+// ownsSchema whether the principal owns a schema, such a principal cannot be dropped
+func (d *Database) ownsSchema(name string) bool {
+	for _, schema := range d.schemas {
+		if schema.Owner == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Database) createSchema(name, owner string) error {
+	if _, ok := d.schemas[name]; ok {
+		return fmt.Errorf("there is already an object named '%s' in the database", name)
+	}
+	if owner == "" {
+		owner = DefaultSchemaOwner
+	}
+	if !d.ownerExists(owner) {
+		return fmt.Errorf("cannot find the user '%s', because it does not exist or you do not have permission", owner)
+	}
+	d.schemas[name] = &Schema{SchemaID: d.nextSchemaID, Name: name, Owner: owner}
+	d.nextSchemaID++
+	return nil
+}
+
+// createBuiltInSchemas creates the ms.BuiltInSchemas and the schemas of the fixed roles every database starts
+// with, each owned by the principal of the same name
+func (d *Database) createBuiltInSchemas() {
+	for i, name := range ms.BuiltInSchemas {
+		d.schemas[name] = &Schema{SchemaID: i + 1, Name: name, Owner: name}
+	}
+	for i, name := range ms.FixedRoles {
+		d.schemas[name] = &Schema{SchemaID: firstFixedRolePrincipalID + i, Name: name, Owner: name}
+	}
+	d.nextSchemaID = firstSchemaID
+}
+
+// dropSchemaPermissions removes the permissions on the dropped schema and on its objects
+func (d *Database) dropSchemaPermissions(schemaName string) {
+	for key, p := range d.permissions {
+		if p.Class != ms.PermissionClassDatabase && strings.EqualFold(p.Schema, schemaName) {
+			delete(d.permissions, key)
+		}
+	}
+}
+
+// CreateSchema implements ms.Provider
+func (p *Provider) CreateSchema(ctx context.Context, databaseName, schemaName, ownerName string) error {
+	if _, err := ms.CreateSchemaStatement(databaseName, schemaName, ownerName); err != nil {
+		return err
+	}
+	s := p.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("CreateSchema"); err != nil {
+		return err
+	}
+	d, ok := s.databases[databaseName]
+	if !ok {
+		return fmt.Errorf("database '%s' does not exist", databaseName)
+	}
+	return d.createSchema(schemaName, ownerName)
+}
+
+// AlterSchemaOwner implements ms.Provider
+func (p *Provider) AlterSchemaOwner(ctx context.Context, databaseName, schemaName, ownerName string) error {
+	if _, err := ms.AlterSchemaOwnerStatement(databaseName, schemaName, ownerName); err != nil {
+		return err
+	}
+	s := p.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("AlterSchemaOwner"); err != nil {
+		return err
+	}
+	d, ok := s.databases[databaseName]
+	if !ok {
+		return fmt.Errorf("database '%s' does not exist", databaseName)
+	}
+	schema, ok := d.schemas[schemaName]
+	if !ok {
+		return fmt.Errorf("cannot find the schema '%s', because it does not exist or you do not have permission", schemaName)
+	}
+	if !d.ownerExists(ownerName) {
+		return fmt.Errorf("cannot find the user '%s', because it does not exist or you do not have permission", ownerName)
+	}
+	schema.Owner = ownerName
+	return nil
+}
+
+// SchemaState implements ms.Provider
+func (p *Provider) SchemaState(ctx context.Context, databaseName, schemaName string) (*ms.SchemaState, error) {
+	if _, err := ms.SchemaStateStatement(databaseName, schemaName); err != nil {
+		return nil, err
+	}
+	s := p.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("SchemaState"); err != nil {
+		return nil, err
+	}
+	d, ok := s.databases[databaseName]
+	if !ok {
+		return nil, fmt.Errorf("database '%s' does not exist", databaseName)
+	}
+	schema, ok := d.schemas[schemaName]
+	if !ok {
+		return nil, nil
+	}
+	return &ms.SchemaState{
+		Name:        schema.Name,
+		SchemaID:    schema.SchemaID,
+		Owner:       schema.Owner,
+		ObjectCount: schema.ObjectCount,
+	}, nil
+}
+
+// DeleteSchema implements ms.Provider
+func (p *Provider) DeleteSchema(ctx context.Context, databaseName, schemaName string) error {
+	if _, err := ms.DropSchemaStatement(databaseName, schemaName); err != nil {
+		return err
+	}
+	s := p.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("DeleteSchema"); err != nil {
+		return err
+	}
+	d, ok := s.databases[databaseName]
+	if !ok {
+		return nil
+	}
+	schema, ok := d.schemas[schemaName]
+	if !ok {
+		return nil
+	}
+	if schema.ObjectCount > 0 {
+		return fmt.Errorf("schema %s of database %s still contains %d objects", schemaName, databaseName, schema.ObjectCount)
+	}
+	delete(d.schemas, schemaName)
+	d.dropSchemaPermissions(schemaName)
+	return nil
+}
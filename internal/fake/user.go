@@ -0,0 +1,254 @@
+package fake
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	ms "github.com/pplavetzki/azure-sql-mi/internal"
+)
+
+const (
+	// DefaultSchema default_schema_name of a user created without a default schema
+	DefaultSchema = "dbo"
+	// firstUserPrincipalID the principal_id of the first user of a database, dbo, guest, INFORMATION_SCHEMA and sys
+	// come before it
+	firstUserPrincipalID = 5
+)
+
+// User a row of sys.database_principals, the password of a contained user is kept in the clear
+type User struct {
+	// PrincipalID sys.database_principals.principal_id, unique within the database
+	PrincipalID int
+	Name        string
+	// SID sys.database_principals.sid formatted like CONVERT(varchar, sid, 1), the sid of the login of a user
+	// mapped to a login
+	SID string
+	// AuthenticationType sys.database_principals.authentication_type_desc
+	AuthenticationType string
+	Password           string
+	DefaultSchema      string
+	CreateDate         time.Time
+}
+
+// User a copy of the user with the name in the database
+func (s *Server) User(databaseName, name string) (User, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.databases[databaseName]
+	if !ok {
+		return User{}, false
+	}
+	u, ok := d.users[name]
+	if !ok {
+		return User{}, false
+	}
+	return *u, true
+}
+
+// AddUser creates a user without login in the database outside of the controllers, returning its sid
+func (s *Server) AddUser(databaseName, name string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.databases[databaseName]
+	if !ok {
+		return "", fmt.Errorf("database '%s' does not exist", databaseName)
+	}
+	return d.createUser(name, newSID(), ms.AuthenticationNone, "", nil).SID, nil
+}
+
+// UpdateUser changes the user outside of the controllers to simulate drift
+func (s *Server) UpdateUser(databaseName, name string, update func(*User)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, err := s.user(databaseName, name)
+	if err != nil {
+		return err
+	}
+	id := u.PrincipalID
+	update(u)
+	u.PrincipalID, u.Name = id, name
+	return nil
+}
+
+// user the user with the name in the database, it fails like ALTER USER when either doesn't exist
+func (s *Server) user(databaseName, name string) (*User, error) {
+	d, ok := s.databases[databaseName]
+	if !ok {
+		return nil, fmt.Errorf("database '%s' does not exist", databaseName)
+	}
+	u, ok := d.users[name]
+	if !ok {
+		return nil, fmt.Errorf("cannot alter the user '%s', because it does not exist or you do not have permission", name)
+	}
+	return u, nil
+}
+
+// loginName the name of the login with the sid like SUSER_SNAME, empty when there is none
+func (s *Server) loginName(sid string) string {
+	for _, l := range s.logins {
+		if l.SID == sid {
+			return l.Name
+		}
+	}
+	return ""
+}
+
+func (d *Database) createUser(name, sid, authentication, password string, params *ms.UserParams) *User {
+	u := &User{
+		PrincipalID:        d.nextPrincipalID,
+		Name:               name,
+		SID:                sid,
+		AuthenticationType: authentication,
+		Password:           password,
+		DefaultSchema:      DefaultSchema,
+		CreateDate:         time.Now().UTC(),
+	}
+	if params != nil && params.DefaultSchema != nil {
+		u.DefaultSchema = *params.DefaultSchema
+	}
+	d.nextPrincipalID++
+	d.users[name] = u
+	// like CREATE USER the user is granted CONNECT
+	d.grant(ms.Permission{Principal: name, Class: ms.PermissionClassDatabase, Permission: "CONNECT", State: ms.PermissionStateGrant})
+	return u
+}
+
+// CreateUser implements ms.Provider
+func (p *Provider) CreateUser(ctx context.Context, databaseName, userName, password string, params *ms.UserParams) error {
+	if _, err := ms.CreateUserStatement(databaseName, userName, password, params); err != nil {
+		return err
+	}
+	s := p.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("CreateUser"); err != nil {
+		return err
+	}
+	d, ok := s.databases[databaseName]
+	if !ok {
+		return fmt.Errorf("database '%s' does not exist", databaseName)
+	}
+	if d.principalExists(userName) {
+		return fmt.Errorf("user, group, or role '%s' already exists in the current database", userName)
+	}
+	sid := newSID()
+	if params.Authentication == ms.AuthenticationInstance {
+		l, ok := s.logins[*params.Login]
+		if !ok {
+			return fmt.Errorf("'%s' is not a valid login or you do not have permission", *params.Login)
+		}
+		sid = l.SID
+	}
+	if params.Authentication != ms.AuthenticationDatabase {
+		password = ""
+	}
+	d.createUser(userName, sid, params.Authentication, password, params)
+	return nil
+}
+
+// AlterUser implements ms.Provider
+func (p *Provider) AlterUser(ctx context.Context, databaseName, userName string, params *ms.UserParams) error {
+	if _, err := ms.AlterUserStatements(databaseName, userName, params); err != nil {
+		return err
+	}
+	s := p.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("AlterUser"); err != nil {
+		return err
+	}
+	u, err := s.user(databaseName, userName)
+	if err != nil {
+		return err
+	}
+	if params == nil {
+		return nil
+	}
+	if params.Login != nil {
+		l, ok := s.logins[*params.Login]
+		if !ok {
+			return fmt.Errorf("'%s' is not a valid login or you do not have permission", *params.Login)
+		}
+		if u.AuthenticationType != ms.AuthenticationInstance {
+			return fmt.Errorf("cannot remap a user of one type to a login of a different type")
+		}
+		u.SID = l.SID
+	}
+	if params.DefaultSchema != nil {
+		u.DefaultSchema = *params.DefaultSchema
+	}
+	return nil
+}
+
+// AlterUserPassword implements ms.Provider
+func (p *Provider) AlterUserPassword(ctx context.Context, databaseName, userName, password string) error {
+	if _, err := ms.AlterUserPasswordStatement(databaseName, userName, password); err != nil {
+		return err
+	}
+	s := p.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("AlterUserPassword"); err != nil {
+		return err
+	}
+	u, err := s.user(databaseName, userName)
+	if err != nil {
+		return err
+	}
+	if u.AuthenticationType != ms.AuthenticationDatabase {
+		return fmt.Errorf("the password of user '%s' cannot be changed, it is not a contained user", userName)
+	}
+	u.Password = password
+	return nil
+}
+
+// UserState implements ms.Provider
+func (p *Provider) UserState(ctx context.Context, databaseName, userName string) (*ms.UserState, error) {
+	s := p.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("UserState"); err != nil {
+		return nil, err
+	}
+	d, ok := s.databases[databaseName]
+	if !ok {
+		return nil, fmt.Errorf("database '%s' does not exist", databaseName)
+	}
+	u, ok := d.users[userName]
+	if !ok {
+		return nil, nil
+	}
+	return &ms.UserState{
+		Name:               u.Name,
+		PrincipalID:        u.PrincipalID,
+		SID:                u.SID,
+		TypeDesc:           "SQL_USER",
+		AuthenticationType: u.AuthenticationType,
+		DefaultSchema:      u.DefaultSchema,
+		Login:              s.loginName(u.SID),
+		CreateDate:         u.CreateDate.Format("2006-01-02T15:04:05.000"),
+	}, nil
+}
+
+// DeleteUser implements ms.Provider
+func (p *Provider) DeleteUser(ctx context.Context, databaseName, userName string) error {
+	if _, err := ms.DropUserStatement(databaseName, userName); err != nil {
+		return err
+	}
+	s := p.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.failure("DeleteUser"); err != nil {
+		return err
+	}
+	if d, ok := s.databases[databaseName]; ok {
+		if d.ownsSchema(userName) {
+			return fmt.Errorf("the database principal '%s' owns a schema in the database, and cannot be dropped", userName)
+		}
+		delete(d.users, userName)
+		d.dropMemberships(userName)
+		d.dropPermissions(userName)
+	}
+	return nil
+}
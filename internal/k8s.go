@@ -4,118 +4,149 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"net/http"
 	"regexp"
-	"time"
 
+	arcdatav1 "github.com/pplavetzki/azure-sql-mi/api/arcdata/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
+const (
+	DefaultUsernameKey = "username"
+	DefaultPasswordKey = "password"
+)
+
 type DatabaseKey struct {
 	DatabaseID string `json:"database-id"`
 }
 
-func QuerySQLManagedInstance(ctx context.Context, namespace, name string) (*SQLManagedInstance, error) {
+// CredentialsRef points at the secret (and the keys within it) holding a sql server login, the password
+// is read from the secret PasswordName when set
+type CredentialsRef struct {
+	Name         string
+	Namespace    string
+	UsernameKey  string
+	PasswordName string
+	PasswordKey  string
+}
+
+// SecretNames the names of the secrets referenced by ref
+func (ref CredentialsRef) SecretNames() []string {
+	if ref.PasswordName == "" || ref.PasswordName == ref.Name {
+		return []string{ref.Name}
+	}
+	return []string{ref.Name, ref.PasswordName}
+}
+
+// Credentials sql server login read from a CredentialsRef
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// QueryCredentials reads the username and password from the referenced secret, the keys default to
+// `username` and `password` when not set
+func QueryCredentials(ctx context.Context, c client.Reader, ref CredentialsRef) (*Credentials, error) {
 	_ = log.FromContext(ctx)
 	logger := log.Log
-	// uri := "http://localhost:8080/api"
-	uri := fmt.Sprintf("http://localhost:9090/apis/sql.arcdata.microsoft.com/v1/namespaces/%s/sqlmanagedinstances/%s", namespace, name)
-	logger.V(1).Info("uri of k8s api", "uri", uri)
 
-	k8sClient := http.Client{
-		Timeout: time.Second * 2, // Timeout after 2 seconds
+	usernameKey := ref.UsernameKey
+	if usernameKey == "" {
+		usernameKey = DefaultUsernameKey
 	}
-
-	req, err := http.NewRequest(http.MethodGet, uri, nil)
-	if err != nil {
-		return nil, err
+	passwordKey := ref.PasswordKey
+	if passwordKey == "" {
+		passwordKey = DefaultPasswordKey
 	}
+	logger.V(1).Info("reading credentials", "secret-name", ref.Name, "secret-namespace", ref.Namespace)
 
-	res, getErr := k8sClient.Do(req)
-	if getErr != nil {
+	sec := &corev1.Secret{}
+	if err := c.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: ref.Namespace}, sec); err != nil {
 		return nil, err
 	}
-
-	if res.Body != nil {
-		defer res.Body.Close()
+	username, ok := sec.Data[usernameKey]
+	if !ok {
+		return nil, fmt.Errorf("secret %s/%s does not contain key: %s", ref.Namespace, ref.Name, usernameKey)
 	}
-	body, readErr := ioutil.ReadAll(res.Body)
-	if readErr != nil {
-		return nil, readErr
+	if ref.PasswordName != "" && ref.PasswordName != ref.Name {
+		sec = &corev1.Secret{}
+		if err := c.Get(ctx, types.NamespacedName{Name: ref.PasswordName, Namespace: ref.Namespace}, sec); err != nil {
+			return nil, err
+		}
 	}
-	if res.StatusCode != 200 {
-		return nil, fmt.Errorf("failed to get sqlmanagedinstance: %s, error: %s", name, string(body))
+	password, ok := sec.Data[passwordKey]
+	if !ok {
+		return nil, fmt.Errorf("secret %s/%s does not contain key: %s", ref.Namespace, sec.Name, passwordKey)
 	}
+	return &Credentials{Username: string(username), Password: string(password)}, nil
+}
 
-	mi := &SQLManagedInstance{}
-	jsonErr := json.Unmarshal(body, mi)
-	if jsonErr != nil {
-		return nil, jsonErr
+// QuerySecretKey reads the value of the key of the secret
+func QuerySecretKey(ctx context.Context, c client.Reader, namespace, name, key string) (string, error) {
+	value, _, err := QuerySecretKeyVersion(ctx, c, namespace, name, key)
+	return value, err
+}
+
+// QuerySecretKeyVersion the value of the key of the secret along with the resourceVersion of the secret, the
+// version tells whether the value changed since it was last read
+func QuerySecretKeyVersion(ctx context.Context, c client.Reader, namespace, name, key string) (string, string, error) {
+	sec := &corev1.Secret{}
+	if err := c.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, sec); err != nil {
+		return "", "", err
+	}
+	value, ok := sec.Data[key]
+	if !ok {
+		return "", "", fmt.Errorf("secret %s/%s does not contain key: %s", namespace, name, key)
 	}
+	return string(value), sec.ResourceVersion, nil
+}
 
-	return mi, nil
+// ResolveCredentials reads the credentials from ref, falling back to the login of the sql managed instance
+// when ref is nil
+func ResolveCredentials(ctx context.Context, c client.Reader, ref *CredentialsRef, mi *arcdatav1.SQLManagedInstance) (*Credentials, error) {
+	if ref != nil {
+		return QueryCredentials(ctx, c, *ref)
+	}
+	secret := mi.LoginSecret()
+	return QueryCredentials(ctx, c, CredentialsRef{Name: secret.Name, Namespace: secret.Namespace})
 }
 
-func QueryJobPod(ctx context.Context, namespace, name string) (*string, error) {
+// QuerySQLManagedInstance reads the sql managed instance through the (cached) client
+func QuerySQLManagedInstance(ctx context.Context, c client.Reader, namespace, name string) (*arcdatav1.SQLManagedInstance, error) {
 	_ = log.FromContext(ctx)
-	dbreg := regexp.MustCompile(`{"database-id": "(.*)"}`)
-
 	logger := log.Log
-	// uri := "http://localhost:8080/api"
-	uri := fmt.Sprintf("http://localhost:9090/api/v1/namespaces/%s/pods?labelSelector=job-name=%s", namespace, name)
-	logger.V(1).Info("uri of k8s api", "uri", uri)
+	logger.V(1).Info("querying sql managed instance", "namespace", namespace, "name", name)
 
-	k8sClient := http.Client{
-		Timeout: time.Second * 2, // Timeout after 2 seconds
+	mi := &arcdatav1.SQLManagedInstance{}
+	if err := c.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, mi); err != nil {
+		return nil, fmt.Errorf("failed to get sqlmanagedinstance: %s, error: %w", name, err)
 	}
+	return mi, nil
+}
 
-	req, err := http.NewRequest(http.MethodGet, uri, nil)
-	if err != nil {
-		return nil, err
-	}
+// QueryJobPod reads the database id written to the log of the pod of the job
+func QueryJobPod(ctx context.Context, c client.Reader, clientset kubernetes.Interface, namespace, name string) (*string, error) {
+	_ = log.FromContext(ctx)
+	dbreg := regexp.MustCompile(`{"database-id": "(.*)"}`)
 
-	res, getErr := k8sClient.Do(req)
-	if getErr != nil {
-		return nil, err
-	}
+	logger := log.Log
+	logger.V(1).Info("querying pods of job", "namespace", namespace, "job-name", name)
 
-	if res.Body != nil {
-		defer res.Body.Close()
-	}
-	body, readErr := ioutil.ReadAll(res.Body)
-	if readErr != nil {
-		return nil, readErr
-	}
-	if res.StatusCode != 200 {
-		return nil, fmt.Errorf("failed to get log: %s, error: %s", name, string(body))
-	}
 	var pl corev1.PodList
-	jsonErr := json.Unmarshal(body, &pl)
-	if jsonErr != nil {
-		return nil, jsonErr
+	if err := c.List(ctx, &pl, client.InNamespace(namespace), client.MatchingLabels{"job-name": name}); err != nil {
+		return nil, err
+	}
+	if len(pl.Items) == 0 {
+		return nil, fmt.Errorf("failed to get log: %s, error: no pods found for job", name)
 	}
 	p := pl.Items[0]
 
-	uriPod := fmt.Sprintf("http://localhost:9090/api/v1/namespaces/%s/pods/%s/log?pretty", namespace, p.Name)
-	reqLog, err := http.NewRequest(http.MethodGet, uriPod, nil)
+	bodyLog, err := clientset.CoreV1().Pods(namespace).GetLogs(p.Name, &corev1.PodLogOptions{}).DoRaw(ctx)
 	if err != nil {
-		return nil, err
-	}
-	resLog, getErr := k8sClient.Do(reqLog)
-	if getErr != nil {
-		return nil, err
-	}
-	if resLog.Body != nil {
-		defer resLog.Body.Close()
-	}
-	bodyLog, readErr := ioutil.ReadAll(resLog.Body)
-	if readErr != nil {
-		return nil, readErr
-	}
-	if resLog.StatusCode != 200 {
-		return nil, fmt.Errorf("failed to get log: %s, error: %s", name, string(body))
+		return nil, fmt.Errorf("failed to get log: %s, error: %w", name, err)
 	}
 	dbbb := dbreg.Find(bodyLog)
 	dbbbbb := &DatabaseKey{}
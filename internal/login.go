@@ -0,0 +1,282 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// names of the login options compared by DiffLogin, they match the json names of the LoginSpec fields
+const (
+	OptionDefaultDatabase = "defaultDatabase"
+	OptionDefaultLanguage = "defaultLanguage"
+	OptionCheckPolicy     = "checkPolicy"
+	OptionCheckExpiration = "checkExpiration"
+	OptionPassword        = "password"
+)
+
+// LoginParams the options of a sql login, nil options are left as they are
+type LoginParams struct {
+	DefaultDatabase *string
+	DefaultLanguage *string
+	CheckPolicy     *bool
+	CheckExpiration *bool
+}
+
+// LoginState a sql login as selected from sys.sql_logins
+type LoginState struct {
+	Name        string `json:"name"`
+	PrincipalID int    `json:"principalID"`
+	// SID the security identifier as a hex string e.g. 0x5A3B...
+	SID             string `json:"sid"`
+	DefaultDatabase string `json:"defaultDatabase"`
+	DefaultLanguage string `json:"defaultLanguage"`
+	CheckPolicy     bool   `json:"checkPolicy"`
+	CheckExpiration bool   `json:"checkExpiration"`
+	IsDisabled      bool   `json:"isDisabled"`
+	CreateDate      string `json:"createDate"`
+	// PasswordMatches whether the password the state was selected with is the password of the login
+	PasswordMatches bool `json:"passwordMatches"`
+}
+
+// Created the create date of the login, like the create date of a database it has no time zone
+func (s *LoginState) Created() (time.Time, error) {
+	return time.ParseInLocation(CreateDateLayout, s.CreateDate, time.UTC)
+}
+
+type LoginSync struct {
+	Login []LoginState `json:"login"`
+}
+
+// LoginDiff the comparison of the options and the password of a sql login
+type LoginDiff struct {
+	Fields []FieldDiff `json:"fields"`
+
+	remediation *LoginParams
+	password    bool
+}
+
+// Drifted the options whose observed value differs from the desired value
+func (d *LoginDiff) Drifted() []FieldDiff {
+	drifted := []FieldDiff{}
+	for _, f := range d.Fields {
+		if f.Drifted {
+			drifted = append(drifted, f)
+		}
+	}
+	return drifted
+}
+
+// HasDrift whether any option or the password drifted
+func (d *LoginDiff) HasDrift() bool {
+	return len(d.Drifted()) > 0
+}
+
+// Remediation the desired values of the drifted options ready to be handed to AlterLogin, nil when no option
+// drifted
+func (d *LoginDiff) Remediation() *LoginParams {
+	return d.remediation
+}
+
+// PasswordDrifted whether the password of the login is not the desired password
+func (d *LoginDiff) PasswordDrifted() bool {
+	return d.password
+}
+
+// loginOption how a single option of a login is compared and remediated
+type loginOption struct {
+	field string
+	// desired the value of the params, empty when not set
+	desired   func(*LoginParams) string
+	observed  func(*LoginState) string
+	equal     func(desired, observed string) bool
+	remediate func(remediation, params *LoginParams)
+}
+
+// loginOptions every option of the LoginSpec that is compared with sys.sql_logins
+var loginOptions = []loginOption{
+	{
+		field:     OptionDefaultDatabase,
+		desired:   func(p *LoginParams) string { return SafeString(p.DefaultDatabase) },
+		observed:  func(s *LoginState) string { return s.DefaultDatabase },
+		equal:     strings.EqualFold,
+		remediate: func(r, p *LoginParams) { r.DefaultDatabase = p.DefaultDatabase },
+	},
+	{
+		field:     OptionDefaultLanguage,
+		desired:   func(p *LoginParams) string { return SafeString(p.DefaultLanguage) },
+		observed:  func(s *LoginState) string { return s.DefaultLanguage },
+		equal:     strings.EqualFold,
+		remediate: func(r, p *LoginParams) { r.DefaultLanguage = p.DefaultLanguage },
+	},
+	{
+		field:     OptionCheckPolicy,
+		desired:   func(p *LoginParams) string { return formatBool(p.CheckPolicy) },
+		observed:  func(s *LoginState) string { return strconv.FormatBool(s.CheckPolicy) },
+		equal:     boolEqual,
+		remediate: func(r, p *LoginParams) { r.CheckPolicy = p.CheckPolicy },
+	},
+	{
+		field:     OptionCheckExpiration,
+		desired:   func(p *LoginParams) string { return formatBool(p.CheckExpiration) },
+		observed:  func(s *LoginState) string { return strconv.FormatBool(s.CheckExpiration) },
+		equal:     boolEqual,
+		remediate: func(r, p *LoginParams) { r.CheckExpiration = p.CheckExpiration },
+	},
+}
+
+// DiffLogin compares the options set in params with the login, the password was compared by PWDCOMPARE when
+// the state was selected so the password field never holds a value
+func DiffLogin(params *LoginParams, state *LoginState) *LoginDiff {
+	if params == nil {
+		params = &LoginParams{}
+	}
+	diff := &LoginDiff{Fields: make([]FieldDiff, 0, len(loginOptions)+1)}
+	remediation := &LoginParams{}
+	remediate := false
+
+	for _, option := range loginOptions {
+		f := FieldDiff{
+			Field:      option.field,
+			Desired:    option.desired(params),
+			Observed:   option.observed(state),
+			Remediable: true,
+		}
+		f.Drifted = f.Desired != "" && !option.equal(f.Desired, f.Observed)
+		if f.Drifted {
+			option.remediate(remediation, params)
+			remediate = true
+		}
+		diff.Fields = append(diff.Fields, f)
+	}
+	diff.password = !state.PasswordMatches
+	diff.Fields = append(diff.Fields, FieldDiff{Field: OptionPassword, Drifted: diff.password, Remediable: true})
+
+	if remediate {
+		diff.remediation = remediation
+	}
+	return diff
+}
+
+// formatBool the value of b, empty when not set
+func formatBool(b *bool) string {
+	if b == nil {
+		return ""
+	}
+	return strconv.FormatBool(*b)
+}
+
+// LoginState the sql login as selected from sys.sql_logins, nil when it doesn't exist
+func (db *MSSql) LoginState(ctx context.Context, loginName, password string) (*LoginState, error) {
+	conn, err := db.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	query := LoginStateStatement(loginName, password)
+	var output string
+	if err = conn.QueryRowContext(ctx, query.SQL, query.Args...).Scan(&output); err != nil {
+		if strings.Contains(err.Error(), "sql: no rows in result set") {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var sync LoginSync
+	if err = json.Unmarshal([]byte(output), &sync); err != nil {
+		return nil, err
+	}
+	if len(sync.Login) == 0 {
+		return nil, nil
+	}
+	return &sync.Login[0], nil
+}
+
+// CreateLogin creates the sql login with the password and the options set in params
+func (db *MSSql) CreateLogin(ctx context.Context, loginName, password string, params *LoginParams) error {
+	_ = log.FromContext(ctx)
+	logger := log.Log
+
+	logger.Info("creating the login", "name", loginName)
+	conn, err := db.conn(ctx)
+	if err != nil {
+		return err
+	}
+	create, err := CreateLoginStatement(loginName, password, params)
+	if err != nil {
+		return err
+	}
+	_, err = conn.ExecContext(ctx, create.SQL, create.Args...)
+	return err
+}
+
+// AlterLogin applies every option set in params
+func (db *MSSql) AlterLogin(ctx context.Context, loginName string, params *LoginParams) error {
+	_ = log.FromContext(ctx)
+	logger := log.Log
+
+	logger.Info("altering the login", "name", loginName)
+	conn, err := db.conn(ctx)
+	if err != nil {
+		return err
+	}
+	altStatements, err := AlterLoginStatements(loginName, params)
+	if err != nil {
+		return err
+	}
+	for _, alter := range altStatements {
+		if _, err = conn.ExecContext(ctx, alter.SQL, alter.Args...); err != nil {
+			return fmt.Errorf("errors while running alter on login: %s: %w", loginName, err)
+		}
+	}
+	return nil
+}
+
+// AlterLoginPassword sets the password of the sql login
+func (db *MSSql) AlterLoginPassword(ctx context.Context, loginName, password string) error {
+	_ = log.FromContext(ctx)
+	logger := log.Log
+
+	logger.Info("changing the password of the login", "name", loginName)
+	conn, err := db.conn(ctx)
+	if err != nil {
+		return err
+	}
+	alter, err := AlterLoginPasswordStatement(loginName, password)
+	if err != nil {
+		return err
+	}
+	_, err = conn.ExecContext(ctx, alter.SQL, alter.Args...)
+	return err
+}
+
+// DeleteLogin drops the sql login if it exists
+func (db *MSSql) DeleteLogin(ctx context.Context, loginName string) error {
+	_ = log.FromContext(ctx)
+	logger := log.Log
+
+	logger.Info("deleting the login", "name", loginName)
+	conn, err := db.conn(ctx)
+	if err != nil {
+		return err
+	}
+	drop, err := DropLoginStatement(loginName)
+	if err != nil {
+		return err
+	}
+	var principalID sql.NullInt64
+	exists := LoginExistsStatement(loginName)
+	if err = conn.QueryRowContext(ctx, exists.SQL, exists.Args...).Scan(&principalID); err != nil {
+		return err
+	}
+	if !principalID.Valid {
+		logger.Info("login doesn't exist returning nil")
+		return nil
+	}
+	_, err = conn.ExecContext(ctx, drop.SQL, drop.Args...)
+	return err
+}
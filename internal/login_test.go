@@ -0,0 +1,73 @@
+package internal
+
+import "testing"
+
+func observedLogin() *LoginState {
+	return &LoginState{
+		Name:            "MyLogin",
+		DefaultDatabase: "master",
+		DefaultLanguage: "us_english",
+		CheckPolicy:     true,
+		PasswordMatches: true,
+	}
+}
+
+func TestDiffLoginInSync(t *testing.T) {
+	policy, expiration := true, false
+	diff := DiffLogin(&LoginParams{
+		DefaultDatabase: SetString("MASTER"),
+		CheckPolicy:     &policy,
+		CheckExpiration: &expiration,
+	}, observedLogin())
+
+	if diff.HasDrift() {
+		t.Errorf("expected no drift, got %+v", diff.Drifted())
+	}
+	if diff.Remediation() != nil {
+		t.Errorf("expected nothing to remediate, got %+v", diff.Remediation())
+	}
+	if len(diff.Fields) != len(loginOptions)+1 {
+		t.Errorf("expected a result for every option and the password, got %+v", diff.Fields)
+	}
+}
+
+func TestDiffLoginDrift(t *testing.T) {
+	policy, expiration := true, true
+	state := observedLogin()
+	state.PasswordMatches = false
+	diff := DiffLogin(&LoginParams{
+		DefaultDatabase: SetString("MyDb"),
+		CheckPolicy:     &policy,
+		CheckExpiration: &expiration,
+	}, state)
+
+	drifted := map[string]bool{}
+	for _, f := range diff.Drifted() {
+		drifted[f.Field] = true
+	}
+	for _, field := range []string{OptionDefaultDatabase, OptionCheckExpiration, OptionPassword} {
+		if !drifted[field] {
+			t.Errorf("expected %s to drift, got %+v", field, diff.Drifted())
+		}
+	}
+	if len(drifted) != 3 {
+		t.Errorf("expected three drifted fields, got %+v", diff.Drifted())
+	}
+	if !diff.PasswordDrifted() {
+		t.Error("expected the password to drift")
+	}
+	remediation := diff.Remediation()
+	if SafeString(remediation.DefaultDatabase) != "MyDb" || !SafeBool(remediation.CheckExpiration) ||
+		remediation.CheckPolicy != nil || remediation.DefaultLanguage != nil {
+		t.Errorf("unexpected remediation: %+v", remediation)
+	}
+}
+
+func TestDiffLoginPasswordOnly(t *testing.T) {
+	state := observedLogin()
+	state.PasswordMatches = false
+	diff := DiffLogin(nil, state)
+	if !diff.PasswordDrifted() || diff.Remediation() != nil {
+		t.Errorf("expected only the password to drift, got %+v", diff.Drifted())
+	}
+}
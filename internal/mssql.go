@@ -5,21 +5,13 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
-	"strconv"
 	"strings"
+	"time"
 
 	_ "github.com/denisenkom/go-mssqldb"
-	"github.com/go-logr/logr"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
-type SyncType string
-
-const (
-	Database = "Database"
-	State    = "State"
-)
-
 // MSSql interaction with sql server
 type MSSql struct {
 	Server   string `json:"server"`
@@ -27,7 +19,7 @@ type MSSql struct {
 	User     string `json:"user"`
 	Password string `json:"password"`
 
-	DB *sql.DB
+	connections *ConnectionManager
 }
 
 type DatabaseParams struct {
@@ -45,29 +37,51 @@ type AlterParams struct {
 	CompatibilityLevel         *int
 }
 
-// NewMSSql contructor pattern
-func NewMSSql(server, user, password string, port int) *MSSql {
+// NewMSSql contructor pattern, connections are taken from the shared pools of the connection manager
+func NewMSSql(server, user, password string, port int, connections *ConnectionManager) *MSSql {
 	return &MSSql{
-		Server:   server,
-		Port:     port,
-		User:     user,
-		Password: password,
+		Server:      server,
+		Port:        port,
+		User:        user,
+		Password:    password,
+		connections: connections,
 	}
 }
 
+// conn the pooled connection of the login, the handle is shared and must not be closed
+func (db *MSSql) conn(ctx context.Context) (*sql.DB, error) {
+	return db.connections.DB(ctx, db.Server, db.Port, db.User, db.Password)
+}
+
+// DatabaseState settings of a database as selected from sys.databases
+type DatabaseState struct {
+	Name                       string `json:"name"`
+	State                      int    `json:"state"`
+	StateDesc                  string `json:"stateDesc"`
+	IsReadOnly                 bool   `json:"isReadOnly"`
+	UserAccess                 int    `json:"userAccess"`
+	CreateDate                 string `json:"createDate"`
+	CompatibilityLevel         int    `json:"compatibilityLevel"`
+	Collation                  string `json:"collation"`
+	AllowSnapshotIsolation     string `json:"allowSnapshotIsolation"`
+	AllowReadCommittedSnapshot string `json:"allowReadCommittedSnapshot"`
+	Parameterization           string `json:"parameterization"`
+	RecoveryModel              string `json:"recoveryModel"`
+	DataSizeBytes              int64  `json:"dataSizeBytes"`
+	LogSizeBytes               int64  `json:"logSizeBytes"`
+}
+
+// CreateDateLayout layout of the create date as formatted by FOR JSON
+const CreateDateLayout = "2006-01-02T15:04:05.999999999"
+
+// Created the create date of the database, sql server returns it without a time zone and the managed
+// instances run in UTC
+func (s *DatabaseState) Created() (time.Time, error) {
+	return time.ParseInLocation(CreateDateLayout, s.CreateDate, time.UTC)
+}
+
 type DatabaseSync struct {
-	Database []struct {
-		Name                       string `json:"name"`
-		State                      int    `json:"state"`
-		IsReadOnly                 bool   `json:"isReadOnly"`
-		UserAccess                 int    `json:"userAccess"`
-		CreateDate                 string `json:"createDate"`
-		CompatibilityLevel         int    `json:"compatibilityLevel"`
-		Collation                  string `json:"collation"`
-		AllowSnapshotIsolation     string `json:"allowSnapshotIsolation"`
-		AllowReadCommittedSnapshot string `json:"allowReadCommittedSnapshot"`
-		Parameterization           string `json:"parameterization"`
-	} `json:"database"`
+	Database []DatabaseState `json:"database"`
 }
 
 type DatabaseConfig struct {
@@ -83,26 +97,13 @@ type DatabaseConfig struct {
 	Parameterization           string
 }
 
-type SyncResponse struct {
-	CompatibilityLevel         *int
-	AllowSnapshotIsolation     *bool
-	Parameterization           *string
-	AllowReadCommittedSnapshot *bool
-}
-
-func (db *MSSql) SyncNeeded(ctx context.Context, params *DatabaseConfig, syncType SyncType) (*SyncResponse, error) {
+// SyncNeeded compares the desired settings with sys.databases, nil when the database doesn't exist
+func (db *MSSql) SyncNeeded(ctx context.Context, params *DatabaseConfig) (*DatabaseDiff, error) {
 	_ = log.FromContext(ctx)
 	logger := log.Log
 
 	logger.V(1).Info("determine syncing", "sync-params", params)
 
-	syncResponse := &SyncResponse{}
-
-	// Build connection string
-	connString := fmt.Sprintf("server=%s;user id=%s;password=%s;port=%d", db.Server, db.User, db.Password, db.Port)
-
-	var err error
-
 	if params.DatabaseID != "" {
 		dn, err := db.FindDatabaseName(ctx, params.DatabaseID)
 		if err != nil {
@@ -116,36 +117,27 @@ func (db *MSSql) SyncNeeded(ctx context.Context, params *DatabaseConfig, syncTyp
 		}
 	}
 
-	// Create connection pool
-	db.DB, err = sql.Open("sqlserver", connString)
-	if err != nil {
+	state, err := db.DatabaseState(ctx, params.DatabaseName)
+	if err != nil || state == nil {
 		return nil, err
 	}
-	err = db.DB.Ping()
+	return Diff(params, state), nil
+}
+
+// DatabaseState the settings of the database as selected from sys.databases, nil when it doesn't exist
+func (db *MSSql) DatabaseState(ctx context.Context, databaseName string) (*DatabaseState, error) {
+	conn, err := db.conn(ctx)
 	if err != nil {
 		return nil, err
 	}
-	sqlStmt := "SELECT [name], " +
-		"[state], " +
-		"[is_read_only] as [isReadOnly], " +
-		"[user_access] as [userAccess], " +
-		"[create_date] as [createDate], " +
-		"[compatibility_level] as [compatibilityLevel], " +
-		"[collation_name] as [collation], " +
-		"IIF(snapshot_isolation_state = 1 or snapshot_isolation_state = 3, 'true', 'false') as [allowSnapshotIsolation], " +
-		"IIF(is_read_committed_snapshot_on = 1, 'true', 'false') as [allowReadCommittedSnapshot], " +
-		"IIF(is_parameterization_forced = 0, 'simple', 'forced' ) as [parameterization] " +
-		"FROM sys.databases " +
-		"WHERE [name] = '%s' " +
-		"FOR JSON PATH, ROOT ('database')"
-
-	stmt, err := db.DB.Prepare(fmt.Sprintf(sqlStmt, params.DatabaseName))
+	query := DatabaseStateStatement(databaseName)
+	stmt, err := conn.PrepareContext(ctx, query.SQL)
 	if err != nil {
 		return nil, err
 	}
 	defer stmt.Close()
 
-	row := stmt.QueryRow()
+	row := stmt.QueryRowContext(ctx, query.Args...)
 	var output string
 	err = row.Scan(&output)
 	// sql: no rows in result set
@@ -161,47 +153,10 @@ func (db *MSSql) SyncNeeded(ctx context.Context, params *DatabaseConfig, syncTyp
 		return nil, err
 	}
 
-	/***************************************************************************************************************************
-	* Perform the validation for syncing logic
-	***************************************************************************************************************************/
-	// allowReadCommittedSnapshot, _ := strconv.ParseBool(sync.Database[0].AllowReadCommittedSnapshot)
-	allowSnapshotIsolation, _ := strconv.ParseBool(sync.Database[0].AllowSnapshotIsolation)
-	requireSync := false
-
-	// if params.AllowReadCommittedSnapshot != allowReadCommittedSnapshot {
-	// 	syncResponse.AllowReadCommittedSnapshot = &params.AllowReadCommittedSnapshot
-	// 	requireSync = true
-	// }
-	if params.AllowSnapshotIsolation != allowSnapshotIsolation {
-		if syncType == State {
-			syncResponse.AllowSnapshotIsolation = &params.AllowSnapshotIsolation
-		} else {
-			syncResponse.AllowSnapshotIsolation = &allowSnapshotIsolation
-		}
-		requireSync = true
+	if len(sync.Database) == 0 {
+		return nil, nil
 	}
-	if params.CompatibilityLevel != sync.Database[0].CompatibilityLevel {
-		if syncType == State {
-			syncResponse.CompatibilityLevel = &params.CompatibilityLevel
-		} else {
-			syncResponse.CompatibilityLevel = &sync.Database[0].CompatibilityLevel
-		}
-		requireSync = true
-	}
-	if params.Parameterization != sync.Database[0].Parameterization {
-		if syncType == State {
-			syncResponse.Parameterization = &params.Parameterization
-		} else {
-			syncResponse.Parameterization = &sync.Database[0].Parameterization
-		}
-		requireSync = true
-	}
-	/**************************************************************************************************************************/
-	if requireSync {
-		return syncResponse, nil
-	}
-
-	return nil, nil
+	return &sync.Database[0], nil
 }
 
 // FindDatabaseID finds the db id
@@ -210,29 +165,18 @@ func (db *MSSql) FindDatabaseID(ctx context.Context, databaseName string) (*stri
 	logger := log.Log
 
 	logger.Info("finding the database if it exists by Name", "name", databaseName)
-	// Build connection string
-	connString := fmt.Sprintf("server=%s;user id=%s;password=%s;port=%d", db.Server, db.User, db.Password, db.Port)
-
-	var err error
-
-	// Create connection pool
-	db.DB, err = sql.Open("sqlserver", connString)
-	if err != nil {
-		return nil, err
-	}
-	err = db.DB.Ping()
+	conn, err := db.conn(ctx)
 	if err != nil {
 		return nil, err
 	}
-	sqlStmt := "SELECT CAST(recovery_fork_guid AS char(36)) as recovery_fork_guid FROM sys.database_recovery_status drs JOIN sys.databases dbs ON drs.database_id = dbs.database_id WHERE dbs.[name] = '%s'"
-
-	stmt, err := db.DB.Prepare(fmt.Sprintf(sqlStmt, databaseName))
+	query := DatabaseIDStatement(databaseName)
+	stmt, err := conn.PrepareContext(ctx, query.SQL)
 	if err != nil {
 		return nil, err
 	}
 	defer stmt.Close()
 
-	row := stmt.QueryRow()
+	row := stmt.QueryRowContext(ctx, query.Args...)
 	var id string
 	err = row.Scan(&id)
 	// sql: no rows in result set
@@ -251,29 +195,18 @@ func (db *MSSql) FindDatabaseName(ctx context.Context, id string) (*string, erro
 	logger := log.Log
 
 	logger.Info("finding the database if it exists by ID", "id", id)
-	// Build connection string
-	connString := fmt.Sprintf("server=%s;user id=%s;password=%s;port=%d", db.Server, db.User, db.Password, db.Port)
-
-	var err error
-
-	// Create connection pool
-	db.DB, err = sql.Open("sqlserver", connString)
+	conn, err := db.conn(ctx)
 	if err != nil {
 		return nil, err
 	}
-	err = db.DB.Ping()
-	if err != nil {
-		return nil, err
-	}
-	sqlStmt := "select dbs.[name] FROM sys.database_recovery_status drs JOIN sys.databases dbs ON drs.database_id = dbs.database_id where drs.recovery_fork_guid = '%s'"
-
-	stmt, err := db.DB.Prepare(fmt.Sprintf(sqlStmt, id))
+	query := DatabaseNameStatement(id)
+	stmt, err := conn.PrepareContext(ctx, query.SQL)
 	if err != nil {
 		return nil, err
 	}
 	defer stmt.Close()
 
-	row := stmt.QueryRow()
+	row := stmt.QueryRowContext(ctx, query.Args...)
 	var name string
 	err = row.Scan(&name)
 	if err != nil {
@@ -290,35 +223,24 @@ func (db *MSSql) DeleteDatabase(ctx context.Context, databaseName string) error
 	logger := log.Log
 
 	logger.Info("deleting the database", "name", databaseName)
-	// Build connection string
-	connString := fmt.Sprintf("server=%s;user id=%s;password=%s;port=%d", db.Server, db.User, db.Password, db.Port)
-
-	var err error
-
-	// Create connection pool
-	db.DB, err = sql.Open("sqlserver", connString)
+	conn, err := db.conn(ctx)
 	if err != nil {
 		return err
 	}
-	defer db.DB.Close()
-	err = db.DB.Ping()
+	drop, err := DropDatabaseStatement(databaseName)
 	if err != nil {
 		return err
 	}
-	var dbID int64
-	result, err := db.DB.Query(fmt.Sprintf("SELECT DB_ID(N'%s') AS [ID];", databaseName))
-	if err != nil {
+	var dbID sql.NullInt64
+	exists := DatabaseExistsStatement(databaseName)
+	if err = conn.QueryRowContext(ctx, exists.SQL, exists.Args...).Scan(&dbID); err != nil {
 		return err
 	}
-	defer result.Close()
-	result.Next()
 
-	if err = result.Scan(&dbID); err == nil {
-		rows, err := db.DB.Query(fmt.Sprintf("DROP DATABASE %s;", databaseName))
-		if err != nil {
+	if dbID.Valid {
+		if _, err = conn.ExecContext(ctx, drop.SQL, drop.Args...); err != nil {
 			return err
 		}
-		defer rows.Close()
 	} else {
 		logger.Info("database doesn't exist returning nil")
 	}
@@ -326,32 +248,56 @@ func (db *MSSql) DeleteDatabase(ctx context.Context, databaseName string) error
 	return nil
 }
 
-func (db *MSSql) CreateDatabase(ctx context.Context, databaseName string, params *DatabaseParams) (*string, error) {
+// RenameDatabase renames the database, the recovery_fork_guid is kept
+func (db *MSSql) RenameDatabase(ctx context.Context, databaseName, newName string) error {
 	_ = log.FromContext(ctx)
 	logger := log.Log
 
-	logger.Info("creating the database", "name", databaseName)
-	// Build connection string
-	connString := fmt.Sprintf("server=%s;user id=%s;password=%s;port=%d", db.Server, db.User, db.Password, db.Port)
+	logger.Info("renaming the database", "name", databaseName, "new-name", newName)
+	conn, err := db.conn(ctx)
+	if err != nil {
+		return err
+	}
+	rename, err := RenameDatabaseStatement(databaseName, newName)
+	if err != nil {
+		return err
+	}
+	_, err = conn.ExecContext(ctx, rename.SQL, rename.Args...)
+	return err
+}
 
-	var err error
+// BackupDatabase takes a COPY_ONLY backup of the database to the path on the sql server
+func (db *MSSql) BackupDatabase(ctx context.Context, databaseName, path string) error {
+	_ = log.FromContext(ctx)
+	logger := log.Log
 
-	// Create connection pool
-	db.DB, err = sql.Open("sqlserver", connString)
+	logger.Info("backing up the database", "name", databaseName, "path", path)
+	conn, err := db.conn(ctx)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	backup, err := BackupDatabaseStatement(databaseName, path)
+	if err != nil {
+		return err
 	}
-	defer db.DB.Close()
-	err = db.DB.Ping()
+	_, err = conn.ExecContext(ctx, backup.SQL, backup.Args...)
+	return err
+}
+
+func (db *MSSql) CreateDatabase(ctx context.Context, databaseName string, params *DatabaseParams) (*string, error) {
+	_ = log.FromContext(ctx)
+	logger := log.Log
+
+	logger.Info("creating the database", "name", databaseName)
+	conn, err := db.conn(ctx)
 	if err != nil {
 		return nil, err
 	}
-	_, err = db.DB.Exec(buildDatabaseSQL("CREATE", databaseName, params))
+	create, err := CreateDatabaseStatement(databaseName, params)
 	if err != nil {
 		return nil, err
 	}
-	// now we need to alter database with params
-	if err = executeAlterCommands(db.DB, logger, databaseName, params); err != nil {
+	if _, err = conn.ExecContext(ctx, create.SQL, create.Args...); err != nil {
 		return nil, err
 	}
 	return db.FindDatabaseID(ctx, databaseName)
@@ -362,39 +308,23 @@ func (db *MSSql) AlterDatabase(ctx context.Context, databaseName string, params
 	logger := log.Log
 
 	logger.Info("altering the database", "name", databaseName)
-	// Build connection string
-	connString := fmt.Sprintf("server=%s;user id=%s;password=%s;port=%d", db.Server, db.User, db.Password, db.Port)
-
-	var err error
-
-	// Create connection pool
-	db.DB, err = sql.Open("sqlserver", connString)
-	if err != nil {
-		return err
-	}
-	defer db.DB.Close()
-	err = db.DB.Ping()
+	conn, err := db.conn(ctx)
 	if err != nil {
 		return err
 	}
 
-	return executeAlterCommands(db.DB, logger, databaseName, params)
+	return executeAlterCommands(ctx, conn, databaseName, params)
 }
 
-func executeAlterCommands(db *sql.DB, logger logr.Logger, databaseName string, params *DatabaseParams) error {
-	altStatements := buildAlterSQL(databaseName, params)
-	errors := []error{}
-	if len(altStatements) > 0 {
-		for _, alter := range altStatements {
-			_, err := db.Exec(alter)
-			if err != nil {
-				logger.V(0).Info(err.Error())
-				errors = append(errors, err)
-			}
-		}
+func executeAlterCommands(ctx context.Context, db *sql.DB, databaseName string, params *DatabaseParams) error {
+	altStatements, err := AlterDatabaseStatements(databaseName, params)
+	if err != nil {
+		return err
 	}
-	if len(errors) > 0 {
-		return fmt.Errorf("errors while running alter on database: %s", databaseName)
+	for _, alter := range altStatements {
+		if _, err = db.ExecContext(ctx, alter.SQL, alter.Args...); err != nil {
+			return fmt.Errorf("errors while running alter on database: %s: %w", databaseName, err)
+		}
 	}
 	return nil
 }
@@ -406,36 +336,3 @@ func onOff(value bool) string {
 		return "OFF"
 	}
 }
-
-func buildAlterSQL(databaseName string, params *DatabaseParams) []string {
-	altStatements := []string{}
-	altTemplate := fmt.Sprintf("Alter DATABASE %s ", databaseName)
-
-	if params.Parameterization != nil && *params.Parameterization != "" {
-		altStatements = append(altStatements, fmt.Sprintf("%s SET PARAMETERIZATION %s;", altTemplate, *params.Parameterization))
-	}
-	// if params.AllowReadCommittedSnapshot != nil {
-	// 	altStatements = append(altStatements, fmt.Sprintf("%s SET READ_COMMITTED_SNAPSHOT %s;", altTemplate, onOff(*params.AllowReadCommittedSnapshot)))
-	// }
-	if params.AllowSnapshotIsolation != nil {
-		altStatements = append(altStatements, fmt.Sprintf("%s SET ALLOW_SNAPSHOT_ISOLATION %s;", altTemplate, onOff(*params.AllowSnapshotIsolation)))
-	}
-	if params.CompatibilityLevel != nil {
-		altStatements = append(altStatements, fmt.Sprintf("%s SET COMPATIBILITY_LEVEL = %d;", altTemplate, *params.CompatibilityLevel))
-	}
-	return altStatements
-}
-
-func buildDatabaseSQL(verb string, databaseName string, params *DatabaseParams) string {
-	var b strings.Builder
-	var count int8 = 0
-
-	fmt.Fprintf(&b, "%s DATABASE %s ", verb, databaseName)
-
-	if params.Collation != nil {
-		fmt.Fprintf(&b, "Collate %s", SafeString(params.Collation))
-		count++
-	}
-
-	return b.String()
-}
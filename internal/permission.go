@@ -0,0 +1,211 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// PermissionClassDatabase sys.database_permissions.class_desc of a permission on the database itself
+	PermissionClassDatabase = "DATABASE"
+	// PermissionClassSchema sys.database_permissions.class_desc of a permission on a schema
+	PermissionClassSchema = "SCHEMA"
+	// PermissionClassObject sys.database_permissions.class_desc of a permission on a table, view or procedure
+	PermissionClassObject = "OBJECT_OR_COLUMN"
+
+	// PermissionStateGrant sys.database_permissions.state_desc of a GRANT
+	PermissionStateGrant = "GRANT"
+	// PermissionStateGrantWithGrantOption sys.database_permissions.state_desc of a GRANT ... WITH GRANT OPTION
+	PermissionStateGrantWithGrantOption = "GRANT_WITH_GRANT_OPTION"
+	// PermissionStateDeny sys.database_permissions.state_desc of a DENY
+	PermissionStateDeny = "DENY"
+)
+
+// Permission a row of sys.database_permissions on the database, a schema or an object, a principal has at most one
+// state per permission and securable
+type Permission struct {
+	// Principal the name of the grantee
+	Principal string `json:"principal"`
+	// Class the class_desc of the securable
+	Class string `json:"class"`
+	// Schema the schema of the securable, or the schema of the object
+	Schema string `json:"schema,omitempty"`
+	// Object the name of the object of an OBJECT_OR_COLUMN permission
+	Object     string `json:"object,omitempty"`
+	Permission string `json:"permission"`
+	State      string `json:"state"`
+}
+
+// Key identifies the row of the permission regardless of its state, names are compared like the collation of a
+// database usually does, case insensitive
+func (p *Permission) Key() string {
+	return strings.ToLower(strings.Join([]string{p.Principal, p.Class, p.Schema, p.Object, p.Permission}, "|"))
+}
+
+// Securable the securable of the permission as written after ON, empty for the database
+func (p *Permission) Securable() string {
+	switch p.Class {
+	case PermissionClassSchema:
+		return fmt.Sprintf("SCHEMA::%s", p.Schema)
+	case PermissionClassObject:
+		return fmt.Sprintf("OBJECT::%s.%s", p.Schema, p.Object)
+	}
+	return ""
+}
+
+func (p *Permission) String() string {
+	s := fmt.Sprintf("%s %s", p.State, p.Permission)
+	if securable := p.Securable(); securable != "" {
+		s += " ON " + securable
+	}
+	return s + " TO " + p.Principal
+}
+
+type PermissionSync struct {
+	Permission []Permission `json:"permission"`
+}
+
+// PermissionChange a permission to apply, the observed row is nil when the principal has no state for the
+// permission and the desired row is nil when the observed row is revoked
+type PermissionChange struct {
+	Desired  *Permission `json:"desired,omitempty"`
+	Observed *Permission `json:"observed,omitempty"`
+}
+
+// PermissionDiff the comparison of the declared permissions of a principal with its rows of
+// sys.database_permissions
+type PermissionDiff struct {
+	// Changes the permissions to grant, deny or revoke
+	Changes []PermissionChange `json:"changes,omitempty"`
+	// Unmanaged the rows that are neither declared nor owned, they are left alone
+	Unmanaged []Permission `json:"unmanaged,omitempty"`
+}
+
+// HasDrift whether a permission has to be applied
+func (d *PermissionDiff) HasDrift() bool {
+	return len(d.Changes) > 0
+}
+
+// permissionsByKey indexes the permissions by Key
+func permissionsByKey(permissions []Permission) map[string]*Permission {
+	byKey := make(map[string]*Permission, len(permissions))
+	for i := range permissions {
+		byKey[permissions[i].Key()] = &permissions[i]
+	}
+	return byKey
+}
+
+// SortPermissions sorts the permissions by principal, securable and permission
+func SortPermissions(permissions []Permission) {
+	sort.Slice(permissions, func(i, j int) bool {
+		return permissions[i].Key() < permissions[j].Key()
+	})
+}
+
+// DiffPermissions compares the desired permissions with the observed rows: a desired permission is applied when
+// its row is missing or in another state, and an owned permission that is no longer desired is revoked. Observed
+// rows that are neither desired nor owned were granted by someone else and are only reported as unmanaged
+func DiffPermissions(desired, observed, owned []Permission) *PermissionDiff {
+	diff := &PermissionDiff{}
+	observedByKey := permissionsByKey(observed)
+	desiredByKey := permissionsByKey(desired)
+	ownedByKey := permissionsByKey(owned)
+	for i := range desired {
+		d := &desired[i]
+		o := observedByKey[d.Key()]
+		if o == nil || o.State != d.State {
+			diff.Changes = append(diff.Changes, PermissionChange{Desired: d, Observed: o})
+		}
+	}
+	for i := range observed {
+		o := &observed[i]
+		if desiredByKey[o.Key()] != nil {
+			continue
+		}
+		if ownedByKey[o.Key()] != nil {
+			diff.Changes = append(diff.Changes, PermissionChange{Observed: o})
+			continue
+		}
+		diff.Unmanaged = append(diff.Unmanaged, *o)
+	}
+	return diff
+}
+
+// ManualPermissions the observed rows not matching a declared permission in its state, the CONNECT every user is
+// granted by CREATE USER is left out
+func ManualPermissions(observed, declared []Permission) []Permission {
+	declaredByKey := permissionsByKey(declared)
+	var manual []Permission
+	for _, o := range observed {
+		if o.Class == PermissionClassDatabase && strings.EqualFold(o.Permission, "CONNECT") && o.State == PermissionStateGrant {
+			continue
+		}
+		if d := declaredByKey[o.Key()]; d != nil && d.State == o.State {
+			continue
+		}
+		manual = append(manual, o)
+	}
+	return manual
+}
+
+// Permissions the rows of sys.database_permissions of the principal on the database, its schemas and its objects,
+// the rows of every principal but the built-in ones and the fixed roles when principalName is empty
+func (db *MSSql) Permissions(ctx context.Context, databaseName, principalName string) ([]Permission, error) {
+	conn, err := db.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	query, err := PermissionsStatement(databaseName, principalName)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn.QueryContext(ctx, query.SQL, query.Args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	// a large FOR JSON result is split over several rows
+	var output strings.Builder
+	for rows.Next() {
+		var chunk string
+		if err = rows.Scan(&chunk); err != nil {
+			return nil, err
+		}
+		output.WriteString(chunk)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if output.Len() == 0 {
+		return nil, nil
+	}
+	var sync PermissionSync
+	if err = json.Unmarshal([]byte(output.String()), &sync); err != nil {
+		return nil, err
+	}
+	SortPermissions(sync.Permission)
+	return sync.Permission, nil
+}
+
+// ApplyPermission grants, denies or revokes the permission so its row goes from observed to desired
+func (db *MSSql) ApplyPermission(ctx context.Context, databaseName string, desired, observed *Permission) error {
+	_ = log.FromContext(ctx)
+	logger := log.Log
+
+	conn, err := db.conn(ctx)
+	if err != nil {
+		return err
+	}
+	apply, err := ApplyPermissionStatement(databaseName, desired, observed)
+	if err != nil {
+		return err
+	}
+	logger.Info("applying the permission", "database", databaseName, "statement", apply.SQL)
+	_, err = conn.ExecContext(ctx, apply.SQL, apply.Args...)
+	return err
+}
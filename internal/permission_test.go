@@ -0,0 +1,49 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffPermissions(t *testing.T) {
+	selectSales := Permission{Principal: "app", Class: PermissionClassSchema, Schema: "sales", Permission: "SELECT", State: PermissionStateGrant}
+	deleteSales := Permission{Principal: "app", Class: PermissionClassSchema, Schema: "sales", Permission: "DELETE", State: PermissionStateDeny}
+	execute := Permission{Principal: "app", Class: PermissionClassDatabase, Permission: "EXECUTE", State: PermissionStateGrant}
+	connect := Permission{Principal: "app", Class: PermissionClassDatabase, Permission: "CONNECT", State: PermissionStateGrant}
+
+	observedDelete := deleteSales
+	observedDelete.State = PermissionStateGrant
+	observedSelect := selectSales
+	observedSelect.Schema = "Sales"
+	diff := DiffPermissions(
+		[]Permission{selectSales, deleteSales},
+		[]Permission{observedSelect, observedDelete, execute, connect},
+		[]Permission{execute})
+
+	expected := []PermissionChange{{Desired: &deleteSales, Observed: &observedDelete}, {Observed: &execute}}
+	if !diff.HasDrift() || !reflect.DeepEqual(diff.Changes, expected) {
+		t.Errorf("expected the DENY to replace the GRANT and the owned EXECUTE to be revoked, got %+v", diff.Changes)
+	}
+	if !reflect.DeepEqual(diff.Unmanaged, []Permission{connect}) {
+		t.Errorf("expected the CONNECT to be left alone, got %+v", diff.Unmanaged)
+	}
+	if diff = DiffPermissions([]Permission{execute}, []Permission{execute}, []Permission{execute}); diff.HasDrift() {
+		t.Errorf("expected no drift, got %+v", diff)
+	}
+}
+
+func TestManualPermissions(t *testing.T) {
+	applied := Permission{Principal: "app", Class: PermissionClassSchema, Schema: "sales", Permission: "SELECT", State: PermissionStateGrant}
+	connect := Permission{Principal: "reporting", Class: PermissionClassDatabase, Permission: "CONNECT", State: PermissionStateGrant}
+	grant := Permission{Principal: "reporting", Class: PermissionClassDatabase, Permission: "SELECT", State: PermissionStateGrant}
+	denied := applied
+	denied.State = PermissionStateDeny
+
+	manual := ManualPermissions([]Permission{applied, connect, grant}, []Permission{applied})
+	if !reflect.DeepEqual(manual, []Permission{grant}) {
+		t.Errorf("expected only the manual SELECT, got %+v", manual)
+	}
+	if manual = ManualPermissions([]Permission{denied}, []Permission{applied}); len(manual) != 1 {
+		t.Errorf("expected a permission changed by hand to be flagged, got %+v", manual)
+	}
+}
@@ -0,0 +1,155 @@
+package internal
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// PoolOptions limits of the connection pool kept per sql server login
+type PoolOptions struct {
+	// MaxOpenConns maximum number of open connections, <= 0 means unlimited
+	MaxOpenConns int
+	// MaxIdleConns maximum number of idle connections, <= 0 means no idle connections are kept
+	MaxIdleConns int
+	// ConnMaxLifetime maximum amount of time a connection may be reused, <= 0 means forever
+	ConnMaxLifetime time.Duration
+	// ConnMaxIdleTime maximum amount of time a connection may be idle, <= 0 means forever
+	ConnMaxIdleTime time.Duration
+}
+
+// DefaultPoolOptions pool limits used when none are configured
+var DefaultPoolOptions = PoolOptions{
+	MaxOpenConns:    10,
+	MaxIdleConns:    2,
+	ConnMaxLifetime: 30 * time.Minute,
+	ConnMaxIdleTime: 5 * time.Minute,
+}
+
+// connectionKey identifies a pool, the fingerprint of the password is part of the key so the logins sharing a
+// user with different passwords, e.g. while a password is rotated, each get their own pool
+type connectionKey struct {
+	server      string
+	port        int
+	user        string
+	fingerprint [sha256.Size]byte
+}
+
+// sameLogin whether the keys are of the same login, whatever its password
+func (k connectionKey) sameLogin(other connectionKey) bool {
+	return k.server == other.server && k.port == other.port && k.user == other.user
+}
+
+// stalePoolAge how long the pool of another password of a login is kept after it was last handed out, it is
+// closed once no connection of it is in use either
+const stalePoolAge = 5 * time.Minute
+
+type pooledDB struct {
+	db *sql.DB
+	// lastUsed when the pool was last handed out
+	lastUsed time.Time
+}
+
+// ConnectionManager hands out pooled *sql.DB handles keyed by server, port, login and password. It is safe for
+// concurrent use and is meant to be shared by every reconcile of the process.
+type ConnectionManager struct {
+	options PoolOptions
+	open    func(driverName, dataSourceName string) (*sql.DB, error)
+	now     func() time.Time
+
+	mu    sync.Mutex
+	pools map[connectionKey]*pooledDB
+}
+
+// NewConnectionManager contructor pattern
+func NewConnectionManager(options PoolOptions) *ConnectionManager {
+	return &ConnectionManager{
+		options: options,
+		open:    sql.Open,
+		now:     time.Now,
+		pools:   map[connectionKey]*pooledDB{},
+	}
+}
+
+// DB returns the pool of the login and password, the pools of the other passwords of the login are closed once
+// they are no longer used as the credentials were rotated
+func (m *ConnectionManager) DB(ctx context.Context, server string, port int, user, password string) (*sql.DB, error) {
+	db, err := m.pool(server, port, user, password)
+	if err != nil {
+		return nil, err
+	}
+	if err = db.PingContext(ctx); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+func (m *ConnectionManager) pool(server string, port int, user, password string) (*sql.DB, error) {
+	key := connectionKey{server: server, port: port, user: user, fingerprint: sha256.Sum256([]byte(password))}
+	now := m.now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.closeStale(key, now)
+	if p, ok := m.pools[key]; ok {
+		p.lastUsed = now
+		return p.db, nil
+	}
+
+	db, err := m.open("sqlserver", connectionString(server, port, user, password))
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(m.options.MaxOpenConns)
+	db.SetMaxIdleConns(m.options.MaxIdleConns)
+	db.SetConnMaxLifetime(m.options.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(m.options.ConnMaxIdleTime)
+
+	m.pools[key] = &pooledDB{db: db, lastUsed: now}
+	return db, nil
+}
+
+// closeStale closes the pools of the other passwords of the login of key that were not handed out for stalePoolAge
+// and have no connection in use, a reconcile still holding the handle of an older password is left to finish
+func (m *ConnectionManager) closeStale(key connectionKey, now time.Time) {
+	for k, p := range m.pools {
+		if k == key || !k.sameLogin(key) || now.Sub(p.lastUsed) < stalePoolAge || p.db.Stats().InUse > 0 {
+			continue
+		}
+		p.db.Close()
+		delete(m.pools, k)
+	}
+}
+
+// Close closes every pool
+func (m *ConnectionManager) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var firstErr error
+	for key, p := range m.pools {
+		if err := p.db.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(m.pools, key)
+	}
+	return firstErr
+}
+
+// connectionString builds the url form of the connection string so the credentials are escaped
+func connectionString(server string, port int, user, password string) string {
+	u := &url.URL{
+		Scheme: "sqlserver",
+		User:   url.UserPassword(user, password),
+		Host:   server,
+	}
+	if port != 0 {
+		u.Host = fmt.Sprintf("%s:%d", server, port)
+	}
+	return u.String()
+}
@@ -0,0 +1,86 @@
+package internal
+
+import "context"
+
+// Provider the sql server operations the controllers and the sync job depend on
+type Provider interface {
+	// CreateDatabase creates the database with the collation of params and returns its recovery_fork_guid, the
+	// other options are applied with AlterDatabase
+	CreateDatabase(ctx context.Context, databaseName string, params *DatabaseParams) (*string, error)
+	// AlterDatabase applies every option set in params
+	AlterDatabase(ctx context.Context, databaseName string, params *DatabaseParams) error
+	// FindDatabaseID the recovery_fork_guid of the database, nil when it doesn't exist
+	FindDatabaseID(ctx context.Context, databaseName string) (*string, error)
+	// FindDatabaseName the name of the database with the recovery_fork_guid, nil when it doesn't exist
+	FindDatabaseName(ctx context.Context, id string) (*string, error)
+	// SyncNeeded the per-option comparison of the desired settings with the database, nil when the database
+	// doesn't exist
+	SyncNeeded(ctx context.Context, params *DatabaseConfig) (*DatabaseDiff, error)
+	// DatabaseState the settings of the database as selected from sys.databases, nil when it doesn't exist
+	DatabaseState(ctx context.Context, databaseName string) (*DatabaseState, error)
+	// DeleteDatabase drops the database if it exists
+	DeleteDatabase(ctx context.Context, databaseName string) error
+	// RenameDatabase renames the database, the recovery_fork_guid is kept
+	RenameDatabase(ctx context.Context, databaseName, newName string) error
+	// BackupDatabase takes a COPY_ONLY backup of the database to the path on the sql server
+	BackupDatabase(ctx context.Context, databaseName, path string) error
+	// CreateLogin creates the sql login with the password and the options set in params
+	CreateLogin(ctx context.Context, loginName, password string, params *LoginParams) error
+	// AlterLogin applies every option set in params
+	AlterLogin(ctx context.Context, loginName string, params *LoginParams) error
+	// AlterLoginPassword sets the password of the sql login
+	AlterLoginPassword(ctx context.Context, loginName, password string) error
+	// LoginState the sql login as selected from sys.sql_logins along with whether password is its password, nil
+	// when it doesn't exist
+	LoginState(ctx context.Context, loginName, password string) (*LoginState, error)
+	// DeleteLogin drops the sql login if it exists
+	DeleteLogin(ctx context.Context, loginName string) error
+	// CreateUser creates the user in the database, the password is only used by contained users
+	CreateUser(ctx context.Context, databaseName, userName, password string, params *UserParams) error
+	// AlterUser applies every option set in params
+	AlterUser(ctx context.Context, databaseName, userName string, params *UserParams) error
+	// AlterUserPassword sets the password of the contained user
+	AlterUserPassword(ctx context.Context, databaseName, userName, password string) error
+	// UserState the user as selected from sys.database_principals of the database, nil when it doesn't exist
+	UserState(ctx context.Context, databaseName, userName string) (*UserState, error)
+	// DeleteUser drops the user if it and its database exist
+	DeleteUser(ctx context.Context, databaseName, userName string) error
+	// CreateRole creates the role in the database without members
+	CreateRole(ctx context.Context, databaseName, roleName string) error
+	// AddRoleMember adds the user or role to the role
+	AddRoleMember(ctx context.Context, databaseName, roleName, memberName string) error
+	// DropRoleMember removes the user or role from the role
+	DropRoleMember(ctx context.Context, databaseName, roleName, memberName string) error
+	// RoleState the role as selected from sys.database_principals of the database along with its membership, nil
+	// when it doesn't exist
+	RoleState(ctx context.Context, databaseName, roleName string) (*RoleState, error)
+	// DeleteRole empties and drops the role if it and its database exist
+	DeleteRole(ctx context.Context, databaseName, roleName string) error
+	// CreateSchema creates the schema owned by the principal, by the user of the login when ownerName is empty
+	CreateSchema(ctx context.Context, databaseName, schemaName, ownerName string) error
+	// AlterSchemaOwner transfers the ownership of the schema to the principal
+	AlterSchemaOwner(ctx context.Context, databaseName, schemaName, ownerName string) error
+	// SchemaState the schema as selected from sys.schemas of the database along with the number of its objects, nil
+	// when it doesn't exist
+	SchemaState(ctx context.Context, databaseName, schemaName string) (*SchemaState, error)
+	// DeleteSchema drops the schema if it and its database exist, it fails when the schema still has objects
+	DeleteSchema(ctx context.Context, databaseName, schemaName string) error
+	// Permissions the permissions granted or denied to the principal on the database, its schemas and its objects,
+	// those of every principal but the built-in ones when principalName is empty
+	Permissions(ctx context.Context, databaseName, principalName string) ([]Permission, error)
+	// ApplyPermission grants, denies or revokes the permission so it goes from the observed state to the desired
+	// one, it is revoked when desired is nil
+	ApplyPermission(ctx context.Context, databaseName string, desired, observed *Permission) error
+}
+
+// ProviderFactory builds the Provider for a sql server login
+type ProviderFactory func(server, user, password string, port int) Provider
+
+var _ Provider = &MSSql{}
+
+// NewMSSqlFactory ProviderFactory of MSSql providers sharing the pools of connections
+func NewMSSqlFactory(connections *ConnectionManager) ProviderFactory {
+	return func(server, user, password string, port int) Provider {
+		return NewMSSql(server, user, password, port, connections)
+	}
+}
@@ -0,0 +1,288 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// FixedRoles the fixed database roles of every database, they cannot be created, dropped nor added to a role but
+// a role can be added to them
+var FixedRoles = []string{
+	"db_owner",
+	"db_securityadmin",
+	"db_accessadmin",
+	"db_backupoperator",
+	"db_ddladmin",
+	"db_datawriter",
+	"db_datareader",
+	"db_denydatawriter",
+	"db_denydatareader",
+}
+
+// IsFixedRole whether the role is one of the FixedRoles
+func IsFixedRole(roleName string) bool {
+	for _, fixed := range FixedRoles {
+		if strings.EqualFold(fixed, roleName) {
+			return true
+		}
+	}
+	return false
+}
+
+// RoleParams the full membership of a database role, sys.database_role_members is made to match it exactly
+type RoleParams struct {
+	// Members the users and roles that are members of the role
+	Members []string
+	// MemberOf the roles the role is a member of, fixed roles included
+	MemberOf []string
+	// OtherMembers the members declared from their side by the MemberOf of other managed roles, they are neither
+	// added nor dropped
+	OtherMembers []string
+	// OtherMemberOf the roles declaring the role as one of their Members, the role is neither added to them nor
+	// dropped from them
+	OtherMemberOf []string
+}
+
+// RoleMember a principal of a row of sys.database_role_members
+type RoleMember struct {
+	Name string `json:"name"`
+}
+
+// RoleState a database role as selected from sys.database_principals along with its rows of
+// sys.database_role_members
+type RoleState struct {
+	Name        string `json:"name"`
+	PrincipalID int    `json:"principalID"`
+	IsFixedRole bool   `json:"isFixedRole"`
+	// Owner the name of the principal owning the role
+	Owner      string `json:"owner"`
+	CreateDate string `json:"createDate"`
+	// Members the principals that are members of the role
+	Members []RoleMember `json:"members"`
+	// MemberOf the roles the role is a member of
+	MemberOf []RoleMember `json:"memberOf"`
+}
+
+// Created the create date of the role, like the create date of a database it has no time zone
+func (s *RoleState) Created() (time.Time, error) {
+	return time.ParseInLocation(CreateDateLayout, s.CreateDate, time.UTC)
+}
+
+// MemberNames the sorted names of the members of the role
+func (s *RoleState) MemberNames() []string {
+	return memberNames(s.Members)
+}
+
+// MemberOfNames the sorted names of the roles the role is a member of
+func (s *RoleState) MemberOfNames() []string {
+	return memberNames(s.MemberOf)
+}
+
+func memberNames(members []RoleMember) []string {
+	names := make([]string, len(members))
+	for i, m := range members {
+		names[i] = m.Name
+	}
+	sort.Strings(names)
+	return names
+}
+
+type RoleSync struct {
+	Role []RoleState `json:"role"`
+}
+
+// MembershipDiff the comparison of a declared list of principals with the rows of sys.database_role_members
+type MembershipDiff struct {
+	// Missing the declared principals that are not in the rows, they are added
+	Missing []string `json:"missing,omitempty"`
+	// Unexpected the principals in the rows that are not declared, they are dropped
+	Unexpected []string `json:"unexpected,omitempty"`
+}
+
+// HasDrift whether a principal is missing or unexpected
+func (d MembershipDiff) HasDrift() bool {
+	return len(d.Missing) > 0 || len(d.Unexpected) > 0
+}
+
+// RoleDiff the comparison of the membership of a database role
+type RoleDiff struct {
+	Members  MembershipDiff `json:"members"`
+	MemberOf MembershipDiff `json:"memberOf"`
+}
+
+// HasDrift whether the members or the roles the role is a member of differ
+func (d *RoleDiff) HasDrift() bool {
+	return d.Members.HasDrift() || d.MemberOf.HasDrift()
+}
+
+// diffMembership compares the declared names with the observed ones, the observed names declared elsewhere are not
+// unexpected. Principal names are compared like the collation of a database usually does, case insensitive
+func diffMembership(desired, elsewhere, observed []string) MembershipDiff {
+	diff := MembershipDiff{}
+	contains := func(names []string, name string) bool {
+		for _, n := range names {
+			if strings.EqualFold(n, name) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, name := range desired {
+		if !contains(observed, name) {
+			diff.Missing = append(diff.Missing, name)
+		}
+	}
+	for _, name := range observed {
+		if !contains(desired, name) && !contains(elsewhere, name) {
+			diff.Unexpected = append(diff.Unexpected, name)
+		}
+	}
+	sort.Strings(diff.Missing)
+	sort.Strings(diff.Unexpected)
+	return diff
+}
+
+// DiffRole compares the membership declared in params with the role, every difference is remediated by adding the
+// missing and dropping the unexpected principals
+func DiffRole(params *RoleParams, state *RoleState) *RoleDiff {
+	if params == nil {
+		params = &RoleParams{}
+	}
+	if state == nil {
+		state = &RoleState{}
+	}
+	return &RoleDiff{
+		Members:  diffMembership(params.Members, params.OtherMembers, state.MemberNames()),
+		MemberOf: diffMembership(params.MemberOf, params.OtherMemberOf, state.MemberOfNames()),
+	}
+}
+
+// RoleState the database role as selected from sys.database_principals along with its membership, nil when it
+// doesn't exist
+func (db *MSSql) RoleState(ctx context.Context, databaseName, roleName string) (*RoleState, error) {
+	conn, err := db.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	query, err := RoleStateStatement(databaseName, roleName)
+	if err != nil {
+		return nil, err
+	}
+	var output string
+	if err = conn.QueryRowContext(ctx, query.SQL, query.Args...).Scan(&output); err != nil {
+		if strings.Contains(err.Error(), "sql: no rows in result set") {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var sync RoleSync
+	if err = json.Unmarshal([]byte(output), &sync); err != nil {
+		return nil, err
+	}
+	if len(sync.Role) == 0 {
+		return nil, nil
+	}
+	return &sync.Role[0], nil
+}
+
+// CreateRole creates the database role without members
+func (db *MSSql) CreateRole(ctx context.Context, databaseName, roleName string) error {
+	_ = log.FromContext(ctx)
+	logger := log.Log
+
+	logger.Info("creating the role", "database", databaseName, "name", roleName)
+	conn, err := db.conn(ctx)
+	if err != nil {
+		return err
+	}
+	create, err := CreateRoleStatement(databaseName, roleName)
+	if err != nil {
+		return err
+	}
+	_, err = conn.ExecContext(ctx, create.SQL, create.Args...)
+	return err
+}
+
+// AddRoleMember adds the user or role to the database role
+func (db *MSSql) AddRoleMember(ctx context.Context, databaseName, roleName, memberName string) error {
+	_ = log.FromContext(ctx)
+	logger := log.Log
+
+	logger.Info("adding the role member", "database", databaseName, "role", roleName, "member", memberName)
+	conn, err := db.conn(ctx)
+	if err != nil {
+		return err
+	}
+	add, err := AddRoleMemberStatement(databaseName, roleName, memberName)
+	if err != nil {
+		return err
+	}
+	_, err = conn.ExecContext(ctx, add.SQL, add.Args...)
+	return err
+}
+
+// DropRoleMember removes the user or role from the database role
+func (db *MSSql) DropRoleMember(ctx context.Context, databaseName, roleName, memberName string) error {
+	_ = log.FromContext(ctx)
+	logger := log.Log
+
+	logger.Info("dropping the role member", "database", databaseName, "role", roleName, "member", memberName)
+	conn, err := db.conn(ctx)
+	if err != nil {
+		return err
+	}
+	drop, err := DropRoleMemberStatement(databaseName, roleName, memberName)
+	if err != nil {
+		return err
+	}
+	_, err = conn.ExecContext(ctx, drop.SQL, drop.Args...)
+	return err
+}
+
+// DeleteRole drops the database role if it and its database exist, a role with members cannot be dropped so its
+// members are dropped first
+func (db *MSSql) DeleteRole(ctx context.Context, databaseName, roleName string) error {
+	_ = log.FromContext(ctx)
+	logger := log.Log
+
+	logger.Info("deleting the role", "database", databaseName, "name", roleName)
+	conn, err := db.conn(ctx)
+	if err != nil {
+		return err
+	}
+	drop, err := DropRoleStatement(databaseName, roleName)
+	if err != nil {
+		return err
+	}
+	var dbID sql.NullInt64
+	exists := DatabaseExistsStatement(databaseName)
+	if err = conn.QueryRowContext(ctx, exists.SQL, exists.Args...).Scan(&dbID); err != nil {
+		return err
+	}
+	if !dbID.Valid {
+		logger.Info("database doesn't exist returning nil")
+		return nil
+	}
+	state, err := db.RoleState(ctx, databaseName, roleName)
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		logger.Info("role doesn't exist returning nil")
+		return nil
+	}
+	for _, member := range state.MemberNames() {
+		if err = db.DropRoleMember(ctx, databaseName, roleName, member); err != nil {
+			return fmt.Errorf("errors while emptying role: %s: %w", roleName, err)
+		}
+	}
+	_, err = conn.ExecContext(ctx, drop.SQL, drop.Args...)
+	return err
+}
@@ -0,0 +1,53 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffRole(t *testing.T) {
+	state := &RoleState{
+		Name:     "app_readers",
+		Members:  []RoleMember{{Name: "App"}, {Name: "intruder"}},
+		MemberOf: []RoleMember{{Name: "db_datareader"}, {Name: "db_owner"}},
+	}
+	diff := DiffRole(&RoleParams{
+		Members:  []string{"app", "reporting"},
+		MemberOf: []string{"db_datareader"},
+	}, state)
+
+	if !diff.HasDrift() {
+		t.Fatal("expected drift")
+	}
+	if !reflect.DeepEqual(diff.Members, MembershipDiff{Missing: []string{"reporting"}, Unexpected: []string{"intruder"}}) {
+		t.Errorf("unexpected members diff: %+v", diff.Members)
+	}
+	if !reflect.DeepEqual(diff.MemberOf, MembershipDiff{Unexpected: []string{"db_owner"}}) {
+		t.Errorf("unexpected memberOf diff: %+v", diff.MemberOf)
+	}
+}
+
+func TestDiffRoleInSync(t *testing.T) {
+	if diff := DiffRole(&RoleParams{}, &RoleState{Name: "app_readers"}); diff.HasDrift() {
+		t.Errorf("expected an empty role to match an empty membership, got %+v", diff)
+	}
+	diff := DiffRole(&RoleParams{Members: []string{"app"}}, nil)
+	if !reflect.DeepEqual(diff.Members.Missing, []string{"app"}) {
+		t.Errorf("expected every member of a missing role to be missing, got %+v", diff.Members)
+	}
+}
+
+func TestDiffRoleMembershipDeclaredByOtherRoles(t *testing.T) {
+	state := &RoleState{
+		Name:     "app_readers",
+		Members:  []RoleMember{{Name: "reporting"}},
+		MemberOf: []RoleMember{{Name: "app_owners"}},
+	}
+	diff := DiffRole(&RoleParams{OtherMembers: []string{"Reporting"}, OtherMemberOf: []string{"app_owners"}}, state)
+	if diff.HasDrift() {
+		t.Errorf("expected the membership declared by the other roles to be kept, got %+v", diff)
+	}
+	if diff = DiffRole(&RoleParams{OtherMembers: []string{"reporting"}}, &RoleState{Name: "app_readers"}); diff.HasDrift() {
+		t.Errorf("expected the membership declared by the other roles not to be added, got %+v", diff)
+	}
+}
@@ -0,0 +1,152 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// BuiltInSchemas the schemas of every database besides the schemas named like the FixedRoles, they cannot be
+// created nor dropped
+var BuiltInSchemas = []string{
+	"dbo",
+	"guest",
+	"INFORMATION_SCHEMA",
+	"sys",
+}
+
+// IsBuiltInSchema whether the schema is one of the BuiltInSchemas or the schema of a fixed role
+func IsBuiltInSchema(schemaName string) bool {
+	for _, builtIn := range BuiltInSchemas {
+		if strings.EqualFold(builtIn, schemaName) {
+			return true
+		}
+	}
+	return IsFixedRole(schemaName)
+}
+
+// SchemaState a schema as selected from sys.schemas along with the number of its objects
+type SchemaState struct {
+	Name     string `json:"name"`
+	SchemaID int    `json:"schemaID"`
+	// Owner the name of the principal owning the schema
+	Owner string `json:"owner"`
+	// ObjectCount the number of rows of sys.objects in the schema, a schema with objects cannot be dropped
+	ObjectCount int `json:"objectCount"`
+}
+
+// IsEmpty whether the schema has no objects
+func (s *SchemaState) IsEmpty() bool {
+	return s.ObjectCount == 0
+}
+
+type SchemaSync struct {
+	Schema []SchemaState `json:"schema"`
+}
+
+// SchemaState the schema as selected from sys.schemas along with the number of its objects, nil when it doesn't
+// exist
+func (db *MSSql) SchemaState(ctx context.Context, databaseName, schemaName string) (*SchemaState, error) {
+	conn, err := db.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	query, err := SchemaStateStatement(databaseName, schemaName)
+	if err != nil {
+		return nil, err
+	}
+	var output string
+	if err = conn.QueryRowContext(ctx, query.SQL, query.Args...).Scan(&output); err != nil {
+		if strings.Contains(err.Error(), "sql: no rows in result set") {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var sync SchemaSync
+	if err = json.Unmarshal([]byte(output), &sync); err != nil {
+		return nil, err
+	}
+	if len(sync.Schema) == 0 {
+		return nil, nil
+	}
+	return &sync.Schema[0], nil
+}
+
+// CreateSchema creates the schema owned by the principal, by the user of the login when ownerName is empty
+func (db *MSSql) CreateSchema(ctx context.Context, databaseName, schemaName, ownerName string) error {
+	_ = log.FromContext(ctx)
+	logger := log.Log
+
+	logger.Info("creating the schema", "database", databaseName, "name", schemaName, "owner", ownerName)
+	conn, err := db.conn(ctx)
+	if err != nil {
+		return err
+	}
+	create, err := CreateSchemaStatement(databaseName, schemaName, ownerName)
+	if err != nil {
+		return err
+	}
+	_, err = conn.ExecContext(ctx, create.SQL, create.Args...)
+	return err
+}
+
+// AlterSchemaOwner transfers the ownership of the schema to the principal
+func (db *MSSql) AlterSchemaOwner(ctx context.Context, databaseName, schemaName, ownerName string) error {
+	_ = log.FromContext(ctx)
+	logger := log.Log
+
+	logger.Info("altering the owner of the schema", "database", databaseName, "name", schemaName, "owner", ownerName)
+	conn, err := db.conn(ctx)
+	if err != nil {
+		return err
+	}
+	alter, err := AlterSchemaOwnerStatement(databaseName, schemaName, ownerName)
+	if err != nil {
+		return err
+	}
+	_, err = conn.ExecContext(ctx, alter.SQL, alter.Args...)
+	return err
+}
+
+// DeleteSchema drops the schema if it and its database exist, a schema that still has objects is refused rather
+// than emptied
+func (db *MSSql) DeleteSchema(ctx context.Context, databaseName, schemaName string) error {
+	_ = log.FromContext(ctx)
+	logger := log.Log
+
+	logger.Info("deleting the schema", "database", databaseName, "name", schemaName)
+	conn, err := db.conn(ctx)
+	if err != nil {
+		return err
+	}
+	drop, err := DropSchemaStatement(databaseName, schemaName)
+	if err != nil {
+		return err
+	}
+	var dbID sql.NullInt64
+	exists := DatabaseExistsStatement(databaseName)
+	if err = conn.QueryRowContext(ctx, exists.SQL, exists.Args...).Scan(&dbID); err != nil {
+		return err
+	}
+	if !dbID.Valid {
+		logger.Info("database doesn't exist returning nil")
+		return nil
+	}
+	state, err := db.SchemaState(ctx, databaseName, schemaName)
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		logger.Info("schema doesn't exist returning nil")
+		return nil
+	}
+	if !state.IsEmpty() {
+		return fmt.Errorf("schema %s of database %s still contains %d objects", schemaName, databaseName, state.ObjectCount)
+	}
+	_, err = conn.ExecContext(ctx, drop.SQL, drop.Args...)
+	return err
+}
@@ -0,0 +1,796 @@
+package internal
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pplavetzki/azure-sql-mi/internal/validation"
+)
+
+// permissions are keywords made of words separated by single spaces e.g. VIEW DEFINITION
+var permissionPattern = regexp.MustCompile(`^[A-Za-z]+( [A-Za-z]+)*$`)
+
+// Statement a T-SQL statement and the query parameters referenced by it, values are never
+// formatted into SQL
+type Statement struct {
+	SQL  string
+	Args []interface{}
+}
+
+func (s *Statement) String() string {
+	return s.SQL
+}
+
+// QuoteName quotes an identifier the same way QUOTENAME does: the identifier is wrapped in brackets
+// and every closing bracket is doubled. Like QUOTENAME it refuses identifiers longer than a sysname.
+func QuoteName(identifier string) (string, error) {
+	if err := validation.ValidateIdentifier(identifier); err != nil {
+		return "", err
+	}
+	return "[" + strings.ReplaceAll(identifier, "]", "]]") + "]", nil
+}
+
+// DatabaseIDStatement selects the recovery_fork_guid of the database by name
+func DatabaseIDStatement(databaseName string) *Statement {
+	return &Statement{
+		SQL: "SELECT CAST(drs.recovery_fork_guid AS char(36)) AS recovery_fork_guid " +
+			"FROM sys.database_recovery_status drs JOIN sys.databases dbs ON drs.database_id = dbs.database_id " +
+			"WHERE dbs.[name] = @name",
+		Args: []interface{}{sql.Named("name", databaseName)},
+	}
+}
+
+// DatabaseNameStatement selects the name of the database by recovery_fork_guid
+func DatabaseNameStatement(id string) *Statement {
+	return &Statement{
+		SQL: "SELECT dbs.[name] " +
+			"FROM sys.database_recovery_status drs JOIN sys.databases dbs ON drs.database_id = dbs.database_id " +
+			"WHERE drs.recovery_fork_guid = TRY_CONVERT(uniqueidentifier, @id)",
+		Args: []interface{}{sql.Named("id", id)},
+	}
+}
+
+// DatabaseExistsStatement selects the DB_ID of the database, NULL when it doesn't exist
+func DatabaseExistsStatement(databaseName string) *Statement {
+	return &Statement{
+		SQL:  "SELECT DB_ID(@name) AS [ID]",
+		Args: []interface{}{sql.Named("name", databaseName)},
+	}
+}
+
+// DatabaseStateStatement selects the settings of the database as json, the sizes are the sums of the data
+// and log files in bytes
+func DatabaseStateStatement(databaseName string) *Statement {
+	return &Statement{
+		SQL: "SELECT [name], " +
+			"[state], " +
+			"[state_desc] as [stateDesc], " +
+			"[is_read_only] as [isReadOnly], " +
+			"[user_access] as [userAccess], " +
+			"[create_date] as [createDate], " +
+			"[compatibility_level] as [compatibilityLevel], " +
+			"[collation_name] as [collation], " +
+			"IIF(snapshot_isolation_state = 1 or snapshot_isolation_state = 3, 'true', 'false') as [allowSnapshotIsolation], " +
+			"IIF(is_read_committed_snapshot_on = 1, 'true', 'false') as [allowReadCommittedSnapshot], " +
+			"IIF(is_parameterization_forced = 0, 'simple', 'forced' ) as [parameterization], " +
+			"[recovery_model_desc] as [recoveryModel], " +
+			"(SELECT SUM(CAST(mf.[size] AS bigint)) * 8192 FROM sys.master_files mf WHERE mf.database_id = dbs.database_id AND mf.[type] = 0) as [dataSizeBytes], " +
+			"(SELECT SUM(CAST(mf.[size] AS bigint)) * 8192 FROM sys.master_files mf WHERE mf.database_id = dbs.database_id AND mf.[type] = 1) as [logSizeBytes] " +
+			"FROM sys.databases dbs " +
+			"WHERE [name] = @name " +
+			"FOR JSON PATH, ROOT ('database')",
+		Args: []interface{}{sql.Named("name", databaseName)},
+	}
+}
+
+// CreateDatabaseStatement CREATE DATABASE with an optional collation
+func CreateDatabaseStatement(databaseName string, params *DatabaseParams) (*Statement, error) {
+	name, err := QuoteName(databaseName)
+	if err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "CREATE DATABASE %s", name)
+
+	if params != nil && params.Collation != nil {
+		if err := validation.ValidateCollation(*params.Collation); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&b, " COLLATE %s", *params.Collation)
+	}
+	return &Statement{SQL: b.String()}, nil
+}
+
+// readCommittedSnapshotRollbackAfter seconds the open transactions of the database are given to complete before
+// they are rolled back by a change of READ_COMMITTED_SNAPSHOT
+const readCommittedSnapshotRollbackAfter = 10
+
+// AlterDatabaseStatements one ALTER DATABASE ... SET per option set in params
+func AlterDatabaseStatements(databaseName string, params *DatabaseParams) ([]*Statement, error) {
+	name, err := QuoteName(databaseName)
+	if err != nil {
+		return nil, err
+	}
+	altStatements := []*Statement{}
+	if params == nil {
+		return altStatements, nil
+	}
+	altTemplate := fmt.Sprintf("ALTER DATABASE %s", name)
+
+	if params.Parameterization != nil && *params.Parameterization != "" {
+		if err := validation.ValidateParameterization(*params.Parameterization); err != nil {
+			return nil, err
+		}
+		altStatements = append(altStatements, &Statement{SQL: fmt.Sprintf("%s SET PARAMETERIZATION %s", altTemplate, strings.ToUpper(*params.Parameterization))})
+	}
+	if params.AllowSnapshotIsolation != nil {
+		altStatements = append(altStatements, &Statement{SQL: fmt.Sprintf("%s SET ALLOW_SNAPSHOT_ISOLATION %s", altTemplate, onOff(*params.AllowSnapshotIsolation))})
+	}
+	if params.AllowReadCommittedSnapshot != nil {
+		// READ_COMMITTED_SNAPSHOT needs the database to itself, the open transactions are rolled back after a grace
+		// period instead of failing the change for as long as the database is in use
+		altStatements = append(altStatements, &Statement{SQL: fmt.Sprintf("%s SET READ_COMMITTED_SNAPSHOT %s WITH ROLLBACK AFTER %d SECONDS",
+			altTemplate, onOff(*params.AllowReadCommittedSnapshot), readCommittedSnapshotRollbackAfter)})
+	}
+	if params.CompatibilityLevel != nil && *params.CompatibilityLevel != 0 {
+		if err := validation.ValidateCompatibilityLevel(*params.CompatibilityLevel); err != nil {
+			return nil, err
+		}
+		altStatements = append(altStatements, &Statement{SQL: fmt.Sprintf("%s SET COMPATIBILITY_LEVEL = %d", altTemplate, *params.CompatibilityLevel)})
+	}
+	return altStatements, nil
+}
+
+// DropDatabaseStatement DROP DATABASE
+func DropDatabaseStatement(databaseName string) (*Statement, error) {
+	name, err := QuoteName(databaseName)
+	if err != nil {
+		return nil, err
+	}
+	return &Statement{SQL: fmt.Sprintf("DROP DATABASE %s", name)}, nil
+}
+
+// RenameDatabaseStatement ALTER DATABASE ... MODIFY NAME
+func RenameDatabaseStatement(databaseName, newName string) (*Statement, error) {
+	name, err := QuoteName(databaseName)
+	if err != nil {
+		return nil, err
+	}
+	quotedNewName, err := QuoteName(newName)
+	if err != nil {
+		return nil, err
+	}
+	return &Statement{SQL: fmt.Sprintf("ALTER DATABASE %s MODIFY NAME = %s", name, quotedNewName)}, nil
+}
+
+// BackupDatabaseStatement a COPY_ONLY full backup of the database to a file on the sql server, a COPY_ONLY
+// backup leaves the backup chain of the scheduled backups untouched
+func BackupDatabaseStatement(databaseName, path string) (*Statement, error) {
+	name, err := QuoteName(databaseName)
+	if err != nil {
+		return nil, err
+	}
+	if path == "" {
+		return nil, fmt.Errorf("backup path cannot be empty")
+	}
+	return &Statement{
+		SQL:  fmt.Sprintf("BACKUP DATABASE %s TO DISK = @path WITH COPY_ONLY", name),
+		Args: []interface{}{sql.Named("path", path)},
+	}, nil
+}
+
+// nationalLiteral quotes s as an nvarchar literal, it is only used to embed generated T-SQL made of quoted
+// identifiers and keywords into dynamic SQL
+func nationalLiteral(s string) string {
+	return "N'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// withPassword CREATE LOGIN and ALTER LOGIN only take the password as a literal, so the statement is run as dynamic
+// SQL the password is spliced into on the server: it is passed as the @password parameter and quoted by REPLACE.
+// The statement is run by executor, the sp_executesql of the server or of a database
+func withPassword(executor, prefix, suffix, password string) *Statement {
+	return &Statement{
+		SQL: fmt.Sprintf("DECLARE @sql nvarchar(max) = %s + N'N''' + REPLACE(@password, N'''', N'''''') + N'''' + %s; EXEC %s @sql",
+			nationalLiteral(prefix), nationalLiteral(suffix), executor),
+		Args: []interface{}{sql.Named("password", password)},
+	}
+}
+
+// databaseExecutor the sp_executesql of the database, the pooled connections are shared by every reconcile so
+// statements scoped to a database are run by it instead of switching the connection with USE
+func databaseExecutor(databaseName string) (string, error) {
+	name, err := QuoteName(databaseName)
+	if err != nil {
+		return "", err
+	}
+	return name + ".sys.sp_executesql", nil
+}
+
+// inDatabase runs the T-SQL made of quoted identifiers and keywords in the database
+func inDatabase(databaseName, statement string) (*Statement, error) {
+	executor, err := databaseExecutor(databaseName)
+	if err != nil {
+		return nil, err
+	}
+	return &Statement{SQL: fmt.Sprintf("EXEC %s %s", executor, nationalLiteral(statement))}, nil
+}
+
+// ValidateLoginParams CHECK_EXPIRATION can only be ON along with CHECK_POLICY
+func ValidateLoginParams(params *LoginParams) error {
+	if params == nil {
+		return nil
+	}
+	if SafeBool(params.CheckExpiration) && params.CheckPolicy != nil && !*params.CheckPolicy {
+		return fmt.Errorf("check expiration cannot be on when check policy is off")
+	}
+	if params.DefaultDatabase != nil {
+		if err := validation.ValidateIdentifier(*params.DefaultDatabase); err != nil {
+			return fmt.Errorf("invalid default database: %w", err)
+		}
+	}
+	if params.DefaultLanguage != nil {
+		if err := validation.ValidateIdentifier(*params.DefaultLanguage); err != nil {
+			return fmt.Errorf("invalid default language: %w", err)
+		}
+	}
+	return nil
+}
+
+// loginOptionClauses the options of CREATE LOGIN set in params, CHECK_EXPIRATION is turned off before and on after
+// CHECK_POLICY
+func loginOptionClauses(params *LoginParams) ([]string, error) {
+	options := []string{}
+	if params == nil {
+		return options, nil
+	}
+	if err := ValidateLoginParams(params); err != nil {
+		return nil, err
+	}
+	if params.DefaultDatabase != nil {
+		database, _ := QuoteName(*params.DefaultDatabase)
+		options = append(options, "DEFAULT_DATABASE = "+database)
+	}
+	if params.DefaultLanguage != nil {
+		language, _ := QuoteName(*params.DefaultLanguage)
+		options = append(options, "DEFAULT_LANGUAGE = "+language)
+	}
+	if params.CheckExpiration != nil && !*params.CheckExpiration {
+		options = append(options, "CHECK_EXPIRATION = OFF")
+	}
+	if params.CheckPolicy != nil {
+		options = append(options, "CHECK_POLICY = "+onOff(*params.CheckPolicy))
+	}
+	if params.CheckExpiration != nil && *params.CheckExpiration {
+		options = append(options, "CHECK_EXPIRATION = ON")
+	}
+	return options, nil
+}
+
+// LoginStateStatement selects the settings of the sql login as json along with whether password is its password,
+// PWDCOMPARE hashes password with the salt of the login so the password itself is never read
+func LoginStateStatement(loginName, password string) *Statement {
+	return &Statement{
+		SQL: "SELECT [name], " +
+			"[principal_id] as [principalID], " +
+			"CONVERT(varchar(172), [sid], 1) as [sid], " +
+			"[default_database_name] as [defaultDatabase], " +
+			"[default_language_name] as [defaultLanguage], " +
+			"[is_policy_checked] as [checkPolicy], " +
+			"[is_expiration_checked] as [checkExpiration], " +
+			"[is_disabled] as [isDisabled], " +
+			"[create_date] as [createDate], " +
+			"CAST(PWDCOMPARE(@password, [password_hash]) AS bit) as [passwordMatches] " +
+			"FROM sys.sql_logins " +
+			"WHERE [name] = @name " +
+			"FOR JSON PATH, ROOT ('login')",
+		Args: []interface{}{sql.Named("name", loginName), sql.Named("password", password)},
+	}
+}
+
+// LoginExistsStatement selects the principal_id of the sql login, NULL when it doesn't exist
+func LoginExistsStatement(loginName string) *Statement {
+	return &Statement{
+		SQL:  "SELECT (SELECT [principal_id] FROM sys.sql_logins WHERE [name] = @name) AS [ID]",
+		Args: []interface{}{sql.Named("name", loginName)},
+	}
+}
+
+// CreateLoginStatement CREATE LOGIN ... WITH PASSWORD and the options set in params
+func CreateLoginStatement(loginName, password string, params *LoginParams) (*Statement, error) {
+	name, err := QuoteName(loginName)
+	if err != nil {
+		return nil, err
+	}
+	options, err := loginOptionClauses(params)
+	if err != nil {
+		return nil, err
+	}
+	suffix := ""
+	if len(options) > 0 {
+		suffix = ", " + strings.Join(options, ", ")
+	}
+	return withPassword("sp_executesql", fmt.Sprintf("CREATE LOGIN %s WITH PASSWORD = ", name), suffix, password), nil
+}
+
+// AlterLoginStatements one ALTER LOGIN ... WITH per option set in params
+func AlterLoginStatements(loginName string, params *LoginParams) ([]*Statement, error) {
+	name, err := QuoteName(loginName)
+	if err != nil {
+		return nil, err
+	}
+	options, err := loginOptionClauses(params)
+	if err != nil {
+		return nil, err
+	}
+	altStatements := make([]*Statement, len(options))
+	for i, option := range options {
+		altStatements[i] = &Statement{SQL: fmt.Sprintf("ALTER LOGIN %s WITH %s", name, option)}
+	}
+	return altStatements, nil
+}
+
+// AlterLoginPasswordStatement ALTER LOGIN ... WITH PASSWORD
+func AlterLoginPasswordStatement(loginName, password string) (*Statement, error) {
+	name, err := QuoteName(loginName)
+	if err != nil {
+		return nil, err
+	}
+	return withPassword("sp_executesql", fmt.Sprintf("ALTER LOGIN %s WITH PASSWORD = ", name), "", password), nil
+}
+
+// DropLoginStatement DROP LOGIN
+func DropLoginStatement(loginName string) (*Statement, error) {
+	name, err := QuoteName(loginName)
+	if err != nil {
+		return nil, err
+	}
+	return &Statement{SQL: fmt.Sprintf("DROP LOGIN %s", name)}, nil
+}
+
+// ValidateUserParams a user is mapped to a login only when its authentication is INSTANCE, and the login as well as
+// the default schema must be identifiers
+func ValidateUserParams(params *UserParams) error {
+	if params == nil {
+		return fmt.Errorf("user params cannot be nil")
+	}
+	switch params.Authentication {
+	case AuthenticationInstance:
+		if params.Login == nil {
+			return fmt.Errorf("the login of a user mapped to a login cannot be empty")
+		}
+		if err := validation.ValidateIdentifier(*params.Login); err != nil {
+			return fmt.Errorf("invalid login: %w", err)
+		}
+	case AuthenticationDatabase, AuthenticationNone:
+		if params.Login != nil {
+			return fmt.Errorf("only a user mapped to a login can have a login")
+		}
+	default:
+		return fmt.Errorf("invalid authentication: %q, must be one of %s, %s, %s", params.Authentication,
+			AuthenticationInstance, AuthenticationDatabase, AuthenticationNone)
+	}
+	if params.DefaultSchema != nil {
+		if err := validation.ValidateIdentifier(*params.DefaultSchema); err != nil {
+			return fmt.Errorf("invalid default schema: %w", err)
+		}
+	}
+	return nil
+}
+
+// UserStateStatement selects the database user as json from the sys.database_principals of the database, the login
+// is the name of the server principal with the sid of the user
+func UserStateStatement(databaseName, userName string) (*Statement, error) {
+	database, err := QuoteName(databaseName)
+	if err != nil {
+		return nil, err
+	}
+	return &Statement{
+		SQL: "SELECT [name], " +
+			"[principal_id] as [principalID], " +
+			"CONVERT(varchar(172), [sid], 1) as [sid], " +
+			"[type_desc] as [typeDesc], " +
+			"[authentication_type_desc] as [authenticationType], " +
+			"[default_schema_name] as [defaultSchema], " +
+			"SUSER_SNAME([sid]) as [login], " +
+			"[create_date] as [createDate] " +
+			"FROM " + database + ".sys.database_principals " +
+			"WHERE [name] = @name " +
+			"FOR JSON PATH, ROOT ('user')",
+		Args: []interface{}{sql.Named("name", userName)},
+	}, nil
+}
+
+// CreateUserStatement CREATE USER in the database FOR LOGIN, WITHOUT LOGIN or WITH PASSWORD depending on the
+// authentication of params, the password is only used by contained users
+func CreateUserStatement(databaseName, userName, password string, params *UserParams) (*Statement, error) {
+	name, err := QuoteName(userName)
+	if err != nil {
+		return nil, err
+	}
+	if err = ValidateUserParams(params); err != nil {
+		return nil, err
+	}
+	options := []string{}
+	if params.DefaultSchema != nil {
+		schema, _ := QuoteName(*params.DefaultSchema)
+		options = append(options, "DEFAULT_SCHEMA = "+schema)
+	}
+
+	var create string
+	switch params.Authentication {
+	case AuthenticationDatabase:
+		if password == "" {
+			return nil, fmt.Errorf("the password of a contained user cannot be empty")
+		}
+		executor, err := databaseExecutor(databaseName)
+		if err != nil {
+			return nil, err
+		}
+		suffix := ""
+		if len(options) > 0 {
+			suffix = ", " + strings.Join(options, ", ")
+		}
+		return withPassword(executor, fmt.Sprintf("CREATE USER %s WITH PASSWORD = ", name), suffix, password), nil
+	case AuthenticationInstance:
+		login, _ := QuoteName(*params.Login)
+		create = fmt.Sprintf("CREATE USER %s FOR LOGIN %s", name, login)
+	default:
+		create = fmt.Sprintf("CREATE USER %s WITHOUT LOGIN", name)
+	}
+	if len(options) > 0 {
+		create += " WITH " + strings.Join(options, ", ")
+	}
+	return inDatabase(databaseName, create)
+}
+
+// AlterUserStatements one ALTER USER ... WITH per option set in params, the authentication of a user cannot be
+// altered so it is ignored
+func AlterUserStatements(databaseName, userName string, params *UserParams) ([]*Statement, error) {
+	name, err := QuoteName(userName)
+	if err != nil {
+		return nil, err
+	}
+	options := []string{}
+	if params != nil && params.Login != nil {
+		login, err := QuoteName(*params.Login)
+		if err != nil {
+			return nil, fmt.Errorf("invalid login: %w", err)
+		}
+		options = append(options, "LOGIN = "+login)
+	}
+	if params != nil && params.DefaultSchema != nil {
+		schema, err := QuoteName(*params.DefaultSchema)
+		if err != nil {
+			return nil, fmt.Errorf("invalid default schema: %w", err)
+		}
+		options = append(options, "DEFAULT_SCHEMA = "+schema)
+	}
+	altStatements := make([]*Statement, len(options))
+	for i, option := range options {
+		if altStatements[i], err = inDatabase(databaseName, fmt.Sprintf("ALTER USER %s WITH %s", name, option)); err != nil {
+			return nil, err
+		}
+	}
+	return altStatements, nil
+}
+
+// AlterUserPasswordStatement ALTER USER ... WITH PASSWORD of a contained user
+func AlterUserPasswordStatement(databaseName, userName, password string) (*Statement, error) {
+	name, err := QuoteName(userName)
+	if err != nil {
+		return nil, err
+	}
+	executor, err := databaseExecutor(databaseName)
+	if err != nil {
+		return nil, err
+	}
+	return withPassword(executor, fmt.Sprintf("ALTER USER %s WITH PASSWORD = ", name), "", password), nil
+}
+
+// DropUserStatement DROP USER in the database
+func DropUserStatement(databaseName, userName string) (*Statement, error) {
+	name, err := QuoteName(userName)
+	if err != nil {
+		return nil, err
+	}
+	return inDatabase(databaseName, fmt.Sprintf("DROP USER %s", name))
+}
+
+// ValidateRoleParams a managed role cannot be a fixed role, and its members as well as the roles it is a member of
+// must be identifiers other than the role itself
+func ValidateRoleParams(roleName string, params *RoleParams) error {
+	if err := validation.ValidateIdentifier(roleName); err != nil {
+		return fmt.Errorf("invalid role: %w", err)
+	}
+	if IsFixedRole(roleName) {
+		return fmt.Errorf("the fixed role %s cannot be managed, add the role to it with memberOf instead", roleName)
+	}
+	if params == nil {
+		return nil
+	}
+	for _, member := range params.Members {
+		if err := validation.ValidateIdentifier(member); err != nil {
+			return fmt.Errorf("invalid member: %w", err)
+		}
+		if strings.EqualFold(member, roleName) {
+			return fmt.Errorf("the role %s cannot be a member of itself", roleName)
+		}
+		if IsFixedRole(member) {
+			return fmt.Errorf("the fixed role %s cannot be a member of a role", member)
+		}
+	}
+	for _, role := range params.MemberOf {
+		if err := validation.ValidateIdentifier(role); err != nil {
+			return fmt.Errorf("invalid memberOf role: %w", err)
+		}
+		if strings.EqualFold(role, roleName) {
+			return fmt.Errorf("the role %s cannot be a member of itself", roleName)
+		}
+	}
+	return nil
+}
+
+// RoleStateStatement selects the database role as json from the sys.database_principals of the database along with
+// the names of its members and of the roles it is a member of from sys.database_role_members
+func RoleStateStatement(databaseName, roleName string) (*Statement, error) {
+	database, err := QuoteName(databaseName)
+	if err != nil {
+		return nil, err
+	}
+	return &Statement{
+		SQL: "SELECT r.[name], " +
+			"r.[principal_id] as [principalID], " +
+			"r.[is_fixed_role] as [isFixedRole], " +
+			"o.[name] as [owner], " +
+			"r.[create_date] as [createDate], " +
+			"(SELECT m.[name] FROM " + database + ".sys.database_role_members rm " +
+			"JOIN " + database + ".sys.database_principals m ON m.[principal_id] = rm.[member_principal_id] " +
+			"WHERE rm.[role_principal_id] = r.[principal_id] FOR JSON PATH) as [members], " +
+			"(SELECT p.[name] FROM " + database + ".sys.database_role_members rm " +
+			"JOIN " + database + ".sys.database_principals p ON p.[principal_id] = rm.[role_principal_id] " +
+			"WHERE rm.[member_principal_id] = r.[principal_id] FOR JSON PATH) as [memberOf] " +
+			"FROM " + database + ".sys.database_principals r " +
+			"LEFT JOIN " + database + ".sys.database_principals o ON o.[principal_id] = r.[owning_principal_id] " +
+			"WHERE r.[name] = @name AND r.[type] = 'R' " +
+			"FOR JSON PATH, ROOT ('role')",
+		Args: []interface{}{sql.Named("name", roleName)},
+	}, nil
+}
+
+// CreateRoleStatement CREATE ROLE in the database
+func CreateRoleStatement(databaseName, roleName string) (*Statement, error) {
+	name, err := QuoteName(roleName)
+	if err != nil {
+		return nil, err
+	}
+	return inDatabase(databaseName, fmt.Sprintf("CREATE ROLE %s", name))
+}
+
+// AddRoleMemberStatement ALTER ROLE ... ADD MEMBER in the database
+func AddRoleMemberStatement(databaseName, roleName, memberName string) (*Statement, error) {
+	return roleMemberStatement(databaseName, roleName, "ADD", memberName)
+}
+
+// DropRoleMemberStatement ALTER ROLE ... DROP MEMBER in the database
+func DropRoleMemberStatement(databaseName, roleName, memberName string) (*Statement, error) {
+	return roleMemberStatement(databaseName, roleName, "DROP", memberName)
+}
+
+func roleMemberStatement(databaseName, roleName, action, memberName string) (*Statement, error) {
+	name, err := QuoteName(roleName)
+	if err != nil {
+		return nil, err
+	}
+	member, err := QuoteName(memberName)
+	if err != nil {
+		return nil, fmt.Errorf("invalid member: %w", err)
+	}
+	return inDatabase(databaseName, fmt.Sprintf("ALTER ROLE %s %s MEMBER %s", name, action, member))
+}
+
+// DropRoleStatement DROP ROLE in the database
+func DropRoleStatement(databaseName, roleName string) (*Statement, error) {
+	name, err := QuoteName(roleName)
+	if err != nil {
+		return nil, err
+	}
+	return inDatabase(databaseName, fmt.Sprintf("DROP ROLE %s", name))
+}
+
+// ValidateSchema a managed schema cannot be a built-in schema, and its owner must be an identifier when set
+func ValidateSchema(schemaName, ownerName string) error {
+	if err := validation.ValidateIdentifier(schemaName); err != nil {
+		return fmt.Errorf("invalid schema: %w", err)
+	}
+	if IsBuiltInSchema(schemaName) {
+		return fmt.Errorf("the built-in schema %s cannot be managed", schemaName)
+	}
+	if ownerName == "" {
+		return nil
+	}
+	if err := validation.ValidateIdentifier(ownerName); err != nil {
+		return fmt.Errorf("invalid owner: %w", err)
+	}
+	return nil
+}
+
+// SchemaStateStatement selects the schema as json from the sys.schemas of the database along with the name of its
+// owner and the number of its rows of sys.objects
+func SchemaStateStatement(databaseName, schemaName string) (*Statement, error) {
+	database, err := QuoteName(databaseName)
+	if err != nil {
+		return nil, err
+	}
+	return &Statement{
+		SQL: "SELECT s.[name], " +
+			"s.[schema_id] as [schemaID], " +
+			"o.[name] as [owner], " +
+			"(SELECT COUNT(*) FROM " + database + ".sys.objects ob WHERE ob.[schema_id] = s.[schema_id]) as [objectCount] " +
+			"FROM " + database + ".sys.schemas s " +
+			"LEFT JOIN " + database + ".sys.database_principals o ON o.[principal_id] = s.[principal_id] " +
+			"WHERE s.[name] = @name " +
+			"FOR JSON PATH, ROOT ('schema')",
+		Args: []interface{}{sql.Named("name", schemaName)},
+	}, nil
+}
+
+// CreateSchemaStatement CREATE SCHEMA in the database, with AUTHORIZATION when ownerName is set
+func CreateSchemaStatement(databaseName, schemaName, ownerName string) (*Statement, error) {
+	if err := ValidateSchema(schemaName, ownerName); err != nil {
+		return nil, err
+	}
+	name, _ := QuoteName(schemaName)
+	if ownerName == "" {
+		return inDatabase(databaseName, fmt.Sprintf("CREATE SCHEMA %s", name))
+	}
+	owner, _ := QuoteName(ownerName)
+	return inDatabase(databaseName, fmt.Sprintf("CREATE SCHEMA %s AUTHORIZATION %s", name, owner))
+}
+
+// AlterSchemaOwnerStatement ALTER AUTHORIZATION ON SCHEMA:: in the database
+func AlterSchemaOwnerStatement(databaseName, schemaName, ownerName string) (*Statement, error) {
+	if ownerName == "" {
+		return nil, fmt.Errorf("invalid owner: the owner of the schema cannot be empty")
+	}
+	if err := ValidateSchema(schemaName, ownerName); err != nil {
+		return nil, err
+	}
+	name, _ := QuoteName(schemaName)
+	owner, _ := QuoteName(ownerName)
+	return inDatabase(databaseName, fmt.Sprintf("ALTER AUTHORIZATION ON SCHEMA::%s TO %s", name, owner))
+}
+
+// DropSchemaStatement DROP SCHEMA in the database
+func DropSchemaStatement(databaseName, schemaName string) (*Statement, error) {
+	if err := ValidateSchema(schemaName, ""); err != nil {
+		return nil, err
+	}
+	name, _ := QuoteName(schemaName)
+	return inDatabase(databaseName, fmt.Sprintf("DROP SCHEMA %s", name))
+}
+
+// ValidatePermission the permission must be made of words e.g. SELECT or VIEW DEFINITION on a securable of its
+// class with identifiers for names, and be granted or denied
+func ValidatePermission(permission *Permission) error {
+	if permission == nil {
+		return fmt.Errorf("permission cannot be nil")
+	}
+	if err := validation.ValidateIdentifier(permission.Principal); err != nil {
+		return fmt.Errorf("invalid principal: %w", err)
+	}
+	if !permissionPattern.MatchString(permission.Permission) {
+		return fmt.Errorf("invalid permission: %q, must be words such as SELECT or VIEW DEFINITION", permission.Permission)
+	}
+	switch permission.State {
+	case PermissionStateGrant, PermissionStateGrantWithGrantOption, PermissionStateDeny:
+	default:
+		return fmt.Errorf("invalid state: %q, must be one of %s, %s, %s", permission.State,
+			PermissionStateGrant, PermissionStateGrantWithGrantOption, PermissionStateDeny)
+	}
+	switch permission.Class {
+	case PermissionClassDatabase:
+		if permission.Schema != "" || permission.Object != "" {
+			return fmt.Errorf("a permission on the database cannot have a schema or an object")
+		}
+	case PermissionClassSchema:
+		if err := validation.ValidateIdentifier(permission.Schema); err != nil {
+			return fmt.Errorf("invalid schema: %w", err)
+		}
+		if permission.Object != "" {
+			return fmt.Errorf("a permission on a schema cannot have an object")
+		}
+	case PermissionClassObject:
+		if err := validation.ValidateIdentifier(permission.Schema); err != nil {
+			return fmt.Errorf("invalid schema: %w", err)
+		}
+		if err := validation.ValidateIdentifier(permission.Object); err != nil {
+			return fmt.Errorf("invalid object: %w", err)
+		}
+	default:
+		return fmt.Errorf("invalid class: %q, must be one of %s, %s, %s", permission.Class,
+			PermissionClassDatabase, PermissionClassSchema, PermissionClassObject)
+	}
+	return nil
+}
+
+// PermissionsStatement selects as json the rows of the sys.database_permissions of the database on the database,
+// its schemas and its objects, granted or denied to the principal or to every principal but the built-in ones and
+// the fixed roles when principalName is empty. Column permissions are left out
+func PermissionsStatement(databaseName, principalName string) (*Statement, error) {
+	database, err := QuoteName(databaseName)
+	if err != nil {
+		return nil, err
+	}
+	statement := &Statement{
+		SQL: "SELECT pr.[name] as [principal], " +
+			"dp.[class_desc] as [class], " +
+			"COALESCE(s.[name], os.[name]) as [schema], " +
+			"o.[name] as [object], " +
+			"dp.[permission_name] as [permission], " +
+			"dp.[state_desc] as [state] " +
+			"FROM " + database + ".sys.database_permissions dp " +
+			"JOIN " + database + ".sys.database_principals pr ON pr.[principal_id] = dp.[grantee_principal_id] " +
+			"LEFT JOIN " + database + ".sys.schemas s ON dp.[class] = 3 AND s.[schema_id] = dp.[major_id] " +
+			"LEFT JOIN " + database + ".sys.objects o ON dp.[class] = 1 AND o.[object_id] = dp.[major_id] " +
+			"LEFT JOIN " + database + ".sys.schemas os ON os.[schema_id] = o.[schema_id] " +
+			"WHERE dp.[class] IN (0, 1, 3) AND dp.[minor_id] = 0 AND ",
+	}
+	if principalName == "" {
+		// public, dbo, guest, INFORMATION_SCHEMA and sys
+		statement.SQL += "pr.[principal_id] > 4 AND pr.[is_fixed_role] = 0 "
+	} else {
+		statement.SQL += "pr.[name] = @principal "
+		statement.Args = []interface{}{sql.Named("principal", principalName)}
+	}
+	statement.SQL += "FOR JSON PATH, ROOT ('permission')"
+	return statement, nil
+}
+
+// ApplyPermissionStatement the GRANT, DENY or REVOKE in the database taking the row of the permission from the
+// observed state to the desired one, the permission is revoked when desired is nil. A grant option is revoked
+// with CASCADE, along with the permissions the principal granted with it
+func ApplyPermissionStatement(databaseName string, desired, observed *Permission) (*Statement, error) {
+	target := desired
+	if target == nil {
+		target = observed
+	}
+	if target == nil {
+		return nil, fmt.Errorf("either the desired or the observed permission must be set")
+	}
+	if err := ValidatePermission(target); err != nil {
+		return nil, err
+	}
+	principal, _ := QuoteName(target.Principal)
+	permission := strings.ToUpper(target.Permission)
+	on := ""
+	switch target.Class {
+	case PermissionClassSchema:
+		schema, _ := QuoteName(target.Schema)
+		on = " ON SCHEMA::" + schema
+	case PermissionClassObject:
+		schema, _ := QuoteName(target.Schema)
+		object, _ := QuoteName(target.Object)
+		on = " ON OBJECT::" + schema + "." + object
+	}
+	cascade := ""
+	if observed != nil && observed.State == PermissionStateGrantWithGrantOption {
+		cascade = " CASCADE"
+	}
+
+	var statement string
+	switch {
+	case desired == nil:
+		statement = fmt.Sprintf("REVOKE %s%s FROM %s%s", permission, on, principal, cascade)
+	case desired.State == PermissionStateDeny:
+		statement = fmt.Sprintf("DENY %s%s TO %s%s", permission, on, principal, cascade)
+	case desired.State == PermissionStateGrantWithGrantOption:
+		statement = fmt.Sprintf("GRANT %s%s TO %s WITH GRANT OPTION", permission, on, principal)
+	case cascade != "":
+		statement = fmt.Sprintf("REVOKE GRANT OPTION FOR %s%s FROM %s CASCADE", permission, on, principal)
+	default:
+		statement = fmt.Sprintf("GRANT %s%s TO %s", permission, on, principal)
+	}
+	return inDatabase(databaseName, statement)
+}
@@ -0,0 +1,111 @@
+//go:build go1.18
+// +build go1.18
+
+package internal
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/pplavetzki/azure-sql-mi/internal/validation"
+)
+
+var alterClausePattern = regexp.MustCompile(`^ SET (PARAMETERIZATION (SIMPLE|FORCED)|ALLOW_SNAPSHOT_ISOLATION (ON|OFF)|READ_COMMITTED_SNAPSHOT (ON|OFF) WITH ROLLBACK AFTER 10 SECONDS|COMPATIBILITY_LEVEL = (100|110|120|130|140|150|160))$`)
+
+// FuzzDropDatabaseStatement the database name can only ever be the identifier being dropped
+func FuzzDropDatabaseStatement(f *testing.F) {
+	for _, seed := range []string{"MyDatabase", "x; DROP DATABASE prod", "x]; DROP DATABASE prod; --", "]]", "[", "'"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, databaseName string) {
+		stmt, err := DropDatabaseStatement(databaseName)
+		if err != nil {
+			if validation.ValidateIdentifier(databaseName) == nil {
+				t.Fatalf("valid identifier %q was rejected: %v", databaseName, err)
+			}
+			return
+		}
+		const prefix = "DROP DATABASE "
+		if !strings.HasPrefix(stmt.SQL, prefix) {
+			t.Fatalf("unexpected statement: %s", stmt.SQL)
+		}
+		name, rest, ok := unquoteName(stmt.SQL[len(prefix):])
+		if !ok || name != databaseName || rest != "" {
+			t.Fatalf("database name %q escaped its identifier: %s", databaseName, stmt.SQL)
+		}
+	})
+}
+
+// FuzzCreateDatabaseStatement neither the name nor the collation can add clauses to CREATE DATABASE
+func FuzzCreateDatabaseStatement(f *testing.F) {
+	f.Add("MyDatabase", "SQL_Latin1_General_CP1_CS_AS")
+	f.Add("x]; DROP DATABASE prod; --", "Latin1_General_100_CI_AS_SC_UTF8")
+	f.Add("MyDatabase", "Latin1; DROP DATABASE prod")
+	f.Fuzz(func(t *testing.T, databaseName, collation string) {
+		stmt, err := CreateDatabaseStatement(databaseName, &DatabaseParams{Collation: &collation})
+		if err != nil {
+			return
+		}
+		const prefix = "CREATE DATABASE "
+		if !strings.HasPrefix(stmt.SQL, prefix) {
+			t.Fatalf("unexpected statement: %s", stmt.SQL)
+		}
+		name, rest, ok := unquoteName(stmt.SQL[len(prefix):])
+		if !ok || name != databaseName {
+			t.Fatalf("database name %q escaped its identifier: %s", databaseName, stmt.SQL)
+		}
+		if rest != " COLLATE "+collation || validation.ValidateCollation(collation) != nil {
+			t.Fatalf("collation %q escaped its position: %s", collation, stmt.SQL)
+		}
+	})
+}
+
+// FuzzAlterDatabaseStatements every ALTER only sets an allow-listed option of the named database
+func FuzzAlterDatabaseStatements(f *testing.F) {
+	f.Add("MyDatabase", "simple", true, false, 150)
+	f.Add("x]; DROP DATABASE prod; --", "forced; DROP DATABASE prod", false, true, 0)
+	f.Fuzz(func(t *testing.T, databaseName, parameterization string, snapshot, readCommittedSnapshot bool, level int) {
+		stmts, err := AlterDatabaseStatements(databaseName, &DatabaseParams{
+			Parameterization:           &parameterization,
+			AllowSnapshotIsolation:     &snapshot,
+			AllowReadCommittedSnapshot: &readCommittedSnapshot,
+			CompatibilityLevel:         &level,
+		})
+		if err != nil {
+			return
+		}
+		const prefix = "ALTER DATABASE "
+		for _, stmt := range stmts {
+			if !strings.HasPrefix(stmt.SQL, prefix) {
+				t.Fatalf("unexpected statement: %s", stmt.SQL)
+			}
+			name, rest, ok := unquoteName(stmt.SQL[len(prefix):])
+			if !ok || name != databaseName {
+				t.Fatalf("database name %q escaped its identifier: %s", databaseName, stmt.SQL)
+			}
+			if !alterClausePattern.MatchString(rest) {
+				t.Fatalf("option escaped its position: %s", stmt.SQL)
+			}
+		}
+	})
+}
+
+// FuzzQueryParameters values used to look up databases are never part of the SQL text
+func FuzzQueryParameters(f *testing.F) {
+	f.Add("MyDatabase")
+	f.Add("x'; DROP DATABASE prod; --")
+	builders := []func(string) *Statement{
+		DatabaseIDStatement,
+		DatabaseNameStatement,
+		DatabaseExistsStatement,
+		DatabaseStateStatement,
+	}
+	f.Fuzz(func(t *testing.T, value string) {
+		for _, build := range builders {
+			if stmt := build(value); stmt.SQL != build("").SQL {
+				t.Fatalf("value %q changed the statement: %s", value, stmt.SQL)
+			}
+		}
+	})
+}
@@ -0,0 +1,624 @@
+package internal
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/pplavetzki/azure-sql-mi/internal/validation"
+)
+
+// unquoteName reads the bracket quoted identifier at the start of s, returning the identifier and the
+// remainder of s after the closing bracket
+func unquoteName(s string) (string, string, bool) {
+	if !strings.HasPrefix(s, "[") {
+		return "", s, false
+	}
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		if s[i] != ']' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+1 < len(s) && s[i+1] == ']' {
+			b.WriteByte(']')
+			i++
+			continue
+		}
+		return b.String(), s[i+1:], true
+	}
+	return "", s, false
+}
+
+func TestQuoteName(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"MyDatabase", "[MyDatabase]"},
+		{"my db", "[my db]"},
+		{"x; DROP DATABASE prod", "[x; DROP DATABASE prod]"},
+		{"x]; DROP DATABASE prod; --", "[x]]; DROP DATABASE prod; --]"},
+		{"[already]", "[[already]]]"},
+		{"O'Brien", "[O'Brien]"},
+	}
+	for _, tt := range tests {
+		quoted, err := QuoteName(tt.name)
+		if err != nil {
+			t.Fatalf("QuoteName(%q) returned error: %v", tt.name, err)
+		}
+		if quoted != tt.expected {
+			t.Errorf("QuoteName(%q) = %q, expected %q", tt.name, quoted, tt.expected)
+		}
+		name, rest, ok := unquoteName(quoted)
+		if !ok || name != tt.name || rest != "" {
+			t.Errorf("unquoteName(%q) = %q, %q, %v", quoted, name, rest, ok)
+		}
+	}
+}
+
+func TestQuoteNameRejectsInvalidIdentifiers(t *testing.T) {
+	for _, name := range []string{"", strings.Repeat("a", validation.MaxIdentifierLength+1), "a\x00b"} {
+		if _, err := QuoteName(name); err == nil {
+			t.Errorf("QuoteName(%q) expected an error", name)
+		}
+	}
+	if _, err := QuoteName(strings.Repeat("é", validation.MaxIdentifierLength)); err != nil {
+		t.Errorf("QuoteName of %d runes returned error: %v", validation.MaxIdentifierLength, err)
+	}
+}
+
+func TestDropDatabaseStatement(t *testing.T) {
+	stmt, err := DropDatabaseStatement("x; DROP DATABASE prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stmt.SQL != "DROP DATABASE [x; DROP DATABASE prod]" {
+		t.Errorf("unexpected statement: %s", stmt.SQL)
+	}
+	if len(stmt.Args) != 0 {
+		t.Errorf("unexpected args: %v", stmt.Args)
+	}
+}
+
+func TestCreateDatabaseStatement(t *testing.T) {
+	stmt, err := CreateDatabaseStatement("MyDatabase", &DatabaseParams{Collation: SetString("SQL_Latin1_General_CP1_CS_AS")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stmt.SQL != "CREATE DATABASE [MyDatabase] COLLATE SQL_Latin1_General_CP1_CS_AS" {
+		t.Errorf("unexpected statement: %s", stmt.SQL)
+	}
+	for _, collation := range []string{"", "Latin1; DROP DATABASE prod", "Latin1 --", "1Latin", "Latin1]"} {
+		if _, err := CreateDatabaseStatement("MyDatabase", &DatabaseParams{Collation: &collation}); err == nil {
+			t.Errorf("collation %q expected an error", collation)
+		}
+	}
+}
+
+func TestAlterDatabaseStatements(t *testing.T) {
+	parameterization := "forced"
+	snapshot := true
+	readCommittedSnapshot := false
+	level := 150
+	stmts, err := AlterDatabaseStatements("My]Db", &DatabaseParams{
+		Parameterization:           &parameterization,
+		AllowSnapshotIsolation:     &snapshot,
+		AllowReadCommittedSnapshot: &readCommittedSnapshot,
+		CompatibilityLevel:         &level,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"ALTER DATABASE [My]]Db] SET PARAMETERIZATION FORCED",
+		"ALTER DATABASE [My]]Db] SET ALLOW_SNAPSHOT_ISOLATION ON",
+		"ALTER DATABASE [My]]Db] SET READ_COMMITTED_SNAPSHOT OFF WITH ROLLBACK AFTER 10 SECONDS",
+		"ALTER DATABASE [My]]Db] SET COMPATIBILITY_LEVEL = 150",
+	}
+	if len(stmts) != len(expected) {
+		t.Fatalf("expected %d statements, got %d", len(expected), len(stmts))
+	}
+	for i, stmt := range stmts {
+		if stmt.SQL != expected[i] {
+			t.Errorf("statement %d = %q, expected %q", i, stmt.SQL, expected[i])
+		}
+	}
+
+	bad := "simple; DROP DATABASE prod"
+	if _, err := AlterDatabaseStatements("MyDb", &DatabaseParams{Parameterization: &bad}); err == nil {
+		t.Error("expected an error for an invalid parameterization")
+	}
+	badLevel := 999
+	if _, err := AlterDatabaseStatements("MyDb", &DatabaseParams{CompatibilityLevel: &badLevel}); err == nil {
+		t.Error("expected an error for an invalid compatibility level")
+	}
+}
+
+func TestQueriesUseParameters(t *testing.T) {
+	value := "x'; DROP DATABASE prod; --"
+	for _, stmt := range []*Statement{
+		DatabaseIDStatement(value),
+		DatabaseNameStatement(value),
+		DatabaseExistsStatement(value),
+		DatabaseStateStatement(value),
+		LoginExistsStatement(value),
+	} {
+		if strings.Contains(stmt.SQL, value) {
+			t.Errorf("value was formatted into the statement: %s", stmt.SQL)
+		}
+		if len(stmt.Args) != 1 {
+			t.Fatalf("expected one argument, got %v", stmt.Args)
+		}
+		if arg, ok := stmt.Args[0].(sql.NamedArg); !ok || arg.Value != value {
+			t.Errorf("unexpected argument: %v", stmt.Args[0])
+		}
+	}
+}
+
+func TestRenameDatabaseStatement(t *testing.T) {
+	stmt, err := RenameDatabaseStatement("My]Db", "My]Db_deleted_20211016120000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "ALTER DATABASE [My]]Db] MODIFY NAME = [My]]Db_deleted_20211016120000]"; stmt.SQL != expected {
+		t.Errorf("statement = %q, expected %q", stmt.SQL, expected)
+	}
+	if _, err := RenameDatabaseStatement("MyDb", ""); err == nil {
+		t.Error("expected an error for an empty new name")
+	}
+}
+
+func TestBackupDatabaseStatement(t *testing.T) {
+	path := "/var/opt/mssql/backups/x'; DROP DATABASE prod; --.bak"
+	stmt, err := BackupDatabaseStatement("My]Db", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "BACKUP DATABASE [My]]Db] TO DISK = @path WITH COPY_ONLY"; stmt.SQL != expected {
+		t.Errorf("statement = %q, expected %q", stmt.SQL, expected)
+	}
+	if arg, ok := stmt.Args[0].(sql.NamedArg); !ok || arg.Value != path {
+		t.Errorf("unexpected argument: %v", stmt.Args[0])
+	}
+	if _, err := BackupDatabaseStatement("MyDb", ""); err == nil {
+		t.Error("expected an error for an empty path")
+	}
+}
+
+func TestCreateLoginStatement(t *testing.T) {
+	password := "x'; DROP LOGIN sa; --"
+	policy, expiration := true, true
+	stmt, err := CreateLoginStatement("O'Brien]", password, &LoginParams{
+		DefaultDatabase: SetString("MyDb"),
+		CheckPolicy:     &policy,
+		CheckExpiration: &expiration,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "DECLARE @sql nvarchar(max) = N'CREATE LOGIN [O''Brien]]] WITH PASSWORD = ' + N'N''' + REPLACE(@password, N'''', N'''''') + N'''' + " +
+		"N', DEFAULT_DATABASE = [MyDb], CHECK_POLICY = ON, CHECK_EXPIRATION = ON'; EXEC sp_executesql @sql"
+	if stmt.SQL != expected {
+		t.Errorf("statement = %q, expected %q", stmt.SQL, expected)
+	}
+	if strings.Contains(stmt.SQL, password) {
+		t.Errorf("password was formatted into the statement: %s", stmt.SQL)
+	}
+	if arg, ok := stmt.Args[0].(sql.NamedArg); !ok || arg.Name != "password" || arg.Value != password {
+		t.Errorf("unexpected argument: %v", stmt.Args[0])
+	}
+
+	policy = false
+	if _, err := CreateLoginStatement("MyLogin", password, &LoginParams{CheckPolicy: &policy, CheckExpiration: &expiration}); err == nil {
+		t.Error("expected an error for check expiration without check policy")
+	}
+}
+
+func TestAlterLoginStatements(t *testing.T) {
+	policy, expiration := false, false
+	stmts, err := AlterLoginStatements("My]Login", &LoginParams{
+		DefaultDatabase: SetString("master"),
+		DefaultLanguage: SetString("us_english"),
+		CheckPolicy:     &policy,
+		CheckExpiration: &expiration,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"ALTER LOGIN [My]]Login] WITH DEFAULT_DATABASE = [master]",
+		"ALTER LOGIN [My]]Login] WITH DEFAULT_LANGUAGE = [us_english]",
+		"ALTER LOGIN [My]]Login] WITH CHECK_EXPIRATION = OFF",
+		"ALTER LOGIN [My]]Login] WITH CHECK_POLICY = OFF",
+	}
+	if len(stmts) != len(expected) {
+		t.Fatalf("expected %d statements, got %d", len(expected), len(stmts))
+	}
+	for i, stmt := range stmts {
+		if stmt.SQL != expected[i] {
+			t.Errorf("statement %d = %q, expected %q", i, stmt.SQL, expected[i])
+		}
+	}
+	if _, err := AlterLoginStatements("MyLogin", &LoginParams{DefaultDatabase: SetString("a\x00b")}); err == nil {
+		t.Error("expected an error for an invalid default database")
+	}
+}
+
+func TestAlterLoginPasswordStatement(t *testing.T) {
+	stmt, err := AlterLoginPasswordStatement("MyLogin", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "DECLARE @sql nvarchar(max) = N'ALTER LOGIN [MyLogin] WITH PASSWORD = ' + N'N''' + REPLACE(@password, N'''', N'''''') + N'''' + N''; EXEC sp_executesql @sql"
+	if stmt.SQL != expected {
+		t.Errorf("statement = %q, expected %q", stmt.SQL, expected)
+	}
+}
+
+func TestLoginStateStatement(t *testing.T) {
+	value := "x'; DROP LOGIN sa; --"
+	stmt := LoginStateStatement(value, value)
+	if strings.Contains(stmt.SQL, value) {
+		t.Errorf("value was formatted into the statement: %s", stmt.SQL)
+	}
+	if len(stmt.Args) != 2 {
+		t.Fatalf("expected two arguments, got %v", stmt.Args)
+	}
+}
+
+func TestCreateUserStatement(t *testing.T) {
+	stmt, err := CreateUserStatement("App", "O'Brien]", "", &UserParams{
+		Authentication: AuthenticationInstance,
+		Login:          SetString("app'login"),
+		DefaultSchema:  SetString("sales"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "EXEC [App].sys.sp_executesql N'CREATE USER [O''Brien]]] FOR LOGIN [app''login] WITH DEFAULT_SCHEMA = [sales]'"
+	if stmt.SQL != expected {
+		t.Errorf("statement = %q, expected %q", stmt.SQL, expected)
+	}
+
+	stmt, err = CreateUserStatement("App", "Owner", "", &UserParams{Authentication: AuthenticationNone})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "EXEC [App].sys.sp_executesql N'CREATE USER [Owner] WITHOUT LOGIN'"; stmt.SQL != expected {
+		t.Errorf("statement = %q, expected %q", stmt.SQL, expected)
+	}
+
+	password := "x'; DROP USER dbo; --"
+	stmt, err = CreateUserStatement("My]Db", "App", password, &UserParams{
+		Authentication: AuthenticationDatabase,
+		DefaultSchema:  SetString("dbo"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = "DECLARE @sql nvarchar(max) = N'CREATE USER [App] WITH PASSWORD = ' + N'N''' + REPLACE(@password, N'''', N'''''') + N'''' + " +
+		"N', DEFAULT_SCHEMA = [dbo]'; EXEC [My]]Db].sys.sp_executesql @sql"
+	if stmt.SQL != expected {
+		t.Errorf("statement = %q, expected %q", stmt.SQL, expected)
+	}
+	if strings.Contains(stmt.SQL, password) {
+		t.Errorf("password was formatted into the statement: %s", stmt.SQL)
+	}
+
+	for _, params := range []*UserParams{
+		{Authentication: AuthenticationInstance},
+		{Authentication: AuthenticationNone, Login: SetString("app")},
+		{Authentication: "EXTERNAL"},
+		nil,
+	} {
+		if _, err := CreateUserStatement("App", "App", "secret", params); err == nil {
+			t.Errorf("expected an error for %+v", params)
+		}
+	}
+	if _, err := CreateUserStatement("App", "App", "", &UserParams{Authentication: AuthenticationDatabase}); err == nil {
+		t.Error("expected an error for a contained user without a password")
+	}
+}
+
+func TestAlterUserStatements(t *testing.T) {
+	stmts, err := AlterUserStatements("App", "My]User", &UserParams{
+		Authentication: AuthenticationInstance,
+		Login:          SetString("app"),
+		DefaultSchema:  SetString("sales"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"EXEC [App].sys.sp_executesql N'ALTER USER [My]]User] WITH LOGIN = [app]'",
+		"EXEC [App].sys.sp_executesql N'ALTER USER [My]]User] WITH DEFAULT_SCHEMA = [sales]'",
+	}
+	if len(stmts) != len(expected) {
+		t.Fatalf("expected %d statements, got %d", len(expected), len(stmts))
+	}
+	for i, stmt := range stmts {
+		if stmt.SQL != expected[i] {
+			t.Errorf("statement %d = %q, expected %q", i, stmt.SQL, expected[i])
+		}
+	}
+	empty := ""
+	if _, err := AlterUserStatements("App", "MyUser", &UserParams{DefaultSchema: &empty}); err == nil {
+		t.Error("expected an error for an empty default schema")
+	}
+}
+
+func TestAlterUserPasswordStatement(t *testing.T) {
+	stmt, err := AlterUserPasswordStatement("App", "MyUser", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "DECLARE @sql nvarchar(max) = N'ALTER USER [MyUser] WITH PASSWORD = ' + N'N''' + REPLACE(@password, N'''', N'''''') + N'''' + N''; EXEC [App].sys.sp_executesql @sql"
+	if stmt.SQL != expected {
+		t.Errorf("statement = %q, expected %q", stmt.SQL, expected)
+	}
+}
+
+func TestUserStatements(t *testing.T) {
+	value := "x'; DROP DATABASE prod; --"
+	stmt, err := UserStateStatement("My]Db", value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stmt.SQL, "FROM [My]]Db].sys.database_principals ") {
+		t.Errorf("expected the principals of the database, got %s", stmt.SQL)
+	}
+	if strings.Contains(stmt.SQL, value) {
+		t.Errorf("value was formatted into the statement: %s", stmt.SQL)
+	}
+	if arg, ok := stmt.Args[0].(sql.NamedArg); !ok || arg.Name != "name" || arg.Value != value {
+		t.Errorf("unexpected argument: %v", stmt.Args[0])
+	}
+
+	drop, err := DropUserStatement("App", "My'User")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "EXEC [App].sys.sp_executesql N'DROP USER [My''User]'"; drop.SQL != expected {
+		t.Errorf("statement = %q, expected %q", drop.SQL, expected)
+	}
+	if _, err := DropUserStatement("", "MyUser"); err == nil {
+		t.Error("expected an error for an empty database name")
+	}
+}
+
+func TestValidateRoleParams(t *testing.T) {
+	valid := &RoleParams{Members: []string{"app", "reporting"}, MemberOf: []string{"db_datareader"}}
+	if err := ValidateRoleParams("app_readers", valid); err != nil {
+		t.Errorf("expected valid params, got %v", err)
+	}
+	invalid := map[string]*RoleParams{
+		"db_datareader": nil,
+		"app_readers":   {Members: []string{"app_readers"}},
+		"app_writers":   {Members: []string{"db_datawriter"}},
+		"app_owners":    {MemberOf: []string{"App_Owners"}},
+		"app_admins":    {Members: []string{""}},
+	}
+	for role, params := range invalid {
+		if err := ValidateRoleParams(role, params); err == nil {
+			t.Errorf("expected %s with %+v to be invalid", role, params)
+		}
+	}
+}
+
+func TestRoleStatements(t *testing.T) {
+	value := "x'; DROP DATABASE prod; --"
+	stmt, err := RoleStateStatement("My]Db", value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stmt.SQL, "FROM [My]]Db].sys.database_principals r ") ||
+		!strings.Contains(stmt.SQL, "[My]]Db].sys.database_role_members rm ") {
+		t.Errorf("expected the principals and the role members of the database, got %s", stmt.SQL)
+	}
+	if strings.Contains(stmt.SQL, value) {
+		t.Errorf("value was formatted into the statement: %s", stmt.SQL)
+	}
+
+	tests := []struct {
+		build    func() (*Statement, error)
+		expected string
+	}{
+		{
+			build:    func() (*Statement, error) { return CreateRoleStatement("App", "app_readers") },
+			expected: "EXEC [App].sys.sp_executesql N'CREATE ROLE [app_readers]'",
+		},
+		{
+			build:    func() (*Statement, error) { return AddRoleMemberStatement("App", "db_datareader", "O'Brien") },
+			expected: "EXEC [App].sys.sp_executesql N'ALTER ROLE [db_datareader] ADD MEMBER [O''Brien]'",
+		},
+		{
+			build:    func() (*Statement, error) { return DropRoleMemberStatement("App", "app_readers", "app") },
+			expected: "EXEC [App].sys.sp_executesql N'ALTER ROLE [app_readers] DROP MEMBER [app]'",
+		},
+		{
+			build:    func() (*Statement, error) { return DropRoleStatement("App", "app_readers") },
+			expected: "EXEC [App].sys.sp_executesql N'DROP ROLE [app_readers]'",
+		},
+	}
+	for _, tt := range tests {
+		stmt, err := tt.build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stmt.SQL != tt.expected {
+			t.Errorf("statement = %q, expected %q", stmt.SQL, tt.expected)
+		}
+	}
+	if _, err := AddRoleMemberStatement("App", "app_readers", ""); err == nil {
+		t.Error("expected an error for an empty member")
+	}
+}
+
+func TestValidateSchema(t *testing.T) {
+	if err := ValidateSchema("sales", "app"); err != nil {
+		t.Errorf("expected a valid schema, got %v", err)
+	}
+	if err := ValidateSchema("sales", ""); err != nil {
+		t.Errorf("expected a schema without owner to be valid, got %v", err)
+	}
+	for _, schema := range []string{"", "dbo", "SYS", "information_schema", "db_datareader"} {
+		if err := ValidateSchema(schema, "app"); err == nil {
+			t.Errorf("expected the schema %q to be invalid", schema)
+		}
+	}
+}
+
+func TestSchemaStatements(t *testing.T) {
+	value := "x'; DROP DATABASE prod; --"
+	stmt, err := SchemaStateStatement("My]Db", value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stmt.SQL, "FROM [My]]Db].sys.schemas s ") ||
+		!strings.Contains(stmt.SQL, "[My]]Db].sys.objects ob ") {
+		t.Errorf("expected the schemas and the objects of the database, got %s", stmt.SQL)
+	}
+	if strings.Contains(stmt.SQL, value) {
+		t.Errorf("value was formatted into the statement: %s", stmt.SQL)
+	}
+
+	tests := []struct {
+		build    func() (*Statement, error)
+		expected string
+	}{
+		{
+			build:    func() (*Statement, error) { return CreateSchemaStatement("App", "sales", "") },
+			expected: "EXEC [App].sys.sp_executesql N'CREATE SCHEMA [sales]'",
+		},
+		{
+			build:    func() (*Statement, error) { return CreateSchemaStatement("App", "sales", "O'Brien") },
+			expected: "EXEC [App].sys.sp_executesql N'CREATE SCHEMA [sales] AUTHORIZATION [O''Brien]'",
+		},
+		{
+			build:    func() (*Statement, error) { return AlterSchemaOwnerStatement("App", "sales", "app") },
+			expected: "EXEC [App].sys.sp_executesql N'ALTER AUTHORIZATION ON SCHEMA::[sales] TO [app]'",
+		},
+		{
+			build:    func() (*Statement, error) { return DropSchemaStatement("App", "sales") },
+			expected: "EXEC [App].sys.sp_executesql N'DROP SCHEMA [sales]'",
+		},
+	}
+	for _, tt := range tests {
+		stmt, err := tt.build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stmt.SQL != tt.expected {
+			t.Errorf("statement = %q, expected %q", stmt.SQL, tt.expected)
+		}
+	}
+	if _, err := AlterSchemaOwnerStatement("App", "sales", ""); err == nil {
+		t.Error("expected an error for an empty owner")
+	}
+	if _, err := DropSchemaStatement("App", "dbo"); err == nil {
+		t.Error("expected an error for a built-in schema")
+	}
+}
+
+func TestValidatePermission(t *testing.T) {
+	valid := Permission{Principal: "app", Class: PermissionClassObject, Schema: "sales", Object: "orders", Permission: "VIEW DEFINITION", State: PermissionStateGrant}
+	if err := ValidatePermission(&valid); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		change func(*Permission)
+	}{
+		{name: "injected permission", change: func(p *Permission) { p.Permission = "SELECT TO [x]; DROP DATABASE prod; --" }},
+		{name: "double space", change: func(p *Permission) { p.Permission = "VIEW  DEFINITION" }},
+		{name: "empty principal", change: func(p *Permission) { p.Principal = "" }},
+		{name: "revoke state", change: func(p *Permission) { p.State = "REVOKE" }},
+		{name: "object without name", change: func(p *Permission) { p.Object = "" }},
+		{name: "database with schema", change: func(p *Permission) { p.Class = PermissionClassDatabase; p.Object = "" }},
+		{name: "schema with object", change: func(p *Permission) { p.Class = PermissionClassSchema }},
+		{name: "column class", change: func(p *Permission) { p.Class = "COLUMN" }},
+	}
+	for _, tt := range tests {
+		p := valid
+		tt.change(&p)
+		if err := ValidatePermission(&p); err == nil {
+			t.Errorf("%s: expected an error for %+v", tt.name, p)
+		}
+	}
+}
+
+func TestPermissionStatements(t *testing.T) {
+	value := "x'; DROP DATABASE prod; --"
+	stmt, err := PermissionsStatement("My]Db", value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stmt.SQL, "FROM [My]]Db].sys.database_permissions dp ") || !strings.Contains(stmt.SQL, "pr.[name] = @principal ") {
+		t.Errorf("expected the permissions of the principal in the database, got %s", stmt.SQL)
+	}
+	if strings.Contains(stmt.SQL, value) {
+		t.Errorf("value was formatted into the statement: %s", stmt.SQL)
+	}
+	if stmt, _ = PermissionsStatement("App", ""); len(stmt.Args) != 0 || !strings.Contains(stmt.SQL, "pr.[principal_id] > 4 ") {
+		t.Errorf("expected the permissions of every principal, got %s", stmt.SQL)
+	}
+
+	onSchema := func(state string) *Permission {
+		return &Permission{Principal: "O'Brien", Class: PermissionClassSchema, Schema: "sales", Permission: "select", State: state}
+	}
+	onDatabase := &Permission{Principal: "app", Class: PermissionClassDatabase, Permission: "VIEW DEFINITION", State: PermissionStateGrant}
+	onObject := &Permission{Principal: "app", Class: PermissionClassObject, Schema: "dbo", Object: "Orders", Permission: "EXECUTE", State: PermissionStateGrantWithGrantOption}
+	tests := []struct {
+		desired, observed *Permission
+		expected          string
+	}{
+		{
+			desired:  onSchema(PermissionStateGrant),
+			expected: "EXEC [App].sys.sp_executesql N'GRANT SELECT ON SCHEMA::[sales] TO [O''Brien]'",
+		},
+		{
+			desired:  onDatabase,
+			expected: "EXEC [App].sys.sp_executesql N'GRANT VIEW DEFINITION TO [app]'",
+		},
+		{
+			desired:  onObject,
+			expected: "EXEC [App].sys.sp_executesql N'GRANT EXECUTE ON OBJECT::[dbo].[Orders] TO [app] WITH GRANT OPTION'",
+		},
+		{
+			desired:  onSchema(PermissionStateDeny),
+			observed: onSchema(PermissionStateGrant),
+			expected: "EXEC [App].sys.sp_executesql N'DENY SELECT ON SCHEMA::[sales] TO [O''Brien]'",
+		},
+		{
+			desired:  onSchema(PermissionStateDeny),
+			observed: onSchema(PermissionStateGrantWithGrantOption),
+			expected: "EXEC [App].sys.sp_executesql N'DENY SELECT ON SCHEMA::[sales] TO [O''Brien] CASCADE'",
+		},
+		{
+			desired:  onSchema(PermissionStateGrant),
+			observed: onSchema(PermissionStateGrantWithGrantOption),
+			expected: "EXEC [App].sys.sp_executesql N'REVOKE GRANT OPTION FOR SELECT ON SCHEMA::[sales] FROM [O''Brien] CASCADE'",
+		},
+		{
+			observed: onSchema(PermissionStateDeny),
+			expected: "EXEC [App].sys.sp_executesql N'REVOKE SELECT ON SCHEMA::[sales] FROM [O''Brien]'",
+		},
+		{
+			observed: onObject,
+			expected: "EXEC [App].sys.sp_executesql N'REVOKE EXECUTE ON OBJECT::[dbo].[Orders] FROM [app] CASCADE'",
+		},
+	}
+	for _, tt := range tests {
+		stmt, err := ApplyPermissionStatement("App", tt.desired, tt.observed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stmt.SQL != tt.expected {
+			t.Errorf("statement = %q, expected %q", stmt.SQL, tt.expected)
+		}
+	}
+	if _, err := ApplyPermissionStatement("App", nil, nil); err == nil {
+		t.Error("expected an error without a permission")
+	}
+}
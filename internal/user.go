@@ -0,0 +1,274 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// authentication types of a database user as listed in sys.database_principals.authentication_type_desc
+const (
+	// AuthenticationInstance the user is mapped to a login, CREATE USER ... FOR LOGIN
+	AuthenticationInstance = "INSTANCE"
+	// AuthenticationDatabase the user is contained in the database with a password, CREATE USER ... WITH PASSWORD
+	AuthenticationDatabase = "DATABASE"
+	// AuthenticationNone the user cannot authenticate, CREATE USER ... WITHOUT LOGIN
+	AuthenticationNone = "NONE"
+)
+
+// names of the user options compared by DiffUser, they match the json names of the DatabaseUserSpec fields
+const (
+	OptionUserType      = "type"
+	OptionLogin         = "login"
+	OptionDefaultSchema = "defaultSchema"
+)
+
+// UserParams the authentication and the options of a database user, nil options are left as they are
+type UserParams struct {
+	// Authentication one of AuthenticationInstance, AuthenticationDatabase or AuthenticationNone
+	Authentication string
+	// Login the login the user is mapped to, AuthenticationInstance only
+	Login         *string
+	DefaultSchema *string
+}
+
+// UserState a database user as selected from sys.database_principals
+type UserState struct {
+	Name        string `json:"name"`
+	PrincipalID int    `json:"principalID"`
+	// SID the security identifier as a hex string e.g. 0x5A3B..., the sid of the login for a user mapped to a login
+	SID string `json:"sid"`
+	// TypeDesc type_desc of the principal e.g. SQL_USER
+	TypeDesc           string `json:"typeDesc"`
+	AuthenticationType string `json:"authenticationType"`
+	DefaultSchema      string `json:"defaultSchema"`
+	// Login the name of the login with the sid of the user, empty when there is none
+	Login      string `json:"login"`
+	CreateDate string `json:"createDate"`
+}
+
+// Created the create date of the user, like the create date of a database it has no time zone
+func (s *UserState) Created() (time.Time, error) {
+	return time.ParseInLocation(CreateDateLayout, s.CreateDate, time.UTC)
+}
+
+type UserSync struct {
+	User []UserState `json:"user"`
+}
+
+// UserDiff the comparison of the authentication and the options of a database user
+type UserDiff struct {
+	Fields []FieldDiff `json:"fields"`
+
+	remediation *UserParams
+}
+
+// Drifted the options whose observed value differs from the desired value
+func (d *UserDiff) Drifted() []FieldDiff {
+	drifted := []FieldDiff{}
+	for _, f := range d.Fields {
+		if f.Drifted {
+			drifted = append(drifted, f)
+		}
+	}
+	return drifted
+}
+
+// HasDrift whether any option drifted
+func (d *UserDiff) HasDrift() bool {
+	return len(d.Drifted()) > 0
+}
+
+// Remediation the desired values of every drifted remediable option ready to be handed to AlterUser, nil when
+// there is nothing to remediate
+func (d *UserDiff) Remediation() *UserParams {
+	return d.remediation
+}
+
+// userOption how a single option of a user is compared and remediated
+type userOption struct {
+	field string
+	// desired the value of the params, empty when not set
+	desired  func(*UserParams) string
+	observed func(*UserState) string
+	// remediate sets the desired value on the remediation, nil when ALTER USER cannot converge the option
+	remediate func(remediation, params *UserParams)
+}
+
+// userOptions every option of the DatabaseUserSpec that is compared with sys.database_principals
+var userOptions = []userOption{
+	{
+		field:    OptionUserType,
+		desired:  func(p *UserParams) string { return p.Authentication },
+		observed: func(s *UserState) string { return s.AuthenticationType },
+	},
+	{
+		field:     OptionLogin,
+		desired:   func(p *UserParams) string { return SafeString(p.Login) },
+		observed:  func(s *UserState) string { return s.Login },
+		remediate: func(r, p *UserParams) { r.Login = p.Login },
+	},
+	{
+		field:     OptionDefaultSchema,
+		desired:   func(p *UserParams) string { return SafeString(p.DefaultSchema) },
+		observed:  func(s *UserState) string { return s.DefaultSchema },
+		remediate: func(r, p *UserParams) { r.DefaultSchema = p.DefaultSchema },
+	},
+}
+
+// DiffUser compares the authentication and the options set in params with the user, the authentication of a user
+// cannot be altered so its drift is not remediable. The password of a contained user cannot be read back and is
+// never compared
+func DiffUser(params *UserParams, state *UserState) *UserDiff {
+	if params == nil {
+		params = &UserParams{}
+	}
+	diff := &UserDiff{Fields: make([]FieldDiff, 0, len(userOptions))}
+	remediation := &UserParams{}
+	remediate := false
+
+	for _, option := range userOptions {
+		f := FieldDiff{
+			Field:      option.field,
+			Desired:    option.desired(params),
+			Observed:   option.observed(state),
+			Remediable: option.remediate != nil,
+		}
+		f.Drifted = f.Desired != "" && !strings.EqualFold(f.Desired, f.Observed)
+		if f.Drifted && f.Remediable {
+			option.remediate(remediation, params)
+			remediate = true
+		}
+		diff.Fields = append(diff.Fields, f)
+	}
+
+	if remediate {
+		diff.remediation = remediation
+	}
+	return diff
+}
+
+// UserState the database user as selected from sys.database_principals, nil when it doesn't exist
+func (db *MSSql) UserState(ctx context.Context, databaseName, userName string) (*UserState, error) {
+	conn, err := db.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	query, err := UserStateStatement(databaseName, userName)
+	if err != nil {
+		return nil, err
+	}
+	var output string
+	if err = conn.QueryRowContext(ctx, query.SQL, query.Args...).Scan(&output); err != nil {
+		if strings.Contains(err.Error(), "sql: no rows in result set") {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var sync UserSync
+	if err = json.Unmarshal([]byte(output), &sync); err != nil {
+		return nil, err
+	}
+	if len(sync.User) == 0 {
+		return nil, nil
+	}
+	return &sync.User[0], nil
+}
+
+// CreateUser creates the database user, the password is only used by contained users
+func (db *MSSql) CreateUser(ctx context.Context, databaseName, userName, password string, params *UserParams) error {
+	_ = log.FromContext(ctx)
+	logger := log.Log
+
+	logger.Info("creating the user", "database", databaseName, "name", userName)
+	conn, err := db.conn(ctx)
+	if err != nil {
+		return err
+	}
+	create, err := CreateUserStatement(databaseName, userName, password, params)
+	if err != nil {
+		return err
+	}
+	_, err = conn.ExecContext(ctx, create.SQL, create.Args...)
+	return err
+}
+
+// AlterUser applies every option set in params
+func (db *MSSql) AlterUser(ctx context.Context, databaseName, userName string, params *UserParams) error {
+	_ = log.FromContext(ctx)
+	logger := log.Log
+
+	logger.Info("altering the user", "database", databaseName, "name", userName)
+	conn, err := db.conn(ctx)
+	if err != nil {
+		return err
+	}
+	altStatements, err := AlterUserStatements(databaseName, userName, params)
+	if err != nil {
+		return err
+	}
+	for _, alter := range altStatements {
+		if _, err = conn.ExecContext(ctx, alter.SQL, alter.Args...); err != nil {
+			return fmt.Errorf("errors while running alter on user: %s: %w", userName, err)
+		}
+	}
+	return nil
+}
+
+// AlterUserPassword sets the password of the contained user
+func (db *MSSql) AlterUserPassword(ctx context.Context, databaseName, userName, password string) error {
+	_ = log.FromContext(ctx)
+	logger := log.Log
+
+	logger.Info("changing the password of the user", "database", databaseName, "name", userName)
+	conn, err := db.conn(ctx)
+	if err != nil {
+		return err
+	}
+	alter, err := AlterUserPasswordStatement(databaseName, userName, password)
+	if err != nil {
+		return err
+	}
+	_, err = conn.ExecContext(ctx, alter.SQL, alter.Args...)
+	return err
+}
+
+// DeleteUser drops the database user if it and its database exist
+func (db *MSSql) DeleteUser(ctx context.Context, databaseName, userName string) error {
+	_ = log.FromContext(ctx)
+	logger := log.Log
+
+	logger.Info("deleting the user", "database", databaseName, "name", userName)
+	conn, err := db.conn(ctx)
+	if err != nil {
+		return err
+	}
+	drop, err := DropUserStatement(databaseName, userName)
+	if err != nil {
+		return err
+	}
+	var dbID sql.NullInt64
+	exists := DatabaseExistsStatement(databaseName)
+	if err = conn.QueryRowContext(ctx, exists.SQL, exists.Args...).Scan(&dbID); err != nil {
+		return err
+	}
+	if !dbID.Valid {
+		logger.Info("database doesn't exist returning nil")
+		return nil
+	}
+	state, err := db.UserState(ctx, databaseName, userName)
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		logger.Info("user doesn't exist returning nil")
+		return nil
+	}
+	_, err = conn.ExecContext(ctx, drop.SQL, drop.Args...)
+	return err
+}
@@ -0,0 +1,68 @@
+package internal
+
+import "testing"
+
+func observedUser() *UserState {
+	return &UserState{
+		Name:               "app",
+		AuthenticationType: AuthenticationInstance,
+		DefaultSchema:      "dbo",
+		Login:              "app",
+	}
+}
+
+func TestDiffUserInSync(t *testing.T) {
+	diff := DiffUser(&UserParams{
+		Authentication: AuthenticationInstance,
+		Login:          SetString("APP"),
+		DefaultSchema:  SetString("dbo"),
+	}, observedUser())
+
+	if diff.HasDrift() {
+		t.Errorf("expected no drift, got %+v", diff.Drifted())
+	}
+	if diff.Remediation() != nil {
+		t.Errorf("expected nothing to remediate, got %+v", diff.Remediation())
+	}
+	if len(diff.Fields) != len(userOptions) {
+		t.Errorf("expected a result for every option, got %+v", diff.Fields)
+	}
+}
+
+func TestDiffUserDrift(t *testing.T) {
+	state := observedUser()
+	state.Login = ""
+	state.DefaultSchema = "sales"
+	diff := DiffUser(&UserParams{
+		Authentication: AuthenticationInstance,
+		Login:          SetString("app"),
+		DefaultSchema:  SetString("dbo"),
+	}, state)
+
+	if len(diff.Drifted()) != 2 {
+		t.Errorf("expected the login and the default schema to drift, got %+v", diff.Drifted())
+	}
+	remediation := diff.Remediation()
+	if remediation == nil || SafeString(remediation.Login) != "app" || SafeString(remediation.DefaultSchema) != "dbo" {
+		t.Errorf("unexpected remediation: %+v", remediation)
+	}
+}
+
+func TestDiffUserType(t *testing.T) {
+	state := observedUser()
+	state.AuthenticationType = AuthenticationNone
+	state.Login = ""
+	diff := DiffUser(&UserParams{Authentication: AuthenticationNone, DefaultSchema: SetString("dbo")}, state)
+	if diff.HasDrift() {
+		t.Errorf("expected no drift, got %+v", diff.Drifted())
+	}
+
+	diff = DiffUser(&UserParams{Authentication: AuthenticationDatabase}, state)
+	drifted := diff.Drifted()
+	if len(drifted) != 1 || drifted[0].Field != OptionUserType || drifted[0].Remediable {
+		t.Errorf("expected the type to drift without remediation, got %+v", drifted)
+	}
+	if diff.Remediation() != nil {
+		t.Errorf("expected nothing to remediate, got %+v", diff.Remediation())
+	}
+}
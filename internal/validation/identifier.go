@@ -0,0 +1,83 @@
+// Package validation the checks of the sql server names, database options and sync schedules of the specs. It
+// doesn't depend on the sql server driver so the admission webhooks of the API can run them as well
+package validation
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// MaxIdentifierLength the maximum length of a sql server identifier (sysname)
+const MaxIdentifierLength = 128
+
+var (
+	// collations are identifiers made of letters, digits and underscores e.g. SQL_Latin1_General_CP1_CS_AS
+	collationPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+	// parameterizations the allowed values of the PARAMETERIZATION database option
+	parameterizations = map[string]bool{
+		"simple": true,
+		"forced": true,
+	}
+
+	// compatibilityLevels the allowed values of the COMPATIBILITY_LEVEL database option
+	compatibilityLevels = map[int]bool{
+		100: true,
+		110: true,
+		120: true,
+		130: true,
+		140: true,
+		150: true,
+		160: true,
+	}
+)
+
+// ValidateIdentifier an identifier must be non-empty, no longer than a sysname and free of NUL characters
+func ValidateIdentifier(identifier string) error {
+	if identifier == "" {
+		return fmt.Errorf("identifier cannot be empty")
+	}
+	if len([]rune(identifier)) > MaxIdentifierLength {
+		return fmt.Errorf("identifier cannot be longer than %d characters", MaxIdentifierLength)
+	}
+	if strings.ContainsRune(identifier, 0) {
+		return fmt.Errorf("identifier cannot contain NUL characters")
+	}
+	return nil
+}
+
+// ValidateCollation a collation must be a plain identifier since it cannot be quoted or parameterized
+func ValidateCollation(collation string) error {
+	if len(collation) > MaxIdentifierLength || !collationPattern.MatchString(collation) {
+		return fmt.Errorf("invalid collation: %q", collation)
+	}
+	return nil
+}
+
+// ValidateParameterization the parameterization must be one of `simple` or `forced`
+func ValidateParameterization(parameterization string) error {
+	if !parameterizations[strings.ToLower(parameterization)] {
+		return fmt.Errorf("invalid parameterization: %q, must be one of simple, forced", parameterization)
+	}
+	return nil
+}
+
+// ValidateCompatibilityLevel the compatibility level must be supported by sql server
+func ValidateCompatibilityLevel(level int) error {
+	if !compatibilityLevels[level] {
+		return fmt.Errorf("invalid compatibility level: %d, must be one of %s", level, strings.Join(CompatibilityLevels(), ", "))
+	}
+	return nil
+}
+
+// CompatibilityLevels the supported compatibility levels in ascending order
+func CompatibilityLevels() []string {
+	levels := []string{}
+	for level := 100; level <= 160; level += 10 {
+		if compatibilityLevels[level] {
+			levels = append(levels, fmt.Sprintf("%d", level))
+		}
+	}
+	return levels
+}
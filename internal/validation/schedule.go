@@ -0,0 +1,31 @@
+package validation
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Schedule a parsed standard cron schedule, parsed like the CronJob controller does: the 5 fields minute, hour,
+// day of month, month and day of week, or one of the @yearly, @monthly, @weekly, @daily, @hourly and @every
+// descriptors
+type Schedule struct {
+	schedule cron.Schedule
+}
+
+// ParseSchedule parses a standard cron schedule
+func ParseSchedule(spec string) (*Schedule, error) {
+	schedule, err := cron.ParseStandard(strings.TrimSpace(spec))
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+	}
+	return &Schedule{schedule: schedule}, nil
+}
+
+// Next the first time after t the schedule fires, in the location of t, the zero time when the schedule never
+// fires within 5 years e.g. on the 31st of February
+func (s *Schedule) Next(t time.Time) time.Time {
+	return s.schedule.Next(t)
+}
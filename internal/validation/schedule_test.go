@@ -0,0 +1,60 @@
+package validation
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseScheduleRejectsInvalidSchedules(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 7",
+		"10-5 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+		"@reboot",
+	} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("ParseSchedule(%q) expected an error", spec)
+		}
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	from := time.Date(2021, 9, 1, 12, 7, 30, 0, time.UTC) // a Wednesday
+	tests := []struct {
+		spec string
+		next time.Time
+	}{
+		{"*/30 * * * *", time.Date(2021, 9, 1, 12, 30, 0, 0, time.UTC)},
+		{"0 */12 * * *", time.Date(2021, 9, 2, 0, 0, 0, 0, time.UTC)},
+		{"7 12 * * *", time.Date(2021, 9, 2, 12, 7, 0, 0, time.UTC)},
+		{"0 9 * * mon-fri", time.Date(2021, 9, 2, 9, 0, 0, 0, time.UTC)},
+		{"0 0 * * sun", time.Date(2021, 9, 5, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 13 * fri", time.Date(2021, 9, 3, 0, 0, 0, 0, time.UTC)},
+		{"*/15 9-17 * * mon-fri", time.Date(2021, 9, 1, 12, 15, 0, 0, time.UTC)},
+		{"5,35 3 ? JAN,Jul SUN", time.Date(2022, 1, 2, 3, 5, 0, 0, time.UTC)},
+		{"50/5 0 1 * *", time.Date(2021, 10, 1, 0, 50, 0, 0, time.UTC)},
+		{"  @hourly ", time.Date(2021, 9, 1, 13, 0, 0, 0, time.UTC)},
+		{"@every 1h", time.Date(2021, 9, 1, 13, 7, 30, 0, time.UTC)},
+		{"@yearly", time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		s, err := ParseSchedule(tt.spec)
+		if err != nil {
+			t.Fatalf("ParseSchedule(%q) returned error: %v", tt.spec, err)
+		}
+		if next := s.Next(from); !next.Equal(tt.next) {
+			t.Errorf("%q.Next(%v) = %v, expected %v", tt.spec, from, next, tt.next)
+		}
+	}
+}
@@ -17,22 +17,29 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
 	"os"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
 
+	arcdatav1 "github.com/pplavetzki/azure-sql-mi/api/arcdata/v1"
 	actionsv1alpha1 "github.com/pplavetzki/azure-sql-mi/api/v1alpha1"
+	actionsv1beta1 "github.com/pplavetzki/azure-sql-mi/api/v1beta1"
 	"github.com/pplavetzki/azure-sql-mi/controllers"
+	ms "github.com/pplavetzki/azure-sql-mi/internal"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -43,8 +50,11 @@ var (
 
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(arcdatav1.AddToScheme(scheme))
+	utilruntime.Must(apiextensionsv1.AddToScheme(scheme))
 
 	utilruntime.Must(actionsv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(actionsv1beta1.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 }
 
@@ -52,11 +62,31 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var eventDedupWindow time.Duration
+	var syncMode string
+	var resyncPeriod time.Duration
+	poolOptions := ms.DefaultPoolOptions
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.IntVar(&poolOptions.MaxOpenConns, "sql-max-open-conns", poolOptions.MaxOpenConns,
+		"The maximum number of open connections per sql server login, <= 0 means unlimited.")
+	flag.IntVar(&poolOptions.MaxIdleConns, "sql-max-idle-conns", poolOptions.MaxIdleConns,
+		"The maximum number of idle connections kept per sql server login.")
+	flag.DurationVar(&poolOptions.ConnMaxLifetime, "sql-conn-max-lifetime", poolOptions.ConnMaxLifetime,
+		"The maximum amount of time a sql server connection may be reused, <= 0 means forever.")
+	flag.DurationVar(&poolOptions.ConnMaxIdleTime, "sql-conn-max-idle-time", poolOptions.ConnMaxIdleTime,
+		"The maximum amount of time a sql server connection may be idle, <= 0 means forever.")
+	flag.DurationVar(&eventDedupWindow, "event-dedup-window", controllers.DefaultEventDedupWindow,
+		"The amount of time an identical not ready, missing credentials, sync failure or drift warning of an object is suppressed.")
+	flag.StringVar(&syncMode, "sync-mode", string(controllers.SyncModeCronJob),
+		"How the scheduled sync of the Databases runs: cronjob runs a CronJob per Database, "+
+			"controller runs the sync in the manager per the schedule of the Databases.")
+	flag.DurationVar(&resyncPeriod, "resync-period", controllers.DefaultResyncPeriod,
+		"How often the Logins, DatabaseUsers, DatabaseRoles, DatabasePermissions and DatabaseSchemas are compared with the server when they did not change, "+
+			"and how long the sync times of an unchanged Database are kept.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -65,6 +95,12 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	mode, err := controllers.ParseSyncMode(syncMode)
+	if err != nil {
+		setupLog.Error(err, "invalid flag", "flag", "sync-mode")
+		os.Exit(1)
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
 		MetricsBindAddress:     metricsAddr,
@@ -78,23 +114,103 @@ func main() {
 		os.Exit(1)
 	}
 
+	connections := ms.NewConnectionManager(poolOptions)
+	if err = mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		return connections.Close()
+	})); err != nil {
+		setupLog.Error(err, "unable to set up sql connections")
+		os.Exit(1)
+	}
+
 	if err = (&controllers.DatabaseReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
-		Logger: ctrl.Log.WithName("controllers").WithName("database"),
+		Client:       mgr.GetClient(),
+		Scheme:       mgr.GetScheme(),
+		Logger:       ctrl.Log.WithName("controllers").WithName("database"),
+		NewProvider:  ms.NewMSSqlFactory(connections),
+		Recorder:     controllers.NewDedupingRecorder(mgr.GetEventRecorderFor("database-controller"), eventDedupWindow),
+		SyncMode:     mode,
+		ResyncPeriod: resyncPeriod,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Database")
 		os.Exit(1)
 	}
 
-	/*******************************************************************************************************************
-	// we need to uncomment this to trigger the webhook!!!
-	*******************************************************************************************************************/
-	// if err = (&actionsv1alpha1.Database{}).SetupWebhookWithManager(mgr); err != nil {
-	// 	setupLog.Error(err, "unable to create webhook", "webhook", "Database")
-	// 	os.Exit(1)
-	// }
-	/******************************************************************************************************************/
+	if err = (&controllers.LoginReconciler{
+		Client:       mgr.GetClient(),
+		Scheme:       mgr.GetScheme(),
+		Logger:       ctrl.Log.WithName("controllers").WithName("login"),
+		NewProvider:  ms.NewMSSqlFactory(connections),
+		Recorder:     controllers.NewDedupingRecorder(mgr.GetEventRecorderFor("login-controller"), eventDedupWindow),
+		ResyncPeriod: resyncPeriod,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Login")
+		os.Exit(1)
+	}
+
+	if err = (&controllers.DatabaseUserReconciler{
+		Client:       mgr.GetClient(),
+		Scheme:       mgr.GetScheme(),
+		Logger:       ctrl.Log.WithName("controllers").WithName("databaseuser"),
+		NewProvider:  ms.NewMSSqlFactory(connections),
+		Recorder:     controllers.NewDedupingRecorder(mgr.GetEventRecorderFor("databaseuser-controller"), eventDedupWindow),
+		ResyncPeriod: resyncPeriod,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "DatabaseUser")
+		os.Exit(1)
+	}
+	if err = (&controllers.DatabaseRoleReconciler{
+		Client:       mgr.GetClient(),
+		Scheme:       mgr.GetScheme(),
+		Logger:       ctrl.Log.WithName("controllers").WithName("databaserole"),
+		NewProvider:  ms.NewMSSqlFactory(connections),
+		Recorder:     controllers.NewDedupingRecorder(mgr.GetEventRecorderFor("databaserole-controller"), eventDedupWindow),
+		ResyncPeriod: resyncPeriod,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "DatabaseRole")
+		os.Exit(1)
+	}
+	if err = (&controllers.DatabasePermissionReconciler{
+		Client:       mgr.GetClient(),
+		Scheme:       mgr.GetScheme(),
+		Logger:       ctrl.Log.WithName("controllers").WithName("databasepermission"),
+		NewProvider:  ms.NewMSSqlFactory(connections),
+		Recorder:     controllers.NewDedupingRecorder(mgr.GetEventRecorderFor("databasepermission-controller"), eventDedupWindow),
+		ResyncPeriod: resyncPeriod,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "DatabasePermission")
+		os.Exit(1)
+	}
+	if err = (&controllers.DatabaseSchemaReconciler{
+		Client:       mgr.GetClient(),
+		Scheme:       mgr.GetScheme(),
+		Logger:       ctrl.Log.WithName("controllers").WithName("databaseschema"),
+		NewProvider:  ms.NewMSSqlFactory(connections),
+		Recorder:     controllers.NewDedupingRecorder(mgr.GetEventRecorderFor("databaseschema-controller"), eventDedupWindow),
+		ResyncPeriod: resyncPeriod,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "DatabaseSchema")
+		os.Exit(1)
+	}
+
+	if err = mgr.Add(&controllers.StorageVersionMigrator{
+		Client:  mgr.GetClient(),
+		Reader:  mgr.GetAPIReader(),
+		Logger:  ctrl.Log.WithName("storage-version-migration").WithName("database"),
+		Backoff: controllers.DefaultMigrationBackoff,
+	}); err != nil {
+		setupLog.Error(err, "unable to set up the storage version migration", "crd", controllers.DatabaseCRDName)
+		os.Exit(1)
+	}
+
+	// the webhooks need the serving certificates, set ENABLE_WEBHOOKS=false to run the manager locally without them,
+	// the conversion webhook of v1alpha1 is served along with the v1beta1 admission webhooks
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err = (&actionsv1beta1.Database{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Database")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {